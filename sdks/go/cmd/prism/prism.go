@@ -34,15 +34,35 @@ var (
 	webPort            = flag.Int("web_port", 8074, "specify the web ui port")
 	jobManagerEndpoint = flag.String("jm_override", "", "set to only stand up a web ui that refers to a seperate JobManagement endpoint")
 	serveHTTP          = flag.Bool("serve_http", true, "enable or disable the web ui")
+	jobStoreDir        = flag.String("job_store_dir", "", "set to persist completed jobs in this directory, retaining them across restarts")
+	jobStoreMaxJobs    = flag.Int("job_store_max_jobs", 0, "the maximum number of persisted jobs, or unlimited if 0")
+	jobStoreMaxAge     = flag.Duration("job_store_max_age", 0, "how long persisted jobs are kept after completing, or forever if 0")
+	pubsubPort         = flag.Int("pubsub_port", 0, "set to start the Pub/Sub emulator on this port at startup, rather than on any available port once a pipeline uses Pub/Sub")
 )
 
 func main() {
 	flag.Parse()
 	ctx := context.Background()
-	cli, err := makeJobClient(ctx, prism.Options{Port: *jobPort}, *jobManagerEndpoint)
+	cli, err := makeJobClient(ctx,
+		prism.Options{
+			Port:            *jobPort,
+			JobStoreDir:     *jobStoreDir,
+			MaxStoredJobs:   *jobStoreMaxJobs,
+			MaxStoredJobAge: *jobStoreMaxAge,
+		},
+		*jobManagerEndpoint)
 	if err != nil {
 		log.Fatalf("error creating job server: %v", err)
 	}
+	if *jobManagerEndpoint == "" && *pubsubPort != 0 {
+		// Pipelines still run without the emulator on the port, since it's
+		// started on any available port once a pipeline uses Pub/Sub.
+		if addr, err := prism.StartPubSubEmulator(*pubsubPort); err != nil {
+			log.Printf("error starting Pub/Sub emulator: %v", err)
+		} else {
+			log.Printf("Pub/Sub emulator serving at %v", addr)
+		}
+	}
 	if *serveHTTP {
 		if err := prism.CreateWebServer(ctx, cli, prism.Options{Port: *webPort}); err != nil {
 			log.Fatalf("error creating web server: %v", err)
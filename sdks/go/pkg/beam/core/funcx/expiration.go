@@ -0,0 +1,50 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcx
+
+import (
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
+)
+
+// onWindowExpirationParams are the parameter kinds an OnWindowExpiration method may take.
+const onWindowExpirationParams = FnContext | FnWindow | FnEventTime | FnStateProvider |
+	FnValue | FnIter | FnReIter | FnMultiMap | FnEmit
+
+// ValidateOnWindowExpiration returns an error if the function can't be used as the
+// OnWindowExpiration method of a stateful DoFn, which has the form:
+//
+//	func(context.Context?, typex.Window?, typex.EventTime?, state.Provider?, K, SideInput*, FnEmit*) error?
+//
+// The method is invoked once for each key and window, when the window expires, so it
+// takes the key as its main input, rather than an element. It may read and write the
+// state of the key and window, but can't set timers, since the window has expired.
+// Elements are output with the emitters at the end of the window.
+func ValidateOnWindowExpiration(u *Fn) error {
+	for i, p := range u.Param {
+		if p.Kind&onWindowExpirationParams == 0 {
+			return errors.Errorf("OnWindowExpiration method %v has invalid parameter %d of kind %v, "+
+				"only allowed a context.Context, Window, EventTime, state.Provider, key, side inputs, and emitters", u.Fn.Name(), i, p.Kind)
+		}
+	}
+	pos, _, ok := u.Inputs()
+	if !ok || u.Param[pos].Kind != FnValue {
+		return errors.Errorf("OnWindowExpiration method %v has no key parameter", u.Fn.Name())
+	}
+	if len(u.Ret) > 1 || (len(u.Ret) == 1 && u.Ret[0].Kind != RetError) {
+		return errors.Errorf("OnWindowExpiration method %v has invalid return values, only allowed an optional error", u.Fn.Name())
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package funcx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
+)
+
+func TestValidateOnWindowExpiration(t *testing.T) {
+	tests := []struct {
+		Name string
+		Fn   any
+		OK   bool
+	}{
+		{
+			Name: "key",
+			Fn:   func(string) {},
+			OK:   true,
+		},
+		{
+			Name: "all params",
+			Fn: func(context.Context, typex.Window, typex.EventTime, state.Provider, string, func() func(*int) bool, func(int)) error {
+				return nil
+			},
+			OK: true,
+		},
+		{
+			Name: "no key",
+			Fn:   func(context.Context, state.Provider, func(int)) {},
+		},
+		{
+			Name: "iterable key",
+			Fn:   func(state.Provider, func(*int) bool) {},
+		},
+		{
+			Name: "timer provider",
+			Fn:   func(state.Provider, timers.Provider, string) {},
+		},
+		{
+			Name: "pane",
+			Fn:   func(typex.PaneInfo, string) {},
+		},
+		{
+			Name: "value return",
+			Fn:   func(string) int { return 0 },
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			u, err := New(reflectx.MakeFunc(test.Fn))
+			if err != nil {
+				t.Fatalf("New(%v) failed: %v", test.Fn, err)
+			}
+			err = ValidateOnWindowExpiration(u)
+			if test.OK && err != nil {
+				t.Errorf("ValidateOnWindowExpiration(%v) = %v, want nil", u, err)
+			}
+			if !test.OK && err == nil {
+				t.Errorf("ValidateOnWindowExpiration(%v) succeeded, want error", u)
+			}
+		})
+	}
+}
@@ -15,6 +15,15 @@
 
 package coder
 
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
+)
+
 // WindowKind represents a kind of window coder.
 type WindowKind string
 
@@ -23,21 +32,26 @@ type WindowKind string
 const (
 	GlobalWindow   WindowKind = "GWC"
 	IntervalWindow WindowKind = "IWC"
+	CustomWindow   WindowKind = "CWC"
 )
 
 // WindowCoder represents a Window coder.
 type WindowCoder struct {
 	Kind    WindowKind
-	Payload string // Payload is only populated for parameterized window coders.
+	Payload string       // Payload is only populated for parameterized window coders.
+	Type    reflect.Type // Type is only populated for custom window coders.
 }
 
 // Equals returns whether passed in WindowCoder has the same
-// Kind and Payload as this WindowCoder.
+// Kind, Payload and Type as this WindowCoder.
 func (w *WindowCoder) Equals(o *WindowCoder) bool {
-	return w.Kind == o.Kind && w.Payload == o.Payload
+	return w.Kind == o.Kind && w.Payload == o.Payload && w.Type == o.Type
 }
 
 func (w *WindowCoder) String() string {
+	if w.Type != nil {
+		return fmt.Sprintf("%v<%v>", w.Kind, w.Type)
+	}
 	return string(w.Kind)
 }
 
@@ -50,3 +64,26 @@ func NewGlobalWindow() *WindowCoder {
 func NewIntervalWindow() *WindowCoder {
 	return &WindowCoder{Kind: IntervalWindow}
 }
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// NewCustomWindow returns a window coder for user-defined windows of the given
+// type. The windows are encoded as their maximum timestamp, so runners can
+// handle them without knowing their type, followed by the bytes of their
+// MarshalBinary method. Returns an error if the type isn't a window that
+// implements encoding.BinaryMarshaler with a pointer that implements
+// encoding.BinaryUnmarshaler.
+func NewCustomWindow(t reflect.Type) (*WindowCoder, error) {
+	switch {
+	case t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr:
+		return nil, errors.Errorf("custom window type %v must not be an interface or pointer", t)
+	case !t.Implements(typex.WindowType):
+		return nil, errors.Errorf("custom window type %v must implement typex.Window", t)
+	case !t.Implements(binaryMarshalerType) || !reflect.PtrTo(t).Implements(binaryUnmarshalerType):
+		return nil, errors.Errorf("custom window type %v must implement encoding.BinaryMarshaler, and *%v encoding.BinaryUnmarshaler", t, t)
+	}
+	return &WindowCoder{Kind: CustomWindow, Type: t}, nil
+}
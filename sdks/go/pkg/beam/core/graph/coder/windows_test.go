@@ -0,0 +1,83 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+type labelWindow struct {
+	Label string
+}
+
+func (labelWindow) MaxTimestamp() typex.EventTime {
+	return 0
+}
+
+func (w labelWindow) Equals(o typex.Window) bool {
+	return w == o
+}
+
+func (w labelWindow) MarshalBinary() ([]byte, error) {
+	return []byte(w.Label), nil
+}
+
+func (w *labelWindow) UnmarshalBinary(b []byte) error {
+	w.Label = string(b)
+	return nil
+}
+
+// plainWindow can't be encoded.
+type plainWindow struct{}
+
+func (plainWindow) MaxTimestamp() typex.EventTime {
+	return 0
+}
+
+func (plainWindow) Equals(o typex.Window) bool {
+	return o == plainWindow{}
+}
+
+func TestNewCustomWindow(t *testing.T) {
+	lwt := reflect.TypeOf(labelWindow{})
+	c, err := NewCustomWindow(lwt)
+	if err != nil {
+		t.Fatalf("NewCustomWindow(%v) failed: %v", lwt, err)
+	}
+	if got, want := c.String(), "CWC<coder.labelWindow>"; got != want {
+		t.Errorf("NewCustomWindow(%v).String() = %v, want %v", lwt, got, want)
+	}
+	if other, _ := NewCustomWindow(lwt); !c.Equals(other) {
+		t.Errorf("%v.Equals(%v) = false, want true", c, other)
+	}
+	if c.Equals(NewIntervalWindow()) {
+		t.Errorf("%v.Equals(%v) = true, want false", c, NewIntervalWindow())
+	}
+
+	for _, bad := range []reflect.Type{
+		reflect.PtrTo(lwt),
+		reflect.TypeOf(plainWindow{}),
+		reflect.TypeOf(""),
+		typex.WindowType,
+	} {
+		if _, err := NewCustomWindow(bad); err == nil {
+			t.Errorf("NewCustomWindow(%v) succeeded, want error", bad)
+		}
+	}
+}
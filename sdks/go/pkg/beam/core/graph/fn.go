@@ -168,7 +168,8 @@ const (
 	initialWatermarkEstimatorStateName = "InitialWatermarkEstimatorState"
 	watermarkEstimatorStateName        = "WatermarkEstimatorState"
 
-	onTimerName = "OnTimer"
+	onTimerName            = "OnTimer"
+	onWindowExpirationName = "OnWindowExpiration"
 
 	createAccumulatorName = "CreateAccumulator"
 	addInputName          = "AddInput"
@@ -186,6 +187,7 @@ var doFnNames = []string{
 	finishBundleName,
 	teardownName,
 	onTimerName,
+	onWindowExpirationName,
 	createInitialRestrictionName,
 	splitRestrictionName,
 	restrictionSizeName,
@@ -315,6 +317,13 @@ func (f *DoFn) OnTimerFn() (*funcx.Fn, bool) {
 	return m, ok
 }
 
+// OnWindowExpirationFn returns the "OnWindowExpiration" function and a bool
+// indicating whether the function is defined or not for the DoFn.
+func (f *DoFn) OnWindowExpirationFn() (*funcx.Fn, bool) {
+	m, ok := f.methods[onWindowExpirationName]
+	return m, ok
+}
+
 // PipelineTimers returns the list of PipelineTimer objects defined for the DoFn.
 func (f *DoFn) PipelineTimers() ([]timers.PipelineTimer, []string) {
 	var t []timers.PipelineTimer
@@ -645,6 +654,11 @@ func AsDoFn(fn *Fn, numMainIn mainInputs) (*DoFn, error) {
 		return nil, addContext(err, fn)
 	}
 
+	err = validateOnWindowExpiration(doFn, numMainIn)
+	if err != nil {
+		return nil, addContext(err, fn)
+	}
+
 	return doFn, nil
 }
 
@@ -1368,10 +1382,10 @@ func validateState(fn *DoFn, numIn mainInputs) error {
 					"unique per DoFn", k, orig, s)
 			}
 			t := s.StateType()
-			if t != state.TypeValue && t != state.TypeBag && t != state.TypeCombining && t != state.TypeSet && t != state.TypeMap {
+			if t != state.TypeValue && t != state.TypeBag && t != state.TypeCombining && t != state.TypeSet && t != state.TypeMap && t != state.TypeOrderedList {
 				err := errors.Errorf("Unrecognized state type %v for state %v", t, s)
 				return errors.SetTopLevelMsgf(err, "Unrecognized state type %v for state %v. Currently the only supported state"+
-					"types are state.Value, state.Combining, state.Bag, state.Set, and state.Map", t, s)
+					"types are state.Value, state.Combining, state.Bag, state.Set, state.Map, and state.OrderedList", t, s)
 			}
 			stateKeys[k] = s
 		}
@@ -1459,6 +1473,69 @@ func validateTimer(fn *DoFn, numIn mainInputs) error {
 	return nil
 }
 
+func validateOnWindowExpiration(fn *DoFn, numIn mainInputs) error {
+	method, ok := fn.methods[onWindowExpirationName]
+	if !ok {
+		return nil
+	}
+	if err := funcx.ValidateOnWindowExpiration(method); err != nil {
+		return errors.SetTopLevelMsgf(err, "Invalid OnWindowExpiration method for DoFn %v. "+
+			"Ensure that it takes the key of the element, with optional context.Context, Window, EventTime, "+
+			"StateProvider, side input and emitter parameters, and returns an optional error.", fn.Name())
+	}
+
+	processFn := fn.methods[processElementName]
+	_, hasSp := processFn.StateProvider()
+	_, hasTp := processFn.TimerProvider()
+	if numIn == MainSingle || !(hasSp || hasTp) {
+		err := errors.Errorf("OnWindowExpiration function is defined for DoFn %v, but it isn't stateful", fn.Name())
+		return errors.SetTopLevelMsgf(err, "OnWindowExpiration function is defined for DoFn %v, but it isn't stateful. "+
+			"OnWindowExpiration may only be used by DoFns that take a key/value pair as an input, and use a "+
+			"StateProvider or TimerProvider in ProcessElement.", fn.Name())
+	}
+	if _, ok := method.StateProvider(); ok && !hasSp {
+		err := errors.Errorf("OnWindowExpiration uses a StateProvider, but ProcessElement doesn't")
+		return errors.SetTopLevelMsgf(err, "OnWindowExpiration uses a StateProvider, but ProcessElement doesn't in DoFn %v. "+
+			"Ensure that the State structs read in OnWindowExpiration are attached to the DoFn and used by ProcessElement.", fn.Name())
+	}
+
+	// The key must match the key of ProcessElement, and any side inputs must match its side inputs.
+	pos, num, _ := processFn.Inputs()
+	processFnInputs := processFn.Param[pos : pos+num]
+	methodPos, methodNum, _ := method.Inputs()
+	methodInputs := method.Param[methodPos : methodPos+methodNum]
+	if processFnInputs[0].T != methodInputs[0].T {
+		var err error = &funcx.TypeMismatchError{Got: methodInputs[0].T, Want: processFnInputs[0].T}
+		err = errors.Wrapf(err, "key parameter in method %v does not match key in %v", onWindowExpirationName, processElementName)
+		return errors.SetTopLevelMsgf(err, "Incorrect key parameter in the %v method of DoFn %v. "+
+			"The key should have the same type as the key of the %v method.", onWindowExpirationName, fn.Name(), processElementName)
+	}
+	if numIn == MainKv {
+		sideInputs := processFnInputs[int(numIn):]
+		if len(sideInputs) != len(methodInputs)-1 {
+			err := errors.Errorf("number of side inputs in method %v does not match method %v: got %d, expected %d",
+				onWindowExpirationName, processElementName, len(methodInputs)-1, len(sideInputs))
+			return errors.SetTopLevelMsgf(err, "Incorrect number of side input parameters in the %v method of DoFn %v. "+
+				"The side input parameters should match those of the %v method.", onWindowExpirationName, fn.Name(), processElementName)
+		}
+		for i, si := range sideInputs {
+			if got := methodInputs[i+1]; got.T != si.T {
+				var err error = &funcx.TypeMismatchError{Got: got.T, Want: si.T}
+				err = errors.Wrapf(err, "side input parameter in method %v does not match side input parameter in %v",
+					onWindowExpirationName, processElementName)
+				return errors.SetTopLevelMsgf(err, "Incorrect side input parameters in the %v method of DoFn %v. "+
+					"The side input parameters should match those of the %v method.", onWindowExpirationName, fn.Name(), processElementName)
+			}
+		}
+	}
+
+	processFnEmits := processFn.Param[0:0]
+	if pos, num, ok := processFn.Emits(); ok {
+		processFnEmits = processFn.Param[pos : pos+num]
+	}
+	return validateEmits(processFnEmits, method, onWindowExpirationName)
+}
+
 // CombineFn represents a CombineFn.
 type CombineFn Fn
 
@@ -61,6 +61,7 @@ func TestNewDoFn(t *testing.T) {
 			})}, opt: NumMainInputs(MainKv)},
 			{dfn: &GoodStatefulDoFn4{State1: state.MakeMapState[string, int]("state1")}, opt: NumMainInputs(MainKv)},
 			{dfn: &GoodStatefulDoFn5{State1: state.MakeSetState[string]("state1")}, opt: NumMainInputs(MainKv)},
+			{dfn: &GoodStatefulDoFnOnWindowExpiration{State1: state.MakeBagState[int]("state1")}, opt: NumMainInputs(MainKv)},
 		}
 
 		for _, test := range tests {
@@ -111,6 +112,12 @@ func TestNewDoFn(t *testing.T) {
 			{dfn: &BadStatefulDoFnNoTimerProvider{Timer1: timers.InEventTime("timer1")}, numInputs: 2},
 			{dfn: &BadStatefulDoFnNoTimerFields{}, numInputs: 2},
 			{dfn: &BadStatefulDoFnNoOnTimer{Timer1: timers.InEventTime("timer1")}, numInputs: 2},
+			// Validate OnWindowExpiration
+			{dfn: &BadDoFnOnWindowExpirationNotStateful{}},
+			{dfn: &BadStatefulDoFnOnWindowExpirationTimerProvider{State1: state.MakeBagState[int]("state1")}, numInputs: 2},
+			{dfn: &BadStatefulDoFnOnWindowExpirationKeyType{State1: state.MakeBagState[int]("state1")}, numInputs: 2},
+			{dfn: &BadStatefulDoFnOnWindowExpirationSideInputs{State1: state.MakeBagState[int]("state1")}, numInputs: 2},
+			{dfn: &BadStatefulDoFnOnWindowExpirationEmits{State1: state.MakeBagState[int]("state1")}, numInputs: 2},
 		}
 		for _, test := range tests {
 			t.Run(reflect.TypeOf(test.dfn).String(), func(t *testing.T) {
@@ -1646,6 +1653,66 @@ func (fn *BadStatefulDoFnNoOnTimer) ProcessElement(timers.Provider, int, int) in
 	return 0
 }
 
+type GoodStatefulDoFnOnWindowExpiration struct {
+	State1 state.Bag[int]
+}
+
+func (fn *GoodStatefulDoFnOnWindowExpiration) ProcessElement(state.Provider, string, int, func() func(*int) bool, func(int)) {
+}
+
+func (fn *GoodStatefulDoFnOnWindowExpiration) OnWindowExpiration(context.Context, typex.Window, state.Provider, string, func() func(*int) bool, func(int)) error {
+	return nil
+}
+
+type BadDoFnOnWindowExpirationNotStateful struct{}
+
+func (fn *BadDoFnOnWindowExpirationNotStateful) ProcessElement(string, int) int {
+	return 0
+}
+
+func (fn *BadDoFnOnWindowExpirationNotStateful) OnWindowExpiration(string) {
+}
+
+type BadStatefulDoFnOnWindowExpirationTimerProvider struct {
+	State1 state.Bag[int]
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationTimerProvider) ProcessElement(state.Provider, string, int) {
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationTimerProvider) OnWindowExpiration(state.Provider, timers.Provider, string) {
+}
+
+type BadStatefulDoFnOnWindowExpirationKeyType struct {
+	State1 state.Bag[int]
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationKeyType) ProcessElement(state.Provider, string, int) {
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationKeyType) OnWindowExpiration(state.Provider, int) {
+}
+
+type BadStatefulDoFnOnWindowExpirationSideInputs struct {
+	State1 state.Bag[int]
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationSideInputs) ProcessElement(state.Provider, string, int, func(*int) bool) {
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationSideInputs) OnWindowExpiration(state.Provider, string) {
+}
+
+type BadStatefulDoFnOnWindowExpirationEmits struct {
+	State1 state.Bag[int]
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationEmits) ProcessElement(state.Provider, string, int, func(int)) {
+}
+
+func (fn *BadStatefulDoFnOnWindowExpirationEmits) OnWindowExpiration(state.Provider, string) {
+}
+
 // Examples of correct CombineFn signatures
 
 type MyAccum struct{}
@@ -17,9 +17,11 @@ package window
 
 import (
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 )
 
 // Kind is the semantic type of a window fn.
@@ -30,6 +32,7 @@ const (
 	FixedWindows   Kind = "FIX"
 	SlidingWindows Kind = "SLI"
 	Sessions       Kind = "SES"
+	Custom         Kind = "CUS"
 )
 
 // NewGlobalWindows returns the default WindowFn, which places all elements
@@ -53,6 +56,31 @@ func NewSessions(gap time.Duration) *Fn {
 	return &Fn{Kind: Sessions, Gap: gap}
 }
 
+// WindowFn is a user-defined window fn, for windowing that can't be expressed
+// with the built-in window fns, such as calendar or data dependent windows.
+//
+// A WindowFn must be a struct type registered with beam.RegisterType, since it's
+// serialized by its exported fields, like a structural DoFn. The windows it
+// assigns must be comparable values of the same type.
+type WindowFn interface {
+	// AssignWindows returns the windows of an element with the given timestamp.
+	// The element is the key of KV elements. It's nil when windows are assigned
+	// only by timestamp, such as when mapping main input windows to side input
+	// windows.
+	AssignWindows(ts typex.EventTime, elem any) []typex.Window
+}
+
+// NewCustomWindows returns a WindowFn that assigns windows of type W with
+// the given user-defined WindowFn. Custom windows are never merged, since
+// merging them would need runners to call back into the SDK to merge windows
+// they can't interpret, which isn't supported.
+//
+// Windows other than IntervalWindows are encoded by their MarshalBinary and
+// UnmarshalBinary methods, and W must be registered with beam.RegisterType.
+func NewCustomWindows[W typex.Window](fn WindowFn) *Fn {
+	return &Fn{Kind: Custom, CustomFn: fn, WindowType: reflect.TypeOf((*W)(nil)).Elem()}
+}
+
 // Fn defines the window fn.
 type Fn struct {
 	Kind Kind
@@ -60,15 +88,31 @@ type Fn struct {
 	Size   time.Duration // FixedWindows, SlidingWindows
 	Period time.Duration // SlidingWindows
 	Gap    time.Duration // Sessions
+
+	CustomFn   WindowFn     // Custom
+	WindowType reflect.Type // Custom
 }
 
-// TODO(herohde) 4/17/2018: do we need to expose the window type as well?
+var intervalWindowType = reflect.TypeOf(IntervalWindow{})
+
+// HasCustomWindows returns true iff the WindowFn assigns user-defined windows,
+// which are encoded with a custom window coder.
+func (w *Fn) HasCustomWindows() bool {
+	return w.Kind == Custom && w.WindowType != intervalWindowType
+}
 
-// Coder returns the WindowCoder for the WindowFn.
+// Coder returns the WindowCoder for the WindowFn. It panics if the WindowFn
+// has custom windows that can't be encoded.
 func (w *Fn) Coder() *coder.WindowCoder {
-	switch w.Kind {
-	case GlobalWindows:
+	switch {
+	case w.Kind == GlobalWindows:
 		return coder.NewGlobalWindow()
+	case w.HasCustomWindows():
+		c, err := coder.NewCustomWindow(w.WindowType)
+		if err != nil {
+			panic(fmt.Sprintf("invalid window type for %v: %v", w, err))
+		}
+		return c
 	default:
 		return coder.NewIntervalWindow()
 	}
@@ -82,6 +126,8 @@ func (w *Fn) String() string {
 		return fmt.Sprintf("%v[%v@%v]", w.Kind, w.Size, w.Period)
 	case Sessions:
 		return fmt.Sprintf("%v[%v]", w.Kind, w.Gap)
+	case Custom:
+		return fmt.Sprintf("%v[%T]", w.Kind, w.CustomFn)
 	default:
 		return string(w.Kind)
 	}
@@ -105,6 +151,8 @@ func (w *Fn) Equals(o *Fn) bool {
 		return w.Period == o.Period && w.Size == o.Size
 	case Sessions:
 		return w.Gap == o.Gap
+	case Custom:
+		return w.WindowType == o.WindowType && reflect.DeepEqual(w.CustomFn, o.CustomFn)
 	default:
 		panic(fmt.Sprintf("unknown window type: %v", w))
 	}
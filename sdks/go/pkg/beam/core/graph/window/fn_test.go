@@ -16,10 +16,52 @@
 package window
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 )
 
+// everyNWindows assigns elements to interval windows of N milliseconds.
+type everyNWindows struct {
+	N int64
+}
+
+func (fn everyNWindows) AssignWindows(ts typex.EventTime, _ any) []typex.Window {
+	start := ts - ts%typex.EventTime(fn.N)
+	return []typex.Window{IntervalWindow{Start: start, End: start + typex.EventTime(fn.N)}}
+}
+
+type labelWindow struct {
+	Label string
+}
+
+func (labelWindow) MaxTimestamp() typex.EventTime {
+	return typex.EventTime(0)
+}
+
+func (w labelWindow) Equals(o typex.Window) bool {
+	return w == o
+}
+
+func (w labelWindow) MarshalBinary() ([]byte, error) {
+	return []byte(w.Label), nil
+}
+
+func (w *labelWindow) UnmarshalBinary(b []byte) error {
+	w.Label = string(b)
+	return nil
+}
+
+// labelWindows assigns elements to windows of their labels.
+type labelWindows struct{}
+
+func (labelWindows) AssignWindows(_ typex.EventTime, elem any) []typex.Window {
+	return []typex.Window{labelWindow{Label: elem.(string)}}
+}
+
 func TestEquals(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -75,6 +117,24 @@ func TestEquals(t *testing.T) {
 			NewSessions(10 * time.Minute),
 			false,
 		},
+		{
+			"custom equal",
+			NewCustomWindows[IntervalWindow](everyNWindows{N: 10}),
+			NewCustomWindows[IntervalWindow](everyNWindows{N: 10}),
+			true,
+		},
+		{
+			"custom inequal fn",
+			NewCustomWindows[IntervalWindow](everyNWindows{N: 10}),
+			NewCustomWindows[IntervalWindow](everyNWindows{N: 20}),
+			false,
+		},
+		{
+			"custom inequal window type",
+			NewCustomWindows[IntervalWindow](labelWindows{}),
+			NewCustomWindows[labelWindow](labelWindows{}),
+			false,
+		},
 		{
 			"mismatched type",
 			NewFixedWindows(100 * time.Millisecond),
@@ -90,3 +150,19 @@ func TestEquals(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomWindows(t *testing.T) {
+	interval := NewCustomWindows[IntervalWindow](everyNWindows{N: 10})
+	if got, want := interval.Coder(), coder.NewIntervalWindow(); !got.Equals(want) {
+		t.Errorf("%v.Coder() = %v, want %v", interval, got, want)
+	}
+
+	custom := NewCustomWindows[labelWindow](labelWindows{})
+	want, err := coder.NewCustomWindow(reflect.TypeOf(labelWindow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := custom.Coder(); !got.Equals(want) {
+		t.Errorf("%v.Coder() = %v, want %v", custom, got, want)
+	}
+}
@@ -17,6 +17,7 @@ package exec
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
 	"io"
 	"reflect"
@@ -1022,6 +1023,9 @@ func MakeWindowEncoder(c *coder.WindowCoder) WindowEncoder {
 	case coder.IntervalWindow:
 		return &intervalWindowEncoder{}
 
+	case coder.CustomWindow:
+		return &customWindowEncoder{}
+
 	default:
 		panic(fmt.Sprintf("Unexpected window coder: %v", c))
 	}
@@ -1037,6 +1041,9 @@ func MakeWindowDecoder(c *coder.WindowCoder) WindowDecoder {
 	case coder.IntervalWindow:
 		w = &intervalWindowDecoder{}
 
+	case coder.CustomWindow:
+		w = &customWindowDecoder{t: c.Type}
+
 	default:
 		panic(fmt.Sprintf("Unexpected window coder: %v", c))
 	}
@@ -1188,6 +1195,73 @@ func (*intervalWindowDecoder) DecodeSingle(r io.Reader) (typex.Window, error) {
 	return window.IntervalWindow{Start: mtime.FromMilliseconds(end.Milliseconds() - int64(duration)), End: end}, nil
 }
 
+// customWindowEncoder encodes user-defined windows as their maximum timestamp,
+// followed by the bytes of their MarshalBinary method.
+type customWindowEncoder struct{}
+
+func (enc *customWindowEncoder) Encode(ws []typex.Window, w io.Writer) error {
+	if err := coder.EncodeInt32(int32(len(ws)), w); err != nil { // #windows
+		return err
+	}
+	for _, elm := range ws {
+		if err := enc.EncodeSingle(elm, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*customWindowEncoder) EncodeSingle(elm typex.Window, w io.Writer) error {
+	m, ok := elm.(encoding.BinaryMarshaler)
+	if !ok {
+		return errors.Errorf("custom window %v of type %T isn't a BinaryMarshaler", elm, elm)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return errors.Wrapf(err, "encoding custom window %v", elm)
+	}
+	if err := coder.EncodeEventTime(elm.MaxTimestamp(), w); err != nil {
+		return err
+	}
+	return coder.EncodeBytes(data, w)
+}
+
+type customWindowDecoder struct {
+	t reflect.Type
+}
+
+func (d *customWindowDecoder) Decode(r io.Reader) ([]typex.Window, error) {
+	n, err := coder.DecodeInt32(r) // #windows
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]typex.Window, n)
+	for i := int32(0); i < n; i++ {
+		w, err := d.DecodeSingle(r)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = w
+	}
+	return ret, nil
+}
+
+func (d *customWindowDecoder) DecodeSingle(r io.Reader) (typex.Window, error) {
+	// The maximum timestamp is only for runners, since it's derived from the window.
+	if _, err := coder.DecodeEventTime(r); err != nil {
+		return nil, err
+	}
+	data, err := coder.DecodeBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	w := reflect.New(d.t)
+	if err := w.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+		return nil, errors.Wrapf(err, "decoding custom window of type %v", d.t)
+	}
+	return w.Elem().Interface().(typex.Window), nil
+}
+
 type intervalWindowValueEncoder struct {
 	intervalWindowEncoder
 }
@@ -92,6 +92,9 @@ func TestCoders(t *testing.T) {
 		}, {
 			coder: coder.NewIntervalWindowCoder(),
 			val:   &FullValue{Elm: window.IntervalWindow{Start: 0, End: 100}},
+		}, {
+			coder: coder.NewW(coder.NewVarInt(), labelWindowCoder()),
+			val:   &FullValue{Elm: int64(13), Windows: []typex.Window{labelWindow{Label: "a"}, labelWindow{Label: "b"}}},
 		},
 	} {
 		t.Run(fmt.Sprintf("%v", test.coder), func(t *testing.T) {
@@ -112,6 +115,38 @@ func TestCoders(t *testing.T) {
 	}
 }
 
+func labelWindowCoder() *coder.WindowCoder {
+	c, err := coder.NewCustomWindow(reflect.TypeOf(labelWindow{}))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestCustomWindowCoder(t *testing.T) {
+	w := labelWindow{Label: "a"}
+	data, err := EncodeWindow(MakeWindowEncoder(labelWindowCoder()), w)
+	if err != nil {
+		t.Fatalf("EncodeWindow(%v) failed: %v", w, err)
+	}
+	// Runners rely on the encoded windows starting with their maximum timestamp.
+	r := bytes.NewReader(data)
+	if got, err := coder.DecodeEventTime(r); err != nil || got != w.MaxTimestamp() {
+		t.Errorf("encoded max timestamp = %v, %v, want %v", got, err, w.MaxTimestamp())
+	}
+	if got, err := coder.DecodeBytes(r); err != nil || string(got) != w.Label {
+		t.Errorf("encoded window bytes = %q, %v, want %q", got, err, w.Label)
+	}
+
+	got, err := MakeWindowDecoder(labelWindowCoder()).DecodeSingle(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeSingle() failed: %v", err)
+	}
+	if !w.Equals(got) {
+		t.Errorf("DecodeSingle() = %v, want %v", got, w)
+	}
+}
+
 // compareFV compares two *FullValue and fails the test with an error if an
 // element is mismatched. Also performs some setup to be able to compare
 // properly, and is recursive if there are nested KVs.
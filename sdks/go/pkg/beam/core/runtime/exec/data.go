@@ -93,6 +93,13 @@ type StateReader interface {
 	GetSideInputCache() SideCache
 }
 
+// SortedMultimapKeysReader is implemented by StateReaders that may read the keys of
+// multimap user state in ascending order of their encoded bytes.
+type SortedMultimapKeysReader interface {
+	// SortedMultimapKeys returns whether the keys of multimap user state are read in order.
+	SortedMultimapKeys() bool
+}
+
 // Elements holds data or timers sent across the data channel.
 // If TimerFamilyID is populated, it's a timer, otherwise it's
 // data elements.
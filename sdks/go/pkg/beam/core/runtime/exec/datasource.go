@@ -71,11 +71,23 @@ func (n *DataSource) InitSplittable() {
 	if n.Out == nil {
 		return
 	}
-	if u, ok := n.Out.(*ProcessSizedElementsAndRestrictions); ok {
+	if u, ok := n.sizedProcessor(); ok {
 		n.su = u.SU
 	}
 }
 
+// sizedProcessor returns the ProcessSizedElementsAndRestrictions unit that
+// follows this datasource, if any. When a pipeline is draining, a
+// TruncateSizedRestriction may be between the two.
+func (n *DataSource) sizedProcessor() (*ProcessSizedElementsAndRestrictions, bool) {
+	out := n.Out
+	if t, ok := out.(*TruncateSizedRestriction); ok {
+		out = t.Out
+	}
+	u, ok := out.(*ProcessSizedElementsAndRestrictions)
+	return u, ok
+}
+
 // ID returns the UnitID for this node.
 func (n *DataSource) ID() UnitID {
 	return n.UID
@@ -454,9 +466,9 @@ func (n *DataSource) Progress() ProgressReportSnapshot {
 
 // getProcessContinuation retrieves a ProcessContinuation that may be returned by
 // a self-checkpointing SDF. Current support for self-checkpointing requires that the
-// SDF is immediately after the DataSource.
+// SDF is immediately after the DataSource, or after a TruncateSizedRestriction.
 func (n *DataSource) getProcessContinuation() sdf.ProcessContinuation {
-	if u, ok := n.Out.(*ProcessSizedElementsAndRestrictions); ok {
+	if u, ok := n.sizedProcessor(); ok {
 		return u.continuation
 	}
 	return nil
@@ -497,7 +509,8 @@ func (n *DataSource) checkpointThis(ctx context.Context, pc sdf.ProcessContinuat
 		return nil, nil
 	}
 
-	su := SplittableUnit(n.Out.(*ProcessSizedElementsAndRestrictions))
+	u, _ := n.sizedProcessor()
+	su := SplittableUnit(u)
 
 	ow := su.GetOutputWatermark()
 
@@ -1008,6 +1008,60 @@ func TestCheckpointing(t *testing.T) {
 			}
 		}
 	})
+	t.Run("Delay_residuals_Truncate", func(t *testing.T) {
+		// When draining, the restriction is truncated before processing, but the
+		// processing transform may still checkpoint.
+		ctx := context.Background()
+		wesInv, _ := newWatermarkEstimatorStateInvoker(nil)
+		process := &ProcessSizedElementsAndRestrictions{
+			PDo: &ParDo{
+				Fn:  dfn,
+				Out: []Node{&Discard{}},
+			},
+			TfId:   "testTransformID",
+			wesInv: wesInv,
+			rt:     offsetrange.NewTracker(rest),
+		}
+		root := &DataSource{
+			Coder: wvERSCoder,
+			Out:   &TruncateSizedRestriction{Fn: dfn, Out: process},
+		}
+		if err := root.Up(ctx); err != nil {
+			t.Fatalf("invalid function: %v", err)
+		}
+		if err := root.Out.Up(ctx); err != nil {
+			t.Fatalf("invalid function: %v", err)
+		}
+		if err := process.Up(ctx); err != nil {
+			t.Fatalf("invalid function: %v", err)
+		}
+
+		enc := MakeElementEncoder(wvERSCoder)
+		cw := makeChanWriter()
+		if err := enc.Encode(value, cw); err != nil {
+			t.Fatalf("couldn't encode value: %v", err)
+		}
+		cw.Close()
+
+		if err := root.StartBundle(ctx, "testBund", DataContext{
+			Data: &TestDataManager{
+				Ch: cw.Ch,
+			},
+		},
+		); err != nil {
+			t.Fatalf("invalid function: %v", err)
+		}
+		cps, err := root.Process(ctx)
+		if err != nil {
+			t.Fatalf("Process() = %v, %v, want nil", cps, err)
+		}
+		if got, want := len(cps), 1; got != want {
+			t.Fatalf("Process() = len %v checkpoints, want %v", got, want)
+		}
+		if got, want := cps[0].SR.TId, process.TfId; got != want {
+			t.Errorf("Process() transformID = %v, want %v", got, want)
+		}
+	})
 }
 
 func runOnRoots(ctx context.Context, t *testing.T, p *Plan, name string, mthd func(Root, context.Context) error) {
@@ -1023,6 +1077,7 @@ type TestDataManager struct {
 	Ch chan Elements
 
 	TimerWrites map[string]*bytes.Buffer
+	TimerClosed map[string]bool // Families whose timer writers were closed.
 }
 
 func (dm *TestDataManager) OpenElementChan(ctx context.Context, id StreamID, expectedTimerTransforms []string) (<-chan Elements, error) {
@@ -1047,13 +1102,22 @@ func (dm *TestDataManager) OpenTimerWrite(ctx context.Context, id StreamID, fami
 		io.Closer
 	}{
 		Buffer: buf,
-		Closer: noopCloser{},
+		Closer: timerCloser{dm: dm, family: family},
 	}, nil
 }
 
-type noopCloser struct{}
+type timerCloser struct {
+	dm     *TestDataManager
+	family string
+}
 
-func (noopCloser) Close() error { return nil }
+func (c timerCloser) Close() error {
+	if c.dm.TimerClosed == nil {
+		c.dm.TimerClosed = map[string]bool{}
+	}
+	c.dm.TimerClosed[c.family] = true
+	return nil
+}
 
 type chanWriter struct {
 	Ch  chan Elements
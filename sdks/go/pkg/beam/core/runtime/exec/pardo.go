@@ -45,6 +45,10 @@ type ParDo struct {
 	TimerTracker *userTimerAdapter
 	Out          []Node
 
+	// OnWindowExpirationFamily is the timer family fired by the runner when a
+	// window expires, if the DoFn has an OnWindowExpiration method.
+	OnWindowExpirationFamily string
+
 	PID      string
 	emitters []ReusableEmitter
 	ctx      context.Context
@@ -52,10 +56,11 @@ type ParDo struct {
 	bf       *bundleFinalizer
 	we       sdf.WatermarkEstimator
 
-	onTimerInvoker *invoker
-	timerManager   DataManager
-	reader         StateReader
-	cache          *cacheElm
+	onTimerInvoker            *invoker
+	onWindowExpirationInvoker *invoker
+	timerManager              DataManager
+	reader                    StateReader
+	cache                     *cacheElm
 
 	status Status
 	err    errorx.GuardedError
@@ -95,6 +100,9 @@ func (n *ParDo) Up(ctx context.Context) error {
 	if fn, ok := n.Fn.OnTimerFn(); ok {
 		n.onTimerInvoker = newInvoker(fn)
 	}
+	if fn, ok := n.Fn.OnWindowExpirationFn(); ok {
+		n.onWindowExpirationInvoker = newInvoker(fn)
+	}
 
 	n.states = metrics.NewPTransformState(n.PID)
 
@@ -247,6 +255,9 @@ func (n *ParDo) FinishBundle(_ context.Context) error {
 	if n.onTimerInvoker != nil {
 		n.onTimerInvoker.Reset()
 	}
+	if n.onWindowExpirationInvoker != nil {
+		n.onWindowExpirationInvoker.Reset()
+	}
 
 	n.states.Set(n.ctx, metrics.FinishBundle)
 
@@ -407,6 +418,9 @@ func (n *ParDo) ProcessTimers(timerFamilyID string, r io.Reader) (err error) {
 	if err != nil {
 		return err
 	}
+	if timerFamilyID == n.OnWindowExpirationFamily {
+		return n.processWindowExpirations(bundleTimers)
+	}
 	for _, tmap := range bundleTimers {
 		n.TimerTracker.SetCurrentKeyString(tmap.KeyString)
 		for i, w := range tmap.Windows {
@@ -494,6 +508,43 @@ func (n *ParDo) processTimer(timerFamilyID string, singleWindow []typex.Window,
 	return err
 }
 
+// processWindowExpirations invokes OnWindowExpiration once for each key and window
+// of the expiration timers from the runner. Expiration timers can't be set by user
+// code, so unlike other timers, there are no inline firings to order them with.
+func (n *ParDo) processWindowExpirations(bundleTimers []TimerRecv) error {
+	for _, tmap := range bundleTimers {
+		if tmap.Clear {
+			continue
+		}
+		for i := range tmap.Windows {
+			if err := n.processWindowExpiration(tmap.Windows[i:i+1], tmap); err != nil {
+				return errors.WithContextf(err, "error processing window expiration %v", tmap)
+			}
+		}
+	}
+	return nil
+}
+
+func (n *ParDo) processWindowExpiration(singleWindow []typex.Window, tmap TimerRecv) (err error) {
+	// Defer side input clean-up in case of panic
+	defer func() {
+		if postErr := n.postInvoke(); postErr != nil {
+			err = postErr
+		}
+	}()
+	if err := n.preInvoke(n.ctx, singleWindow, tmap.HoldTimestamp); err != nil {
+		return err
+	}
+
+	_, err = n.onWindowExpirationInvoker.invokeWithOpts(n.ctx, tmap.Pane, singleWindow, tmap.HoldTimestamp, InvokeOpts{
+		opt:   &MainInput{Key: *tmap.Key},
+		sa:    n.UState,
+		sr:    n.reader,
+		extra: n.cache.extra,
+	})
+	return err
+}
+
 // invokeProcessFn handles the per element invocations
 func (n *ParDo) invokeProcessFn(ctx context.Context, pn typex.PaneInfo, ws []typex.Window, ts typex.EventTime, opt *MainInput) (val *FullValue, err error) {
 	// Defer side input clean-up in case of panic
@@ -29,6 +29,7 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/sdf"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
@@ -584,6 +585,87 @@ func TestProcessTimers(t *testing.T) {
 	}
 }
 
+// expiresWindows is to do unit testing for OnWindowExpiration, and emits the key
+// of each expired window.
+type expiresWindows struct {
+	State state.Value[string]
+}
+
+func (fn *expiresWindows) ProcessElement(sp state.Provider, k, v string, emit func(string)) {
+}
+
+func (fn *expiresWindows) OnWindowExpiration(w typex.Window, k string, emit func(string)) {
+	emit(fmt.Sprintf("%v:%v", k, w.MaxTimestamp()))
+}
+
+func TestProcessTimers_OnWindowExpiration(t *testing.T) {
+	fn, err := graph.NewDoFn(&expiresWindows{State: state.MakeValueState[string]("state")})
+	if err != nil {
+		t.Fatalf("invalid function %v", err)
+	}
+	g := graph.New()
+	nN := g.NewNode(typex.NewKV(typex.New(reflectx.String), typex.New(reflectx.String)), window.DefaultWindowingStrategy(), true)
+
+	edge, err := graph.NewParDo(g, g.Root(), fn, []*graph.Node{nN}, nil, nil)
+	if err != nil {
+		t.Fatalf("invalid pardo: %v", err)
+	}
+
+	out := &CaptureNode{UID: 1}
+	c := coder.NewT(coder.NewString(), coder.NewIntervalWindow())
+	ta := newUserTimerAdapter(StreamID{}, map[string]timerFamilySpec{
+		"expiration": {
+			Domain:     timers.EventTimeDomain,
+			KeyEncoder: MakeElementEncoder(c.Components[0]),
+			KeyDecoder: MakeElementDecoder(c.Components[0]),
+			WinEncoder: MakeWindowEncoder(c.Window),
+			WinDecoder: MakeWindowDecoder(c.Window),
+		},
+	})
+	pardo := &ParDo{UID: 2, Fn: edge.DoFn, Inbound: edge.Input, Out: []Node{out}, TimerTracker: ta, OnWindowExpirationFamily: "expiration"}
+
+	w1 := window.IntervalWindow{Start: 0, End: 1000}
+	w2 := window.IntervalWindow{Start: 1000, End: 2000}
+	tc := MakeElementEncoder(c)
+	var buf bytes.Buffer
+	for _, timer := range []TimerRecv{
+		{Key: &FullValue{Elm: "a"}, Windows: []typex.Window{w1, w2}},
+		{Key: &FullValue{Elm: "b"}, Windows: []typex.Window{w2}},
+		{Key: &FullValue{Elm: "c"}, Windows: []typex.Window{w2}, TimerMap: timers.TimerMap{Clear: true}},
+	} {
+		timer.Pane = typex.NoFiringPane()
+		timer.Family = "expiration"
+		if !timer.Clear {
+			timer.FireTimestamp = timer.Windows[len(timer.Windows)-1].MaxTimestamp()
+			timer.HoldTimestamp = timer.FireTimestamp
+		}
+		if err := tc.Encode(&FullValue{Elm: timer}, &buf); err != nil {
+			t.Fatalf("failed to encode timer for key %v", timer.Key.Elm)
+		}
+	}
+
+	if err := pardo.Up(context.Background()); err != nil {
+		t.Fatalf("pardo.Up failed: %v", err)
+	}
+	if err := out.Up(context.Background()); err != nil {
+		t.Fatalf("capture.Up failed: %v", err)
+	}
+	if err := pardo.StartBundle(context.Background(), "testID", DataContext{}); err != nil {
+		t.Fatalf("pardo.StartBundle failed: %v", err)
+	}
+	if err := pardo.ProcessTimers("expiration", &buf); err != nil {
+		t.Errorf("ProcessTimers failed when it should have succeeded: %v", err)
+	}
+	want := []any{
+		fmt.Sprintf("a:%v", w1.MaxTimestamp()),
+		fmt.Sprintf("a:%v", w2.MaxTimestamp()),
+		fmt.Sprintf("b:%v", w2.MaxTimestamp()),
+	}
+	if diff := cmp.Diff(want, extractValues(out.Elements...)); diff != "" {
+		t.Errorf("ParDo.ProcessTimers diff: \n%v", diff)
+	}
+}
+
 func emitSumFn(n int, emit func(int)) {
 	emit(n + 1)
 }
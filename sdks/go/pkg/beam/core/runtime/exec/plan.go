@@ -73,7 +73,8 @@ func NewPlan(id string, units []Unit) (*Plan, error) {
 			if onTimers == nil {
 				onTimers = map[string]*ParDo{}
 			}
-			onTimers[pd.PID] = pd
+			// Timers are routed by the transform ID, rather than the unique name in PID.
+			onTimers[pd.TimerTracker.sID.PtransformID] = pd
 		}
 		if p, ok := u.(needsBundleFinalization); ok {
 			p.AttachFinalizer(&bf)
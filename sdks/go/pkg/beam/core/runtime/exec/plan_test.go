@@ -35,6 +35,22 @@ func TestPlan_Checkpoint(t *testing.T) {
 	}
 }
 
+func TestNewPlan_OnTimerTransforms(t *testing.T) {
+	source := &DataSource{UID: 1}
+	pd := &ParDo{
+		UID:          2,
+		PID:          "a/unique/name",
+		TimerTracker: newUserTimerAdapter(StreamID{PtransformID: "e2"}, nil),
+	}
+	if _, err := NewPlan("test", []Unit{source, pd}); err != nil {
+		t.Fatalf("NewPlan() = %v, want nil", err)
+	}
+	// Runners send timers for the transform ID, which needn't be its unique name.
+	if got := source.OnTimerTransforms; len(got) != 1 || got["e2"] != pd {
+		t.Errorf("NewPlan() set OnTimerTransforms = %v, want map[e2:%v]", got, pd)
+	}
+}
+
 func TestPlan_BundleFinalizers(t *testing.T) {
 	newPlan := func() Plan {
 		var p Plan
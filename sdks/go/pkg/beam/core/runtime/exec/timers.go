@@ -121,11 +121,22 @@ func (u *userTimerAdapter) GetModifications(key windowKeyPair) *timerModificatio
 }
 
 // FlushAndReset writes all outstanding modified timers to the datamanager.
+//
+// A writer is opened and closed for every timer family of the transform, so that
+// the runner is always informed that the bundle has finished writing timers,
+// even if no timers were set for that family.
 func (u *userTimerAdapter) FlushAndReset(ctx context.Context, manager DataManager) error {
 	if u == nil {
 		return nil
 	}
-	writersByFamily := map[string]io.Writer{}
+	writersByFamily := map[string]io.WriteCloser{}
+	for family := range u.familyToSpec {
+		w, err := manager.OpenTimerWrite(ctx, u.sID, family)
+		if err != nil {
+			return err
+		}
+		writersByFamily[family] = w
+	}
 
 	var b bytes.Buffer
 	for windowKeyPair, mods := range u.modifications {
@@ -133,12 +144,7 @@ func (u *userTimerAdapter) FlushAndReset(ctx context.Context, manager DataManage
 			spec := u.familyToSpec[id.family]
 			w, ok := writersByFamily[id.family]
 			if !ok {
-				var err error
-				w, err = manager.OpenTimerWrite(ctx, u.sID, id.family)
-				if err != nil {
-					return err
-				}
-				writersByFamily[id.family] = w
+				return errors.Errorf("timer family %v, tag %v is not declared for transform %v", timer.Family, timer.Tag, u.sID.PtransformID)
 			}
 			b.Reset()
 			b.Write([]byte(windowKeyPair.key))
@@ -153,6 +159,11 @@ func (u *userTimerAdapter) FlushAndReset(ctx context.Context, manager DataManage
 			w.Write(b.Bytes())
 		}
 	}
+	for family, w := range writersByFamily {
+		if err := w.Close(); err != nil {
+			return errors.WithContextf(err, "error closing timer family %v", family)
+		}
+	}
 
 	u.modifications = nil
 	u.currentKey = nil
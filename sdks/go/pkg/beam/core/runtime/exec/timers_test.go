@@ -280,10 +280,19 @@ func TestTimerAdapter(t *testing.T) {
 			dm := &TestDataManager{}
 			ta.FlushAndReset(context.Background(), dm)
 
-			if len(dm.TimerWrites) != len(test.want) {
-				t.Errorf("didn't receive writes for all expected families: got %v, want %v", maps.Keys(dm.TimerWrites), maps.Keys(test.want))
+			if got, want := len(dm.TimerWrites), len(ta.familyToSpec); got != want {
+				t.Errorf("didn't open writers for all families: got %v, want %v", maps.Keys(dm.TimerWrites), maps.Keys(ta.familyToSpec))
 			}
+			written := map[string]*bytes.Buffer{}
 			for family, buf := range dm.TimerWrites {
+				if buf.Len() > 0 {
+					written[family] = buf
+				}
+			}
+			if len(written) != len(test.want) {
+				t.Errorf("didn't receive writes for all expected families: got %v, want %v", maps.Keys(written), maps.Keys(test.want))
+			}
+			for family, buf := range written {
 				r := bytes.NewBuffer(buf.Bytes())
 				wantedTimers := test.want[family]
 				spec := ta.familyToSpec[family]
@@ -306,6 +315,37 @@ func TestTimerAdapter(t *testing.T) {
 	}
 }
 
+func TestTimerAdapter_FlushAndReset(t *testing.T) {
+	timerCoder := coder.NewT(coder.NewString(), coder.NewGlobalWindow())
+	newAdapter := func() *userTimerAdapter {
+		ta := newUserTimerAdapter(StreamID{PtransformID: "test"}, map[string]timerFamilySpec{
+			"family1": newTimerFamilySpec(timers.EventTimeDomain, timerCoder),
+			"family2": newTimerFamilySpec(timers.ProcessingTimeDomain, timerCoder),
+		})
+		ta.SetCurrentKey(&MainInput{Key: FullValue{Elm: "key"}})
+		return ta
+	}
+
+	t.Run("closes every family", func(t *testing.T) {
+		ta := newAdapter()
+		ta.NewTimerProvider(typex.NoFiringPane(), window.SingleGlobalWindow).Set(timers.TimerMap{Family: "family1", FireTimestamp: 123})
+
+		dm := &TestDataManager{}
+		if err := ta.FlushAndReset(context.Background(), dm); err != nil {
+			t.Fatalf("FlushAndReset() = %v, want nil", err)
+		}
+		// The runner is told every family is done, even those without any timers set.
+		for family := range ta.familyToSpec {
+			if !dm.TimerClosed[family] {
+				t.Errorf("FlushAndReset() didn't close the writer of family %v", family)
+			}
+		}
+		if got := dm.TimerWrites["family2"].Len(); got != 0 {
+			t.Errorf("FlushAndReset() wrote %v bytes for family2, want 0", got)
+		}
+	})
+}
+
 func TestSortableTimer_Less(t *testing.T) {
 	f := "family"
 
@@ -273,11 +273,27 @@ func unmarshalWindowFn(wfn *pipepb.FunctionSpec) (*window.Fn, error) {
 		gap := gapPB.AsDuration()
 		return window.NewSessions(gap), nil
 
+	case graphx.URNCustomWindowFn:
+		return unmarshalCustomWindowFn(wfn.GetPayload())
+
 	default:
 		return nil, errors.Errorf("unsupported window type: %v", urn)
 	}
 }
 
+func unmarshalCustomWindowFn(payload []byte) (*window.Fn, error) {
+	var ref v1pb.Fn
+	if err := proto.Unmarshal(payload, &ref); err != nil {
+		return nil, err
+	}
+	fn, err := graphx.DecodeCustomWindowFn(&ref)
+	if err != nil {
+		return nil, err
+	}
+	// The window type isn't needed to assign or merge windows.
+	return &window.Fn{Kind: window.Custom, CustomFn: fn}, nil
+}
+
 func unmarshalAndMakeWindowMapping(wmfn *pipepb.FunctionSpec) (WindowMapper, error) {
 	switch urn := wmfn.GetUrn(); urn {
 	case graphx.URNWindowMappingGlobal:
@@ -310,6 +326,12 @@ func unmarshalAndMakeWindowMapping(wmfn *pipepb.FunctionSpec) (WindowMapper, err
 		}
 		size := sizePB.AsDuration()
 		return &windowMapper{wfn: window.NewSlidingWindows(period, size)}, nil
+	case graphx.URNWindowMappingCustom:
+		wfn, err := unmarshalCustomWindowFn(wmfn.GetPayload())
+		if err != nil {
+			return nil, err
+		}
+		return &windowMapper{wfn: wfn}, nil
 	default:
 		return nil, fmt.Errorf("unsupported window mapping fn URN %v", urn)
 	}
@@ -468,6 +490,7 @@ func (b *builder) makeLink(from string, id linkID) (Node, error) {
 		var sides map[string]*pipepb.SideInput
 		var userState map[string]*pipepb.StateSpec
 		var userTimers map[string]*pipepb.TimerFamilySpec
+		var onWindowExpiration string
 		switch urn {
 		case graphx.URNParDo,
 			urnPairWithRestriction,
@@ -482,6 +505,7 @@ func (b *builder) makeLink(from string, id linkID) (Node, error) {
 			sides = pardo.GetSideInputs()
 			userState = pardo.GetStateSpecs()
 			userTimers = pardo.GetTimerFamilySpecs()
+			onWindowExpiration = pardo.GetOnWindowExpirationTimerFamilySpec()
 		case urnPerKeyCombinePre, urnPerKeyCombineMerge, urnPerKeyCombineExtract, urnPerKeyCombineConvert:
 			var cmb pipepb.CombinePayload
 			if err := proto.Unmarshal(payload, &cmb); err != nil {
@@ -561,6 +585,9 @@ func (b *builder) makeLink(from string, id linkID) (Node, error) {
 								kcID = ms.KeyCoderId
 							} else if ss := spec.GetSetSpec(); ss != nil {
 								kcID = ss.ElementCoderId
+							} else if mms := spec.GetMultimapSpec(); mms != nil {
+								cID = mms.ValueCoderId
+								kcID = mms.KeyCoderId
 							} else {
 								return nil, errors.Errorf("Unrecognized state type %v", spec)
 							}
@@ -608,6 +635,7 @@ func (b *builder) makeLink(from string, id linkID) (Node, error) {
 							familyToSpec[fam] = newTimerFamilySpec(domain, timerCoder)
 						}
 						n.TimerTracker = newUserTimerAdapter(sID, familyToSpec)
+						n.OnWindowExpirationFamily = onWindowExpiration
 					}
 
 					for i := 1; i < len(input); i++ {
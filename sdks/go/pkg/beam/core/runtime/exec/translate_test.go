@@ -26,6 +26,7 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/protox"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
@@ -225,6 +226,34 @@ func TestUnmarshalWindowFn(t *testing.T) {
 	}
 }
 
+func init() {
+	runtime.RegisterType(reflect.TypeOf((*labelWindows)(nil)).Elem())
+}
+
+func TestUnmarshalWindowFn_Custom(t *testing.T) {
+	ref, err := graphx.EncodeCustomWindowFn(labelWindows{})
+	if err != nil {
+		t.Fatalf("failed to encode window fn, got %v", err)
+	}
+	payload := protox.MustEncode(ref)
+
+	got, err := unmarshalWindowFn(&pipepb.FunctionSpec{Urn: graphx.URNCustomWindowFn, Payload: payload})
+	if err != nil {
+		t.Fatalf("failed to unmarshal window fn, got %v", err)
+	}
+	if got.Kind != window.Custom || got.CustomFn != (labelWindows{}) {
+		t.Errorf("got window fn %v, want %v", got, window.Custom)
+	}
+
+	wMap, err := unmarshalAndMakeWindowMapping(&pipepb.FunctionSpec{Urn: graphx.URNWindowMappingCustom, Payload: payload})
+	if err != nil {
+		t.Fatalf("failed to unmarshal window mapping fn, got %v", err)
+	}
+	if got := wMap.(*windowMapper).wfn; got.Kind != window.Custom || got.CustomFn != (labelWindows{}) {
+		t.Errorf("got window mapping fn %v, want %v", got, window.Custom)
+	}
+}
+
 func TestUnmarshalWindowMapper(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -18,6 +18,7 @@ package exec
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 
@@ -328,6 +329,162 @@ func (s *stateProvider) ClearMapState(val state.Transaction) error {
 	return nil
 }
 
+// orderedListKey encodes a timestamp of ordered list state as its map key. The keys
+// are big endian, with the sign bit flipped, so their bytes sort in timestamp order.
+func orderedListKey(ts int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(ts)^(1<<63))
+	return b[:]
+}
+
+// orderedListTimestamp decodes the timestamp of an ordered list state map key.
+func orderedListTimestamp(k []byte) (int64, error) {
+	if len(k) != 8 {
+		return 0, fmt.Errorf("invalid ordered list state key %x: want 8 bytes", k)
+	}
+	return int64(binary.BigEndian.Uint64(k) ^ (1 << 63)), nil
+}
+
+// ReadOrderedListTimestamps reads the timestamps that have values in an ordered list state.
+// The timestamps are paged in from the runner as they're iterated, and already reflect the
+// state's transactions, so none are returned.
+func (s *stateProvider) ReadOrderedListTimestamps(userStateID string) (state.TimestampIterator, []state.Transaction, error) {
+	rw, err := s.sr.OpenMultimapKeysUserStateReader(s.ctx, s.SID, userStateID, s.elementKey, s.window)
+	if err != nil {
+		return nil, nil, err
+	}
+	sr, ok := s.sr.(SortedMultimapKeysReader)
+	return &orderedListTimestamps{
+		r:      rw,
+		dec:    MakeElementDecoder(coder.SkipW(s.keyCodersByID[userStateID])),
+		sorted: ok && sr.SortedMultimapKeys(),
+	}, nil, nil
+}
+
+// orderedListTimestamps decodes ordered list state timestamps from a reader of the
+// state's map keys as they're iterated.
+type orderedListTimestamps struct {
+	r      io.ReadCloser
+	dec    ElementDecoder
+	sorted bool
+}
+
+// Next returns the next decoded timestamp and true, or false once the reader is
+// exhausted, closing it.
+func (t *orderedListTimestamps) Next() (int64, bool, error) {
+	if t.r == nil {
+		return 0, false, nil
+	}
+	resp, err := t.dec.Decode(t.r)
+	if err == io.EOF {
+		return 0, false, t.Close()
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	ts, err := orderedListTimestamp(resp.Elm.([]byte))
+	if err != nil {
+		return 0, false, err
+	}
+	return ts, true, nil
+}
+
+// Sorted returns whether the runner reads the map keys in order, so the timestamps are ascending.
+func (t *orderedListTimestamps) Sorted() bool {
+	return t.sorted
+}
+
+// Close closes the reader, if it isn't exhausted.
+func (t *orderedListTimestamps) Close() error {
+	if t.r == nil {
+		return nil
+	}
+	r := t.r
+	t.r = nil
+	return r.Close()
+}
+
+// ReadOrderedListValues reads the values with the given timestamp in an ordered list state.
+// The values are paged in from the runner as they're iterated, and already reflect the
+// state's transactions, so none are returned.
+func (s *stateProvider) ReadOrderedListValues(userStateID string, ts int64) (state.Iterator, []state.Transaction, error) {
+	rw, err := s.getMultiMapReader(userStateID, orderedListKey(ts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &stateValues{r: rw, dec: MakeElementDecoder(coder.SkipW(s.codersByKey[userStateID]))}, nil, nil
+}
+
+// stateValues decodes state values from a reader as they're iterated.
+type stateValues struct {
+	r   io.ReadCloser
+	dec ElementDecoder
+}
+
+// Next returns the next decoded value and true, or false once the reader is exhausted,
+// closing it.
+func (v *stateValues) Next() (any, bool, error) {
+	if v.r == nil {
+		return nil, false, nil
+	}
+	resp, err := v.dec.Decode(v.r)
+	if err == io.EOF {
+		return nil, false, v.Close()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.Elm, true, nil
+}
+
+// Close closes the reader, if it isn't exhausted.
+func (v *stateValues) Close() error {
+	if v.r == nil {
+		return nil
+	}
+	r := v.r
+	v.r = nil
+	return r.Close()
+}
+
+// WriteOrderedListState appends a timestamped value to an ordered list state.
+func (s *stateProvider) WriteOrderedListState(val state.Transaction) error {
+	ap, err := s.getMultiMapAppender(val.Key, orderedListKey(val.MapKey.(int64)))
+	if err != nil {
+		return err
+	}
+	fv := FullValue{Elm: val.Val}
+	enc := MakeElementEncoder(coder.SkipW(s.codersByKey[val.Key]))
+	if err := enc.Encode(&fv, ap); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearOrderedListTimestamp deletes the values with a timestamp from an ordered list state.
+func (s *stateProvider) ClearOrderedListTimestamp(val state.Transaction) error {
+	cl, err := s.getMultiMapKeyClearer(val.Key, orderedListKey(val.MapKey.(int64)))
+	if err != nil {
+		return err
+	}
+	if _, err := cl.Write([]byte{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearOrderedListState deletes all values from an ordered list state.
+func (s *stateProvider) ClearOrderedListState(val state.Transaction) error {
+	cl, err := s.getMultiMapClearer(val.Key)
+	if err != nil {
+		return err
+	}
+	if _, err := cl.Write([]byte{}); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s *stateProvider) CreateAccumulatorFn(userStateID string) reflectx.Func {
 	a := s.combineFnsByKey[userStateID]
 	if ca := a.CreateAccumulatorFn(); ca != nil {
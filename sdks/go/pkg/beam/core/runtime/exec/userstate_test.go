@@ -16,11 +16,13 @@
 package exec
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
@@ -203,3 +205,117 @@ func TestNewUserStateAdapter(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderedListReadRange_StateRequests(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	for _, test := range []struct {
+		sorted bool
+		want   int
+	}{
+		// The page with the first timestamp past the range ends the read.
+		{sorted: true, want: 4},
+		// Every page of timestamps is read.
+		{sorted: false, want: 102},
+	} {
+		sp := buildStateProvider()
+		sp.keyCodersByID = map[string]*coder.Coder{"list": coder.NewBytes()}
+		sp.codersByKey["list"] = coder.NewString()
+		sr := &pagedStateReader{pageSize: 10, sorted: test.sorted, values: map[string][]byte{}}
+		sp.sr = sr
+		for ts := int64(0); ts < 1000; ts++ {
+			mk, err := sp.encodeKey("list", orderedListKey(ts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := MakeElementEncoder(coder.NewString()).Encode(&FullValue{Elm: fmt.Sprint(ts)}, &buf); err != nil {
+				t.Fatal(err)
+			}
+			sr.keys = append(sr.keys, mk)
+			sr.values[string(mk)] = buf.Bytes()
+		}
+
+		list := state.MakeOrderedListState[string]("list")
+		it, err := list.ReadRange(&sp, at(10), at(12))
+		if err != nil {
+			t.Fatalf("ReadRange() with sorted keys %v returned error %v", test.sorted, err)
+		}
+		var got []string
+		for {
+			v, ok, err := it.Next()
+			if err != nil {
+				t.Fatalf("Next() with sorted keys %v returned error %v", test.sorted, err)
+			}
+			if !ok {
+				break
+			}
+			got = append(got, v.Value)
+		}
+		if want := []string{"10", "11"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadRange() with sorted keys %v = %v, want %v", test.sorted, got, want)
+		}
+		if sr.requests != test.want {
+			t.Errorf("ReadRange() with sorted keys %v made %v state requests, want %v", test.sorted, sr.requests, test.want)
+		}
+	}
+}
+
+// pagedStateReader serves multimap user state keys in pages, like the runner's
+// responses with continuation tokens, counting the state requests made.
+type pagedStateReader struct {
+	testStateReader
+	keys     [][]byte          // Encoded map keys, in order.
+	values   map[string][]byte // Encoded values of each map key.
+	pageSize int
+	sorted   bool
+	requests int
+}
+
+func (r *pagedStateReader) SortedMultimapKeys() bool {
+	return r.sorted
+}
+
+func (r *pagedStateReader) OpenMultimapKeysUserStateReader(ctx context.Context, id StreamID, userStateID string, key []byte, w []byte) (io.ReadCloser, error) {
+	keys := r.keys
+	if !r.sorted {
+		keys = make([][]byte, len(r.keys))
+		for i, k := range r.keys {
+			keys[len(keys)-1-i] = k
+		}
+	}
+	return &pagedKeysReader{r: r, keys: keys}, nil
+}
+
+func (r *pagedStateReader) OpenMultimapUserStateReader(ctx context.Context, id StreamID, userStateID string, key []byte, w []byte, mk []byte) (io.ReadCloser, error) {
+	r.requests++
+	return io.NopCloser(bytes.NewReader(r.values[string(mk)])), nil
+}
+
+// pagedKeysReader requests the next page of keys once the current one is read.
+type pagedKeysReader struct {
+	r    *pagedStateReader
+	keys [][]byte
+	page bytes.Buffer
+}
+
+func (p *pagedKeysReader) Read(buf []byte) (int, error) {
+	if p.page.Len() == 0 {
+		if len(p.keys) == 0 {
+			return 0, io.EOF
+		}
+		p.r.requests++
+		n := p.r.pageSize
+		if n > len(p.keys) {
+			n = len(p.keys)
+		}
+		for _, k := range p.keys[:n] {
+			p.page.Write(k)
+		}
+		p.keys = p.keys[n:]
+	}
+	return p.page.Read(buf)
+}
+
+func (p *pagedKeysReader) Close() error {
+	return nil
+}
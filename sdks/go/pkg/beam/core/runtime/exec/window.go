@@ -48,7 +48,7 @@ func (w *WindowInto) StartBundle(ctx context.Context, id string, data DataContex
 
 func (w *WindowInto) ProcessElement(ctx context.Context, elm *FullValue, values ...ReStream) error {
 	windowed := &FullValue{
-		Windows:   assignWindows(w.Fn, elm.Timestamp),
+		Windows:   assignWindows(w.Fn, elm.Timestamp, elm.Elm),
 		Timestamp: elm.Timestamp,
 		Elm:       elm.Elm,
 		Elm2:      elm.Elm2,
@@ -57,7 +57,9 @@ func (w *WindowInto) ProcessElement(ctx context.Context, elm *FullValue, values
 	return w.Out.ProcessElement(ctx, windowed, values...)
 }
 
-func assignWindows(wfn *window.Fn, ts typex.EventTime) []typex.Window {
+// assignWindows returns the windows of an element with the given timestamp. The
+// element is only used by custom WindowFns, and is the key of KV elements.
+func assignWindows(wfn *window.Fn, ts typex.EventTime, elem any) []typex.Window {
 	switch wfn.Kind {
 	case window.GlobalWindows:
 		return window.SingleGlobalWindow
@@ -82,6 +84,9 @@ func assignWindows(wfn *window.Fn, ts typex.EventTime) []typex.Window {
 		// each other) will be merged.
 		return []typex.Window{window.IntervalWindow{Start: ts, End: ts.Add(wfn.Gap)}}
 
+	case window.Custom:
+		return wfn.CustomFn.AssignWindows(ts, elem)
+
 	default:
 		panic(fmt.Sprintf("Unexpected window fn: %v", wfn))
 	}
@@ -165,7 +170,7 @@ type windowMapper struct {
 }
 
 func (f *windowMapper) MapWindow(w typex.Window) (typex.Window, error) {
-	candidates := assignWindows(f.wfn, w.MaxTimestamp())
+	candidates := assignWindows(f.wfn, w.MaxTimestamp(), nil)
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("failed to map main input window to side input window with WindowFn %v", f.wfn.String())
 	}
@@ -116,13 +116,53 @@ func TestAssignWindow(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		out := assignWindows(test.fn, test.in)
+		out := assignWindows(test.fn, test.in, nil)
 		if !window.IsEqualList(out, test.out) {
 			t.Errorf("assignWindows(%v, %v) = %v, want %v", test.fn, test.in, out, test.out)
 		}
 	}
 }
 
+// labelWindow is a custom window of the elements with a label.
+type labelWindow struct {
+	Label string
+}
+
+func (labelWindow) MaxTimestamp() typex.EventTime {
+	return mtime.EndOfGlobalWindowTime
+}
+
+func (w labelWindow) Equals(o typex.Window) bool {
+	return w == o
+}
+
+func (w labelWindow) MarshalBinary() ([]byte, error) {
+	return []byte(w.Label), nil
+}
+
+func (w *labelWindow) UnmarshalBinary(data []byte) error {
+	w.Label = string(data)
+	return nil
+}
+
+// labelWindows assigns string elements to the windows of their labels.
+type labelWindows struct{}
+
+func (labelWindows) AssignWindows(_ typex.EventTime, elem any) []typex.Window {
+	if elem == nil {
+		return []typex.Window{labelWindow{}}
+	}
+	return []typex.Window{labelWindow{Label: elem.(string)}}
+}
+
+func TestAssignWindow_Custom(t *testing.T) {
+	wfn := window.NewCustomWindows[labelWindow](labelWindows{})
+	got := assignWindows(wfn, mtime.ZeroTimestamp, "apple")
+	if want := []typex.Window{labelWindow{Label: "apple"}}; !window.IsEqualList(got, want) {
+		t.Errorf("assignWindows(%v, %v, apple) = %v, want %v", wfn, mtime.ZeroTimestamp, got, want)
+	}
+}
+
 func TestMapWindow(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -160,6 +200,12 @@ func TestMapWindow(t *testing.T) {
 			window.IntervalWindow{Start: 0, End: 1001},
 			window.IntervalWindow{Start: 300, End: 1300},
 		},
+		{
+			"interval to custom",
+			window.NewCustomWindows[labelWindow](labelWindows{}),
+			window.IntervalWindow{Start: 0, End: 1000},
+			labelWindow{},
+		},
 	}
 	for _, test := range tests {
 		mapper := &windowMapper{wfn: test.wfn}
@@ -50,6 +50,7 @@ const (
 
 	urnGlobalWindow   = "beam:coder:global_window:v1"
 	urnIntervalWindow = "beam:coder:interval_window:v1"
+	urnCustomWindow   = "beam:coder:custom_window:v1"
 
 	// SDK constants
 
@@ -71,6 +72,7 @@ func knownStandardCoders() []string {
 		urnWindowedValueCoder,
 		urnGlobalWindow,
 		urnIntervalWindow,
+		urnCustomWindow,
 		urnRowCoder,
 		urnNullableCoder,
 		urnTimerCoder,
@@ -165,7 +167,12 @@ func (b *CoderUnmarshaller) WindowCoder(id string) (*coder.WindowCoder, error) {
 		return nil, err
 	}
 
-	w, err := urnToWindowCoder(c.GetSpec().GetUrn())
+	var w *coder.WindowCoder
+	if c.GetSpec().GetUrn() == urnCustomWindow {
+		w, err = b.customWindowCoder(c)
+	} else {
+		w, err = urnToWindowCoder(c.GetSpec().GetUrn())
+	}
 	if err != nil {
 		return nil, errors.SetTopLevelMsgf(err, "failed to unmarshal window coder %v", id)
 	}
@@ -173,6 +180,20 @@ func (b *CoderUnmarshaller) WindowCoder(id string) (*coder.WindowCoder, error) {
 	return w, nil
 }
 
+// customWindowCoder unmarshals a custom window coder, whose payload is the
+// window type.
+func (b *CoderUnmarshaller) customWindowCoder(c *pipepb.Coder) (*coder.WindowCoder, error) {
+	var ref v1pb.Type
+	if err := proto.Unmarshal(c.GetSpec().GetPayload(), &ref); err != nil {
+		return nil, errors.Wrap(err, "failed to decode custom window type")
+	}
+	t, err := decodeType(&ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode custom window type")
+	}
+	return coder.NewCustomWindow(t)
+}
+
 func urnToWindowCoder(urn string) (*coder.WindowCoder, error) {
 	switch urn {
 	case urnGlobalWindow:
@@ -583,6 +604,20 @@ func (b *CoderMarshaller) AddWindowCoder(w *coder.WindowCoder) (string, error) {
 		return b.internBuiltInCoder(urnGlobalWindow), nil
 	case coder.IntervalWindow:
 		return b.internBuiltInCoder(urnIntervalWindow), nil
+	case coder.CustomWindow:
+		// Custom windows are encoded as their MarshalBinary bytes, after their
+		// maximum timestamp. Runners only need the bytes coder to decode them.
+		ref, err := encodeType(w.Type)
+		if err != nil {
+			return "", errors.WithContextf(err, "failed to marshal window coder %v", w)
+		}
+		return b.internCoder(&pipepb.Coder{
+			Spec: &pipepb.FunctionSpec{
+				Urn:     urnCustomWindow,
+				Payload: protox.MustEncode(ref),
+			},
+			ComponentCoderIds: []string{b.internBuiltInCoder(urnBytesCoder)},
+		}), nil
 	default:
 		err := errors.Errorf("window coder with unexpected type %v", w.Kind)
 		return "", errors.WithContextf(err, "failed to unmarshal window coder %v", w)
@@ -200,6 +200,52 @@ func decodeWindowFn(w *v1pb.WindowFn) *window.Fn {
 	}
 }
 
+// EncodeCustomWindowFn encodes a user-defined WindowFn like a structural DoFn,
+// as its registered type and JSON-serialized value.
+func EncodeCustomWindowFn(fn window.WindowFn) (*v1pb.Fn, error) {
+	t := reflect.TypeOf(fn)
+	k, ok := runtime.TypeKey(reflectx.SkipPtr(t))
+	if !ok {
+		err := errors.Errorf("failed to create TypeKey for WindowFn type %T", fn)
+		return nil, errors.WithContextf(err, "encoding custom WindowFn %v", fn)
+	}
+	if _, ok := runtime.LookupType(k); !ok {
+		err := errors.Errorf("WindowFn type %v must be registered", t)
+		return nil, errors.WithContextf(err, "encoding custom WindowFn %v", fn)
+	}
+	typ, err := encodeType(t)
+	if err != nil {
+		wrapped := errors.Wrapf(err, "failed to encode WindowFn type %T", fn)
+		return nil, errors.WithContextf(wrapped, "encoding custom WindowFn %v", fn)
+	}
+	data, err := jsonx.Marshal(fn)
+	if err != nil {
+		wrapped := errors.Wrapf(err, "failed to marshal WindowFn %v", fn)
+		return nil, errors.WithContextf(wrapped, "encoding custom WindowFn %v", fn)
+	}
+	return &v1pb.Fn{Type: typ, Opt: string(data)}, nil
+}
+
+// DecodeCustomWindowFn decodes a user-defined WindowFn encoded by EncodeCustomWindowFn.
+func DecodeCustomWindowFn(ref *v1pb.Fn) (window.WindowFn, error) {
+	t, err := decodeType(ref.GetType())
+	if err != nil {
+		wrapped := errors.Wrap(err, "bad type")
+		return nil, errors.WithContextf(wrapped, "decoding custom WindowFn %v", ref)
+	}
+	elem := reflect.New(t)
+	if err := jsonx.UnmarshalFrom(elem.Interface(), strings.NewReader(ref.GetOpt())); err != nil {
+		wrapped := errors.Wrap(err, "bad struct encoding")
+		return nil, errors.WithContextf(wrapped, "decoding custom WindowFn %v", ref)
+	}
+	fn, ok := elem.Elem().Interface().(window.WindowFn)
+	if !ok {
+		err := errors.Errorf("type %v isn't a WindowFn", t)
+		return nil, errors.WithContextf(err, "decoding custom WindowFn %v", ref)
+	}
+	return fn, nil
+}
+
 func duration2ms(d time.Duration) int64 {
 	return d.Nanoseconds() / 1e6
 }
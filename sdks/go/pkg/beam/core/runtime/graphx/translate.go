@@ -60,6 +60,8 @@ const (
 	// SDK constants
 	URNDoFn = "beam:go:transform:dofn:v1"
 
+	URNCustomWindowFn = "beam:go:windowfn:custom:v1"
+
 	URNIterableSideInputKey = "beam:go:transform:iterablesideinputkey:v1"
 	URNReshuffleInput       = "beam:go:transform:reshuffleinput:v1"
 	URNReshuffleOutput      = "beam:go:transform:reshuffleoutput:v1"
@@ -67,6 +69,7 @@ const (
 	URNWindowMappingGlobal  = "beam:go:windowmapping:global:v1"
 	URNWindowMappingFixed   = "beam:go:windowmapping:fixed:v1"
 	URNWindowMappingSliding = "beam:go:windowmapping:sliding:v1"
+	URNWindowMappingCustom  = "beam:go:windowmapping:custom:v1"
 
 	URNProgressReporting     = "beam:protocol:progress_reporting:v1"
 	URNMultiCore             = "beam:protocol:multi_core_bundle_processing:v1"
@@ -76,8 +79,13 @@ const (
 	URNRequiresSplittableDoFn     = "beam:requirement:pardo:splittable_dofn:v1"
 	URNRequiresBundleFinalization = "beam:requirement:pardo:finalization:v1"
 	URNRequiresStatefulProcessing = "beam:requirement:pardo:stateful:v1"
+	URNRequiresOnWindowExpiration = "beam:requirement:pardo:on_window_expiration:v1"
 	URNTruncate                   = "beam:transform:sdf_truncate_sized_restrictions:v1"
 
+	// OnWindowExpirationTimerFamily is the ID of the timer family the runner fires
+	// when a window expires, for DoFns with an OnWindowExpiration method.
+	OnWindowExpirationTimerFamily = "__OnWindowExpiration"
+
 	// Deprecated: Determine worker binary based on GoWorkerBinary Role instead.
 	URNArtifactGoWorker = "beam:artifact:type:go_worker_binary:v1"
 
@@ -331,6 +339,8 @@ func getSideWindowMappingUrn(winFn *window.Fn) string {
 		mappingUrn = URNWindowMappingSliding
 	case window.Sessions:
 		panic("session windowing is not supported for side inputs")
+	case window.Custom:
+		mappingUrn = URNWindowMappingCustom
 	}
 	return mappingUrn
 }
@@ -493,8 +503,8 @@ func (m *marshaller) addMultiEdge(edge NamedEdge) ([]string, error) {
 					if err != nil {
 						return handleErr(err)
 					}
-				} else if ps.StateType() == state.TypeMap || ps.StateType() == state.TypeSet {
-					return nil, errors.Errorf("set or map state type %v must have a key coder type, none detected", ps)
+				} else if ps.StateType() == state.TypeMap || ps.StateType() == state.TypeSet || ps.StateType() == state.TypeOrderedList {
+					return nil, errors.Errorf("set, map, or ordered list state type %v must have a key coder type, none detected", ps)
 				}
 				switch ps.StateType() {
 				case state.TypeValue:
@@ -574,13 +584,29 @@ func (m *marshaller) addMultiEdge(edge NamedEdge) ([]string, error) {
 							Urn: URNMultiMapUserState,
 						},
 					}
+				case state.TypeOrderedList:
+					// The FnAPI has no ordered list state protocol, so ordered lists are
+					// stored as a multimap from timestamp to the values with that timestamp.
+					stateSpecs[ps.StateKey()] = &pipepb.StateSpec{
+						Spec: &pipepb.StateSpec_MultimapSpec{
+							MultimapSpec: &pipepb.MultimapStateSpec{
+								KeyCoderId:   keyCoderID,
+								ValueCoderId: coderID,
+							},
+						},
+						Protocol: &pipepb.FunctionSpec{
+							Urn: URNMultiMapUserState,
+						},
+					}
 				default:
 					return nil, errors.Errorf("State type %v not recognized for state %v", ps.StateKey(), ps)
 				}
 			}
 			payload.StateSpecs = stateSpecs
 		}
-		if _, ok := edge.Edge.DoFn.ProcessElementFn().TimerProvider(); ok {
+		_, hasTimers := edge.Edge.DoFn.ProcessElementFn().TimerProvider()
+		_, hasOnWindowExpiration := edge.Edge.DoFn.OnWindowExpirationFn()
+		if hasTimers || hasOnWindowExpiration {
 			m.requirements[URNRequiresStatefulProcessing] = true
 			timerSpecs := make(map[string]*pipepb.TimerFamilySpec)
 			pipelineTimers, _ := edge.Edge.DoFn.PipelineTimers()
@@ -608,6 +634,15 @@ func (m *marshaller) addMultiEdge(edge NamedEdge) ([]string, error) {
 					}
 				}
 			}
+			if hasOnWindowExpiration {
+				// The runner fires the timer for each key and window once the window expires.
+				timerSpecs[OnWindowExpirationTimerFamily] = &pipepb.TimerFamilySpec{
+					TimeDomain:         pipepb.TimeDomain_EVENT_TIME,
+					TimerFamilyCoderId: timerCoderID,
+				}
+				payload.OnWindowExpirationTimerFamilySpec = OnWindowExpirationTimerFamily
+				m.requirements[URNRequiresOnWindowExpiration] = true
+			}
 			payload.TimerFamilySpecs = timerSpecs
 		}
 		spec = &pipepb.FunctionSpec{Urn: URNParDo, Payload: protox.MustEncode(payload)}
@@ -1420,6 +1455,15 @@ func makeWindowFn(w *window.Fn) (*pipepb.FunctionSpec, error) {
 				},
 			),
 		}, nil
+	case window.Custom:
+		ref, err := EncodeCustomWindowFn(w.CustomFn)
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.FunctionSpec{
+			Urn:     URNCustomWindowFn,
+			Payload: protox.MustEncode(ref),
+		}, nil
 	default:
 		return nil, errors.Errorf("unexpected windowing strategy: %v", w)
 	}
@@ -1431,6 +1475,11 @@ func makeWindowCoder(w *window.Fn) (*coder.WindowCoder, error) {
 		return coder.NewGlobalWindow(), nil
 	case window.FixedWindows, window.SlidingWindows, window.Sessions, URNSlidingWindowsWindowFn:
 		return coder.NewIntervalWindow(), nil
+	case window.Custom:
+		if !w.HasCustomWindows() {
+			return coder.NewIntervalWindow(), nil
+		}
+		return coder.NewCustomWindow(w.WindowType)
 	default:
 		return nil, errors.Errorf("unexpected windowing strategy for coder: %v", w)
 	}
@@ -26,9 +26,12 @@ import (
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx"
+	v1pb "github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/graphx/v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/protox"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
@@ -40,6 +43,10 @@ import (
 func init() {
 	runtime.RegisterFunction(pickFn)
 	runtime.RegisterType(reflect.TypeOf((*splitPickFn)(nil)).Elem())
+	runtime.RegisterType(reflect.TypeOf((*expiringSumFn)(nil)).Elem())
+	runtime.RegisterType(reflect.TypeOf((*everyNWindows)(nil)).Elem())
+	runtime.RegisterType(reflect.TypeOf((*moduloWindows)(nil)).Elem())
+	runtime.RegisterType(reflect.TypeOf((*moduloWindow)(nil)).Elem())
 }
 
 func pickFn(a int, small, big func(int)) {
@@ -82,6 +89,12 @@ func newIntInput(g *graph.Graph) *graph.Node {
 	return in
 }
 
+func newKVInput(g *graph.Graph) *graph.Node {
+	in := g.NewNode(typex.NewKV(typex.New(reflectx.String), intT()), window.DefaultWindowingStrategy(), true)
+	in.Coder = coder.NewKV([]*coder.Coder{coder.NewString(), intCoder()})
+	return in
+}
+
 func intT() typex.FullType {
 	return typex.New(reflectx.Int)
 }
@@ -152,6 +165,15 @@ func TestMarshal(t *testing.T) {
 			edges:      1,
 			transforms: 4,
 			roots:      1,
+		}, {
+			name: "OnWindowExpiration",
+			makeGraph: func(t *testing.T, g *graph.Graph) {
+				addDoFn(t, g, &expiringSumFn{Sum: state.MakeValueState[int]("sum")}, g.Root(), []*graph.Node{newKVInput(g)}, []*coder.Coder{intCoder()}, nil)
+			},
+			edges:        1,
+			transforms:   1,
+			roots:        1,
+			requirements: []string{graphx.URNRequiresStatefulProcessing, graphx.URNRequiresOnWindowExpiration},
 		},
 	}
 	for _, test := range tests {
@@ -381,3 +403,130 @@ func TestUpdateDefaultEnvWorkerType(t *testing.T) {
 	})
 
 }
+
+// expiringSumFn is used for the OnWindowExpiration test, and outputs the sum
+// of the values of each key when its window expires.
+type expiringSumFn struct {
+	Sum state.Value[int]
+}
+
+func (fn *expiringSumFn) ProcessElement(sp state.Provider, _ string, v int, _ func(int)) error {
+	sum, _, err := fn.Sum.Read(sp)
+	if err != nil {
+		return err
+	}
+	return fn.Sum.Write(sp, sum+v)
+}
+
+func (fn *expiringSumFn) OnWindowExpiration(sp state.Provider, _ string, emit func(int)) error {
+	sum, _, err := fn.Sum.Read(sp)
+	if err != nil {
+		return err
+	}
+	emit(sum)
+	return nil
+}
+
+// everyNWindows assigns elements to interval windows of N milliseconds.
+type everyNWindows struct {
+	N int64
+}
+
+func (fn everyNWindows) AssignWindows(ts typex.EventTime, _ any) []typex.Window {
+	start := ts - ts%typex.EventTime(fn.N)
+	return []typex.Window{window.IntervalWindow{Start: start, End: start + typex.EventTime(fn.N)}}
+}
+
+// moduloWindow is the window of the timestamps with the same remainder.
+type moduloWindow struct {
+	Rem int64
+}
+
+func (w moduloWindow) MaxTimestamp() typex.EventTime {
+	return mtime.EndOfGlobalWindowTime
+}
+
+func (w moduloWindow) Equals(o typex.Window) bool {
+	return w == o
+}
+
+func (w moduloWindow) MarshalBinary() ([]byte, error) {
+	return []byte{byte(w.Rem)}, nil
+}
+
+func (w *moduloWindow) UnmarshalBinary(b []byte) error {
+	w.Rem = int64(b[0])
+	return nil
+}
+
+// moduloWindows assigns elements to windows by the remainder of their timestamps.
+type moduloWindows struct {
+	Mod int64
+}
+
+func (fn moduloWindows) AssignWindows(ts typex.EventTime, _ any) []typex.Window {
+	return []typex.Window{moduloWindow{Rem: int64(ts) % fn.Mod}}
+}
+
+func TestMarshalWindowingStrategy_Custom(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        *window.Fn
+		wantMerge pipepb.MergeStatus_Enum
+		wantCoder string
+	}{
+		{
+			name:      "IntervalWindows",
+			fn:        window.NewCustomWindows[window.IntervalWindow](everyNWindows{N: 10}),
+			wantMerge: pipepb.MergeStatus_NON_MERGING,
+			wantCoder: "beam:coder:interval_window:v1",
+		}, {
+			name:      "CustomWindows",
+			fn:        window.NewCustomWindows[moduloWindow](moduloWindows{Mod: 3}),
+			wantMerge: pipepb.MergeStatus_NON_MERGING,
+			wantCoder: "beam:coder:custom_window:v1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ws := window.DefaultWindowingStrategy()
+			ws.Fn = test.fn
+			cm := graphx.NewCoderMarshaller()
+			got, err := graphx.MarshalWindowingStrategy(cm, ws)
+			if err != nil {
+				t.Fatalf("MarshalWindowingStrategy(%v) failed: %v", ws, err)
+			}
+			if got, want := got.GetWindowFn().GetUrn(), graphx.URNCustomWindowFn; got != want {
+				t.Errorf("WindowFn URN = %v, want %v", got, want)
+			}
+			if got := got.GetMergeStatus(); got != test.wantMerge {
+				t.Errorf("MergeStatus = %v, want %v", got, test.wantMerge)
+			}
+
+			var ref v1pb.Fn
+			if err := proto.Unmarshal(got.GetWindowFn().GetPayload(), &ref); err != nil {
+				t.Fatalf("failed to unmarshal WindowFn payload: %v", err)
+			}
+			fn, err := graphx.DecodeCustomWindowFn(&ref)
+			if err != nil {
+				t.Fatalf("DecodeCustomWindowFn() failed: %v", err)
+			}
+			if !reflect.DeepEqual(fn, test.fn.CustomFn) {
+				t.Errorf("DecodeCustomWindowFn() = %v, want %v", fn, test.fn.CustomFn)
+			}
+
+			coders := cm.Build()
+			id := got.GetWindowCoderId()
+			if got := coders[id].GetSpec().GetUrn(); got != test.wantCoder {
+				t.Errorf("window coder URN = %v, want %v", got, test.wantCoder)
+			}
+			wc, err := graphx.NewCoderUnmarshaller(coders).WindowCoder(id)
+			if err != nil {
+				t.Fatalf("WindowCoder(%v) failed: %v", id, err)
+			}
+			if want := test.fn.Coder(); !wc.Equals(want) {
+				t.Errorf("WindowCoder(%v) = %v, want %v", id, wc, want)
+			}
+		})
+	}
+}
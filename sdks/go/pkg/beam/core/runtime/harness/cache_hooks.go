@@ -23,7 +23,8 @@ import (
 )
 
 var (
-	cacheSize int = 0
+	cacheSize          int   = 0
+	userStateCacheSize int64 = 0
 )
 
 func init() {
@@ -48,4 +49,26 @@ func init() {
 		}
 	}
 	hooks.RegisterHook("beam:go:hook:sideinputcache:capacity", hf)
+
+	uhf := func(opts []string) hooks.Hook {
+		return hooks.Hook{
+			Init: func(ctx context.Context) (context.Context, error) {
+				if len(opts) == 0 {
+					return ctx, nil
+				}
+				if len(opts) > 1 {
+					return ctx, fmt.Errorf("expected 1 option, got %v: %v", len(opts), opts)
+				}
+
+				var bytes int64
+				_, err := fmt.Sscan(opts[0], &bytes)
+				if err != nil {
+					return nil, err
+				}
+				userStateCacheSize = bytes
+				return ctx, nil
+			},
+		}
+	}
+	hooks.RegisterHook("beam:go:hook:userstatecache:capacity", uhf)
 }
@@ -45,6 +45,11 @@ import (
 // URNMonitoringInfoShortID is a URN indicating support for short monitoring info IDs.
 const URNMonitoringInfoShortID = "beam:protocol:monitoring_info_short_ids:v1"
 
+// URNSortedMultimapKeys is a URN indicating the runner lists the keys of multimap user
+// state in ascending order of their encoded bytes, so ordered list state range reads
+// may stop past the end of the range.
+const URNSortedMultimapKeys = "beam:go:protocol:sorted_multimap_keys:v1"
+
 // Options for harness.Main that affect execution of the harness, such as runner capabilities.
 type Options struct {
 	RunnerCapabilities []string // URNs for what runners are able to understand over the FnAPI.
@@ -141,6 +146,10 @@ func MainWithOptions(ctx context.Context, loggingEndpoint, controlEndpoint strin
 
 	sideCache := statecache.SideInputCache{}
 	sideCache.Init(cacheSize)
+	userCache := statecache.UserStateCache{}
+	if err := userCache.Init(userStateCacheSize); err != nil {
+		log.Errorf(ctx, "user state cache disabled: %v", err)
+	}
 
 	ctrl := &control{
 		lookupDesc:           lookupDesc,
@@ -154,12 +163,13 @@ func MainWithOptions(ctx context.Context, loggingEndpoint, controlEndpoint strin
 		data:                 &DataChannelManager{},
 		state:                &StateChannelManager{},
 		cache:                &sideCache,
+		userCache:            &userCache,
 		runnerCapabilities:   rcMap,
 	}
 
 	// if the runner supports worker status api then expose SDK harness status
 	if opts.StatusEndpoint != "" {
-		statusHandler, err := newWorkerStatusHandler(ctx, opts.StatusEndpoint, ctrl.cache, func(statusInfo *strings.Builder) { ctrl.metStoreToString(statusInfo) })
+		statusHandler, err := newWorkerStatusHandler(ctx, opts.StatusEndpoint, ctrl.cache, ctrl.userCache, func(statusInfo *strings.Builder) { ctrl.metStoreToString(statusInfo) })
 		if err != nil {
 			log.Errorf(ctx, "error establishing connection to worker status API: %v", err)
 		} else {
@@ -303,6 +313,7 @@ type control struct {
 	state *StateChannelManager
 	// TODO(BEAM-11097): Cache is currently unused.
 	cache              *statecache.SideInputCache
+	userCache          *statecache.UserStateCache
 	runnerCapabilities map[string]bool
 }
 
@@ -399,9 +410,12 @@ func (c *control) handleInstruction(ctx context.Context, req *fnpb.InstructionRe
 
 		tokens := msg.GetCacheTokens()
 		c.cache.SetValidTokens(tokens...)
+		c.userCache.SetValidTokens(tokens...)
 
 		data := NewScopedDataManager(c.data, instID)
 		state := NewScopedStateReaderWithCache(c.state, instID, c.cache)
+		state.SetUserStateCache(c.userCache, statecache.UserStateToken(tokens...))
+		state.sortedKeys = c.runnerCapabilities[URNSortedMultimapKeys]
 
 		sampler := newSampler(store)
 		go sampler.start(ctx, samplePeriod)
@@ -412,8 +426,13 @@ func (c *control) handleInstruction(ctx context.Context, req *fnpb.InstructionRe
 
 		dataError := data.Close()
 		state.Close()
+		if err != nil || (dataError != io.EOF && dataError != nil) {
+			// The runner discards the failed bundle's writes, so they mustn't be cached.
+			state.InvalidateUserState()
+		}
 
 		c.cache.CompleteBundle(tokens...)
+		c.userCache.CompleteBundle(tokens...)
 
 		mons, pylds := monitoring(plan, store, c.runnerCapabilities[URNMonitoringInfoShortID])
 
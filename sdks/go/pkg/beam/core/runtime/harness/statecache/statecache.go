@@ -102,7 +102,7 @@ func (c *SideInputCache) SetValidTokens(cacheTokens ...*fnpb.ProcessBundleReques
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for _, tok := range cacheTokens {
-		// User State caching is currently not supported, so these tokens are ignored
+		// User state tokens are handled by the UserStateCache.
 		if tok.GetUserState() != nil {
 			continue
 		}
@@ -138,7 +138,7 @@ func (c *SideInputCache) CompleteBundle(cacheTokens ...*fnpb.ProcessBundleReques
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for _, tok := range cacheTokens {
-		// User State caching is currently not supported, so these tokens are ignored
+		// User state tokens are handled by the UserStateCache.
 		if tok.GetUserState() != nil {
 			continue
 		}
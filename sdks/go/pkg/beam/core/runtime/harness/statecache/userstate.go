@@ -0,0 +1,371 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statecache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
+	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
+)
+
+// UserStateKey identifies the user state of a transform for a single key and window.
+type UserStateKey struct {
+	TransformID, UserStateID string
+	Key, Window              []byte // Encoded element key and window.
+}
+
+// PartKind is the kind of a part of user state.
+type PartKind int
+
+const (
+	// Bag is the contents of bag user state.
+	Bag PartKind = iota
+	// MultimapValues is the values of a single map key of multimap user state.
+	MultimapValues
+	// MultimapKeys is the map keys of multimap user state. Clearing them clears
+	// all the values of the multimap.
+	MultimapKeys
+)
+
+// Part is a part of user state that is read or written as a unit through the State API.
+type Part struct {
+	Kind   PartKind
+	MapKey []byte // Encoded map key of MultimapValues parts.
+}
+
+type userStateCacheKey struct {
+	tok                      token
+	transformID, userStateID string
+	key, win                 string
+}
+
+// userStateEntry holds the cached parts of the user state of a single key and window.
+type userStateEntry struct {
+	ck      userStateCacheKey
+	elem    *list.Element // Position in the LRU list.
+	version int64         // Incremented by every write.
+	size    int64
+
+	bag        []byte
+	bagCached  bool
+	keys       []byte // Concatenated encoded map keys.
+	keysCached bool
+	values     map[string][]byte // Values by encoded map key.
+	cleared    bool              // Whether map keys without cached values are known to be empty.
+}
+
+// entryOverhead approximates the bytes used by an entry besides its state, so entries
+// that only track writes to uncached state are bounded too.
+const entryOverhead = 128
+
+func (e *userStateEntry) computeSize() int64 {
+	size := int64(entryOverhead + len(e.ck.transformID) + len(e.ck.userStateID) + len(e.ck.key) + len(e.ck.win))
+	size += int64(len(e.bag) + len(e.keys))
+	for mk, v := range e.values {
+		size += int64(len(mk) + len(v))
+	}
+	return size
+}
+
+// mapValues returns the cached values of a map key, and whether they're known.
+func (e *userStateEntry) mapValues(mk string) ([]byte, bool) {
+	if v, ok := e.values[mk]; ok {
+		return v, true
+	}
+	return nil, e.cleared
+}
+
+// UserStateCache caches the user state of stateful DoFns across bundles, eliminating
+// redundant reads from the runner.
+//
+// User state may only be cached when the runner provides a user state cache token with
+// a ProcessBundleRequest. Cached state is only used by bundles with the same token, since
+// the runner changes the token whenever state may have changed outside of the SDK.
+// Appends and clears made by the SDK are applied to cached state as they're written
+// through to the runner, so it stays consistent with the runner. The runner discards the
+// writes of failed bundles, so the state they wrote must be invalidated.
+//
+// The cache is bounded by the total bytes of cached state. When it's exceeded, the user
+// state of the least recently used keys and windows is evicted.
+type UserStateCache struct {
+	capacity    int64
+	size        int64
+	enabled     bool
+	mu          sync.Mutex
+	cache       map[userStateCacheKey]*userStateEntry
+	lru         *list.List     // Front is most recently used.
+	validTokens map[token]int8 // Maps tokens to active bundle counts
+	metrics     CacheMetrics
+}
+
+// Init makes the cache for up to the given number of bytes of user state. Should only be
+// called once. A capacity of 0 disables the cache. Returns an error for negative capacities.
+func (c *UserStateCache) Init(capBytes int64) error {
+	if capBytes < 0 {
+		return errors.Errorf("capacity must be a positive integer, got %v", capBytes)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if capBytes == 0 {
+		c.enabled = false
+		return nil
+	}
+	c.capacity = capBytes
+	c.size = 0
+	c.cache = make(map[userStateCacheKey]*userStateEntry)
+	c.lru = list.New()
+	c.validTokens = make(map[token]int8)
+	c.metrics = CacheMetrics{}
+	c.enabled = true
+	return nil
+}
+
+// UserStateToken returns the user state cache token of a ProcessBundleRequest, or "" if the
+// runner didn't provide one, and so user state can't be cached for the bundle.
+func UserStateToken(cacheTokens ...*fnpb.ProcessBundleRequest_CacheToken) string {
+	for _, tok := range cacheTokens {
+		if tok.GetUserState() != nil {
+			return string(tok.GetToken())
+		}
+	}
+	return ""
+}
+
+// SetValidTokens marks the user state cache token of a new ProcessBundleRequest as in use.
+// Should be called at the start of every ProcessBundleRequest.
+func (c *UserStateCache) SetValidTokens(cacheTokens ...*fnpb.ProcessBundleRequest_CacheToken) {
+	if !c.enabled {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tok := UserStateToken(cacheTokens...); tok != "" {
+		c.validTokens[token(tok)]++
+	}
+}
+
+// CompleteBundle marks the user state cache token of a ProcessBundleRequest as no longer
+// in use by it. Should be called once ProcessBundle has completed.
+func (c *UserStateCache) CompleteBundle(cacheTokens ...*fnpb.ProcessBundleRequest_CacheToken) {
+	if !c.enabled {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tok := token(UserStateToken(cacheTokens...)); tok != "" {
+		if count := c.validTokens[tok]; count <= 1 {
+			delete(c.validTokens, tok)
+		} else {
+			c.validTokens[tok] = count - 1
+		}
+	}
+}
+
+// Capacity returns the maximum number of bytes of cached user state, or 0 if the cache
+// is disabled.
+func (c *UserStateCache) Capacity() int64 {
+	if c == nil || !c.enabled {
+		return 0
+	}
+	return c.capacity
+}
+
+func makeUserStateCacheKey(tok string, k UserStateKey) userStateCacheKey {
+	return userStateCacheKey{
+		tok:         token(tok),
+		transformID: k.TransformID,
+		userStateID: k.UserStateID,
+		key:         string(k.Key),
+		win:         string(k.Window),
+	}
+}
+
+// Query returns the cached contents of the part of user state, and true, if they're
+// cached for the token. Otherwise it returns the version of the state to pass to Set
+// once the contents have been read from the runner, and false.
+func (c *UserStateCache) Query(tok string, k UserStateKey, p Part) ([]byte, int64, bool) {
+	if !c.enabled || tok == "" {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.cache[makeUserStateCacheKey(tok, k)]
+	if !ok {
+		c.metrics.Misses++
+		return nil, 0, false
+	}
+	var data []byte
+	switch p.Kind {
+	case Bag:
+		data, ok = e.bag, e.bagCached
+	case MultimapValues:
+		data, ok = e.mapValues(string(p.MapKey))
+	case MultimapKeys:
+		data, ok = e.keys, e.keysCached
+	}
+	if !ok {
+		c.metrics.Misses++
+		return nil, e.version, false
+	}
+	c.metrics.Hits++
+	c.lru.MoveToFront(e.elem)
+	return data, 0, true
+}
+
+// Set caches the contents of the part of user state read from the runner, unless the state
+// has been written since the version returned by Query, since the contents may be stale.
+func (c *UserStateCache) Set(tok string, k UserStateKey, p Part, version int64, data []byte) {
+	if !c.enabled || tok == "" || int64(len(data)) > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(makeUserStateCacheKey(tok, k))
+	if e.version != version {
+		return
+	}
+	data = append([]byte(nil), data...)
+	switch p.Kind {
+	case Bag:
+		e.bag, e.bagCached = data, true
+	case MultimapValues:
+		e.values[string(p.MapKey)] = data
+	case MultimapKeys:
+		e.keys, e.keysCached = data, true
+	}
+	c.resize(e)
+}
+
+// Append applies an append written to the runner to the cached part of user state.
+func (c *UserStateCache) Append(tok string, k UserStateKey, p Part, data []byte) {
+	if !c.enabled || tok == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(makeUserStateCacheKey(tok, k))
+	e.version++
+	switch p.Kind {
+	case Bag:
+		if e.bagCached {
+			e.bag = append(e.bag, data...)
+		}
+	case MultimapValues:
+		mk := string(p.MapKey)
+		v, known := e.mapValues(mk)
+		if known {
+			e.values[mk] = append(v, data...)
+		}
+		switch {
+		case known && len(v) > 0:
+			// The map key is already present.
+		case known && e.keysCached:
+			e.keys = append(e.keys, p.MapKey...)
+		default:
+			e.keys, e.keysCached = nil, false
+		}
+	}
+	c.resize(e)
+}
+
+// Clear applies a clear written to the runner to the cached part of user state.
+func (c *UserStateCache) Clear(tok string, k UserStateKey, p Part) {
+	if !c.enabled || tok == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(makeUserStateCacheKey(tok, k))
+	e.version++
+	switch p.Kind {
+	case Bag:
+		e.bag, e.bagCached = nil, true
+	case MultimapValues:
+		mk := string(p.MapKey)
+		if v, known := e.mapValues(mk); !known || len(v) > 0 {
+			// The map key may have been present, and the encoded keys can't be split
+			// to remove it.
+			e.keys, e.keysCached = nil, false
+		}
+		e.values[mk] = nil
+	case MultimapKeys:
+		e.keys, e.keysCached = nil, true
+		e.values = make(map[string][]byte)
+		e.cleared = true
+	}
+	c.resize(e)
+}
+
+// Invalidate evicts the cached user state of the keys and windows, such as those written
+// by a failed bundle, whose writes the runner discards.
+func (c *UserStateCache) Invalidate(tok string, ks ...UserStateKey) {
+	if c.Capacity() == 0 || tok == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range ks {
+		if e, ok := c.cache[makeUserStateCacheKey(tok, k)]; ok {
+			c.lru.Remove(e.elem)
+			delete(c.cache, e.ck)
+			c.size -= e.size
+		}
+	}
+}
+
+// entry returns the entry for the cache key, creating it if necessary, as the most
+// recently used. Must be called with the lock held.
+func (c *UserStateCache) entry(ck userStateCacheKey) *userStateEntry {
+	if e, ok := c.cache[ck]; ok {
+		c.lru.MoveToFront(e.elem)
+		return e
+	}
+	e := &userStateEntry{ck: ck, values: make(map[string][]byte)}
+	e.elem = c.lru.PushFront(e)
+	c.cache[ck] = e
+	return e
+}
+
+// resize updates the size of the cache for changes to the entry, evicting the least
+// recently used entries until it's within capacity. Must be called with the lock held.
+func (c *UserStateCache) resize(e *userStateEntry) {
+	size := e.computeSize()
+	c.size += size - e.size
+	e.size = size
+	for c.size > c.capacity {
+		c.evict(c.lru.Back().Value.(*userStateEntry))
+	}
+}
+
+func (c *UserStateCache) evict(e *userStateEntry) {
+	c.lru.Remove(e.elem)
+	delete(c.cache, e.ck)
+	c.size -= e.size
+	if c.validTokens[e.ck.tok] > 0 {
+		c.metrics.InUseEvictions++
+	} else {
+		c.metrics.Evictions++
+	}
+}
+
+// CacheMetrics returns the cache metrics for the current user state cache.
+func (c *UserStateCache) CacheMetrics() CacheMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.metrics
+}
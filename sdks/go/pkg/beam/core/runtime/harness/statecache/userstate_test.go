@@ -0,0 +1,208 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statecache
+
+import (
+	"testing"
+
+	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
+)
+
+func makeUserStateToken(tok string) *fnpb.ProcessBundleRequest_CacheToken {
+	return &fnpb.ProcessBundleRequest_CacheToken{
+		Token: []byte(tok),
+		Type: &fnpb.ProcessBundleRequest_CacheToken_UserState_{
+			UserState: &fnpb.ProcessBundleRequest_CacheToken_UserState{},
+		},
+	}
+}
+
+var (
+	testUserStateKey = UserStateKey{TransformID: "t1", UserStateID: "s1", Key: []byte("k1"), Window: []byte("w1")}
+	bagPart          = Part{Kind: Bag}
+	keysPart         = Part{Kind: MultimapKeys}
+)
+
+func valuesPart(mk string) Part {
+	return Part{Kind: MultimapValues, MapKey: []byte(mk)}
+}
+
+func newUserStateCache(t *testing.T, capBytes int64) *UserStateCache {
+	t.Helper()
+	var c UserStateCache
+	if err := c.Init(capBytes); err != nil {
+		t.Fatalf("UserStateCache.Init(%v) = %v, want nil", capBytes, err)
+	}
+	return &c
+}
+
+// checkQuery checks the cached contents of a part of user state.
+func checkQuery(t *testing.T, c *UserStateCache, tok string, p Part, want string, wantOK bool) {
+	t.Helper()
+	got, _, ok := c.Query(tok, testUserStateKey, p)
+	if ok != wantOK || string(got) != want {
+		t.Errorf("Query(%q, %+v) = %q, %v, want %q, %v", tok, p, got, ok, want, wantOK)
+	}
+}
+
+func TestUserStateCache_Init(t *testing.T) {
+	var c UserStateCache
+	if err := c.Init(-1); err == nil {
+		t.Error("UserStateCache.Init(-1) succeeded but should have failed")
+	}
+	if err := c.Init(0); err != nil {
+		t.Errorf("UserStateCache.Init(0) = %v, want nil", err)
+	}
+	if got := c.Capacity(); got != 0 {
+		t.Errorf("disabled UserStateCache.Capacity() = %v, want 0", got)
+	}
+	c.Set("tok1", testUserStateKey, bagPart, 0, []byte("a"))
+	checkQuery(t, &c, "tok1", bagPart, "", false)
+}
+
+func TestUserStateToken(t *testing.T) {
+	side := makeRequest("t1", "s1", "side")
+	if got := UserStateToken(side); got != "" {
+		t.Errorf("UserStateToken(side input token) = %q, want \"\"", got)
+	}
+	if got, want := UserStateToken(side, makeUserStateToken("tok1")), "tok1"; got != want {
+		t.Errorf("UserStateToken(side input and user state tokens) = %q, want %q", got, want)
+	}
+}
+
+func TestUserStateCache_Bag(t *testing.T) {
+	c := newUserStateCache(t, 1<<20)
+	checkQuery(t, c, "tok1", bagPart, "", false)
+	c.Set("tok1", testUserStateKey, bagPart, 0, []byte("ab"))
+	checkQuery(t, c, "tok1", bagPart, "ab", true)
+
+	// Cached state is only used with the same token.
+	checkQuery(t, c, "tok2", bagPart, "", false)
+
+	c.Append("tok1", testUserStateKey, bagPart, []byte("c"))
+	checkQuery(t, c, "tok1", bagPart, "abc", true)
+	c.Clear("tok1", testUserStateKey, bagPart)
+	checkQuery(t, c, "tok1", bagPart, "", true)
+	c.Append("tok1", testUserStateKey, bagPart, []byte("d"))
+	checkQuery(t, c, "tok1", bagPart, "d", true)
+
+	if got, want := c.CacheMetrics(), (CacheMetrics{Hits: 4, Misses: 2}); got != want {
+		t.Errorf("CacheMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUserStateCache_StaleSet(t *testing.T) {
+	c := newUserStateCache(t, 1<<20)
+	_, version, ok := c.Query("tok1", testUserStateKey, bagPart)
+	if ok {
+		t.Fatal("Query() of empty cache returned ok")
+	}
+	// Appended while the state was being read from the runner, so it may not be included.
+	c.Append("tok1", testUserStateKey, bagPart, []byte("b"))
+	c.Set("tok1", testUserStateKey, bagPart, version, []byte("a"))
+	checkQuery(t, c, "tok1", bagPart, "", false)
+
+	_, version, _ = c.Query("tok1", testUserStateKey, bagPart)
+	c.Set("tok1", testUserStateKey, bagPart, version, []byte("ab"))
+	checkQuery(t, c, "tok1", bagPart, "ab", true)
+}
+
+func TestUserStateCache_Multimap(t *testing.T) {
+	c := newUserStateCache(t, 1<<20)
+	c.Set("tok1", testUserStateKey, keysPart, 0, []byte("k1"))
+	c.Set("tok1", testUserStateKey, valuesPart("k1"), 0, []byte("v1"))
+	c.Set("tok1", testUserStateKey, valuesPart("k2"), 0, nil)
+
+	// Appending to a present key leaves the keys unchanged.
+	c.Append("tok1", testUserStateKey, valuesPart("k1"), []byte("v2"))
+	checkQuery(t, c, "tok1", valuesPart("k1"), "v1v2", true)
+	checkQuery(t, c, "tok1", keysPart, "k1", true)
+
+	// Appending to an absent key adds it.
+	c.Append("tok1", testUserStateKey, valuesPart("k2"), []byte("v3"))
+	checkQuery(t, c, "tok1", valuesPart("k2"), "v3", true)
+	checkQuery(t, c, "tok1", keysPart, "k1k2", true)
+
+	// Appending to an unknown key invalidates the keys.
+	c.Append("tok1", testUserStateKey, valuesPart("k3"), []byte("v4"))
+	checkQuery(t, c, "tok1", valuesPart("k3"), "", false)
+	checkQuery(t, c, "tok1", keysPart, "", false)
+
+	// Clearing a key's values makes them known, but invalidates the keys.
+	_, version, _ := c.Query("tok1", testUserStateKey, keysPart)
+	c.Set("tok1", testUserStateKey, keysPart, version, []byte("k1k2k3"))
+	checkQuery(t, c, "tok1", keysPart, "k1k2k3", true)
+	c.Clear("tok1", testUserStateKey, valuesPart("k1"))
+	checkQuery(t, c, "tok1", valuesPart("k1"), "", true)
+	checkQuery(t, c, "tok1", keysPart, "", false)
+
+	// Clearing the keys clears all values, including uncached ones.
+	c.Clear("tok1", testUserStateKey, keysPart)
+	checkQuery(t, c, "tok1", keysPart, "", true)
+	checkQuery(t, c, "tok1", valuesPart("k2"), "", true)
+	checkQuery(t, c, "tok1", valuesPart("k4"), "", true)
+	c.Append("tok1", testUserStateKey, valuesPart("k4"), []byte("v5"))
+	checkQuery(t, c, "tok1", valuesPart("k4"), "v5", true)
+	checkQuery(t, c, "tok1", keysPart, "k4", true)
+}
+
+func TestUserStateCache_Eviction(t *testing.T) {
+	entrySize := int64(entryOverhead + len("t1s1k1w1"))
+	c := newUserStateCache(t, 2*entrySize+10)
+	c.SetValidTokens(makeUserStateToken("tok1"))
+
+	other := testUserStateKey
+	other.Key = []byte("k2")
+	c.Set("tok1", other, bagPart, 0, []byte("01234"))
+	c.Set("tok1", testUserStateKey, bagPart, 0, []byte("56789"))
+	checkQuery(t, c, "tok1", bagPart, "56789", true)
+
+	// Exceeding the capacity evicts the least recently used key.
+	c.Append("tok1", testUserStateKey, bagPart, []byte("!"))
+	checkQuery(t, c, "tok1", bagPart, "56789!", true)
+	if _, _, ok := c.Query("tok1", other, bagPart); ok {
+		t.Errorf("Query(%+v) returned ok after it should have been evicted", other)
+	}
+	c.CompleteBundle(makeUserStateToken("tok1"))
+
+	// State larger than the cache isn't cached.
+	c.Set("tok1", other, bagPart, 0, make([]byte, 3*entrySize))
+	if _, _, ok := c.Query("tok1", other, bagPart); ok {
+		t.Errorf("Query(%+v) returned ok for state larger than the cache", other)
+	}
+	// Evicting entries of tokens not in use is recorded separately.
+	c.Set("tok1", other, bagPart, 0, make([]byte, entrySize))
+	if got, want := c.CacheMetrics(), (CacheMetrics{Hits: 2, Misses: 2, Evictions: 1, InUseEvictions: 1}); got != want {
+		t.Errorf("CacheMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUserStateCache_Invalidate(t *testing.T) {
+	c := newUserStateCache(t, 1<<20)
+	other := testUserStateKey
+	other.Key = []byte("k2")
+	c.Set("tok1", testUserStateKey, bagPart, 0, []byte("ab"))
+	c.Set("tok1", other, bagPart, 0, []byte("cd"))
+	c.Append("tok1", testUserStateKey, bagPart, []byte("e"))
+
+	c.Invalidate("tok1", testUserStateKey)
+	checkQuery(t, c, "tok1", bagPart, "", false)
+	if data, _, ok := c.Query("tok1", other, bagPart); !ok || string(data) != "cd" {
+		t.Errorf("Query(%+v) = %q, %v, want %q, true", other, data, ok, "cd")
+	}
+	// Invalidating uncached state is a no-op.
+	c.Invalidate("tok2", testUserStateKey)
+}
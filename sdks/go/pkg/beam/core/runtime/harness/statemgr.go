@@ -16,6 +16,7 @@
 package harness
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -50,6 +51,17 @@ type ScopedStateReader struct {
 	mu     sync.Mutex
 
 	cache *statecache.SideInputCache
+
+	userCache      *statecache.UserStateCache
+	userStateToken string                                 // The bundle's user state cache token, if any.
+	written        map[writtenKey]statecache.UserStateKey // User state written by the bundle.
+
+	sortedKeys bool // Whether the runner lists the keys of multimap user state in order.
+}
+
+// writtenKey is a comparable statecache.UserStateKey.
+type writtenKey struct {
+	transformID, userStateID, key, win string
 }
 
 // NewScopedStateReader returns a ScopedStateReader for the given instruction.
@@ -85,66 +97,87 @@ func (s *ScopedStateReader) OpenIterable(ctx context.Context, id exec.StreamID,
 
 // OpenBagUserStateReader opens a byte stream for reading user bag state.
 func (s *ScopedStateReader) OpenBagUserStateReader(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte) (io.ReadCloser, error) {
-	rw, err := s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
-		return newBagUserStateReader(ch, id, s.instID, userStateID, key, w)
+	return s.openCachedReader(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.Bag}, func() (io.ReadCloser, error) {
+		return s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
+			return newBagUserStateReader(ch, id, s.instID, userStateID, key, w)
+		})
 	})
-	return rw, err
 }
 
 // OpenBagUserStateAppender opens a byte stream for appending user bag state.
 func (s *ScopedStateReader) OpenBagUserStateAppender(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte) (io.Writer, error) {
-	wr, err := s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
-		return newBagUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeAppend)
+	return s.openCachedWriter(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.Bag}, writeTypeAppend, func() (io.Writer, error) {
+		return s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
+			return newBagUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeAppend)
+		})
 	})
-	return wr, err
 }
 
 // OpenBagUserStateClearer opens a byte stream for clearing user bag state.
 func (s *ScopedStateReader) OpenBagUserStateClearer(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte) (io.Writer, error) {
-	wr, err := s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
-		return newBagUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeClear)
+	return s.openCachedWriter(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.Bag}, writeTypeClear, func() (io.Writer, error) {
+		return s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
+			return newBagUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeClear)
+		})
 	})
-	return wr, err
 }
 
 // OpenMultimapUserStateReader opens a byte stream for reading user multimap state.
 func (s *ScopedStateReader) OpenMultimapUserStateReader(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte, mk []byte) (io.ReadCloser, error) {
-	rw, err := s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
-		return newMultimapUserStateReader(ch, id, s.instID, userStateID, key, w, mk)
+	return s.openCachedReader(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.MultimapValues, MapKey: mk}, func() (io.ReadCloser, error) {
+		return s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
+			return newMultimapUserStateReader(ch, id, s.instID, userStateID, key, w, mk)
+		})
 	})
-	return rw, err
 }
 
 // OpenMultimapUserStateAppender opens a byte stream for appending user multimap state.
 func (s *ScopedStateReader) OpenMultimapUserStateAppender(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte, mk []byte) (io.Writer, error) {
-	wr, err := s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
-		return newMultimapUserStateWriter(ch, id, s.instID, userStateID, key, w, mk, writeTypeAppend)
+	return s.openCachedWriter(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.MultimapValues, MapKey: mk}, writeTypeAppend, func() (io.Writer, error) {
+		return s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
+			return newMultimapUserStateWriter(ch, id, s.instID, userStateID, key, w, mk, writeTypeAppend)
+		})
 	})
-	return wr, err
 }
 
 // OpenMultimapUserStateClearer opens a byte stream for clearing user multimap state by key.
 func (s *ScopedStateReader) OpenMultimapUserStateClearer(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte, mk []byte) (io.Writer, error) {
-	wr, err := s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
-		return newMultimapUserStateWriter(ch, id, s.instID, userStateID, key, w, mk, writeTypeClear)
+	return s.openCachedWriter(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.MultimapValues, MapKey: mk}, writeTypeClear, func() (io.Writer, error) {
+		return s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
+			return newMultimapUserStateWriter(ch, id, s.instID, userStateID, key, w, mk, writeTypeClear)
+		})
 	})
-	return wr, err
 }
 
 // OpenMultimapKeysUserStateReader opens a byte stream for reading the keys of user multimap state.
+// If the runner lists the keys in order, they aren't cached, since keys appended to the cache
+// aren't in order.
 func (s *ScopedStateReader) OpenMultimapKeysUserStateReader(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte) (io.ReadCloser, error) {
-	rw, err := s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
-		return newMultimapKeysUserStateReader(ch, id, s.instID, userStateID, key, w)
+	if s.sortedKeys {
+		return s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
+			return newMultimapKeysUserStateReader(ch, id, s.instID, userStateID, key, w)
+		})
+	}
+	return s.openCachedReader(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.MultimapKeys}, func() (io.ReadCloser, error) {
+		return s.openReader(ctx, id, func(ch *StateChannel) *stateKeyReader {
+			return newMultimapKeysUserStateReader(ch, id, s.instID, userStateID, key, w)
+		})
 	})
-	return rw, err
 }
 
 // OpenMultimapKeysUserStateClearer opens a byte stream for clearing all keys of user multimap state.
 func (s *ScopedStateReader) OpenMultimapKeysUserStateClearer(ctx context.Context, id exec.StreamID, userStateID string, key []byte, w []byte) (io.Writer, error) {
-	wr, err := s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
-		return newMultimapKeysUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeClear)
+	return s.openCachedWriter(userStateKey(id, userStateID, key, w), statecache.Part{Kind: statecache.MultimapKeys}, writeTypeClear, func() (io.Writer, error) {
+		return s.openWriter(ctx, id, func(ch *StateChannel) *stateKeyWriter {
+			return newMultimapKeysUserStateWriter(ch, id, s.instID, userStateID, key, w, writeTypeClear)
+		})
 	})
-	return wr, err
+}
+
+// SortedMultimapKeys returns whether the runner lists the keys of multimap user state in
+// ascending order of their encoded bytes.
+func (s *ScopedStateReader) SortedMultimapKeys() bool {
+	return s.sortedKeys
 }
 
 // GetSideInputCache returns a pointer to the SideInputCache being used by the SDK harness.
@@ -152,6 +185,96 @@ func (s *ScopedStateReader) GetSideInputCache() exec.SideCache {
 	return s.cache
 }
 
+// SetUserStateCache sets the cache of user state, and the bundle's user state cache token,
+// which must be non-empty for user state to be cached.
+func (s *ScopedStateReader) SetUserStateCache(cache *statecache.UserStateCache, tok string) {
+	s.userCache, s.userStateToken = cache, tok
+}
+
+func userStateKey(id exec.StreamID, userStateID string, key, w []byte) statecache.UserStateKey {
+	return statecache.UserStateKey{TransformID: id.PtransformID, UserStateID: userStateID, Key: key, Window: w}
+}
+
+// openCachedReader returns a reader of the part of user state from the cache. If it isn't
+// cached, it's read from the runner, and cached unless it's larger than the cache.
+func (s *ScopedStateReader) openCachedReader(k statecache.UserStateKey, p statecache.Part, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	limit := s.userCache.Capacity()
+	if limit == 0 || s.userStateToken == "" {
+		return open()
+	}
+	data, version, ok := s.userCache.Query(s.userStateToken, k, p)
+	if ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	// Readers needn't read to EOF, such as for value state, so the part is read eagerly.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, limit+1); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		// Too large to cache, so the rest is read lazily.
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buf, r), r}, nil
+	}
+	s.userCache.Set(s.userStateToken, k, p, version, buf.Bytes())
+	return io.NopCloser(&buf), nil
+}
+
+// openCachedWriter opens a writer to the runner that applies successful writes to the
+// cached part of user state.
+func (s *ScopedStateReader) openCachedWriter(k statecache.UserStateKey, p statecache.Part, wt writeTypeEnum, open func() (io.Writer, error)) (io.Writer, error) {
+	w, err := open()
+	if err != nil || s.userCache.Capacity() == 0 || s.userStateToken == "" {
+		return w, err
+	}
+	s.mu.Lock()
+	if s.written == nil {
+		s.written = make(map[writtenKey]statecache.UserStateKey)
+	}
+	s.written[writtenKey{k.TransformID, k.UserStateID, string(k.Key), string(k.Window)}] = k
+	s.mu.Unlock()
+	return &cachingWriter{Writer: w, apply: func(data []byte) {
+		if wt == writeTypeClear {
+			s.userCache.Clear(s.userStateToken, k, p)
+		} else {
+			s.userCache.Append(s.userStateToken, k, p, data)
+		}
+	}}, nil
+}
+
+// InvalidateUserState evicts the cached user state written by the bundle. It must be
+// called when the bundle fails, since the runner discards its writes.
+func (s *ScopedStateReader) InvalidateUserState() {
+	s.mu.Lock()
+	ks := make([]statecache.UserStateKey, 0, len(s.written))
+	for _, k := range s.written {
+		ks = append(ks, k)
+	}
+	s.written = nil
+	s.mu.Unlock()
+	s.userCache.Invalidate(s.userStateToken, ks...)
+}
+
+// cachingWriter writes user state to the runner, applying successful writes to the cache.
+type cachingWriter struct {
+	io.Writer
+	apply func(data []byte)
+}
+
+func (w *cachingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if err == nil {
+		w.apply(p)
+	}
+	return n, err
+}
+
 func (s *ScopedStateReader) openReader(ctx context.Context, id exec.StreamID, readerFn func(*StateChannel) *stateKeyReader) (*stateKeyReader, error) {
 	ch, err := s.open(ctx, id.Port)
 	if err != nil {
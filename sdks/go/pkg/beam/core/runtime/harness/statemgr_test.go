@@ -26,6 +26,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/harness/statecache"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
 )
@@ -500,6 +502,116 @@ func TestStateKeyWriter(t *testing.T) {
 	}
 }
 
+func TestScopedStateReader_UserStateCache(t *testing.T) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	ch := &StateChannel{
+		id:        "test",
+		requests:  make(chan *fnpb.StateRequest),
+		responses: make(map[string]chan<- *fnpb.StateResponse),
+		cancelFn:  cancelFn,
+		DoneCh:    ctx.Done(),
+	}
+	port := exec.Port{URL: "statecache"}
+	mgr := &StateChannelManager{ports: map[string]*StateChannel{port.URL: ch}}
+
+	// Serve a single bag of user state, counting the reads.
+	var mu sync.Mutex
+	var bag []byte
+	var gets int
+	go func() {
+		for {
+			var req *fnpb.StateRequest
+			select {
+			case req = <-ch.requests:
+			case <-ctx.Done():
+				return
+			}
+			resp := &fnpb.StateResponse{Id: req.Id}
+			mu.Lock()
+			switch r := req.Request.(type) {
+			case *fnpb.StateRequest_Get:
+				gets++
+				resp.Response = &fnpb.StateResponse_Get{Get: &fnpb.StateGetResponse{Data: bag}}
+			case *fnpb.StateRequest_Append:
+				bag = append(bag, r.Append.GetData()...)
+				resp.Response = &fnpb.StateResponse_Append{Append: &fnpb.StateAppendResponse{}}
+			case *fnpb.StateRequest_Clear:
+				bag = nil
+				resp.Response = &fnpb.StateResponse_Clear{Clear: &fnpb.StateClearResponse{}}
+			}
+			mu.Unlock()
+			ch.responses[req.Id] <- resp
+		}
+	}()
+
+	var cache statecache.UserStateCache
+	if err := cache.Init(1 << 20); err != nil {
+		t.Fatalf("UserStateCache.Init() = %v", err)
+	}
+	id := exec.StreamID{Port: port, PtransformID: "t1"}
+	key, win := []byte("k1"), []byte("w1")
+	read := func(s *ScopedStateReader) string {
+		t.Helper()
+		r, err := s.OpenBagUserStateReader(ctx, id, "s1", key, win)
+		if err != nil {
+			t.Fatalf("OpenBagUserStateReader() = %v", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		}
+		return string(b)
+	}
+	check := func(s *ScopedStateReader, want string, wantGets int) {
+		t.Helper()
+		got := read(s)
+		mu.Lock()
+		defer mu.Unlock()
+		if got != want || gets != wantGets {
+			t.Errorf("read bag %q after %v reads from the runner, want %q after %v", got, gets, want, wantGets)
+		}
+	}
+
+	s := NewScopedStateReader(mgr, "inst1")
+	s.SetUserStateCache(&cache, "tok1")
+	check(s, "", 1)
+	w, err := s.OpenBagUserStateAppender(ctx, id, "s1", key, win)
+	if err != nil {
+		t.Fatalf("OpenBagUserStateAppender() = %v", err)
+	}
+	w.Write([]byte("ab"))
+	check(s, "ab", 1)
+
+	// Later bundles with the same token read from the cache.
+	s = NewScopedStateReader(mgr, "inst2")
+	s.SetUserStateCache(&cache, "tok1")
+	check(s, "ab", 1)
+	w, err = s.OpenBagUserStateClearer(ctx, id, "s1", key, win)
+	if err != nil {
+		t.Fatalf("OpenBagUserStateClearer() = %v", err)
+	}
+	w.Write([]byte{})
+	check(s, "", 1)
+
+	// The runner discards the writes of failed bundles, so retries read from the runner.
+	s.InvalidateUserState()
+	s = NewScopedStateReader(mgr, "inst2")
+	s.SetUserStateCache(&cache, "tok1")
+	check(s, "", 2)
+
+	// Bundles with a new token, or without one, read from the runner.
+	s = NewScopedStateReader(mgr, "inst3")
+	s.SetUserStateCache(&cache, "tok2")
+	check(s, "", 3)
+	s = NewScopedStateReader(mgr, "inst4")
+	check(s, "", 4)
+
+	if got, want := cache.CacheMetrics(), (statecache.CacheMetrics{Hits: 3, Misses: 3}); got != want {
+		t.Errorf("CacheMetrics() = %+v, want %+v", got, want)
+	}
+}
+
 // This likely can't be replaced by the "errors" package helpers,
 // since we serialize errors in some cases.
 func contains(got, want error) bool {
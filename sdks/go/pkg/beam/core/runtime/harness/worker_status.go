@@ -41,15 +41,16 @@ type workerStatusHandler struct {
 	shouldShutdown   int32
 	wg               sync.WaitGroup
 	cache            *statecache.SideInputCache
+	userCache        *statecache.UserStateCache
 	metStoreToString func(*strings.Builder)
 }
 
-func newWorkerStatusHandler(ctx context.Context, endpoint string, cache *statecache.SideInputCache, metStoreToString func(*strings.Builder)) (*workerStatusHandler, error) {
+func newWorkerStatusHandler(ctx context.Context, endpoint string, cache *statecache.SideInputCache, userCache *statecache.UserStateCache, metStoreToString func(*strings.Builder)) (*workerStatusHandler, error) {
 	sconn, err := dial(ctx, endpoint, "status", 60*time.Second)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to connect: %v\n", endpoint)
 	}
-	return &workerStatusHandler{conn: sconn, shouldShutdown: 0, cache: cache, metStoreToString: metStoreToString}, nil
+	return &workerStatusHandler{conn: sconn, shouldShutdown: 0, cache: cache, userCache: userCache, metStoreToString: metStoreToString}, nil
 }
 
 func (w *workerStatusHandler) isAlive() bool {
@@ -92,6 +93,9 @@ func (w *workerStatusHandler) activeProcessBundleStates(statusInfo *strings.Buil
 func (w *workerStatusHandler) cacheStats(statusInfo *strings.Builder) {
 	statusInfo.WriteString("\n============Cache Stats============\n")
 	statusInfo.WriteString(fmt.Sprintf("State Cache:\n%+v\n", w.cache.CacheMetrics()))
+	if w.userCache != nil {
+		statusInfo.WriteString(fmt.Sprintf("User State Cache:\n%+v\n", w.userCache.CacheMetrics()))
+	}
 }
 
 func goroutineDump(statusInfo *strings.Builder) {
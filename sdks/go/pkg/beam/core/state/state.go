@@ -14,12 +14,22 @@
 // limitations under the License.
 
 // Package state contains structs for reading and manipulating pipeline state.
+//
+// Ordered list state is implemented with multimap user state keyed by the
+// timestamps of its values, since the FnAPI this SDK uses has no
+// OrderedListUserState state key. Range reads page in the state's timestamps,
+// stopping past the end of the range if the runner lists them in order, and
+// page in the values of each timestamp in range as they're iterated.
 package state
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"time"
 
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
 )
 
@@ -46,6 +56,8 @@ const (
 	TypeMap TypeEnum = 3
 	// TypeSet represents a set state
 	TypeSet TypeEnum = 4
+	// TypeOrderedList represents an ordered list state
+	TypeOrderedList TypeEnum = 5
 )
 
 var (
@@ -84,6 +96,11 @@ type Provider interface {
 	WriteMapState(val Transaction) error
 	ClearMapStateKey(val Transaction) error
 	ClearMapState(val Transaction) error
+	ReadOrderedListTimestamps(userStateID string) (TimestampIterator, []Transaction, error)
+	ReadOrderedListValues(userStateID string, ts int64) (Iterator, []Transaction, error)
+	WriteOrderedListState(val Transaction) error
+	ClearOrderedListTimestamp(val Transaction) error
+	ClearOrderedListState(val Transaction) error
 }
 
 // PipelineState is an interface representing different kinds of PipelineState (currently just state.Value).
@@ -684,3 +701,284 @@ func MakeSetState[K comparable](k string) Set[K] {
 		Key: k,
 	}
 }
+
+// TimestampedValue is a value of ordered list state, along with the timestamp it is ordered by.
+type TimestampedValue[T any] struct {
+	Timestamp time.Time
+	Value     T
+}
+
+// OrderedList is used to read and write global pipeline state representing a list of values
+// ordered by timestamp. Timestamps have millisecond precision, like other Beam timestamps,
+// and values added with the same timestamp are kept in the order they were added.
+// Key represents the key used to lookup this state.
+//
+// Ordered list state is stored as multimap user state keyed by timestamp, so it is
+// supported by runners that support map state.
+type OrderedList[T any] struct {
+	Key string
+}
+
+// Add is used to add a value with the given timestamp to this instance of ordered list state.
+func (s *OrderedList[T]) Add(p Provider, ts time.Time, val T) error {
+	return p.WriteOrderedListState(Transaction{
+		Key:    s.Key,
+		Type:   TransactionTypeAppend,
+		MapKey: int64(mtime.FromTime(ts)),
+		Val:    val,
+	})
+}
+
+// Read is used to read all the values of this instance of ordered list state, in timestamp order.
+// When no values are found, returns nil and false.
+func (s *OrderedList[T]) Read(p Provider) ([]TimestampedValue[T], bool, error) {
+	it, err := s.readRange(p, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, false, err
+	}
+	var vals []TimestampedValue[T]
+	for {
+		v, ok, err := it.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			break
+		}
+		vals = append(vals, v)
+	}
+	return vals, len(vals) > 0, nil
+}
+
+// ReadRange is used to read the values of this instance of ordered list state with timestamps
+// in the range [from, to), in timestamp order. The values are read as the returned iterator
+// advances, so large ranges needn't be held in memory. If the runner lists timestamps in
+// order, those after the range aren't read.
+func (s *OrderedList[T]) ReadRange(p Provider, from, to time.Time) (*OrderedListIterator[T], error) {
+	return s.readRange(p, int64(mtime.FromTime(from)), int64(mtime.FromTime(to)))
+}
+
+// ClearRange deletes the values of this instance of ordered list state with timestamps
+// in the range [from, to).
+func (s *OrderedList[T]) ClearRange(p Provider, from, to time.Time) error {
+	timestamps, err := s.timestamps(p, int64(mtime.FromTime(from)), int64(mtime.FromTime(to)))
+	if err != nil {
+		return err
+	}
+	for _, ts := range timestamps {
+		err := p.ClearOrderedListTimestamp(Transaction{
+			Key:    s.Key,
+			Type:   TransactionTypeClear,
+			MapKey: ts,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear deletes all values from this instance of ordered list state.
+func (s *OrderedList[T]) Clear(p Provider) error {
+	return p.ClearOrderedListState(Transaction{
+		Key:  s.Key,
+		Type: TransactionTypeClear,
+	})
+}
+
+func (s *OrderedList[T]) readRange(p Provider, lo, hi int64) (*OrderedListIterator[T], error) {
+	timestamps, err := s.timestamps(p, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderedListIterator[T]{p: p, key: s.Key, timestamps: timestamps}, nil
+}
+
+// timestamps returns the sorted timestamps of this instance of ordered list state in the
+// range [lo, hi). Only the timestamps in range are retained as they're paged in.
+func (s *OrderedList[T]) timestamps(p Provider, lo, hi int64) ([]int64, error) {
+	in := func(ts int64) bool { return lo <= ts && ts < hi }
+	// This replays any writes that have happened to this state since we last read
+	// For more detail, see "State Transactionality" below for buffered transactions
+	initial, bufferedTransactions, err := p.ReadOrderedListTimestamps(s.Key)
+	if err != nil {
+		return nil, err
+	}
+	present := map[int64]bool{}
+	for {
+		ts, ok, err := initial.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if ts >= hi && initial.Sorted() {
+			// Later timestamps are also past the range, so they aren't read.
+			if err := initial.Close(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if in(ts) {
+			present[ts] = true
+		}
+	}
+	for _, t := range bufferedTransactions {
+		switch t.Type {
+		case TransactionTypeAppend:
+			present[t.MapKey.(int64)] = true
+		case TransactionTypeClear:
+			if t.MapKey == nil {
+				present = map[int64]bool{}
+			} else {
+				delete(present, t.MapKey.(int64))
+			}
+		}
+	}
+	var timestamps []int64
+	for ts := range present {
+		if in(ts) {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps, nil
+}
+
+// StateKey returns the key for this pipeline state entry.
+func (s OrderedList[T]) StateKey() string {
+	return s.Key
+}
+
+// KeyCoderType returns the type of the ordered list's timestamps, which are stored as
+// bytes that sort in timestamp order.
+func (s OrderedList[T]) KeyCoderType() reflect.Type {
+	return reflect.TypeOf([]byte(nil))
+}
+
+// CoderType returns the type of the ordered list state which should be used for a coder.
+func (s OrderedList[T]) CoderType() reflect.Type {
+	var t T
+	return reflect.TypeOf(t)
+}
+
+// StateType returns the type of the state (in this case always OrderedList).
+func (s OrderedList[T]) StateType() TypeEnum {
+	return TypeOrderedList
+}
+
+// MakeOrderedListState is a factory function to create an instance of OrderedListState with the given key.
+func MakeOrderedListState[T any](k string) OrderedList[T] {
+	return OrderedList[T]{
+		Key: k,
+	}
+}
+
+// Iterator pages in state values as they're read.
+type Iterator interface {
+	// Next returns the next value and true, or false once the values are exhausted.
+	Next() (any, bool, error)
+	// Close releases the iterator's resources, if the values aren't exhausted.
+	Close() error
+}
+
+// TimestampIterator pages in the timestamps of ordered list state as they're read.
+type TimestampIterator interface {
+	// Next returns the next timestamp and true, or false once the timestamps are exhausted.
+	Next() (int64, bool, error)
+	// Sorted returns whether the timestamps are returned in ascending order, so reads
+	// may stop once they're past the end of a range.
+	Sorted() bool
+	// Close releases the iterator's resources, if the timestamps aren't exhausted.
+	Close() error
+}
+
+// OrderedListIterator iterates over the values of ordered list state in timestamp order.
+// The values for each timestamp are paged in as the iterator reaches them, and aren't
+// retained once they're returned.
+type OrderedListIterator[T any] struct {
+	p          Provider
+	key        string
+	timestamps []int64 // Timestamps not yet read.
+	ts         int64   // Timestamp of vals.
+	vals       *timestampValues
+}
+
+// Next returns the next value of the ordered list and true, or false once the values are exhausted.
+func (it *OrderedListIterator[T]) Next() (TimestampedValue[T], bool, error) {
+	for {
+		if it.vals != nil {
+			v, ok, err := it.vals.next()
+			if err != nil {
+				return TimestampedValue[T]{}, false, err
+			}
+			if ok {
+				return TimestampedValue[T]{Timestamp: mtime.Time(it.ts).ToTime(), Value: v.(T)}, true, nil
+			}
+			it.vals = nil
+		}
+		if len(it.timestamps) == 0 {
+			return TimestampedValue[T]{}, false, nil
+		}
+		it.ts, it.timestamps = it.timestamps[0], it.timestamps[1:]
+		vals, err := it.readValues(it.ts)
+		if err != nil {
+			return TimestampedValue[T]{}, false, err
+		}
+		it.vals = vals
+	}
+}
+
+// readValues returns the values with the given timestamp, replaying any writes since they were read.
+func (it *OrderedListIterator[T]) readValues(ts int64) (*timestampValues, error) {
+	initial, bufferedTransactions, err := it.p.ReadOrderedListValues(it.key, ts)
+	if err != nil {
+		return nil, err
+	}
+	vals := &timestampValues{initial: initial}
+	for _, t := range bufferedTransactions {
+		switch t.Type {
+		case TransactionTypeAppend:
+			if t.MapKey.(int64) == ts {
+				vals.appended = append(vals.appended, t.Val)
+			}
+		case TransactionTypeClear:
+			if t.MapKey == nil || t.MapKey.(int64) == ts {
+				vals.cleared, vals.appended = true, nil
+			}
+		}
+	}
+	if vals.cleared {
+		if err := vals.initial.Close(); err != nil {
+			return nil, err
+		}
+		vals.initial = nil
+	}
+	return vals, nil
+}
+
+// timestampValues are the values of an ordered list with a timestamp, the paged
+// values read from the runner, unless they've been cleared, followed by any
+// buffered appends.
+type timestampValues struct {
+	initial  Iterator
+	cleared  bool
+	appended []any
+}
+
+func (v *timestampValues) next() (any, bool, error) {
+	if v.initial != nil {
+		val, ok, err := v.initial.Next()
+		if err != nil || ok {
+			return val, ok, err
+		}
+		v.initial = nil
+	}
+	if len(v.appended) == 0 {
+		return nil, false, nil
+	}
+	val := v.appended[0]
+	v.appended = v.appended[1:]
+	return val, true, nil
+}
@@ -17,7 +17,10 @@ package state
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/util/reflectx"
 )
@@ -30,6 +33,10 @@ type fakeProvider struct {
 	initialState      map[string]any
 	initialBagState   map[string][]any
 	initialMapState   map[string]map[string]any
+	initialListState  map[string]map[int64][]any
+	sortedTimestamps  bool                     // Whether ordered list timestamps are read in order.
+	timestampReads    []*fakeTimestampIterator // Iterators of ordered list timestamps, in the order they're read.
+	listValueReads    []*fakeIterator          // Iterators of ordered list values, in the order they're read.
 	transactions      map[string][]Transaction
 	err               map[string]error
 	createAccumForKey map[string]bool
@@ -177,6 +184,90 @@ func (s *fakeProvider) ClearMapState(val Transaction) error {
 	return nil
 }
 
+func (s *fakeProvider) ReadOrderedListTimestamps(userStateID string) (TimestampIterator, []Transaction, error) {
+	if err, ok := s.err[userStateID]; ok {
+		return nil, nil, err
+	}
+	it := &fakeTimestampIterator{sorted: s.sortedTimestamps}
+	for ts := range s.initialListState[userStateID] {
+		it.timestamps = append(it.timestamps, ts)
+	}
+	if it.sorted {
+		sort.Slice(it.timestamps, func(i, j int) bool { return it.timestamps[i] < it.timestamps[j] })
+	}
+	s.timestampReads = append(s.timestampReads, it)
+	return it, s.transactions[userStateID], nil
+}
+
+// fakeTimestampIterator iterates over timestamps, recording how many were read.
+type fakeTimestampIterator struct {
+	timestamps []int64
+	sorted     bool
+	read       int
+	closed     bool
+}
+
+func (it *fakeTimestampIterator) Next() (int64, bool, error) {
+	if it.read == len(it.timestamps) {
+		return 0, false, nil
+	}
+	it.read++
+	return it.timestamps[it.read-1], true, nil
+}
+
+func (it *fakeTimestampIterator) Sorted() bool {
+	return it.sorted
+}
+
+func (it *fakeTimestampIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+func (s *fakeProvider) ReadOrderedListValues(userStateID string, ts int64) (Iterator, []Transaction, error) {
+	if err, ok := s.err[userStateID]; ok {
+		return nil, nil, err
+	}
+	it := &fakeIterator{vals: s.initialListState[userStateID][ts]}
+	s.listValueReads = append(s.listValueReads, it)
+	return it, s.transactions[userStateID], nil
+}
+
+// fakeIterator iterates over values, recording whether it was closed.
+type fakeIterator struct {
+	vals   []any
+	closed bool
+}
+
+func (it *fakeIterator) Next() (any, bool, error) {
+	if len(it.vals) == 0 {
+		return nil, false, nil
+	}
+	v := it.vals[0]
+	it.vals = it.vals[1:]
+	return v, true, nil
+}
+
+func (it *fakeIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+func (s *fakeProvider) WriteOrderedListState(val Transaction) error {
+	s.transactions[val.Key] = append(s.transactions[val.Key], val)
+	return nil
+}
+
+func (s *fakeProvider) ClearOrderedListTimestamp(val Transaction) error {
+	s.transactions[val.Key] = append(s.transactions[val.Key], val)
+	return nil
+}
+
+func (s *fakeProvider) ClearOrderedListState(val Transaction) error {
+	s.transactions[val.Key] = []Transaction{val}
+	return nil
+}
+
 func TestValueRead(t *testing.T) {
 	is := make(map[string]any)
 	ts := make(map[string][]Transaction)
@@ -1200,3 +1291,232 @@ func TestSetClear(t *testing.T) {
 		}
 	}
 }
+
+func readOrderedList(t *testing.T, it *OrderedListIterator[string]) []TimestampedValue[string] {
+	t.Helper()
+	var vals []TimestampedValue[string]
+	for {
+		v, ok, err := it.Next()
+		if err != nil {
+			t.Fatalf("OrderedListIterator.Next() returned error %v", err)
+		}
+		if !ok {
+			return vals
+		}
+		vals = append(vals, v)
+	}
+}
+
+func equalTimestampedValues(a, b []TimestampedValue[string]) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Timestamp.Equal(b[i].Timestamp) || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOrderedListRead(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	il := make(map[string]map[int64][]any)
+	ts := make(map[string][]Transaction)
+	es := make(map[string]error)
+	il["initial"] = map[int64][]any{3: {"c"}, 1: {"a", "b"}}
+	il["basic_add"] = map[int64][]any{3: {"c"}}
+	ts["basic_add"] = []Transaction{{Key: "basic_add", Type: TransactionTypeAppend, MapKey: int64(1), Val: "a"}, {Key: "basic_add", Type: TransactionTypeAppend, MapKey: int64(3), Val: "d"}}
+	il["clear_timestamp"] = map[int64][]any{3: {"c"}, 1: {"a", "b"}}
+	ts["clear_timestamp"] = []Transaction{{Key: "clear_timestamp", Type: TransactionTypeClear, MapKey: int64(1)}}
+	il["clear_then_add"] = map[int64][]any{3: {"c"}, 1: {"a", "b"}}
+	ts["clear_then_add"] = []Transaction{{Key: "clear_then_add", Type: TransactionTypeClear}, {Key: "clear_then_add", Type: TransactionTypeAppend, MapKey: int64(2), Val: "e"}}
+	es["err"] = errFake
+
+	f := fakeProvider{
+		initialListState: il,
+		transactions:     ts,
+		err:              es,
+	}
+
+	var tests = []struct {
+		vs   OrderedList[string]
+		vals []TimestampedValue[string]
+		ok   bool
+		err  error
+	}{
+		{MakeOrderedListState[string]("no_transactions"), nil, false, nil},
+		{MakeOrderedListState[string]("initial"), []TimestampedValue[string]{{at(1), "a"}, {at(1), "b"}, {at(3), "c"}}, true, nil},
+		{MakeOrderedListState[string]("basic_add"), []TimestampedValue[string]{{at(1), "a"}, {at(3), "c"}, {at(3), "d"}}, true, nil},
+		{MakeOrderedListState[string]("clear_timestamp"), []TimestampedValue[string]{{at(3), "c"}}, true, nil},
+		{MakeOrderedListState[string]("clear_then_add"), []TimestampedValue[string]{{at(2), "e"}}, true, nil},
+		{MakeOrderedListState[string]("err"), nil, false, errFake},
+	}
+
+	for _, tt := range tests {
+		vals, ok, err := tt.vs.Read(&f)
+		if err != tt.err {
+			t.Errorf("OrderedList.Read() returned error %v for state key %v, want %v", err, tt.vs.Key, tt.err)
+		} else if ok != tt.ok {
+			t.Errorf("OrderedList.Read() returned ok %v for state key %v, want %v", ok, tt.vs.Key, tt.ok)
+		} else if !equalTimestampedValues(vals, tt.vals) {
+			t.Errorf("OrderedList.Read()=%v, want %v for state key %v", vals, tt.vals, tt.vs.Key)
+		}
+	}
+}
+
+func TestOrderedListReadRange(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	f := fakeProvider{
+		initialListState: map[string]map[int64][]any{"vs": {1: {"a"}, 2: {"b"}, 3: {"c"}, 4: {"d"}}},
+		transactions:     make(map[string][]Transaction),
+		err:              make(map[string]error),
+	}
+	vs := MakeOrderedListState[string]("vs")
+
+	var tests = []struct {
+		from, to time.Time
+		vals     []TimestampedValue[string]
+	}{
+		{at(0), at(10), []TimestampedValue[string]{{at(1), "a"}, {at(2), "b"}, {at(3), "c"}, {at(4), "d"}}},
+		{at(2), at(4), []TimestampedValue[string]{{at(2), "b"}, {at(3), "c"}}},
+		{at(4), at(2), nil},
+		{at(5), at(10), nil},
+	}
+
+	for _, tt := range tests {
+		it, err := vs.ReadRange(&f, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("OrderedList.ReadRange(%v, %v) returned error %v", tt.from, tt.to, err)
+		}
+		if vals := readOrderedList(t, it); !equalTimestampedValues(vals, tt.vals) {
+			t.Errorf("OrderedList.ReadRange(%v, %v)=%v, want %v", tt.from, tt.to, vals, tt.vals)
+		}
+	}
+}
+
+func TestOrderedListReadRange_SortedTimestamps(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	list := map[int64][]any{}
+	for ts := int64(0); ts < 1000; ts++ {
+		list[ts] = []any{fmt.Sprint(ts)}
+	}
+	for _, sorted := range []bool{true, false} {
+		f := fakeProvider{
+			initialListState: map[string]map[int64][]any{"vs": list},
+			sortedTimestamps: sorted,
+			transactions:     make(map[string][]Transaction),
+			err:              make(map[string]error),
+		}
+		vs := MakeOrderedListState[string]("vs")
+		it, err := vs.ReadRange(&f, at(10), at(12))
+		if err != nil {
+			t.Fatalf("OrderedList.ReadRange() returned error %v", err)
+		}
+		if vals := readOrderedList(t, it); !equalTimestampedValues(vals, []TimestampedValue[string]{{at(10), "10"}, {at(11), "11"}}) {
+			t.Errorf("OrderedList.ReadRange() with sorted timestamps %v = %v, want 10, 11", sorted, vals)
+		}
+		// Sorted timestamps are read until the first past the range.
+		want := 1000
+		if sorted {
+			want = 13
+		}
+		if got := f.timestampReads[0].read; got != want {
+			t.Errorf("timestamps read with sorted timestamps %v = %v, want %v", sorted, got, want)
+		}
+		if got := f.timestampReads[0].closed; got != sorted {
+			t.Errorf("timestamp iterator closed with sorted timestamps %v = %v, want %v", sorted, got, sorted)
+		}
+	}
+}
+
+func TestOrderedListIterator_PagesValues(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	f := fakeProvider{
+		initialListState: map[string]map[int64][]any{"vs": {1: {"a", "b"}, 2: {"c"}, 3: {"d"}}},
+		transactions: map[string][]Transaction{"vs": {
+			{Key: "vs", Type: TransactionTypeClear, MapKey: int64(2)},
+			{Key: "vs", Type: TransactionTypeAppend, MapKey: int64(2), Val: "e"},
+		}},
+		err: make(map[string]error),
+	}
+	vs := MakeOrderedListState[string]("vs")
+	it, err := vs.ReadRange(&f, at(0), at(10))
+	if err != nil {
+		t.Fatalf("OrderedList.ReadRange() returned error %v", err)
+	}
+	if got := len(f.listValueReads); got != 0 {
+		t.Errorf("values read for %v timestamps before iterating, want 0", got)
+	}
+	if v, ok, err := it.Next(); err != nil || !ok || v.Value != "a" {
+		t.Fatalf("OrderedListIterator.Next()=%v, %v, %v, want a, true, nil", v, ok, err)
+	}
+	if got := len(f.listValueReads); got != 1 {
+		t.Errorf("values read for %v timestamps after the first value, want 1", got)
+	}
+	// Values read of cleared timestamps are skipped and closed, leaving later appends.
+	if vals := readOrderedList(t, it); !equalTimestampedValues(vals, []TimestampedValue[string]{{at(1), "b"}, {at(2), "e"}, {at(3), "d"}}) {
+		t.Errorf("remaining values = %v, want b, e, d", vals)
+	}
+	if got := len(f.listValueReads); got != 3 {
+		t.Fatalf("values read for %v timestamps, want 3", got)
+	}
+	if !f.listValueReads[1].closed {
+		t.Error("values read of the cleared timestamp weren't closed")
+	}
+}
+
+func TestOrderedListAdd(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	f := fakeProvider{
+		transactions: make(map[string][]Transaction),
+		err:          make(map[string]error),
+	}
+	vs := MakeOrderedListState[string]("vs")
+	for _, v := range []TimestampedValue[string]{{at(5), "late"}, {at(1), "early"}, {at(5), "later"}} {
+		if err := vs.Add(&f, v.Timestamp, v.Value); err != nil {
+			t.Fatalf("OrderedList.Add(%v, %v) returned error %v", v.Timestamp, v.Value, err)
+		}
+	}
+	vals, ok, err := vs.Read(&f)
+	want := []TimestampedValue[string]{{at(1), "early"}, {at(5), "late"}, {at(5), "later"}}
+	if err != nil || !ok || !equalTimestampedValues(vals, want) {
+		t.Errorf("OrderedList.Read()=%v, %v, %v, want %v, true, nil", vals, ok, err, want)
+	}
+}
+
+func TestOrderedListClearRange(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	f := fakeProvider{
+		initialListState: map[string]map[int64][]any{"vs": {1: {"a"}, 2: {"b"}, 3: {"c"}}},
+		transactions:     make(map[string][]Transaction),
+		err:              make(map[string]error),
+	}
+	vs := MakeOrderedListState[string]("vs")
+	vs.Add(&f, at(4), "d")
+	if err := vs.ClearRange(&f, at(2), at(4)); err != nil {
+		t.Fatalf("OrderedList.ClearRange() returned error %v", err)
+	}
+	vals, _, err := vs.Read(&f)
+	want := []TimestampedValue[string]{{at(1), "a"}, {at(4), "d"}}
+	if err != nil || !equalTimestampedValues(vals, want) {
+		t.Errorf("OrderedList.Read()=%v, %v, want %v after ClearRange", vals, err, want)
+	}
+}
+
+func TestOrderedListClear(t *testing.T) {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	f := fakeProvider{
+		transactions: make(map[string][]Transaction),
+		err:          make(map[string]error),
+	}
+	vs := MakeOrderedListState[string]("vs")
+	vs.Add(&f, at(1), "a")
+	if err := vs.Clear(&f); err != nil {
+		t.Fatalf("OrderedList.Clear() returned error %v", err)
+	}
+	vals, ok, err := vs.Read(&f)
+	if err != nil || ok || len(vals) != 0 {
+		t.Errorf("OrderedList.Read()=%v, %v, %v, want nil, false, nil after Clear", vals, ok, err)
+	}
+}
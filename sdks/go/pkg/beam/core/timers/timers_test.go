@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+)
+
+type fakeProvider struct {
+	timers []TimerMap
+}
+
+func (p *fakeProvider) Set(t TimerMap) {
+	p.timers = append(p.timers, t)
+}
+
+func TestSet_HoldTimestamp(t *testing.T) {
+	fire := time.UnixMilli(5000)
+	tests := []struct {
+		name string
+		opts []timerOptions
+		want mtime.Time
+	}{
+		{"default", nil, mtime.FromTime(fire)},
+		{"output timestamp", []timerOptions{WithOutputTimestamp(time.UnixMilli(1000))}, mtime.FromMilliseconds(1000)},
+		// The Unix epoch is a valid output timestamp, not an unset one.
+		{"epoch output timestamp", []timerOptions{WithOutputTimestamp(time.UnixMilli(0))}, mtime.FromMilliseconds(0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var p fakeProvider
+			EventTime{Family: "et"}.Set(&p, fire, test.opts...)
+			ProcessingTime{Family: "pt"}.Set(&p, fire, test.opts...)
+			for _, tm := range p.timers {
+				if tm.HoldTimestamp != test.want {
+					t.Errorf("%v timer HoldTimestamp = %v, want %v", tm.Family, tm.HoldTimestamp, test.want)
+				}
+			}
+		})
+	}
+}
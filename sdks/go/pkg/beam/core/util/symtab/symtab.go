@@ -18,6 +18,7 @@ package symtab
 
 import (
 	"debug/elf"
+	"debug/gosym"
 	"debug/macho"
 	"debug/pe"
 	"fmt"
@@ -97,6 +98,11 @@ func symbolData(filename string) (map[uintptr]string, map[string]uintptr, error)
 // elfSymbolData builds function symbol maps from an ELF file.
 func elfSymbolData(ef *elf.File) (map[uintptr]string, map[string]uintptr, error) {
 	syms, err := ef.Symbols()
+	if err == elf.ErrNoSymbols {
+		// Stripped binaries, such as those built by go test, still have the
+		// Go line table.
+		return elfLineTableData(ef)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -113,6 +119,30 @@ func elfSymbolData(ef *elf.File) (map[uintptr]string, map[string]uintptr, error)
 	return addr2Sym, sym2Addr, nil
 }
 
+// elfLineTableData builds function symbol maps from the Go line table of an ELF file.
+func elfLineTableData(ef *elf.File) (map[uintptr]string, map[string]uintptr, error) {
+	pclntab, text := ef.Section(".gopclntab"), ef.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, nil, elf.ErrNoSymbols
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, nil, err
+	}
+	addr2Sym := make(map[uintptr]string)
+	sym2Addr := make(map[string]uintptr)
+	for _, fn := range table.Funcs {
+		value := uintptr(fn.Entry)
+		addr2Sym[value] = fn.Name
+		sym2Addr[fn.Name] = value
+	}
+	return addr2Sym, sym2Addr, nil
+}
+
 // machoSymbolData builds function symbol maps from a Mach-O file.
 func machoSymbolData(mf *macho.File) (map[uintptr]string, map[string]uintptr, error) {
 	addr2Sym := make(map[uintptr]string)
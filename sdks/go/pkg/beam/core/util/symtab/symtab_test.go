@@ -118,3 +118,32 @@ func TestSym2Addr(t *testing.T) {
 		}
 	}
 }
+
+// TestSym2Addr_StrippedELF checks that functions are found in ELF binaries linked without
+// a symbol table, such as go test binaries, from the Go line table.
+func TestSym2Addr_StrippedELF(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("ELF binaries aren't built on %v", runtime.GOOS)
+	}
+	dir := t.TempDir()
+	fname, bin := filepath.Join(dir, "main.go"), filepath.Join(dir, "main")
+	if err := os.WriteFile(fname, []byte(testprog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gotool := filepath.Join(runtime.GOROOT(), "bin", "go")
+	for _, arg := range []string{"-buildmode=exe", "-buildmode=pie"} {
+		args := []string{gotool, "build", "-o", bin, arg, "-ldflags=-s -w", fname}
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Logf("%s", out)
+			t.Errorf("%v failed: %v", args, err)
+			continue
+		}
+		if _, _, err := symbolData(bin); err != nil {
+			t.Errorf("symbolData() of binary built with %v = %v, want nil", args, err)
+		}
+		if out, err := exec.Command(bin).CombinedOutput(); err != nil {
+			t.Logf("%s", out)
+			t.Errorf("test program built with %v failed: %v", args, err)
+		}
+	}
+}
@@ -15,7 +15,8 @@
 
 // Package pubsubio provides access to Pub/Sub on Dataflow streaming.
 //
-// This implementation only functions on the Dataflow runner.
+// This implementation only functions on the Dataflow runner, and on the Prism
+// runner, which emulates Pub/Sub in process for local testing.
 //
 // See https://cloud.google.com/dataflow/docs/concepts/streaming-with-cloud-pubsub
 // for details on using Pub/Sub with Dataflow.
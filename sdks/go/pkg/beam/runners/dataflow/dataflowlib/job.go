@@ -153,6 +153,9 @@ func Translate(ctx context.Context, p *pipepb.Pipeline, opts *JobOptions, worker
 	if err := validateWorkerSettings(ctx, opts); err != nil {
 		return nil, err
 	}
+	if err := validateWindowFns(p); err != nil {
+		return nil, err
+	}
 
 	job := &df.Job{
 		ProjectId: opts.Project,
@@ -380,6 +383,17 @@ func printOptions(opts *JobOptions, images []string) []*displayData {
 	return ret
 }
 
+// validateWindowFns rejects pipelines with the Go SDK's custom WindowFns, such as
+// calendar windows, since Dataflow can't interpret them.
+func validateWindowFns(p *pipepb.Pipeline) error {
+	for id, ws := range p.GetComponents().GetWindowingStrategies() {
+		if urn := ws.GetWindowFn().GetUrn(); urn == graphx.URNCustomWindowFn {
+			return errors.Errorf("windowing strategy %v uses a custom WindowFn, which Dataflow doesn't support", id)
+		}
+	}
+	return nil
+}
+
 func validateWorkerSettings(ctx context.Context, opts *JobOptions) error {
 	if opts.Zone != "" && opts.WorkerRegion != "" {
 		return errors.New("cannot use option zone with workerRegion; prefer either workerZone or workerRegion")
@@ -167,6 +167,24 @@ func TestValidateWorkerSettings(t *testing.T) {
 	}
 }
 
+func TestValidateWindowFns(t *testing.T) {
+	pipeline := func(urn string) *pipepb.Pipeline {
+		return &pipepb.Pipeline{
+			Components: &pipepb.Components{
+				WindowingStrategies: map[string]*pipepb.WindowingStrategy{
+					"ws": {WindowFn: &pipepb.FunctionSpec{Urn: urn}},
+				},
+			},
+		}
+	}
+	if err := validateWindowFns(pipeline(graphx.URNFixedWindowsWindowFn)); err != nil {
+		t.Errorf("validateWindowFns() with fixed windows = %v, want nil", err)
+	}
+	if err := validateWindowFns(pipeline(graphx.URNCustomWindowFn)); err == nil {
+		t.Error("validateWindowFns() with a custom WindowFn succeeded, want error")
+	}
+}
+
 func TestCurrentStateMessage(t *testing.T) {
 	tests := []struct {
 		state   string
@@ -0,0 +1,218 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
+	"golang.org/x/exp/maps"
+	"google.golang.org/protobuf/proto"
+)
+
+// Pipeline options that configure checkpointing jobs, and resuming them.
+const (
+	// optCheckpointDir is the directory snapshots of the job's progress are written under,
+	// in a subdirectory named for the job ID. Jobs aren't checkpointed if unset.
+	optCheckpointDir = "checkpoint_dir"
+	// optCheckpointInterval is how often snapshots are taken, as a Go duration string.
+	optCheckpointInterval = "checkpoint_interval"
+	// optResumeJob is the ID of an earlier job of the same pipeline, whose latest
+	// snapshot under the checkpoint_dir the job resumes from.
+	optResumeJob = "resume_job"
+)
+
+const defaultCheckpointInterval = time.Minute
+
+// checkpointFile is the name of the latest snapshot in a job's checkpoint directory.
+const checkpointFile = "checkpoint"
+
+// checkpointConfig configures checkpointing for a job.
+type checkpointConfig struct {
+	Dir       string        // Snapshots are written under this directory. Empty disables checkpointing.
+	Interval  time.Duration // How often snapshots are taken.
+	ResumeJob string        // Job ID to resume from. Empty starts the job from the beginning.
+}
+
+// jobCheckpointConfig returns the checkpointing configured by the job's pipeline options.
+func jobCheckpointConfig(j *jobservices.Job) (checkpointConfig, error) {
+	opts := j.PipelineOptions()
+	c := checkpointConfig{Interval: defaultCheckpointInterval}
+	c.Dir, _ = jobOption(opts, optCheckpointDir)
+	c.ResumeJob, _ = jobOption(opts, optResumeJob)
+	if v, ok := jobOption(opts, optCheckpointInterval); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid %v pipeline option %q: must be a positive duration", optCheckpointInterval, v)
+		}
+		c.Interval = d
+	}
+	if c.ResumeJob != "" && c.Dir == "" {
+		return c, fmt.Errorf("the %v pipeline option requires the %v pipeline option", optResumeJob, optCheckpointDir)
+	}
+	return c, nil
+}
+
+// jobCheckpoint is the content of a checkpoint file.
+type jobCheckpoint struct {
+	JobID, JobName string
+	Time           time.Time
+	Fingerprint    string // Identifies the pipeline, so only the same pipeline may resume.
+
+	Stages        *engine.Snapshot
+	SideInputData map[string][][]byte // Committed output, keyed by PCollection ID, for side inputs.
+}
+
+// pipelineFingerprint identifies the pipeline's transforms, PCollections, coders, and windowing
+// strategies. Environments are excluded, since they may vary between submissions of a
+// pipeline, such as with the endpoints of loopback workers.
+func pipelineFingerprint(p *pipepb.Pipeline) (string, error) {
+	comps := p.GetComponents()
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pipepb.Components{
+		Transforms:          comps.GetTransforms(),
+		Pcollections:        comps.GetPcollections(),
+		WindowingStrategies: comps.GetWindowingStrategies(),
+		Coders:              comps.GetCoders(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to fingerprint pipeline: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeCheckpoint replaces the job's latest checkpoint in the directory.
+// The checkpoint is written to a temporary file first, so the latest checkpoint
+// is never partially written.
+func writeCheckpoint(dir string, cp *jobCheckpoint) error {
+	jobDir := filepath.Join(dir, cp.JobID)
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create checkpoint directory: %w", err)
+	}
+	f, err := os.CreateTemp(jobDir, checkpointFile+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+	if err := gob.NewEncoder(f).Encode(cp); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(jobDir, checkpointFile)); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// readCheckpoint reads the latest checkpoint of the job from the directory.
+func readCheckpoint(dir, jobID string) (*jobCheckpoint, error) {
+	f, err := os.Open(filepath.Join(dir, jobID, checkpointFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint of job %v: %w", jobID, err)
+	}
+	defer f.Close()
+	var cp jobCheckpoint
+	if err := gob.NewDecoder(f).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint of job %v: %w", jobID, err)
+	}
+	return &cp, nil
+}
+
+// uncheckpointableWindows describes the windows of the pipeline's PCollections that
+// snapshots can't encode, or returns the empty string if snapshots can encode them all.
+// Snapshots only encode global and interval windows.
+func uncheckpointableWindows(comps *pipepb.Components) string {
+	ids := maps.Keys(comps.GetPcollections())
+	sort.Strings(ids)
+	for _, id := range ids {
+		ws := comps.GetWindowingStrategies()[comps.GetPcollections()[id].GetWindowingStrategyId()]
+		switch urn := comps.GetCoders()[ws.GetWindowCoderId()].GetSpec().GetUrn(); urn {
+		case urns.CoderGlobalWindow, urns.CoderIntervalWindow:
+		default:
+			return fmt.Sprintf("windows encoded by %v, in PCollection %v", urn, id)
+		}
+	}
+	return ""
+}
+
+// configureCheckpoints resumes the job from the checkpoint of an earlier job if configured,
+// and has the ElementManager checkpoint the job's progress periodically.
+//
+// Must be called after the job's stages are added to the ElementManager, and before
+// bundles are produced. Pipelines which can't be resumed describe why with unresumable,
+// such as "a TestStream". Pipelines with windows that snapshots can't encode aren't
+// checkpointed, and the job is sent a message saying why.
+func configureCheckpoints(j *jobservices.Job, em *engine.ElementManager, ds *worker.DataService, c checkpointConfig, unresumable string) error {
+	if w := uncheckpointableWindows(j.Pipeline.GetComponents()); w != "" {
+		if c.ResumeJob != "" {
+			return fmt.Errorf("unable to resume job %v: pipelines with %v can't be checkpointed", c.ResumeJob, w)
+		}
+		j.SendMsg(fmt.Sprintf("checkpoints disabled: pipelines with %v can't be checkpointed, since only global and interval windows are supported", w))
+		return nil
+	}
+	fingerprint, err := pipelineFingerprint(j.Pipeline)
+	if err != nil {
+		return err
+	}
+	if c.ResumeJob != "" {
+		if unresumable != "" {
+			return fmt.Errorf("unable to resume job %v: pipelines with %v can't be resumed", c.ResumeJob, unresumable)
+		}
+		cp, err := readCheckpoint(c.Dir, c.ResumeJob)
+		if err != nil {
+			return err
+		}
+		if cp.Fingerprint != fingerprint {
+			return fmt.Errorf("unable to resume job %v: its checkpoint is of a different pipeline", c.ResumeJob)
+		}
+		if err := em.Restore(cp.Stages); err != nil {
+			return fmt.Errorf("unable to resume job %v: %w", c.ResumeJob, err)
+		}
+		ds.Commit(engine.TentativeData{Raw: cp.SideInputData})
+		j.SendMsg(fmt.Sprintf("resumed from the checkpoint of job %v at %v", c.ResumeJob, cp.Time.Format(time.RFC3339)))
+	}
+	em.Checkpoint(c.Interval, func(snap *engine.Snapshot) error {
+		data, err := ds.Snapshot()
+		if err != nil {
+			return err
+		}
+		return writeCheckpoint(c.Dir, &jobCheckpoint{
+			JobID:         j.JobKey(),
+			JobName:       j.String(),
+			Time:          time.Now(),
+			Fingerprint:   fingerprint,
+			Stages:        snap,
+			SideInputData: data,
+		})
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+)
+
+func TestUncheckpointableWindows(t *testing.T) {
+	comps := func(windowCoderURN string) *pipepb.Components {
+		return &pipepb.Components{
+			Pcollections: map[string]*pipepb.PCollection{
+				"global": {WindowingStrategyId: "global"},
+				"other":  {WindowingStrategyId: "other"},
+			},
+			WindowingStrategies: map[string]*pipepb.WindowingStrategy{
+				"global": {WindowCoderId: "globalCoder"},
+				"other":  {WindowCoderId: "otherCoder"},
+			},
+			Coders: map[string]*pipepb.Coder{
+				"globalCoder": {Spec: &pipepb.FunctionSpec{Urn: urns.CoderGlobalWindow}},
+				"otherCoder":  {Spec: &pipepb.FunctionSpec{Urn: windowCoderURN}},
+			},
+		}
+	}
+	if got := uncheckpointableWindows(comps(urns.CoderIntervalWindow)); got != "" {
+		t.Errorf("uncheckpointableWindows(interval windows) = %q, want empty", got)
+	}
+	got := uncheckpointableWindows(comps("beam:coder:custom:v1"))
+	if !strings.Contains(got, "beam:coder:custom:v1") || !strings.Contains(got, "other") {
+		t.Errorf("uncheckpointableWindows(custom windows) = %q, want the coder and PCollection described", got)
+	}
+}
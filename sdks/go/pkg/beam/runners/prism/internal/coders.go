@@ -18,8 +18,13 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
@@ -248,3 +253,112 @@ func pullDecoderNoAlloc(c *pipepb.Coder, coders map[string]*pipepb.Coder) func(i
 		panic(fmt.Sprintf("unknown coder urn key: %v", urn))
 	}
 }
+
+// elementFormatter returns a function that decodes a single element of the given coder
+// into a readable form, for inspecting elements.
+//
+// Elements of coders the runner doesn't understand are length prefixed, so they're
+// rendered from their bytes, as text if it's printable, and as hex otherwise.
+func elementFormatter(c *pipepb.Coder, coders map[string]*pipepb.Coder) func(io.Reader) (string, error) {
+	switch c.GetSpec().GetUrn() {
+	case urns.CoderBytes:
+		return func(r io.Reader) (string, error) {
+			b, err := coder.DecodeBytes(r)
+			return fmt.Sprintf("%q", b), err
+		}
+	case urns.CoderStringUTF8:
+		return func(r io.Reader) (string, error) {
+			s, err := coder.DecodeStringUTF8(r)
+			return strconv.Quote(s), err
+		}
+	case urns.CoderVarInt:
+		return func(r io.Reader) (string, error) {
+			v, err := coder.DecodeVarInt(r)
+			return strconv.FormatInt(v, 10), err
+		}
+	case urns.CoderBool:
+		return func(r io.Reader) (string, error) {
+			v, err := coder.DecodeBool(r)
+			return strconv.FormatBool(v), err
+		}
+	case urns.CoderDouble:
+		return func(r io.Reader) (string, error) {
+			v, err := coder.DecodeDouble(r)
+			return strconv.FormatFloat(v, 'g', -1, 64), err
+		}
+	case urns.CoderLengthPrefix:
+		inner := coders[c.GetComponentCoderIds()[0]]
+		var innerFmt func(io.Reader) (string, error)
+		if isLeafCoder(inner) {
+			innerFmt = elementFormatter(inner, coders)
+		}
+		return func(r io.Reader) (string, error) {
+			b, err := coder.DecodeBytes(r)
+			if err != nil {
+				return "", err
+			}
+			if innerFmt != nil {
+				return innerFmt(bytes.NewReader(b))
+			}
+			return opaqueElement(b), nil
+		}
+	case urns.CoderKV:
+		ccids := c.GetComponentCoderIds()
+		kf := elementFormatter(coders[ccids[0]], coders)
+		vf := elementFormatter(coders[ccids[1]], coders)
+		return func(r io.Reader) (string, error) {
+			k, err := kf(r)
+			if err != nil {
+				return "", err
+			}
+			v, err := vf(r)
+			return "(" + k + ", " + v + ")", err
+		}
+	case urns.CoderIterable:
+		ef := elementFormatter(coders[c.GetComponentCoderIds()[0]], coders)
+		return func(r io.Reader) (string, error) {
+			l, err := coder.DecodeInt32(r)
+			if err != nil {
+				return "", err
+			}
+			if l < 0 {
+				return "", fmt.Errorf("iterables of unknown length are unsupported")
+			}
+			es := make([]string, 0, l)
+			for i := int32(0); i < l; i++ {
+				e, err := ef(r)
+				if err != nil {
+					return "", err
+				}
+				es = append(es, e)
+			}
+			return "[" + strings.Join(es, ", ") + "]", nil
+		}
+	case urns.CoderNullable:
+		ef := elementFormatter(coders[c.GetComponentCoderIds()[0]], coders)
+		return func(r io.Reader) (string, error) {
+			present, err := coder.DecodeBool(r)
+			if err != nil || !present {
+				return "null", err
+			}
+			return ef(r)
+		}
+	default:
+		// The element is the remainder of the reader.
+		return func(r io.Reader) (string, error) {
+			b, err := io.ReadAll(r)
+			return opaqueElement(b), err
+		}
+	}
+}
+
+// opaqueElement renders the bytes of an element with an unknown coder.
+func opaqueElement(b []byte) string {
+	printable := utf8.Valid(b) && strings.IndexFunc(string(b), func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) < 0
+	if printable {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
@@ -377,3 +377,50 @@ func Test_pullDecoder(t *testing.T) {
 		})
 	}
 }
+
+func Test_elementFormatter(t *testing.T) {
+	leaf := func(urn string) *pipepb.Coder {
+		return &pipepb.Coder{Spec: &pipepb.FunctionSpec{Urn: urn}}
+	}
+	coders := map[string]*pipepb.Coder{
+		"varint": leaf(urns.CoderVarInt),
+		"string": leaf(urns.CoderStringUTF8),
+		"custom": leaf("beam:go:coder:custom:v1"),
+		"custom_lp": {
+			Spec:              &pipepb.FunctionSpec{Urn: urns.CoderLengthPrefix},
+			ComponentCoderIds: []string{"custom"},
+		},
+	}
+	composite := func(urn string, ccids ...string) *pipepb.Coder {
+		return &pipepb.Coder{Spec: &pipepb.FunctionSpec{Urn: urn}, ComponentCoderIds: ccids}
+	}
+
+	tests := []struct {
+		name  string
+		coder *pipepb.Coder
+		input []byte
+		want  string
+	}{
+		{"bytes", leaf(urns.CoderBytes), []byte{2, 'h', 0}, `"h\x00"`},
+		{"string", coders["string"], []byte{2, 'h', 'i'}, `"hi"`},
+		{"varint", coders["varint"], []byte{255, 3}, "511"},
+		{"bool", leaf(urns.CoderBool), []byte{1}, "true"},
+		{"kv", composite(urns.CoderKV, "string", "varint"), []byte{1, 'a', 3}, `("a", 3)`},
+		{"iterable", composite(urns.CoderIterable, "varint"), []byte{0, 0, 0, 2, 1, 2}, "[1, 2]"},
+		{"nullable", composite(urns.CoderNullable, "varint"), []byte{0}, "null"},
+		{"lpText", coders["custom_lp"], []byte{7, '{', '"', 'A', '"', ':', '1', '}'}, `{"A":1}`},
+		{"lpBinary", coders["custom_lp"], []byte{2, 0, 255}, "0x00ff"},
+		{"lpKnown", composite(urns.CoderLengthPrefix, "varint"), []byte{1, 5}, "5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := elementFormatter(test.coder, coders)(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("elementFormatter(%v)(%v) error = %v", test.coder.GetSpec().GetUrn(), test.input, err)
+			}
+			if got != test.want {
+				t.Errorf("elementFormatter(%v)(%v) = %v, want %v", test.coder.GetSpec().GetUrn(), test.input, got, test.want)
+			}
+		})
+	}
+}
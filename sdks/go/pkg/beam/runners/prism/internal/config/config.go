@@ -146,6 +146,16 @@ func (v *Variant) GetCharacteristics(handler string) any {
 	return rtv.Elem().Interface()
 }
 
+// Configures returns whether this variant configures the handler's characteristics,
+// rather than relying on the defaults.
+func (v *Variant) Configures(handler string) bool {
+	if v == nil {
+		return false
+	}
+	_, ok := v.handlers[handler]
+	return ok
+}
+
 // HandlerRegistry stores known handlers and their associated metadata needed to parse
 // the YAML configuration.
 type HandlerRegistry struct {
@@ -112,6 +112,12 @@ dataflow:
 					t.Errorf("mismatch in spot check for (%v, %v) (-want, +got):\n%v", spot.v, spot.h, d)
 				}
 			}
+			if got, want := reg.GetVariant("flink").Configures("sdf"), false; got != want {
+				t.Errorf("GetVariant(flink).Configures(sdf) = %v, want %v", got, want)
+			}
+			if got, want := reg.GetVariant("dataflow").Configures("sdf"), true; got != want {
+				t.Errorf("GetVariant(dataflow).Configures(sdf) = %v, want %v", got, want)
+			}
 		})
 	}
 
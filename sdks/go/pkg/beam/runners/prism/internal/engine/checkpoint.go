@@ -0,0 +1,297 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// Snapshot is the execution progress of a job's stages, from which the job may
+// be resumed. Snapshots may be encoded with encoding/gob.
+type Snapshot struct {
+	Stages map[string]*StageSnapshot // Keyed by stage ID.
+}
+
+// StageSnapshot is the execution progress of a stage.
+//
+// Elements of in progress bundles are pending in the snapshot, so they're
+// processed again on resumption. Elements buffered in panes of triggered stages
+// are also pending, so triggers restart from their initial state.
+type StageSnapshot struct {
+	InputID   string   // The stage's parallel input, to validate the resumed pipeline.
+	OutputIDs []string // The stage's outputs, to validate the resumed pipeline.
+
+	Input, Output, EstimatedOutput mtime.Time
+	Upstream                       map[string]mtime.Time // Upstream watermarks, keyed by PCollection ID.
+
+	Pending [][]byte        // Pending elements, including residuals, in the runner's encoding.
+	Timers  [][]byte        // Set timers, including those firing in in progress bundles.
+	State   []StateSnapshot // Committed user state.
+}
+
+// StateSnapshot is the committed user state of a key and window.
+type StateSnapshot struct {
+	Link     LinkID
+	Window   []byte // In the runner's encoding.
+	Key      []byte
+	Bag      [][]byte
+	Multimap map[string][][]byte
+}
+
+// Checkpoint configures the ElementManager to take a snapshot of the job's progress
+// at the given interval, and pass it to the write function.
+//
+// Snapshots are only taken while no bundles are in progress, so they're consistent with
+// the committed output of bundles. Once a snapshot is due, new bundles aren't started until
+// those in progress complete. The write function is called before bundles resume, so it
+// may save other job data consistently with the snapshot. Failures to write are logged,
+// and don't fail the job. A failure to take a snapshot disables checkpoints for the job.
+//
+// Must be called before Bundles.
+func (em *ElementManager) Checkpoint(interval time.Duration, write func(*Snapshot) error) {
+	em.checkpointInterval = interval
+	em.checkpointWrite = write
+}
+
+// startCheckpointTicker marks a checkpoint due at each interval, until the context is done.
+func (em *ElementManager) startCheckpointTicker(ctx context.Context) {
+	if em.checkpointWrite == nil || em.checkpointInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(em.checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				em.refreshCond.L.Lock()
+				if em.checkpointWrite == nil {
+					// Checkpoints were disabled after a failed snapshot.
+					em.refreshCond.L.Unlock()
+					return
+				}
+				em.checkpointDue = true
+				em.refreshCond.Broadcast()
+				em.refreshCond.L.Unlock()
+			}
+		}
+	}()
+}
+
+// checkpoint takes and writes a snapshot of the job.
+//
+// Must be called while holding em.refreshCond.L, with no bundles in progress.
+func (em *ElementManager) checkpoint() {
+	em.checkpointDue = false
+	snap, err := em.snapshot()
+	if err != nil {
+		// Snapshots fail for data that can't be encoded, which persists for the
+		// job, so no more are attempted.
+		slog.Warn("unable to snapshot job progress, disabling checkpoints", slog.Any("error", err))
+		em.checkpointWrite = nil
+		return
+	}
+	if err := em.checkpointWrite(snap); err != nil {
+		slog.Warn("unable to write job checkpoint", slog.Any("error", err))
+	}
+}
+
+// snapshot returns the execution progress of the job's stages.
+//
+// Must be called while holding em.refreshCond.L.
+func (em *ElementManager) snapshot() (*Snapshot, error) {
+	snap := &Snapshot{Stages: map[string]*StageSnapshot{}}
+	for id, ss := range em.stages {
+		s, err := ss.snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("stage %v: %w", id, err)
+		}
+		snap.Stages[id] = s
+	}
+	return snap, nil
+}
+
+func (ss *stageState) snapshot() (*StageSnapshot, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s := &StageSnapshot{
+		InputID:         ss.inputID,
+		OutputIDs:       ss.outputIDs,
+		Input:           ss.input,
+		Output:          ss.output,
+		EstimatedOutput: ss.estimatedOutput,
+		Upstream:        map[string]mtime.Time{},
+	}
+	ss.upstreamWatermarks.Range(func(k, v any) bool {
+		s.Upstream[k.(string)] = v.(mtime.Time)
+		return true
+	})
+
+	add := func(dst *[][]byte, e element) error {
+		b, ok := encodeElement(e)
+		if !ok {
+			return fmt.Errorf("unable to snapshot element in window %v of type %T", e.window, e.window)
+		}
+		*dst = append(*dst, b)
+		return nil
+	}
+	for _, e := range ss.pending {
+		if err := add(&s.Pending, e); err != nil {
+			return nil, err
+		}
+	}
+	// Spilled elements are already encoded.
+	for _, sp := range ss.spilled {
+		records, err := ss.spill.Read(sp.seg)
+		if err != nil {
+			return nil, err
+		}
+		s.Pending = append(s.Pending, records...)
+	}
+	for _, es := range ss.inprogress {
+		for _, e := range es.es {
+			dst := &s.Pending
+			if e.IsTimer() {
+				dst = &s.Timers
+			}
+			if err := add(dst, e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, keys := range ss.panes {
+		for _, ps := range keys {
+			for _, e := range ps.buffer {
+				if err := add(&s.Pending, e); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, t := range ss.timers {
+		if err := add(&s.Timers, t); err != nil {
+			return nil, err
+		}
+	}
+	for link, winMap := range ss.state {
+		for w, keyMap := range winMap {
+			var wBuf bytes.Buffer
+			if !encodeWindow(&wBuf, w) {
+				return nil, fmt.Errorf("unable to snapshot state in window %v of type %T", w, w)
+			}
+			for key, data := range keyMap {
+				s.State = append(s.State, StateSnapshot{
+					Link:     link,
+					Window:   wBuf.Bytes(),
+					Key:      []byte(key),
+					Bag:      data.Bag,
+					Multimap: data.Multimap,
+				})
+			}
+		}
+	}
+	return s, nil
+}
+
+// Restore resumes the job from the snapshot of an earlier job with the same pipeline,
+// in place of its impulses. The stages must already be added and configured.
+func (em *ElementManager) Restore(snap *Snapshot) error {
+	if len(snap.Stages) != len(em.stages) {
+		return fmt.Errorf("snapshot has %v stages, but the pipeline has %v", len(snap.Stages), len(em.stages))
+	}
+	for id, s := range snap.Stages {
+		ss, ok := em.stages[id]
+		if !ok {
+			return fmt.Errorf("snapshot has unknown stage %v", id)
+		}
+		if s.InputID != ss.inputID || !slices.Equal(s.OutputIDs, ss.outputIDs) {
+			return fmt.Errorf("stage %v of the snapshot has input %q and outputs %v, but the pipeline has input %q and outputs %v",
+				id, s.InputID, s.OutputIDs, ss.inputID, ss.outputIDs)
+		}
+	}
+	var count int
+	for id, s := range snap.Stages {
+		n, err := em.stages[id].restore(em, s)
+		if err != nil {
+			return fmt.Errorf("stage %v: %w", id, err)
+		}
+		count += n
+		em.watermarkRefreshes.insert(id)
+	}
+	em.pendingElements.Add(count)
+	return nil
+}
+
+// restore sets the stage's progress from its snapshot, and returns the number of
+// pending elements and timers restored.
+func (ss *stageState) restore(em *ElementManager, s *StageSnapshot) (int, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.input, ss.output, ss.estimatedOutput = s.Input, s.Output, s.EstimatedOutput
+	for pcol, w := range s.Upstream {
+		ss.upstreamWatermarks.Store(pcol, w)
+	}
+	for _, b := range s.Pending {
+		e, err := decodeElement(b)
+		if err != nil {
+			return 0, fmt.Errorf("unable to restore element: %w", err)
+		}
+		ss.pending = append(ss.pending, e)
+		ss.pendingAdded(e)
+	}
+	heap.Init(&ss.pending)
+	for _, b := range s.Timers {
+		t, err := decodeElement(b)
+		if err != nil {
+			return 0, fmt.Errorf("unable to restore timer: %w", err)
+		}
+		if ss.timers == nil {
+			ss.timers = map[timerKey]element{}
+		}
+		ss.timers[timerKey{
+			transform: t.transform,
+			family:    t.family,
+			tag:       t.tag,
+			window:    t.window,
+			key:       string(t.keyBytes),
+		}] = t
+		ss.addHold(t.holdTimestamp)
+		if ss.processingTimeTimers[LinkID{Transform: t.transform, Local: t.family}] {
+			em.wakeStageAt(ss.ID, t.timestamp)
+		}
+	}
+	for _, st := range s.State {
+		w, err := decodeWindow(bytes.NewReader(st.Window))
+		if err != nil {
+			return 0, fmt.Errorf("unable to restore state window: %w", err)
+		}
+		var d TentativeData
+		d.setStateData(st.Link, w, st.Key, StateData{Bag: st.Bag, Multimap: st.Multimap})
+		ss.commitState(d)
+	}
+	ss.spillOverBudget()
+	return len(s.Pending) + len(s.Timers), nil
+}
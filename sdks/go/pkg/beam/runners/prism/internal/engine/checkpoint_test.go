@@ -0,0 +1,145 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestElementManager_SnapshotRestore(t *testing.T) {
+	newEM := func() *ElementManager {
+		em := NewElementManager(Config{})
+		em.AddStage("impulse", nil, nil, []string{"input"})
+		em.AddStage("stateful", []string{"input"}, nil, nil)
+		em.StageStateful("stateful", func(r io.Reader) []byte {
+			b, _ := io.ReadAll(r)
+			return b
+		})
+		return em
+	}
+	em := newEM()
+	ss := em.stages["stateful"]
+	em.pendingElements.Add(2)
+	ss.AddPending([]element{
+		{window: window.GlobalWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+		{window: window.GlobalWindow{}, timestamp: 2, pane: typex.NoFiringPane(), elmBytes: []byte("b")},
+	})
+	// One element is in progress, and is pending again on resumption.
+	bundIDs, ok := ss.startBundle(em, 2, 0, func() string { return "0" })
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	ss.mu.Lock()
+	ss.input, ss.output = 2, 1
+	timer := element{window: window.GlobalWindow{}, timestamp: 10, holdTimestamp: 5, pane: typex.NoFiringPane(), transform: "t", family: "f", tag: "", keyBytes: []byte("b")}
+	ss.timers = map[timerKey]element{{transform: "t", family: "f", window: window.GlobalWindow{}, key: "b"}: timer}
+	ss.addHold(timer.holdTimestamp)
+	var d TentativeData
+	d.AppendBagState(LinkID{Transform: "t", Local: "bag"}, nil, []byte("a"), []byte("state"))
+	ss.commitState(d)
+	ss.mu.Unlock()
+
+	snap, err := em.snapshot()
+	if err != nil {
+		t.Fatalf("snapshot() = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := newEM()
+	if err := resumed.Restore(&decoded); err != nil {
+		t.Fatalf("Restore() = %v", err)
+	}
+	rs := resumed.stages["stateful"]
+	if rs.input != 2 || rs.output != 1 {
+		t.Errorf("restored watermarks = %v, %v, want 2, 1", rs.input, rs.output)
+	}
+	var pending []string
+	for _, e := range rs.pending {
+		pending = append(pending, string(e.elmBytes))
+	}
+	if d := cmp.Diff([]string{"a", "b"}, pending, cmpopts.SortSlices(func(a, b string) bool { return a < b })); d != "" {
+		t.Errorf("restored pending (-want, +got):\n%v", d)
+	}
+	if d := cmp.Diff(ss.timers, rs.timers, cmp.AllowUnexported(timerKey{}, element{})); d != "" {
+		t.Errorf("restored timers (-want, +got):\n%v", d)
+	}
+	if got, want := rs.minWatermarkHold(), mtime.Time(5); got != want {
+		t.Errorf("restored minWatermarkHold() = %v, want %v", got, want)
+	}
+	if d := cmp.Diff(ss.state, rs.state); d != "" {
+		t.Errorf("restored state (-want, +got):\n%v", d)
+	}
+	if _, ok := resumed.watermarkRefreshes["stateful"]; !ok {
+		t.Error("restored stage isn't scheduled for a watermark refresh")
+	}
+
+	// Snapshots only restore to the same stages.
+	other := NewElementManager(Config{})
+	other.AddStage("impulse", nil, nil, []string{"other"})
+	other.AddStage("stateful", []string{"other"}, nil, nil)
+	if err := other.Restore(&decoded); err == nil {
+		t.Error("Restore() to a different pipeline = nil, want error")
+	}
+}
+
+// unencodableWindow is a window type that snapshots can't encode.
+type unencodableWindow struct{}
+
+func (unencodableWindow) MaxTimestamp() typex.EventTime { return mtime.EndOfGlobalWindowTime }
+func (unencodableWindow) Equals(o typex.Window) bool    { return o == unencodableWindow{} }
+
+func TestElementManager_checkpointDisabled(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("impulse", nil, nil, []string{"input"})
+	em.AddStage("stage", []string{"input"}, nil, nil)
+	em.pendingElements.Add(1)
+	em.stages["stage"].AddPending([]element{
+		{window: unencodableWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+	})
+
+	var writes int
+	em.Checkpoint(time.Minute, func(*Snapshot) error {
+		writes++
+		return nil
+	})
+	em.refreshCond.L.Lock()
+	em.checkpoint()
+	em.refreshCond.L.Unlock()
+
+	if writes != 0 {
+		t.Errorf("checkpoint() wrote %v snapshots, want 0", writes)
+	}
+	if em.checkpointWrite != nil {
+		t.Error("checkpoint() didn't disable checkpoints after a failed snapshot")
+	}
+}
@@ -0,0 +1,156 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+// The runner's own encoding of elements, for paging them out to disk, and checkpoints.
+// Unlike the windowed value encoding, it doesn't depend on the PCollection's coders,
+// and retains the runner's bookkeeping, such as extracted keys and timer fields.
+
+// Window kinds for encoded elements.
+const (
+	globalWindowKind   byte = 0
+	intervalWindowKind byte = 1
+)
+
+// encodeWindow writes the window, returning false if the kind of window can't be encoded.
+func encodeWindow(buf *bytes.Buffer, w typex.Window) bool {
+	switch w := w.(type) {
+	case window.GlobalWindow:
+		buf.WriteByte(globalWindowKind)
+	case window.IntervalWindow:
+		buf.WriteByte(intervalWindowKind)
+		binary.Write(buf, binary.BigEndian, int64(w.Start))
+		binary.Write(buf, binary.BigEndian, int64(w.End))
+	default:
+		return false
+	}
+	return true
+}
+
+func decodeWindow(r *bytes.Reader) (typex.Window, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case globalWindowKind:
+		return window.GlobalWindow{}, nil
+	case intervalWindowKind:
+		var start, end int64
+		if err := binary.Read(r, binary.BigEndian, &start); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &end); err != nil {
+			return nil, err
+		}
+		return window.IntervalWindow{Start: mtime.Time(start), End: mtime.Time(end)}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoded window kind %v", kind)
+	}
+}
+
+// encodeElement encodes an element or timer. Returns false for elements in windows
+// that can't be encoded, which must remain in memory.
+func encodeElement(e element) ([]byte, bool) {
+	var buf bytes.Buffer
+	if !encodeWindow(&buf, e.window) {
+		return nil, false
+	}
+	binary.Write(&buf, binary.BigEndian, int64(e.timestamp))
+	binary.Write(&buf, binary.BigEndian, int64(e.holdTimestamp))
+	if err := coder.EncodePane(e.pane, &buf); err != nil {
+		return nil, false
+	}
+	writeBytes(&buf, []byte(e.transform))
+	writeBytes(&buf, []byte(e.family))
+	writeBytes(&buf, []byte(e.tag))
+	writeBytes(&buf, e.elmBytes)
+	writeBytes(&buf, e.keyBytes)
+	return buf.Bytes(), true
+}
+
+// decodeElement decodes an element encoded by encodeElement.
+func decodeElement(b []byte) (element, error) {
+	r := bytes.NewReader(b)
+	var e element
+	var err error
+	if e.window, err = decodeWindow(r); err != nil {
+		return e, err
+	}
+	var ts, hold int64
+	if err := binary.Read(r, binary.BigEndian, &ts); err != nil {
+		return e, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &hold); err != nil {
+		return e, err
+	}
+	e.timestamp, e.holdTimestamp = mtime.Time(ts), mtime.Time(hold)
+	if e.pane, err = coder.DecodePane(r); err != nil {
+		return e, err
+	}
+	var transform, family, tag []byte
+	for _, f := range []*[]byte{&transform, &family, &tag, &e.elmBytes, &e.keyBytes} {
+		if *f, err = readBytes(r); err != nil {
+			return e, err
+		}
+	}
+	e.transform, e.family, e.tag = string(transform), string(family), string(tag)
+	return e, nil
+}
+
+// writeBytes writes the length prefixed bytes. Nil and empty bytes are distinguished,
+// since nil keys indicate keys haven't been extracted.
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	if b == nil {
+		buf.WriteByte(0)
+		return
+	}
+	buf.WriteByte(1)
+	var lenBuf [binary.MaxVarintLen64]byte
+	buf.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(b)))])
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	present, err := r.ReadByte()
+	if err != nil || present == 0 {
+		return nil, err
+	}
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,47 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestElementCodec(t *testing.T) {
+	tests := []element{
+		{window: window.GlobalWindow{}, timestamp: mtime.MinTimestamp, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+		{window: window.IntervalWindow{Start: 10, End: 20}, timestamp: 15, pane: typex.PaneInfo{Timing: typex.PaneLate, Index: 2, NonSpeculativeIndex: 1}, elmBytes: []byte("b"), keyBytes: []byte("k")},
+		{window: window.GlobalWindow{}, timestamp: 3, pane: typex.NoFiringPane(), elmBytes: []byte{}, keyBytes: []byte{}},
+		{window: window.GlobalWindow{}, timestamp: 7, holdTimestamp: 4, pane: typex.NoFiringPane(), transform: "t", family: "f", tag: "tag", keyBytes: []byte("k")},
+	}
+	for _, want := range tests {
+		b, ok := encodeElement(want)
+		if !ok {
+			t.Fatalf("encodeElement(%v) = false, want true", want)
+		}
+		got, err := decodeElement(b)
+		if err != nil {
+			t.Fatalf("decodeElement(%v) error = %v", want, err)
+		}
+		if d := cmp.Diff(want, got, cmp.AllowUnexported(element{})); d != "" {
+			t.Errorf("decodeElement(encodeElement(e)) (-want, +got):\n%v", d)
+		}
+	}
+}
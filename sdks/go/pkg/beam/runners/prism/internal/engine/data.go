@@ -15,10 +15,77 @@
 
 package engine
 
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"golang.org/x/exp/slog"
+)
+
+// StateData is a "union" between Bag state and MultiMap state to increase common code.
+type StateData struct {
+	Bag      [][]byte
+	Multimap map[string][][]byte
+}
+
+// LinkID represents a fully qualified input or output.
+type LinkID struct {
+	Transform, Local, Global string
+}
+
 // TentativeData is where data for in progress bundles is put
 // until the bundle executes successfully.
 type TentativeData struct {
 	Raw map[string][][]byte
+
+	// state is a map from transformID + UserStateID, to window, to userKey, to types of state.
+	state map[LinkID]map[typex.Window]map[string]StateData
+
+	// timers is a map from the transformID + TimerFamilyID, to the encoded timers set by the bundle.
+	timers map[LinkID][][]byte
+
+	spill *Spiller // The job's Spiller that written data and timers count against. May be nil.
+	bytes int64    // Bytes of data and timers counted against spill.
+}
+
+// Track counts the data and timers, including those written later, against the
+// Spiller's memory budget, until they're released.
+func (d *TentativeData) Track(s *Spiller) {
+	if s == nil {
+		return
+	}
+	d.spill = s
+	var n int64
+	for _, data := range d.Raw {
+		for _, datum := range data {
+			n += int64(len(datum))
+		}
+	}
+	for _, timers := range d.timers {
+		for _, t := range timers {
+			n += int64(len(t))
+		}
+	}
+	d.track(n - d.bytes)
+}
+
+// Release stops counting the data and timers against the Spiller's memory budget,
+// such as once they're persisted, or discarded.
+func (d *TentativeData) Release() {
+	d.track(-d.bytes)
+}
+
+func (d *TentativeData) track(delta int64) {
+	if d.spill == nil {
+		return
+	}
+	d.bytes += delta
+	d.spill.Track(delta)
 }
 
 // WriteData adds data to a given global collectionID.
@@ -27,4 +94,190 @@ func (d *TentativeData) WriteData(colID string, data []byte) {
 		d.Raw = map[string][][]byte{}
 	}
 	d.Raw[colID] = append(d.Raw[colID], data)
+	d.track(int64(len(data)))
+}
+
+// WriteTimers adds timers to the given transform and timer family.
+func (d *TentativeData) WriteTimers(transformID, familyID string, timers []byte) {
+	if d.timers == nil {
+		d.timers = map[LinkID][][]byte{}
+	}
+	link := LinkID{Transform: transformID, Local: familyID}
+	d.timers[link] = append(d.timers[link], timers)
+	d.track(int64(len(timers)))
+}
+
+// toWindow decodes the window of a user state key. Jobs only have global or interval
+// windows, since Prepare rejects other window coders.
+func (d *TentativeData) toWindow(wKey []byte) (typex.Window, error) {
+	if len(wKey) == 0 {
+		return window.GlobalWindow{}, nil
+	}
+	w, err := exec.MakeWindowDecoder(coder.NewIntervalWindow()).DecodeSingle(bytes.NewBuffer(wKey))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding user state window key %v: %w", wKey, err)
+	}
+	return w, nil
+}
+
+// stateData returns the StateData for the given link, window and user key, and whether
+// it was present. Parent maps are not created for missing entries.
+func (d *TentativeData) stateData(stateID LinkID, w typex.Window, uKey []byte) (StateData, bool) {
+	sd, ok := d.state[stateID][w][string(uKey)]
+	return sd, ok
+}
+
+// setStateData stores the given StateData, creating any parent maps as needed.
+func (d *TentativeData) setStateData(stateID LinkID, w typex.Window, uKey []byte, sd StateData) {
+	if d.state == nil {
+		d.state = map[LinkID]map[typex.Window]map[string]StateData{}
+	}
+	winMap, ok := d.state[stateID]
+	if !ok {
+		winMap = map[typex.Window]map[string]StateData{}
+		d.state[stateID] = winMap
+	}
+	kmap, ok := winMap[w]
+	if !ok {
+		kmap = map[string]StateData{}
+		winMap[w] = kmap
+	}
+	kmap[string(uKey)] = sd
+}
+
+// GetBagState retrieves available state from the tentative bundle data.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) GetBagState(stateID LinkID, wKey, uKey []byte) ([][]byte, error) {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return nil, err
+	}
+	sd, _ := d.stateData(stateID, w, uKey)
+	slog.Debug("State() Bag.Get", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("Window", w), slog.Any("Data", sd.Bag))
+	return sd.Bag, nil
+}
+
+// AppendBagState appends the incoming data to the existing tentative data bundle.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) AppendBagState(stateID LinkID, wKey, uKey, data []byte) error {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return err
+	}
+	sd, _ := d.stateData(stateID, w, uKey)
+	sd.Bag = append(sd.Bag, data)
+	d.setStateData(stateID, w, uKey, sd)
+	slog.Debug("State() Bag.Append", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("Window", w), slog.Any("NewData", data))
+	return nil
+}
+
+// ClearBagState clears any tentative data for the state. Since state data is only initialized if any exists,
+// Clear takes the approach to not create state that doesn't already exist. Existing state is zeroed
+// to allow that to be committed post bundle commpletion.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) ClearBagState(stateID LinkID, wKey, uKey []byte) error {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return err
+	}
+	sd, ok := d.stateData(stateID, w, uKey)
+	if !ok {
+		return nil
+	}
+	// Zero the current entry to clear.
+	// Delete makes it difficult to delete the persisted stage state for the key.
+	sd.Bag = nil
+	d.setStateData(stateID, w, uKey, sd)
+	slog.Debug("State() Bag.Clear", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("WindowKey", wKey))
+	return nil
+}
+
+// GetMultimapState retrieves available state from the tentative bundle data.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) GetMultimapState(stateID LinkID, wKey, uKey, mapKey []byte) ([][]byte, error) {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return nil, err
+	}
+	sd, _ := d.stateData(stateID, w, uKey)
+	data := sd.Multimap[string(mapKey)]
+	slog.Debug("State() Multimap.Get", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("Window", w), slog.Any("Data", data))
+	return data, nil
+}
+
+// AppendMultimapState appends the incoming data to the existing tentative data bundle.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) AppendMultimapState(stateID LinkID, wKey, uKey, mapKey, data []byte) error {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return err
+	}
+	sd, _ := d.stateData(stateID, w, uKey)
+	if sd.Multimap == nil {
+		sd.Multimap = map[string][][]byte{}
+	}
+	sd.Multimap[string(mapKey)] = append(sd.Multimap[string(mapKey)], data)
+	d.setStateData(stateID, w, uKey, sd)
+	slog.Debug("State() Multimap.Append", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("MapKey", mapKey), slog.Any("Window", w), slog.Any("NewData", data))
+	return nil
+}
+
+// ClearMultimapState clears any tentative data for the state. Since state data is only initialized if any exists,
+// Clear takes the approach to not create state that doesn't already exist. Existing state is zeroed
+// to allow that to be committed post bundle commpletion.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) ClearMultimapState(stateID LinkID, wKey, uKey, mapKey []byte) error {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return err
+	}
+	sd, ok := d.stateData(stateID, w, uKey)
+	if !ok {
+		return nil
+	}
+	// Zero the current entry to clear.
+	// Delete makes it difficult to delete the persisted stage state for the key.
+	delete(sd.Multimap, string(mapKey))
+	d.setStateData(stateID, w, uKey, sd)
+	slog.Debug("State() Multimap.Clear", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("MapKey", mapKey), slog.Any("Window", w))
+	return nil
+}
+
+// GetMultimapKeysState retrieves the keys of multimap state from the tentative bundle data.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) GetMultimapKeysState(stateID LinkID, wKey, uKey []byte) ([][]byte, error) {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return nil, err
+	}
+	sd, _ := d.stateData(stateID, w, uKey)
+	var keys [][]byte
+	for k := range sd.Multimap {
+		keys = append(keys, []byte(k))
+	}
+	// Keys are listed in order of their encoded bytes, as advertised to SDKs.
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	slog.Debug("State() MultimapKeys.Get", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("Window", w), slog.Any("Keys", keys))
+	return keys, nil
+}
+
+// ClearMultimapKeysState clears tentative data for all user map keys. Since state data is only initialized if any exists,
+// Clear takes the approach to not create state that doesn't already exist. Existing state is zeroed
+// to allow that to be committed post bundle commpletion.
+// The stateID has the Transform and Local fields populated, for the Transform and UserStateID respectively.
+func (d *TentativeData) ClearMultimapKeysState(stateID LinkID, wKey, uKey []byte) error {
+	w, err := d.toWindow(wKey)
+	if err != nil {
+		return err
+	}
+	sd, ok := d.stateData(stateID, w, uKey)
+	if !ok {
+		return nil
+	}
+	// Zero the current entry to clear.
+	// Delete makes it difficult to delete the persisted stage state for the key.
+	sd.Multimap = nil
+	d.setStateData(stateID, w, uKey, sd)
+	slog.Debug("State() MultimapKeys.Clear", slog.Any("StateID", stateID), slog.Any("UserKey", uKey), slog.Any("WindowKey", wKey))
+	return nil
 }
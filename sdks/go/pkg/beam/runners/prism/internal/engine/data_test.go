@@ -0,0 +1,131 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTentativeData_BagState(t *testing.T) {
+	var d TentativeData
+	link := LinkID{Transform: "t", Local: "bag"}
+	uKey := []byte("key")
+	get := func(uKey []byte) [][]byte {
+		t.Helper()
+		got, err := d.GetBagState(link, nil, uKey)
+		if err != nil {
+			t.Fatalf("GetBagState() = %v", err)
+		}
+		return got
+	}
+
+	if got := get(uKey); len(got) != 0 {
+		t.Errorf("GetBagState on empty data = %v, want empty", got)
+	}
+	d.AppendBagState(link, nil, uKey, []byte{1})
+	d.AppendBagState(link, nil, uKey, []byte{2})
+	if got, want := get(uKey), [][]byte{{1}, {2}}; !cmp.Equal(got, want) {
+		t.Errorf("GetBagState after appends = %v, want %v", got, want)
+	}
+	if got := get([]byte("otherKey")); len(got) != 0 {
+		t.Errorf("GetBagState for other key = %v, want empty", got)
+	}
+	d.ClearBagState(link, nil, uKey)
+	if got := get(uKey); len(got) != 0 {
+		t.Errorf("GetBagState after clear = %v, want empty", got)
+	}
+}
+
+func TestTentativeData_MultimapState(t *testing.T) {
+	var d TentativeData
+	link := LinkID{Transform: "t", Local: "map"}
+	uKey := []byte("key")
+	get := func(mapKey string) [][]byte {
+		t.Helper()
+		got, err := d.GetMultimapState(link, nil, uKey, []byte(mapKey))
+		if err != nil {
+			t.Fatalf("GetMultimapState() = %v", err)
+		}
+		return got
+	}
+	getKeys := func() [][]byte {
+		t.Helper()
+		keys, err := d.GetMultimapKeysState(link, nil, uKey)
+		if err != nil {
+			t.Fatalf("GetMultimapKeysState() = %v", err)
+		}
+		return keys
+	}
+
+	d.AppendMultimapState(link, nil, uKey, []byte("a"), []byte{1})
+	d.AppendMultimapState(link, nil, uKey, []byte("a"), []byte{2})
+	d.AppendMultimapState(link, nil, uKey, []byte("b"), []byte{3})
+
+	if got, want := get("a"), [][]byte{{1}, {2}}; !cmp.Equal(got, want) {
+		t.Errorf("GetMultimapState(a) = %v, want %v", got, want)
+	}
+	keys := getKeys()
+	sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+	if want := [][]byte{[]byte("a"), []byte("b")}; !cmp.Equal(keys, want) {
+		t.Errorf("GetMultimapKeysState = %v, want %v", keys, want)
+	}
+
+	d.ClearMultimapState(link, nil, uKey, []byte("a"))
+	if got := get("a"); len(got) != 0 {
+		t.Errorf("GetMultimapState(a) after clear = %v, want empty", got)
+	}
+	d.ClearMultimapKeysState(link, nil, uKey)
+	if got := getKeys(); len(got) != 0 {
+		t.Errorf("GetMultimapKeysState after clear = %v, want empty", got)
+	}
+}
+
+func TestTentativeData_BadWindow(t *testing.T) {
+	var d TentativeData
+	link := LinkID{Transform: "t", Local: "bag"}
+	wKey := []byte{1} // Too short for an interval window.
+	if _, err := d.GetBagState(link, wKey, []byte("key")); err == nil {
+		t.Error("GetBagState with a bad window key succeeded, want error")
+	}
+	if err := d.AppendMultimapState(link, wKey, []byte("key"), []byte("a"), []byte{1}); err == nil {
+		t.Error("AppendMultimapState with a bad window key succeeded, want error")
+	}
+	if err := d.ClearBagState(link, wKey, []byte("key")); err == nil {
+		t.Error("ClearBagState with a bad window key succeeded, want error")
+	}
+}
+
+func TestTentativeData_Track(t *testing.T) {
+	s := NewSpiller(t.TempDir(), 1<<20)
+	defer s.Close()
+
+	var d TentativeData
+	d.WriteData("pcol", []byte("abc"))
+	d.Track(s)
+	d.WriteData("pcol", []byte("de"))
+	d.WriteTimers("t", "family", []byte("f"))
+	if got, want := s.resident.Load(), int64(6); got != want {
+		t.Errorf("resident bytes after writes = %v, want %v", got, want)
+	}
+	d.Release()
+	d.Release()
+	if got := s.resident.Load(); got != 0 {
+		t.Errorf("resident bytes after Release() = %v, want 0", got)
+	}
+}
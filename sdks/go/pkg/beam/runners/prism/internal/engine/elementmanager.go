@@ -23,7 +23,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
@@ -33,16 +36,27 @@ import (
 )
 
 type element struct {
-	window    typex.Window
-	timestamp mtime.Time
-	pane      typex.PaneInfo
+	window        typex.Window
+	timestamp     mtime.Time
+	holdTimestamp mtime.Time // only used for Timers
+	pane          typex.PaneInfo
+
+	transform, family, tag string // only used for Timers.
 
 	elmBytes []byte
+	keyBytes []byte // Only populated for elements destined for stateful stages.
+}
+
+// IsTimer returns whether this element is a timer firing, rather than data.
+func (e *element) IsTimer() bool {
+	return e.family != ""
 }
 
 type elements struct {
 	es           []element
 	minTimestamp mtime.Time
+	holds        []mtime.Time // Watermark holds of fired panes, released when the bundle completes.
+	started      time.Time    // When the bundle was started, to measure its latency.
 }
 
 type PColInfo struct {
@@ -53,9 +67,13 @@ type PColInfo struct {
 }
 
 // ToData recodes the elements with their approprate windowed value header.
+// Timers are excluded.
 func (es elements) ToData(info PColInfo) [][]byte {
 	var ret [][]byte
 	for _, e := range es.es {
+		if e.IsTimer() {
+			continue
+		}
 		var buf bytes.Buffer
 		exec.EncodeWindowedValueHeader(info.WEnc, []typex.Window{e.window}, e.timestamp, e.pane, &buf)
 		buf.Write(e.elmBytes)
@@ -90,6 +108,120 @@ type Config struct {
 	// MaxBundleSize caps the number of elements permitted in a bundle.
 	// 0 or less means this is ignored.
 	MaxBundleSize int
+	// TargetParallelism is the number of bundles the ready elements of a stage
+	// are initially partitioned into, so they may be processed concurrently.
+	// Stateful stages are partitioned by key, retaining per key ordering.
+	// 0 or less means ready elements are processed in a single bundle.
+	TargetParallelism int
+	// PartitionMode selects how the ready elements of a stage are partitioned
+	// into bundles. The zero value is PartitionAuto.
+	PartitionMode PartitionMode
+	// SampleSize is the number of recent elements retained for each PCollection,
+	// so they may be inspected while the job runs.
+	// 0 or less means elements aren't sampled.
+	SampleSize int
+	// MemoryBudget is the estimated bytes of pending elements and side input data
+	// held in memory, beyond which they're paged out to disk until needed.
+	// 0 or less means nothing is paged out.
+	MemoryBudget int64
+	// SpillDir is the directory paged out data is written under.
+	// Empty uses the OS temporary directory.
+	SpillDir string
+}
+
+// PartitionMode selects how the ready elements of a stage are partitioned
+// into bundles. Aggregations always use a single bundle.
+type PartitionMode int
+
+const (
+	// PartitionAuto partitions the ready elements of stateful stages by key,
+	// and those of other stages evenly.
+	PartitionAuto PartitionMode = iota
+	// PartitionByKey partitions the ready elements of stages with keyed input
+	// by key, so all elements for a key are processed in the same bundle.
+	// Stages are marked as keyed with StageKeyed.
+	PartitionByKey
+	// PartitionNone processes the ready elements of a stage in a single bundle.
+	PartitionNone
+)
+
+func (m PartitionMode) String() string {
+	switch m {
+	case PartitionAuto:
+		return "auto"
+	case PartitionByKey:
+		return "key"
+	case PartitionNone:
+		return "none"
+	}
+	return fmt.Sprintf("PartitionMode(%d)", int(m))
+}
+
+// partition divides the elements into bundles for concurrent processing,
+// according to the TargetParallelism and MaxBundleSize of the configuration.
+//
+// Keyed elements are partitioned by key, so all elements for a key are in the
+// same bundle, and a bundle is only split by MaxBundleSize at key boundaries.
+// Elements retain their relative order within each bundle, and timers are kept
+// after the data elements.
+func (c Config) partition(es []element, keyed bool) [][]element {
+	n := c.TargetParallelism
+	if n < 1 {
+		n = 1
+	}
+	var parts [][]element
+	if !keyed {
+		size := (len(es) + n - 1) / n
+		if c.MaxBundleSize > 0 && size > c.MaxBundleSize {
+			size = c.MaxBundleSize
+		}
+		for len(es) > 0 {
+			end := size
+			if end > len(es) {
+				end = len(es)
+			}
+			parts = append(parts, es[:end:end])
+			es = es[end:]
+		}
+		return parts
+	}
+
+	// Group the elements by key, in order of first appearance, and
+	// deal the keys out to the partitions.
+	var keys []string
+	groups := map[string][]element{}
+	for _, e := range es {
+		k := string(e.keyBytes)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], e)
+	}
+	shards := make([][]string, n)
+	for i, k := range keys {
+		shards[i%n] = append(shards[i%n], k)
+	}
+	dataFirst := func(part []element) []element {
+		sort.SliceStable(part, func(i, j int) bool {
+			return !part[i].IsTimer() && part[j].IsTimer()
+		})
+		return part
+	}
+	for _, shard := range shards {
+		var part []element
+		for _, k := range shard {
+			g := groups[k]
+			if len(part) > 0 && c.MaxBundleSize > 0 && len(part)+len(g) > c.MaxBundleSize {
+				parts = append(parts, dataFirst(part))
+				part = nil
+			}
+			part = append(part, g...)
+		}
+		if len(part) > 0 {
+			parts = append(parts, dataFirst(part))
+		}
+	}
+	return parts
 }
 
 // ElementManager handles elements, watermarks, and related errata to determine
@@ -129,6 +261,25 @@ type ElementManager struct {
 	watermarkRefreshes set[string] // Scheduled stageID watermark refreshes
 
 	pendingElements sync.WaitGroup // pendingElements counts all unprocessed elements in a job. Jobs with no pending elements terminate successfully.
+
+	testStreamHandler *testStreamHandler // Optional test stream handler when a test stream is in the pipeline.
+	sources           set[string]        // Unfinished unbounded sources, read by the runner. Protected by refreshCond.L.
+
+	draining atomic.Bool // Whether the job is draining, so bundles should truncate unbounded work.
+
+	samplesMu sync.Mutex
+	samples   map[string]*sampleRing // Recent elements of PCollections, keyed by PCollection ID.
+
+	spill *Spiller // Pages pending elements out to disk under memory pressure. Nil if unbudgeted.
+	err   error    // Why bundles can no longer be produced for the job. Protected by refreshCond.L.
+
+	checkpointInterval time.Duration         // How often snapshots of the job's progress are taken.
+	checkpointWrite    func(*Snapshot) error // Writes snapshots. Nil if the job isn't checkpointed.
+	checkpointDue      bool                  // Whether a snapshot is due. Protected by refreshCond.L.
+
+	wakeupsMu      sync.Mutex
+	wakeups        set[*time.Timer] // Pending processing time wakeups of stages.
+	wakeupsStopped bool             // Whether the job has ended, so no more wakeups are scheduled.
 }
 
 func NewElementManager(config Config) *ElementManager {
@@ -141,14 +292,22 @@ func NewElementManager(config Config) *ElementManager {
 		watermarkRefreshes: set[string]{},
 		inprogressBundles:  set[string]{},
 		refreshCond:        sync.Cond{L: &sync.Mutex{}},
+		spill:              NewSpiller(config.SpillDir, config.MemoryBudget),
 	}
 }
 
+// Spiller returns the job's Spiller, so other buffered data for the job may share its
+// memory budget. Nil if the job has no memory budget.
+func (em *ElementManager) Spiller() *Spiller {
+	return em.spill
+}
+
 // AddStage adds a stage to this element manager, connecting it's PCollections and
 // nodes to the watermark propagation graph.
 func (em *ElementManager) AddStage(ID string, inputIDs, sides, outputIDs []string) {
 	slog.Debug("AddStage", slog.String("ID", ID), slog.Any("inputs", inputIDs), slog.Any("sides", sides), slog.Any("outputs", outputIDs))
 	ss := makeStageState(ID, inputIDs, sides, outputIDs)
+	ss.spill = em.spill
 
 	em.stages[ss.ID] = ss
 	for _, outputIDs := range ss.outputIDs {
@@ -168,6 +327,60 @@ func (em *ElementManager) StageAggregates(ID string) {
 	em.stages[ID].aggregate = true
 }
 
+// StageSessions marks the given stage as an aggregation of session windows
+// with the given gap size. Elements are only processed once their merged session
+// may no longer be extended by later elements.
+//
+// Elements that arrive after their window, before merging, has expired
+// are dropped as late.
+func (em *ElementManager) StageSessions(ID string, gapSize, allowedLateness time.Duration) {
+	ss := em.stages[ID]
+	ss.aggregate = true
+	ss.strat = sessionStrat{GapSize: gapSize}
+	ss.expires = true
+	ss.allowedLateness = allowedLateness
+}
+
+// StageStateful marks the given stage as stateful, which means elements are
+// processed by key, and per key user state is retained by the stage.
+// The keyDec extracts the encoded key bytes from the stage's input elements.
+func (em *ElementManager) StageStateful(ID string, keyDec func(io.Reader) []byte) {
+	ss := em.stages[ID]
+	ss.stateful = true
+	ss.keyDec = keyDec
+}
+
+// StageKeyed marks the given stage as having keyed input, so its ready elements
+// are partitioned by key under PartitionByKey. The keyDec extracts the encoded
+// key bytes from the stage's input elements.
+func (em *ElementManager) StageKeyed(ID string, keyDec func(io.Reader) []byte) {
+	ss := em.stages[ID]
+	ss.keyed = true
+	ss.keyDec = keyDec
+}
+
+// StageTimeSorted marks the given stage as requiring time sorted input.
+// Elements are only processed once the stage's input watermark has passed
+// them, and are provided to bundles in timestamp order, retaining per key
+// ordering for stateful stages.
+func (em *ElementManager) StageTimeSorted(ID string) {
+	em.stages[ID].timeSorted = true
+}
+
+// StageReorder has the given stage shuffle the elements ready as of each
+// watermark, with a shuffle function such as rand.Shuffle, before they're
+// partitioned into bundles. Elements are reordered both within and across the
+// bundles. Fired timers, and the input of time sorted stages, aren't reordered.
+func (em *ElementManager) StageReorder(ID string, shuffle func(n int, swap func(i, j int))) {
+	em.stages[ID].shuffle = shuffle
+}
+
+// StageProcessingTimeTimers indicates which timer families of the given stage
+// are in the processing time domain, keyed by transform and timer family.
+func (em *ElementManager) StageProcessingTimeTimers(ID string, ptTimers map[LinkID]bool) {
+	em.stages[ID].processingTimeTimers = ptTimers
+}
+
 // Impulse marks and initializes the given stage as an impulse which
 // is a root transform that starts processing.
 func (em *ElementManager) Impulse(stageID string) {
@@ -179,6 +392,7 @@ func (em *ElementManager) Impulse(stageID string) {
 		elmBytes:  []byte{0}, // Represents an encoded 0 length byte slice.
 	}}
 
+	em.sampleElements(stage.outputIDs[0], newPending)
 	consumers := em.consumers[stage.outputIDs[0]]
 	slog.Debug("Impulse", slog.String("stageID", stageID), slog.Any("outputs", stage.outputIDs), slog.Any("consumers", consumers))
 
@@ -195,21 +409,57 @@ type RunBundle struct {
 	StageID   string
 	BundleID  string
 	Watermark mtime.Time
+	Draining  bool // Whether the bundle was started while the job is draining.
 }
 
 func (rb RunBundle) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("ID", rb.BundleID),
 		slog.String("stage", rb.StageID),
-		slog.Time("watermark", rb.Watermark.ToTime()))
+		slog.Time("watermark", rb.Watermark.ToTime()),
+		slog.Bool("draining", rb.Draining))
+}
+
+// Drain puts the ElementManager into drain mode, so the job finishes its
+// work in progress without consuming new input.
+//
+// Bundles started while draining are marked, so the runner can have splittable
+// DoFns truncate their restrictions. A TestStream skips its remaining events,
+// and advances its watermarks to the end of time, and unbounded sources are
+// finished. As the roots of the pipeline complete, watermarks advance, and all
+// windows are flushed.
+func (em *ElementManager) Drain() {
+	em.refreshCond.L.Lock()
+	defer em.refreshCond.L.Unlock()
+	if em.draining.Swap(true) {
+		return
+	}
+	slog.Debug("Drain: draining pipeline")
+	em.testStreamHandler.skipRemainingEvents()
+	for sID := range em.sources {
+		em.finishSource(sID)
+	}
+	for sID := range em.stages {
+		em.watermarkRefreshes.insert(sID)
+	}
+	em.refreshCond.Broadcast()
+}
+
+// Draining returns whether the ElementManager is in drain mode.
+func (em *ElementManager) Draining() bool {
+	return em.draining.Load()
 }
 
 // Bundles is the core execution loop. It produces a sequences of bundles able to be executed.
-// The returned channel is closed when the context is canceled, or there are no pending elements
-// remaining.
+// The returned channel is closed when the context is canceled, there are no pending elements
+// remaining, or the job can't progress, as reported by Err.
 func (em *ElementManager) Bundles(ctx context.Context, nextBundID func() string) <-chan RunBundle {
 	runStageCh := make(chan RunBundle)
 	ctx, cancelFn := context.WithCancelCause(ctx)
+	go func() {
+		<-ctx.Done()
+		em.stopWakeups()
+	}()
 	go func() {
 		em.pendingElements.Wait()
 		slog.Debug("no more pending elements: terminating pipeline")
@@ -217,13 +467,15 @@ func (em *ElementManager) Bundles(ctx context.Context, nextBundID func() string)
 		// Ensure the watermark evaluation goroutine exits.
 		em.refreshCond.Broadcast()
 	}()
+	em.startCheckpointTicker(ctx)
 	// Watermark evaluation goroutine.
 	go func() {
 		defer close(runStageCh)
 		for {
 			em.refreshCond.L.Lock()
 			// If there are no watermark refreshes available, we wait until there are.
-			for len(em.watermarkRefreshes) == 0 {
+			// While a checkpoint is due, bundles aren't started until it's taken.
+			for len(em.watermarkRefreshes) == 0 || em.checkpointDue {
 				// Check to see if we must exit
 				select {
 				case <-ctx.Done():
@@ -231,41 +483,104 @@ func (em *ElementManager) Bundles(ctx context.Context, nextBundID func() string)
 					return
 				default:
 				}
+				// The next TestStream event only executes once no other work is in progress,
+				// so the pipeline follows the script deterministically.
+				if len(em.inprogressBundles) == 0 {
+					if em.checkpointDue {
+						em.checkpoint()
+						continue
+					}
+					if ev := em.testStreamHandler.NextEvent(); ev != nil {
+						ev.Execute(em)
+						continue
+					}
+				}
 				em.refreshCond.Wait() // until watermarks may have changed.
 			}
 
 			// We know there is some work we can do that may advance the watermarks,
 			// refresh them, and see which stages have advanced.
 			advanced := em.refreshWatermarks()
+			now := em.processingTimeNow()
 
 			// Check each advanced stage, to see if it's able to execute based on the watermark.
 			for stageID := range advanced {
+				if em.err != nil {
+					break
+				}
 				ss := em.stages[stageID]
-				watermark, ready := ss.bundleReady(em)
+				watermark, ready := ss.bundleReady(em, now)
 				if ready {
-					bundleID, ok := ss.startBundle(watermark, nextBundID)
+					bundleIDs, ok := ss.startBundle(em, watermark, now, nextBundID)
 					if !ok {
 						continue
 					}
-					rb := RunBundle{StageID: stageID, BundleID: bundleID, Watermark: watermark}
-
-					em.inprogressBundles.insert(rb.BundleID)
+					draining := em.draining.Load()
+					for _, bundleID := range bundleIDs {
+						em.inprogressBundles.insert(bundleID)
+					}
 					em.refreshCond.L.Unlock()
 
-					select {
-					case <-ctx.Done():
-						return
-					case runStageCh <- rb:
+					for _, bundleID := range bundleIDs {
+						rb := RunBundle{StageID: stageID, BundleID: bundleID, Watermark: watermark, Draining: draining}
+						select {
+						case <-ctx.Done():
+							return
+						case runStageCh <- rb:
+						}
 					}
 					em.refreshCond.L.Lock()
 				}
 			}
+			if em.err != nil {
+				em.refreshCond.L.Unlock()
+				return
+			}
 			em.refreshCond.L.Unlock()
 		}
 	}()
 	return runStageCh
 }
 
+// fail stops the production of bundles for the job, since it can't progress
+// correctly. The first error is kept.
+//
+// Assumes em.refreshCond.L is held.
+func (em *ElementManager) fail(err error) {
+	if em.err == nil {
+		em.err = err
+	}
+}
+
+// Err returns why the channel returned by Bundles was closed before the job
+// completed, or nil if it wasn't.
+func (em *ElementManager) Err() error {
+	em.refreshCond.L.Lock()
+	defer em.refreshCond.L.Unlock()
+	return em.err
+}
+
+// processingTimeNow returns the current processing time of the job.
+// Jobs with a TestStream use the synthetic processing time from the TestStream.
+//
+// Must be called while holding em.refreshCond.L
+func (em *ElementManager) processingTimeNow() mtime.Time {
+	if em.testStreamHandler != nil {
+		return em.testStreamHandler.processingTime
+	}
+	return mtime.Now()
+}
+
+// PCollectionWatermarks returns the current watermarks of the PCollections produced
+// by stages, keyed by PCollection ID. They're the output watermarks of the producing stages.
+func (em *ElementManager) PCollectionWatermarks() map[string]mtime.Time {
+	wms := make(map[string]mtime.Time, len(em.pcolParents))
+	for pcol, sID := range em.pcolParents {
+		wms[pcol] = em.stages[sID].OutputWatermark()
+	}
+	return wms
+}
+
 // InputForBundle returns pre-allocated data for the given bundle, encoding the elements using
 // the PCollection's coders.
 func (em *ElementManager) InputForBundle(rb RunBundle, info PColInfo) [][]byte {
@@ -276,6 +591,54 @@ func (em *ElementManager) InputForBundle(rb RunBundle, info PColInfo) [][]byte {
 	return es.ToData(info)
 }
 
+// TimersForBundle returns the encoded timers fired for the given bundle, keyed by
+// transform and timer family.
+func (em *ElementManager) TimersForBundle(rb RunBundle, info PColInfo) map[LinkID][]byte {
+	ss := em.stages[rb.StageID]
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	es := ss.inprogress[rb.BundleID]
+	return es.ToTimers(info)
+}
+
+// StateForBundle retreives relevant state for the given bundle, WRT the data in the bundle.
+//
+// Only state for keys being processed by the bundle is returned. The holding
+// slices and maps are copied, so the bundle may modify the returned state
+// tentatively, without affecting the committed state. Data and timers the bundle
+// writes count against the job's memory budget until they're released.
+func (em *ElementManager) StateForBundle(rb RunBundle) TentativeData {
+	ss := em.stages[rb.StageID]
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ret := TentativeData{spill: em.spill}
+	keys := ss.inprogressKeysByBundle[rb.BundleID]
+	for link, winMap := range ss.state {
+		for w, keyMap := range winMap {
+			for key := range keys {
+				data, ok := keyMap[key]
+				if !ok {
+					continue
+				}
+				var mm map[string][][]byte
+				if len(data.Multimap) > 0 {
+					mm = map[string][][]byte{}
+					for uk, v := range data.Multimap {
+						// Clone the "holding" slice, but refer to the existing data bytes.
+						mm[uk] = append([][]byte(nil), v...)
+					}
+				}
+				// Clone the "holding" slice, but refer to the existing data bytes.
+				ret.setStateData(link, w, []byte(key), StateData{
+					Bag:      append([][]byte(nil), data.Bag...),
+					Multimap: mm,
+				})
+			}
+		}
+	}
+	return ret
+}
+
 // reElementResiduals extracts the windowed value header from residual bytes, and explodes them
 // back out to their windows.
 func reElementResiduals(residuals [][]byte, inputInfo PColInfo, rb RunBundle) []element {
@@ -319,6 +682,7 @@ func reElementResiduals(residuals [][]byte, inputInfo PColInfo, rb RunBundle) []
 // input elements, and the committed output elements.
 func (em *ElementManager) PersistBundle(rb RunBundle, col2Coders map[string]PColInfo, d TentativeData, inputInfo PColInfo, residuals [][]byte, estimatedOWM map[string]mtime.Time) {
 	stage := em.stages[rb.StageID]
+	refreshConsumers := set[string]{}
 	for output, data := range d.Raw {
 		info := col2Coders[output]
 		var newPending []element
@@ -356,6 +720,7 @@ func (em *ElementManager) PersistBundle(rb RunBundle, col2Coders map[string]PCol
 				}
 			}
 		}
+		em.sampleElements(output, newPending)
 		consumers := em.consumers[output]
 		slog.Debug("PersistBundle: bundle has downstream consumers.", "bundle", rb, slog.Int("newPending", len(newPending)), "consumers", consumers)
 		for _, sID := range consumers {
@@ -363,6 +728,12 @@ func (em *ElementManager) PersistBundle(rb RunBundle, col2Coders map[string]PCol
 			consumer := em.stages[sID]
 			consumer.AddPending(newPending)
 		}
+		// Consumers may be able to process new elements without a watermark change.
+		if len(newPending) > 0 {
+			for _, sID := range consumers {
+				refreshConsumers.insert(sID)
+			}
+		}
 	}
 
 	// Return unprocessed to this stage's pending
@@ -376,9 +747,21 @@ func (em *ElementManager) PersistBundle(rb RunBundle, col2Coders map[string]PCol
 	// Must be done after adding the new pending elements to avoid an incorrect
 	// watermark advancement.
 	stage.mu.Lock()
+	// Set timers are pending work for the stage, so they're counted before
+	// the completed elements are removed.
+	timerDelta, procTimes := stage.commitTimers(d, inputInfo.WDec)
+	em.pendingElements.Add(timerDelta)
 	completed := stage.inprogress[rb.BundleID]
 	em.pendingElements.Add(-len(completed.es))
+	stage.releaseFiredHolds(completed)
 	delete(stage.inprogress, rb.BundleID)
+	if !completed.started.IsZero() {
+		stage.bundleLatency.observe(time.Since(completed.started))
+	}
+	// Commit any state changes for the bundle, and release the bundle's keys.
+	stage.commitState(d)
+	stage.releaseKeys(rb.BundleID)
+	stage.collectExpiredState()
 	// If there are estimated output watermarks, set the estimated
 	// output watermark for the stage.
 	if len(estimatedOWM) > 0 {
@@ -390,27 +773,100 @@ func (em *ElementManager) PersistBundle(rb RunBundle, col2Coders map[string]PCol
 	}
 	stage.mu.Unlock()
 
-	// TODO support state/timer watermark holds.
+	// Processing time timers don't depend on watermark changes, so schedule a
+	// refresh of the stage for when they are ready to fire.
+	// With a TestStream, processing time only advances with the TestStream's events.
+	if em.testStreamHandler != nil {
+		procTimes = nil
+	}
+	for _, t := range procTimes {
+		em.wakeStageAt(stage.ID, t)
+	}
+	em.addRefreshes(refreshConsumers)
 	em.addRefreshAndClearBundle(stage.ID, rb.BundleID)
 }
 
+// wakeStageAt schedules a refresh of the stage at the given processing time, for
+// work that becomes ready as processing time passes, rather than the watermark.
+func (em *ElementManager) wakeStageAt(stageID string, t mtime.Time) {
+	em.wakeupsMu.Lock()
+	defer em.wakeupsMu.Unlock()
+	if em.wakeupsStopped {
+		return
+	}
+	if em.wakeups == nil {
+		em.wakeups = set[*time.Timer]{}
+	}
+	var timer *time.Timer
+	// The lock is held until timer is assigned, so the callback always sees it.
+	timer = time.AfterFunc(time.Until(t.ToTime()), func() {
+		em.wakeupsMu.Lock()
+		em.wakeups.remove(timer)
+		em.wakeupsMu.Unlock()
+		em.addRefreshes(singleSet(stageID))
+	})
+	em.wakeups.insert(timer)
+}
+
+// stopWakeups stops all pending wakeups once the job has ended, so they don't
+// fire into a finished or cancelled job.
+func (em *ElementManager) stopWakeups() {
+	em.wakeupsMu.Lock()
+	defer em.wakeupsMu.Unlock()
+	em.wakeupsStopped = true
+	for timer := range em.wakeups {
+		timer.Stop()
+	}
+	em.wakeups = nil
+}
+
 // FailBundle clears the extant data allowing the execution to shut down.
 func (em *ElementManager) FailBundle(rb RunBundle) {
 	stage := em.stages[rb.StageID]
 	stage.mu.Lock()
 	completed := stage.inprogress[rb.BundleID]
 	em.pendingElements.Add(-len(completed.es))
+	stage.releaseFiredHolds(completed)
 	delete(stage.inprogress, rb.BundleID)
+	stage.releaseKeys(rb.BundleID)
 	stage.mu.Unlock()
 	em.addRefreshAndClearBundle(rb.StageID, rb.BundleID)
 }
 
+// RetryBundle moves the elements of a failed bundle to a new bundle with the
+// given ID, so they may be processed again with the same inputs. The failed
+// bundle's tentative outputs are never persisted, and the new bundle retains
+// its keys and watermark holds.
+func (em *ElementManager) RetryBundle(rb RunBundle, bundID string) RunBundle {
+	stage := em.stages[rb.StageID]
+	stage.mu.Lock()
+	stage.inprogress[bundID] = stage.inprogress[rb.BundleID]
+	delete(stage.inprogress, rb.BundleID)
+	if keys, ok := stage.inprogressKeysByBundle[rb.BundleID]; ok {
+		stage.inprogressKeysByBundle[bundID] = keys
+		delete(stage.inprogressKeysByBundle, rb.BundleID)
+	}
+	stage.mu.Unlock()
+
+	em.refreshCond.L.Lock()
+	em.inprogressBundles.remove(rb.BundleID)
+	em.inprogressBundles.insert(bundID)
+	em.refreshCond.L.Unlock()
+
+	rb.BundleID = bundID
+	return rb
+}
+
 // ReturnResiduals is called after a successful split, so the remaining work
 // can be re-assigned to a new bundle.
-func (em *ElementManager) ReturnResiduals(rb RunBundle, firstRsIndex int, inputInfo PColInfo, residuals [][]byte) {
+//
+// The bundle keeps the elements up to lastPrimary. Elements between lastPrimary
+// and firstRsIndex were split within the element, and are replaced by the
+// primaries, so a retry of the bundle only processes its primary restrictions.
+func (em *ElementManager) ReturnResiduals(rb RunBundle, lastPrimary, firstRsIndex int, inputInfo PColInfo, primaries, residuals [][]byte) {
 	stage := em.stages[rb.StageID]
 
-	stage.splitBundle(rb, firstRsIndex)
+	stage.splitBundle(rb, lastPrimary, firstRsIndex, reElementResiduals(primaries, inputInfo, rb))
 	unprocessedElements := reElementResiduals(residuals, inputInfo, rb)
 	if len(unprocessedElements) > 0 {
 		slog.Debug("ReturnResiduals: unprocessed elements", "bundle", rb, "count", len(unprocessedElements))
@@ -449,9 +905,7 @@ func (em *ElementManager) refreshWatermarks() set[string] {
 		ss := em.stages[stageID]
 		refreshed.insert(stageID)
 
-		dummyStateHold := mtime.MaxTimestamp
-
-		refreshes := ss.updateWatermarks(ss.minPendingTimestamp(), dummyStateHold, em)
+		refreshes := ss.updateWatermarks(ss.minPendingTimestamp(), ss.minWatermarkHold(), em)
 		nextUpdates.merge(refreshes)
 		// cap refreshes incrementally.
 		if i < 10 {
@@ -492,8 +946,25 @@ type stageState struct {
 	sides     []string // PCollection IDs of side inputs that can block execution.
 
 	// Special handling bits
-	aggregate bool     // whether this state needs to block for aggregation.
-	strat     winStrat // Windowing Strategy for aggregation fireings.
+	aggregate    bool          // whether this state needs to block for aggregation.
+	strat        winStrat      // Windowing Strategy for aggregation fireings.
+	triggerStrat *TriggerStrat // Trigger strategy for triggered aggregations, which emit panes per key and window.
+	stateful     bool          // whether this stage uses state or timers, and needs keyed processing.
+	keyed        bool          // whether this stage's input is keyed, and partitioned by key under PartitionByKey.
+	timeSorted   bool          // whether this stage requires its input sorted by timestamp.
+
+	keyDec func(io.Reader) []byte // Extracts the key bytes from elements for stateful, triggered and keyed stages.
+
+	processingTimeTimers map[LinkID]bool // Timer families in the processing time domain, by transform.
+
+	// Window expiration handling, for stateful stages.
+	expires          bool          // whether the stage's windows expire, dropping late elements and garbage collecting state.
+	allowedLateness  time.Duration // How long after the end of a window late data is still accepted.
+	expirationTimers []LinkID      // Timer families fired for each key and window when the window expires.
+	droppedLate      int           // count of elements dropped for arriving after their window expired.
+	lateArrivals     int           // count of late elements of session stages dropped on arrival, yet to be reported by dropLate.
+
+	shuffle func(n int, swap func(i, j int)) // Reorders ready elements before they're partitioned into bundles. May be nil.
 
 	mu                 sync.Mutex
 	upstreamWatermarks sync.Map   // watermark set from inputPCollection's parent.
@@ -503,6 +974,26 @@ type stageState struct {
 
 	pending    elementHeap         // pending input elements for this stage that are to be processesd
 	inprogress map[string]elements // inprogress elements by active bundles, keyed by bundle
+
+	// Stateful stage handling.
+	inprogressKeys         set[string]                                      // keys currently being processed by a bundle.
+	inprogressKeysByBundle map[string]set[string]                           // keys being processed, keyed by bundle.
+	state                  map[LinkID]map[typex.Window]map[string]StateData // committed user state, keyed by state ID, window, and user key.
+	timers                 map[timerKey]element                             // set timers waiting to fire.
+	watermarkHolds         map[mtime.Time]int                               // counts of output watermark holds from set and firing timers, and triggered panes.
+
+	bundleLatency Histogram // latencies of the stage's persisted bundles.
+
+	// Spilled element handling.
+	spill        *Spiller          // The job's Spiller, nil if pending elements are never spilled.
+	pendingBytes int64             // estimated bytes held in memory by pending and pane buffered elements.
+	spilled      []spilledElements // pending elements paged out to disk.
+	spilledCount int               // number of pending elements paged out to disk.
+	spilledBytes int64             // total bytes of pending elements paged out to disk.
+
+	// Triggered aggregation handling.
+	panes         map[typex.Window]map[string]*paneState // buffered panes, keyed by window and key.
+	triggerWakeup mtime.Time                             // processing time of the next scheduled trigger refresh.
 }
 
 // makeStageState produces an initialized stageState.
@@ -532,8 +1023,22 @@ func makeStageState(ID string, inputIDs, sides, outputIDs []string) *stageState
 func (ss *stageState) AddPending(newPending []element) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
-	ss.pending = append(ss.pending, newPending...)
+	newPending = ss.dropLateArrivals(newPending)
+	n := len(ss.pending)
+	if ss.keyDec != nil {
+		// Elements are shared between consuming stages, so only the local copies get keys.
+		for _, e := range newPending {
+			if e.keyBytes == nil {
+				e.keyBytes = ss.keyDec(bytes.NewBuffer(e.elmBytes))
+			}
+			ss.pending = append(ss.pending, e)
+		}
+	} else {
+		ss.pending = append(ss.pending, newPending...)
+	}
+	ss.pendingAdded(ss.pending[n:]...)
 	heap.Init(&ss.pending)
+	ss.spillOverBudget()
 }
 
 // updateUpstreamWatermark is for the parent of the input pcollection
@@ -575,10 +1080,16 @@ func (ss *stageState) OutputWatermark() mtime.Time {
 	return ss.output
 }
 
-// startBundle initializes a bundle with elements if possible.
+// startBundle initializes bundles with elements if possible.
 // A bundle only starts if there are elements at all, and if it's
 // an aggregation stage, if the windowing stratgy allows it.
-func (ss *stageState) startBundle(watermark mtime.Time, genBundID func() string) (string, bool) {
+//
+// The ready elements of non-aggregation stages are partitioned into
+// multiple bundles according to the ElementManager's configuration,
+// so they may be processed concurrently.
+//
+// Assumes em.refreshCond.L is held.
+func (ss *stageState) startBundle(em *ElementManager, watermark, now mtime.Time, genBundID func() string) ([]string, bool) {
 	defer func() {
 		if e := recover(); e != nil {
 			panic(fmt.Sprintf("generating bundle for stage %v at %v panicked\n%v", ss.ID, watermark, e))
@@ -587,9 +1098,62 @@ func (ss *stageState) startBundle(watermark mtime.Time, genBundID func() string)
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
+	// Spilled elements that may be ready are returned to the pending heap, and
+	// any that aren't processed are spilled again if the job remains over budget.
+	if err := ss.unspill(watermark); err != nil {
+		em.fail(err)
+		return nil, false
+	}
+	defer ss.spillOverBudget()
+
+	// Late elements are dropped before they may be processed, and state of expired
+	// windows is collected before their expiration timers may be set again.
+	if dropped := ss.dropLate(); dropped > 0 {
+		em.pendingElements.Add(-dropped)
+		// Without a bundle, the stage isn't refreshed on persistence, but the
+		// watermarks may still advance without the dropped elements.
+		em.watermarkRefreshes.insert(ss.ID)
+	}
+	ss.collectExpiredState()
+
+	if ss.triggerStrat != nil {
+		bundID, ok := ss.startTriggeredBundle(em, watermark, now, genBundID)
+		if !ok {
+			return nil, false
+		}
+		return []string{bundID}, true
+	}
+
+	// Session windows are evaluated by the session they merge into.
+	var sessions map[typex.Window]typex.Window
+	if strat, ok := ss.strat.(sessionStrat); ok {
+		sessions = strat.mergeSessions(ss.pending)
+	}
+
 	var toProcess, notYet []element
 	for _, e := range ss.pending {
-		if !ss.aggregate || ss.aggregate && ss.strat.EarliestCompletion(e.window) < watermark {
+		// Keys being processed by another bundle must wait to preserve per key ordering.
+		if ss.stateful {
+			if _, ok := ss.inprogressKeys[string(e.keyBytes)]; ok {
+				notYet = append(notYet, e)
+				continue
+			}
+		}
+		// Time sorted stages only process elements the watermark has passed,
+		// since earlier elements may still arrive until then.
+		if ss.timeSorted && watermark < mtime.MaxTimestamp && e.timestamp >= watermark {
+			notYet = append(notYet, e)
+			continue
+		}
+		w := e.window
+		if sw, ok := sessions[w]; ok {
+			w = sw
+		}
+		if !ss.aggregate || ss.aggregate && ss.strat.EarliestCompletion(w) < watermark {
+			if ss.aggregate {
+				// Untriggered aggregations emit a single pane, regardless of upstream panes.
+				e.pane = typex.NoFiringPane()
+			}
 			toProcess = append(toProcess, e)
 		} else {
 			notYet = append(notYet, e)
@@ -597,49 +1161,189 @@ func (ss *stageState) startBundle(watermark mtime.Time, genBundID func() string)
 	}
 	ss.pending = notYet
 	heap.Init(&ss.pending)
+	ss.pendingRemoved(toProcess...)
+	if ss.timeSorted {
+		sort.SliceStable(toProcess, func(i, j int) bool {
+			return toProcess[i].timestamp < toProcess[j].timestamp
+		})
+	} else if ss.shuffle != nil {
+		ss.shuffle(len(toProcess), func(i, j int) {
+			toProcess[i], toProcess[j] = toProcess[j], toProcess[i]
+		})
+	}
+	// Expiration timers are set before they're counted as pending, since the
+	// processed elements remain pending until the bundle is persisted.
+	em.pendingElements.Add(ss.setExpirationTimers(toProcess))
+
+	// Fire any ready timers for keys not being processed by other bundles.
+	// Timers are kept after the data elements, so data indices remain valid for splits.
+	var fired []element
+	for tk, t := range ss.timers {
+		if _, ok := ss.inprogressKeys[tk.key]; ok {
+			continue
+		}
+		if !ss.timerReady(t, now) {
+			continue
+		}
+		// The hold for the timer is retained until the firing bundle is persisted.
+		delete(ss.timers, tk)
+		fired = append(fired, t)
+	}
+	// Timers are fired in a deterministic order, regardless of map iteration.
+	sortTimers(fired)
+	toProcess = append(toProcess, fired...)
 
 	if len(toProcess) == 0 {
-		return "", false
+		return nil, false
 	}
-	// Is THIS is where basic splits should happen/per element processing?
-	es := elements{
-		es:           toProcess,
-		minTimestamp: toProcess[0].timestamp,
+	// Aggregations need all the elements for a window in a single bundle.
+	parts := [][]element{toProcess}
+	switch {
+	case ss.aggregate, em.config.PartitionMode == PartitionNone:
+	case em.config.PartitionMode == PartitionByKey:
+		parts = em.config.partition(toProcess, ss.stateful || ss.keyed)
+	default:
+		parts = em.config.partition(toProcess, ss.stateful)
 	}
+
 	if ss.inprogress == nil {
 		ss.inprogress = make(map[string]elements)
 	}
-	bundID := genBundID()
-	ss.inprogress[bundID] = es
-	return bundID, true
+	if ss.stateful {
+		if ss.inprogressKeys == nil {
+			ss.inprogressKeys = set[string]{}
+		}
+		if ss.inprogressKeysByBundle == nil {
+			ss.inprogressKeysByBundle = map[string]set[string]{}
+		}
+	}
+	var bundIDs []string
+	for _, part := range parts {
+		minTs := mtime.MaxTimestamp
+		newKeys := set[string]{}
+		for _, e := range part {
+			if e.IsTimer() {
+				minTs = mtime.Min(minTs, e.holdTimestamp)
+			} else {
+				minTs = mtime.Min(minTs, e.timestamp)
+			}
+			if ss.stateful {
+				newKeys.insert(string(e.keyBytes))
+			}
+		}
+		bundID := genBundID()
+		ss.inprogress[bundID] = elements{
+			es:           part,
+			minTimestamp: minTs,
+			started:      time.Now(),
+		}
+		if ss.stateful {
+			ss.inprogressKeys.merge(newKeys)
+			ss.inprogressKeysByBundle[bundID] = newKeys
+		}
+		bundIDs = append(bundIDs, bundID)
+	}
+	return bundIDs, true
+}
+
+// commitState persists the tentative state from a bundle into the stage's
+// committed state. Assumes the stage's lock is held.
+func (ss *stageState) commitState(d TentativeData) {
+	if len(d.state) == 0 {
+		return
+	}
+	if ss.state == nil {
+		ss.state = map[LinkID]map[typex.Window]map[string]StateData{}
+	}
+	for link, winMap := range d.state {
+		for w, keyMap := range winMap {
+			for key, data := range keyMap {
+				lmap, ok := ss.state[link]
+				if !ok {
+					lmap = map[typex.Window]map[string]StateData{}
+					ss.state[link] = lmap
+				}
+				kmap, ok := lmap[w]
+				if !ok {
+					kmap = map[string]StateData{}
+					lmap[w] = kmap
+				}
+				if len(data.Bag) == 0 && len(data.Multimap) == 0 {
+					// Cleared state doesn't need to be retained.
+					delete(kmap, key)
+					continue
+				}
+				kmap[key] = data
+			}
+		}
+	}
+}
+
+// releaseFiredHolds releases the watermark holds of any timers fired, or panes
+// emitted in the given elements. Assumes the stage's lock is held.
+func (ss *stageState) releaseFiredHolds(es elements) {
+	for _, e := range es.es {
+		if e.IsTimer() {
+			ss.releaseHold(e.holdTimestamp)
+		}
+	}
+	for _, h := range es.holds {
+		ss.releaseHold(h)
+	}
+}
+
+// releaseKeys permits the keys of the given bundle to be processed in subsequent
+// bundles. Assumes the stage's lock is held.
+func (ss *stageState) releaseKeys(bundID string) {
+	for k := range ss.inprogressKeysByBundle[bundID] {
+		ss.inprogressKeys.remove(k)
+	}
+	delete(ss.inprogressKeysByBundle, bundID)
 }
 
-func (ss *stageState) splitBundle(rb RunBundle, firstResidual int) {
+func (ss *stageState) splitBundle(rb RunBundle, lastPrimary, firstResidual int, primaries []element) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
 	es := ss.inprogress[rb.BundleID]
-	slog.Debug("split elements", "bundle", rb, "elem count", len(es.es), "res", firstResidual)
-
-	prim := es.es[:firstResidual]
-	res := es.es[firstResidual:]
+	slog.Debug("split elements", "bundle", rb, "elem count", len(es.es), "prim", lastPrimary, "res", firstResidual)
+
+	// Fired timers are not split, and remain with the primary.
+	var prim, res []element
+	for i, e := range es.es {
+		switch {
+		case i <= lastPrimary || e.IsTimer():
+			prim = append(prim, e)
+		case i < firstResidual:
+			// The element was split, so only its primary remains with the bundle.
+			for _, p := range primaries {
+				p.keyBytes = e.keyBytes
+				prim = append(prim, p)
+			}
+			primaries = nil
+		default:
+			res = append(res, e)
+		}
+	}
 
 	es.es = prim
 	ss.pending = append(ss.pending, res...)
 	heap.Init(&ss.pending)
+	ss.pendingAdded(res...)
+	ss.spillOverBudget()
 	ss.inprogress[rb.BundleID] = es
 }
 
 // minimumPendingTimestamp returns the minimum pending timestamp from all pending elements,
-// including in progress ones.
+// including in progress ones, and those spilled to disk.
 //
 // Assumes that the pending heap is initialized if it's not empty.
 func (ss *stageState) minPendingTimestamp() mtime.Time {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
-	minPending := mtime.MaxTimestamp
+	minPending := ss.minSpilledTimestamp()
 	if len(ss.pending) != 0 {
-		minPending = ss.pending[0].timestamp
+		minPending = mtime.Min(minPending, ss.pending[0].timestamp)
 	}
 	for _, es := range ss.inprogress {
 		minPending = mtime.Min(minPending, es.minTimestamp)
@@ -707,15 +1411,20 @@ func (ss *stageState) updateWatermarks(minPending, minStateHold mtime.Time, em *
 }
 
 // bundleReady returns the maximum allowed watermark for this stage, and whether
-// it's permitted to execute by side inputs.
-func (ss *stageState) bundleReady(em *ElementManager) (mtime.Time, bool) {
+// it's permitted to execute by side inputs, or ready timers and triggers as of
+// the given processing time.
+func (ss *stageState) bundleReady(em *ElementManager, now mtime.Time) (mtime.Time, bool) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 	// If the upstream watermark and the input watermark are the same,
 	// then we can't yet process this stage.
 	inputW := ss.input
 	_, upstreamW := ss.UpstreamWatermark()
-	if inputW == upstreamW {
+	// With a TestStream or unbounded sources, watermarks may not advance until elements
+	// are processed, so stages without side inputs process pending elements as they arrive.
+	unbounded := em.testStreamHandler != nil || len(em.sources) > 0
+	streaming := unbounded && ss.hasPending() && len(ss.sides) == 0
+	if inputW == upstreamW && !streaming && !ss.hasReadyTimers(now) && !ss.hasTriggerWork(upstreamW, now) {
 		slog.Debug("bundleReady: insufficient upstream watermark",
 			slog.String("stage", ss.ID),
 			slog.Group("watermark",
@@ -737,6 +1446,13 @@ func (ss *stageState) bundleReady(em *ElementManager) (mtime.Time, bool) {
 		if upstreamW > ow {
 			ready = false
 		}
+		// The side input windows an element reads may end after the upstream
+		// watermark, so bounded pipelines wait until their side inputs are
+		// complete. Otherwise elements could read partial side inputs while
+		// the producing stage still has bundles in progress.
+		if !unbounded && ow < mtime.MaxTimestamp {
+			ready = false
+		}
 	}
 	return upstreamW, ready
 }
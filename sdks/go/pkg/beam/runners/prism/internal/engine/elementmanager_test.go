@@ -20,7 +20,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
@@ -514,3 +516,364 @@ func TestElementManager(t *testing.T) {
 		}
 	})
 }
+
+func TestConfig_partition(t *testing.T) {
+	// Elements are described as "key:value", with a "timer" value for timers.
+	elms := func(descs ...string) []element {
+		var es []element
+		for _, d := range descs {
+			k, v, _ := strings.Cut(d, ":")
+			e := element{keyBytes: []byte(k), elmBytes: []byte(v)}
+			if v == "timer" {
+				e.family = "f"
+			}
+			es = append(es, e)
+		}
+		return es
+	}
+	describe := func(parts [][]element) [][]string {
+		var descs [][]string
+		for _, p := range parts {
+			var ds []string
+			for _, e := range p {
+				ds = append(ds, string(e.keyBytes)+":"+string(e.elmBytes))
+			}
+			descs = append(descs, ds)
+		}
+		return descs
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		keyed  bool
+		input  []element
+		want   [][]string
+	}{
+		{
+			name:   "default",
+			config: Config{},
+			input:  elms(":1", ":2", ":3"),
+			want:   [][]string{{":1", ":2", ":3"}},
+		}, {
+			name:   "unkeyed",
+			config: Config{TargetParallelism: 2},
+			input:  elms(":1", ":2", ":3", ":4", ":5"),
+			want:   [][]string{{":1", ":2", ":3"}, {":4", ":5"}},
+		}, {
+			name:   "unkeyed_fewElements",
+			config: Config{TargetParallelism: 4},
+			input:  elms(":1", ":2"),
+			want:   [][]string{{":1"}, {":2"}},
+		}, {
+			name:   "unkeyed_maxBundleSize",
+			config: Config{TargetParallelism: 1, MaxBundleSize: 2},
+			input:  elms(":1", ":2", ":3", ":4", ":5"),
+			want:   [][]string{{":1", ":2"}, {":3", ":4"}, {":5"}},
+		}, {
+			name:   "keyed",
+			config: Config{TargetParallelism: 2},
+			keyed:  true,
+			input:  elms("a:1", "b:2", "a:3", "c:4", "b:5"),
+			want:   [][]string{{"a:1", "a:3", "c:4"}, {"b:2", "b:5"}},
+		}, {
+			name:   "keyed_timersAfterData",
+			config: Config{TargetParallelism: 2},
+			keyed:  true,
+			input:  elms("a:1", "b:2", "c:3", "a:timer", "d:timer"),
+			want:   [][]string{{"a:1", "c:3", "a:timer"}, {"b:2", "d:timer"}},
+		}, {
+			name:   "keyed_maxBundleSize",
+			config: Config{TargetParallelism: 1, MaxBundleSize: 2},
+			keyed:  true,
+			input:  elms("a:1", "a:2", "a:3", "b:4", "c:5", "c:timer"),
+			want:   [][]string{{"a:1", "a:2", "a:3"}, {"b:4"}, {"c:5", "c:timer"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := describe(test.config.partition(test.input, test.keyed))
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("partition(%v) diff (-want, +got):\n%v", test.keyed, d)
+			}
+		})
+	}
+}
+
+func TestStageState_startBundle_Partitioned(t *testing.T) {
+	em := NewElementManager(Config{TargetParallelism: 2})
+	em.AddStage("stateful", []string{"input"}, nil, nil)
+	em.StageStateful("stateful", func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	})
+	ss := em.stages["stateful"]
+
+	var i int
+	genBundID := func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	}
+	add := func(keys ...string) {
+		var es []element
+		for _, k := range keys {
+			es = append(es, element{window: window.GlobalWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte(k)})
+		}
+		em.pendingElements.Add(len(es))
+		ss.AddPending(es)
+	}
+
+	add("a", "b", "a", "c")
+	bundIDs, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, genBundID)
+	if !ok {
+		t.Fatalf("startBundle() = %v, false, want bundles", bundIDs)
+	}
+	if got, want := len(bundIDs), 2; got != want {
+		t.Fatalf("startBundle() started %v bundles, want %v", got, want)
+	}
+	if got, want := len(ss.inprogressKeys), 3; got != want {
+		t.Errorf("len(inprogressKeys) = %v, want %v", got, want)
+	}
+
+	// Keys in progress are held back until their bundle is persisted.
+	add("a", "d")
+	more, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, genBundID)
+	if !ok || len(more) != 1 {
+		t.Fatalf("startBundle() with inprogress keys = %v, %v, want a single bundle", more, ok)
+	}
+	if got, want := len(ss.inprogress[more[0]].es), 1; got != want {
+		t.Errorf("bundle with inprogress keys has %v elements, want %v", got, want)
+	}
+	if got, want := len(ss.pending), 1; got != want {
+		t.Errorf("len(pending) = %v, want %v", got, want)
+	}
+}
+
+func TestStageState_startBundle_PartitionMode(t *testing.T) {
+	keyDec := func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	}
+	tests := []struct {
+		mode  PartitionMode
+		keyed bool
+		want  [][]string
+	}{
+		{mode: PartitionAuto, keyed: true, want: [][]string{{"a", "b"}, {"a", "c"}}},
+		{mode: PartitionByKey, keyed: false, want: [][]string{{"a", "b"}, {"a", "c"}}},
+		{mode: PartitionByKey, keyed: true, want: [][]string{{"a", "a", "c"}, {"b"}}},
+		{mode: PartitionNone, keyed: true, want: [][]string{{"a", "b", "a", "c"}}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v_keyed=%v", test.mode, test.keyed), func(t *testing.T) {
+			em := NewElementManager(Config{TargetParallelism: 2, PartitionMode: test.mode})
+			em.AddStage("stage", []string{"input"}, nil, nil)
+			if test.keyed {
+				em.StageKeyed("stage", keyDec)
+			}
+			ss := em.stages["stage"]
+
+			var es []element
+			for _, k := range []string{"a", "b", "a", "c"} {
+				es = append(es, element{window: window.GlobalWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte(k)})
+			}
+			em.pendingElements.Add(len(es))
+			ss.AddPending(es)
+
+			var i int
+			bundIDs, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, func() string {
+				defer func() { i++ }()
+				return fmt.Sprintf("%v", i)
+			})
+			if !ok {
+				t.Fatalf("startBundle() = %v, false, want bundles", bundIDs)
+			}
+			var got [][]string
+			for _, id := range bundIDs {
+				var ks []string
+				for _, e := range ss.inprogress[id].es {
+					ks = append(ks, string(e.elmBytes))
+				}
+				got = append(got, ks)
+			}
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("startBundle() bundles (-want, +got):\n%v", d)
+			}
+		})
+	}
+}
+
+func TestStageState_startBundle_TimeSorted(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("sorted", []string{"input"}, nil, nil)
+	em.StageStateful("sorted", func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	})
+	em.StageTimeSorted("sorted")
+	ss := em.stages["sorted"]
+
+	var es []element
+	for _, ts := range []mtime.Time{30, 10, 50, 20, 40} {
+		es = append(es, element{window: window.GlobalWindow{}, timestamp: ts, pane: typex.NoFiringPane(), elmBytes: []byte("a")})
+	}
+	em.pendingElements.Add(len(es))
+	ss.AddPending(es)
+
+	bundIDs, ok := ss.startBundle(em, 35, 0, func() string { return "0" })
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	var got []mtime.Time
+	for _, e := range ss.inprogress[bundIDs[0]].es {
+		got = append(got, e.timestamp)
+	}
+	if d := cmp.Diff([]mtime.Time{10, 20, 30}, got); d != "" {
+		t.Errorf("startBundle() timestamps (-want, +got):\n%v", d)
+	}
+	// Elements the watermark hasn't passed are held back.
+	if got, want := len(ss.pending), 2; got != want {
+		t.Errorf("len(pending) = %v, want %v", got, want)
+	}
+}
+
+func TestStageState_startBundle_TimerOrder(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("timers", []string{"input"}, nil, nil)
+	em.StageStateful("timers", func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	})
+	ss := em.stages["timers"]
+	ss.input = 100
+
+	// Timers are unique by key, family and tag, so the timestamps vary with those.
+	timers := []struct {
+		family, tag string
+		ts          mtime.Time
+	}{{"b", "y", 10}, {"a", "x", 20}, {"b", "x", 10}, {"a", "y", 10}}
+	ss.timers = map[timerKey]element{}
+	for _, key := range []string{"k2", "k1"} {
+		for _, tm := range timers {
+			tk := timerKey{transform: "t", family: tm.family, tag: tm.tag, window: window.GlobalWindow{}, key: key}
+			ss.timers[tk] = element{window: window.GlobalWindow{}, timestamp: tm.ts, holdTimestamp: tm.ts, pane: typex.NoFiringPane(), transform: "t", family: tm.family, tag: tm.tag, keyBytes: []byte(key)}
+		}
+	}
+	// Bundles of stateful stages keep the elements of each key together.
+	want := []string{"10ayk1", "10bxk1", "10byk1", "20axk1", "10ayk2", "10bxk2", "10byk2", "20axk2"}
+
+	bundIDs, ok := ss.startBundle(em, 100, 0, func() string { return "0" })
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	var got []string
+	for _, e := range ss.inprogress[bundIDs[0]].es {
+		got = append(got, fmt.Sprint(e.timestamp)+e.family+e.tag+string(e.keyBytes))
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("startBundle() fired timers (-want, +got):\n%v", d)
+	}
+}
+
+func TestElementManager_RetryBundle(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stateful", []string{"input"}, nil, nil)
+	em.StageStateful("stateful", func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	})
+	ss := em.stages["stateful"]
+	em.pendingElements.Add(2)
+	ss.AddPending([]element{
+		{window: window.GlobalWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+		{window: window.GlobalWindow{}, timestamp: 2, pane: typex.NoFiringPane(), elmBytes: []byte("b")},
+	})
+	bundIDs, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, func() string { return "first" })
+	if !ok {
+		t.Fatal("startBundle() = false, want a bundle")
+	}
+	rb := RunBundle{StageID: "stateful", BundleID: bundIDs[0], Watermark: mtime.MaxTimestamp}
+	em.inprogressBundles.insert(rb.BundleID)
+
+	retry := em.RetryBundle(rb, "retry")
+	if got, want := retry.BundleID, "retry"; got != want {
+		t.Errorf("RetryBundle().BundleID = %v, want %v", got, want)
+	}
+	if _, ok := ss.inprogress[rb.BundleID]; ok {
+		t.Errorf("failed bundle %v still in progress", rb.BundleID)
+	}
+	if got, want := len(ss.inprogress[retry.BundleID].es), 2; got != want {
+		t.Errorf("retried bundle has %v elements, want %v", got, want)
+	}
+	if got, want := len(ss.inprogressKeysByBundle[retry.BundleID]), 2; got != want {
+		t.Errorf("retried bundle has %v keys, want %v", got, want)
+	}
+	if got, want := em.inprogressBundles, singleSet(retry.BundleID); !cmp.Equal(got, want) {
+		t.Errorf("inprogressBundles = %v, want %v", got, want)
+	}
+	if got, want := ss.minPendingTimestamp(), mtime.Time(1); got != want {
+		t.Errorf("minPendingTimestamp() = %v, want %v", got, want)
+	}
+}
+
+func TestElementManager_StageReorder(t *testing.T) {
+	em := NewElementManager(Config{TargetParallelism: 2})
+	em.AddStage("stage", []string{"input"}, nil, nil)
+	ss := em.stages["stage"]
+	// Reverse the ready elements.
+	em.StageReorder("stage", func(n int, swap func(i, j int)) {
+		for i := 0; i < n/2; i++ {
+			swap(i, n-1-i)
+		}
+	})
+	var es []element
+	for _, v := range []string{"a", "b", "c", "d"} {
+		es = append(es, element{window: window.GlobalWindow{}, timestamp: 1, pane: typex.NoFiringPane(), elmBytes: []byte(v)})
+	}
+	em.pendingElements.Add(len(es))
+	ss.AddPending(es)
+
+	// Elements are reordered across bundles, not only within them.
+	bundIDs, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, func() string { return fmt.Sprint(len(ss.inprogress)) })
+	if !ok {
+		t.Fatal("startBundle() = false, want bundles")
+	}
+	var got []string
+	for _, id := range bundIDs {
+		for _, e := range ss.inprogress[id].es {
+			got = append(got, string(e.elmBytes))
+		}
+	}
+	if want := []string{"d", "c", "b", "a"}; !cmp.Equal(got, want) {
+		t.Errorf("startBundle() order = %v, want %v", got, want)
+	}
+}
+
+func TestElementManager_Wakeups(t *testing.T) {
+	em := NewElementManager(Config{})
+	hasRefresh := func() bool {
+		em.refreshCond.L.Lock()
+		defer em.refreshCond.L.Unlock()
+		_, ok := em.watermarkRefreshes["stage"]
+		return ok
+	}
+
+	em.wakeStageAt("stage", mtime.Now())
+	for deadline := time.Now().Add(10 * time.Second); !hasRefresh(); {
+		if time.Now().After(deadline) {
+			t.Fatal("wakeStageAt() didn't refresh the stage")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	em.wakeStageAt("stage", mtime.Now().Add(time.Hour))
+	em.stopWakeups()
+	if got := len(em.wakeups); got != 0 {
+		t.Errorf("stopWakeups() left %v pending wakeups, want 0", got)
+	}
+	// Once the job has ended, no more wakeups are scheduled.
+	em.wakeStageAt("stage", mtime.Now().Add(time.Hour))
+	if got := len(em.wakeups); got != 0 {
+		t.Errorf("wakeStageAt() after stopWakeups() left %v pending wakeups, want 0", got)
+	}
+}
@@ -0,0 +1,205 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"golang.org/x/exp/slog"
+)
+
+// gcTime returns the time after which the window is expired, given the allowed
+// lateness of its windowing strategy. Late elements for expired windows are
+// dropped, and their state may be garbage collected.
+func gcTime(w typex.Window, allowedLateness time.Duration) mtime.Time {
+	return mtime.Min(w.MaxTimestamp().Add(allowedLateness), mtime.EndOfGlobalWindowTime)
+}
+
+// StageWindowExpiration marks the given stateful stage as expiring its windows,
+// once the input watermark passes the end of a window plus the allowed lateness.
+//
+// Elements that arrive for expired windows are dropped as late, and the user state
+// of expired windows is garbage collected. For each key and window the stage
+// processes elements for, a timer of each of the onExpiration timer families fires
+// when the window expires, before its state is garbage collected.
+func (em *ElementManager) StageWindowExpiration(ID string, allowedLateness time.Duration, onExpiration []LinkID) {
+	ss := em.stages[ID]
+	ss.expires = true
+	ss.allowedLateness = allowedLateness
+	ss.expirationTimers = onExpiration
+}
+
+// expired returns whether the window has expired for the stage.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) expired(w typex.Window) bool {
+	return ss.expires && gcTime(w, ss.allowedLateness) < ss.input
+}
+
+// dropLate removes pending elements for expired windows, and returns the
+// number of elements dropped, including those of session stages dropped on
+// arrival since the last call.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) dropLate() int {
+	if !ss.expires {
+		return 0
+	}
+	if _, ok := ss.strat.(sessionStrat); ok {
+		// Pending elements of sessions wait for their merged session to complete,
+		// so they're only late if their own window expired before they arrived.
+		dropped := ss.lateArrivals
+		ss.lateArrivals = 0
+		return dropped
+	}
+	var dropped int
+	kept := ss.pending[:0]
+	for _, e := range ss.pending {
+		if ss.expired(e.window) {
+			slog.Debug("dropLate: dropping late element", slog.String("stage", ss.ID), slog.Any("window", e.window), slog.Any("timestamp", e.timestamp))
+			ss.pendingRemoved(e)
+			dropped++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if dropped == 0 {
+		return 0
+	}
+	// Clear the tail, so dropped elements may be collected.
+	for i := len(kept); i < len(ss.pending); i++ {
+		ss.pending[i] = element{}
+	}
+	ss.pending = kept
+	heap.Init(&ss.pending)
+	ss.droppedLate += dropped
+	return dropped
+}
+
+// dropLateArrivals returns the given elements without those for expired windows,
+// for session stages. Dropped elements are counted as late, and reported by the
+// next call to dropLate, since they were already counted as pending.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) dropLateArrivals(es []element) []element {
+	if _, ok := ss.strat.(sessionStrat); !ok || !ss.expires {
+		return es
+	}
+	var kept []element
+	for _, e := range es {
+		if ss.expired(e.window) {
+			slog.Debug("dropLateArrivals: dropping late element", slog.String("stage", ss.ID), slog.Any("window", e.window), slog.Any("timestamp", e.timestamp))
+			ss.lateArrivals++
+			ss.droppedLate++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+// setExpirationTimers sets a timer in each of the stage's expiration timer
+// families for the keys and windows of the given data elements, unless one is
+// already set. Expiration timers fire when their window expires, and hold the
+// output watermark at the end of the window until then.
+// Returns the number of timers set.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) setExpirationTimers(es []element) int {
+	var n int
+	for _, e := range es {
+		if e.IsTimer() {
+			continue
+		}
+		for _, link := range ss.expirationTimers {
+			tk := timerKey{
+				transform: link.Transform,
+				family:    link.Local,
+				window:    e.window,
+				key:       string(e.keyBytes),
+			}
+			if _, ok := ss.timers[tk]; ok {
+				continue
+			}
+			if ss.timers == nil {
+				ss.timers = map[timerKey]element{}
+			}
+			t := element{
+				window:        e.window,
+				timestamp:     gcTime(e.window, ss.allowedLateness),
+				holdTimestamp: e.window.MaxTimestamp(),
+				pane:          typex.NoFiringPane(),
+				transform:     link.Transform,
+				family:        link.Local,
+				keyBytes:      e.keyBytes,
+			}
+			ss.timers[tk] = t
+			ss.addHold(t.holdTimestamp)
+			n++
+		}
+	}
+	return n
+}
+
+// collectExpiredState garbage collects the user state of expired windows.
+// The state of a key is retained while a bundle is processing the key, or
+// timers are set for the key in the window, so fired timers may still read it.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) collectExpiredState() {
+	if !ss.expires || len(ss.state) == 0 {
+		return
+	}
+	type keyWindow struct {
+		window typex.Window
+		key    string
+	}
+	var timed set[keyWindow]
+	for tk := range ss.timers {
+		if !ss.expired(tk.window) {
+			continue
+		}
+		if timed == nil {
+			timed = set[keyWindow]{}
+		}
+		timed.insert(keyWindow{tk.window, tk.key})
+	}
+	for link, winMap := range ss.state {
+		for w, keyMap := range winMap {
+			if !ss.expired(w) {
+				continue
+			}
+			for key := range keyMap {
+				if _, ok := ss.inprogressKeys[key]; ok {
+					continue
+				}
+				if _, ok := timed[keyWindow{w, key}]; ok {
+					continue
+				}
+				delete(keyMap, key)
+			}
+			if len(keyMap) == 0 {
+				delete(winMap, w)
+			}
+		}
+		if len(winMap) == 0 {
+			delete(ss.state, link)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGCTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   typex.Window
+		lateness time.Duration
+		want     mtime.Time
+	}{
+		{"interval", window.IntervalWindow{Start: 0, End: 10}, 0, 9},
+		{"lateness", window.IntervalWindow{Start: 0, End: 10}, 5 * time.Millisecond, 14},
+		{"global", window.GlobalWindow{}, time.Hour, mtime.EndOfGlobalWindowTime},
+	}
+	for _, test := range tests {
+		if got := gcTime(test.window, test.lateness); got != test.want {
+			t.Errorf("%v: gcTime(%v, %v) = %v, want %v", test.name, test.window, test.lateness, got, test.want)
+		}
+	}
+}
+
+func TestStageState_WindowExpiration(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stateful", []string{"input"}, nil, nil)
+	em.StageStateful("stateful", func(r io.Reader) []byte {
+		b, _ := io.ReadAll(r)
+		return b
+	})
+	owe := LinkID{Transform: "t1", Local: "owe"}
+	em.StageWindowExpiration("stateful", 0, []LinkID{owe})
+	ss := em.stages["stateful"]
+
+	early := window.IntervalWindow{Start: 0, End: 10}
+	later := window.IntervalWindow{Start: 20, End: 30}
+	add := func(w typex.Window, ts mtime.Time, keys ...string) {
+		var es []element
+		for _, k := range keys {
+			es = append(es, element{window: w, timestamp: ts, pane: typex.NoFiringPane(), elmBytes: []byte(k)})
+		}
+		em.pendingElements.Add(len(es))
+		ss.AddPending(es)
+	}
+	var i int
+	genBundID := func() string {
+		defer func() { i++ }()
+		return string(rune('a' + i))
+	}
+	bundleContents := func(bundID string) []string {
+		var got []string
+		for _, e := range ss.inprogress[bundID].es {
+			if e.IsTimer() {
+				got = append(got, e.family+":"+string(e.keyBytes))
+			} else {
+				got = append(got, string(e.keyBytes))
+			}
+		}
+		sort.Strings(got)
+		return got
+	}
+	complete := func(bundID string) {
+		ss.releaseFiredHolds(ss.inprogress[bundID])
+		delete(ss.inprogress, bundID)
+		ss.releaseKeys(bundID)
+		ss.collectExpiredState()
+	}
+
+	// Processing elements sets an expiration timer per key and window, holding the output watermark.
+	add(early, 5, "a", "b", "a")
+	ss.input = 5
+	bundIDs, ok := ss.startBundle(em, 5, 0, genBundID)
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	if got, want := len(ss.timers), 2; got != want {
+		t.Fatalf("len(timers) = %v, want %v", got, want)
+	}
+	for tk, timer := range ss.timers {
+		if timer.timestamp != 9 || timer.holdTimestamp != 9 || tk.window != early {
+			t.Errorf("expiration timer %+v = fires at %v, holds at %v, want 9, 9", tk, timer.timestamp, timer.holdTimestamp)
+		}
+	}
+	if got, want := ss.watermarkHolds, map[mtime.Time]int{9: 2}; !cmp.Equal(got, want) {
+		t.Errorf("watermarkHolds = %v, want %v", got, want)
+	}
+	var d TentativeData
+	for _, k := range []string{"a", "b"} {
+		d.setStateData(LinkID{Transform: "t1", Local: "s"}, early, []byte(k), StateData{Bag: [][]byte{{1}}})
+	}
+	d.setStateData(LinkID{Transform: "t1", Local: "s"}, later, []byte("a"), StateData{Bag: [][]byte{{1}}})
+	ss.commitState(d)
+	complete(bundIDs[0])
+
+	// Once the window expires, late elements are dropped, and expiration timers fire with state readable.
+	add(early, 8, "c")
+	add(later, 25, "a")
+	ss.input = 20
+	bundIDs, ok = ss.startBundle(em, 20, 0, genBundID)
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() after expiry = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	if d := cmp.Diff([]string{"a", "owe:a", "owe:b"}, bundleContents(bundIDs[0])); d != "" {
+		t.Errorf("bundle after expiry (-want, +got):\n%v", d)
+	}
+	if got, want := ss.droppedLate, 1; got != want {
+		t.Errorf("droppedLate = %v, want %v", got, want)
+	}
+	if got, want := len(ss.state[LinkID{Transform: "t1", Local: "s"}][early]), 2; got != want {
+		t.Errorf("expired window has state for %v keys while expiration timers fire, want %v", got, want)
+	}
+
+	// After the expiration timers fire, state for the expired window is collected.
+	complete(bundIDs[0])
+	if _, ok := ss.state[LinkID{Transform: "t1", Local: "s"}][early]; ok {
+		t.Errorf("expired window state retained after expiration timers fired")
+	}
+	if got, want := len(ss.state[LinkID{Transform: "t1", Local: "s"}][later]), 1; got != want {
+		t.Errorf("unexpired window has state for %v keys, want %v", got, want)
+	}
+	if got, want := ss.watermarkHolds, map[mtime.Time]int{29: 1}; !cmp.Equal(got, want) {
+		t.Errorf("watermarkHolds = %v, want %v", got, want)
+	}
+	if got, want := em.StageStats()[0].DroppedLate, 1; got != want {
+		t.Errorf("StageStats().DroppedLate = %v, want %v", got, want)
+	}
+}
+
+func TestStageState_SessionsDropLate(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("sessions", []string{"input"}, nil, nil)
+	em.StageSessions("sessions", 10*time.Millisecond, 0)
+	ss := em.stages["sessions"]
+
+	add := func(start mtime.Time, v string) {
+		em.pendingElements.Add(1)
+		ss.AddPending([]element{{
+			window:    window.IntervalWindow{Start: start, End: start + 10},
+			timestamp: start,
+			pane:      typex.NoFiringPane(),
+			elmBytes:  []byte(v),
+		}})
+	}
+
+	// Elements waiting for their session to complete aren't late, even once
+	// the watermark passes the end of their own window.
+	add(0, "a")
+	add(5, "b")
+	ss.input = 12
+	if bundIDs, ok := ss.startBundle(em, 12, 0, func() string { return "0" }); ok {
+		t.Fatalf("startBundle() = %v, %v, want no bundle for the incomplete session", bundIDs, ok)
+	}
+	if got := len(ss.pending); got != 2 {
+		t.Fatalf("len(pending) = %v, want 2", got)
+	}
+
+	// Elements whose window expired before they arrived are dropped as late.
+	add(1, "late")
+	if got, want := ss.droppedLate, 1; got != want {
+		t.Errorf("droppedLate = %v, want %v", got, want)
+	}
+	ss.input = 30
+	bundIDs, ok := ss.startBundle(em, 30, 0, func() string { return "1" })
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	var got []string
+	for _, e := range ss.inprogress[bundIDs[0]].es {
+		got = append(got, string(e.elmBytes))
+	}
+	sort.Strings(got)
+	if d := cmp.Diff([]string{"a", "b"}, got); d != "" {
+		t.Errorf("bundle (-want, +got):\n%v", d)
+	}
+	if got, want := em.StageStats()[0].DroppedLate, 1; got != want {
+		t.Errorf("StageStats().DroppedLate = %v, want %v", got, want)
+	}
+}
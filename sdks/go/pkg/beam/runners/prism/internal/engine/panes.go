@@ -0,0 +1,250 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"container/heap"
+	"io"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"golang.org/x/exp/slog"
+)
+
+// paneState is the buffered elements and trigger state for a single key and
+// window of a triggered aggregation.
+type paneState struct {
+	buffer []element    // Elements to be emitted in the next pane.
+	dirty  bool         // Whether the buffer has elements that haven't yet been emitted.
+	closed bool         // Whether the trigger has finished, so further elements are dropped.
+	state  triggerState // State of the trigger for this pane.
+
+	index, nonSpeculativeIndex int64 // Indices for the next emitted pane.
+}
+
+// StageTriggered marks the given stage as a triggered aggregation, which means
+// elements are buffered per key and window, and emitted in panes according to
+// the trigger strategy. The keyDec extracts the encoded key bytes from the
+// stage's input elements.
+//
+// Only non-merging windowing strategies may be triggered.
+func (em *ElementManager) StageTriggered(ID string, keyDec func(io.Reader) []byte, strat TriggerStrat) {
+	ss := em.stages[ID]
+	ss.aggregate = true
+	ss.keyDec = keyDec
+	ss.triggerStrat = &strat
+}
+
+// hasTriggerWork returns whether the triggered stage has pending elements,
+// or panes that may fire or expire as of the given watermark and processing time.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) hasTriggerWork(watermark, now mtime.Time) bool {
+	if ss.triggerStrat == nil {
+		return false
+	}
+	if ss.hasPending() {
+		return true
+	}
+	for w, keys := range ss.panes {
+		if ss.triggerStrat.gcTime(w) < watermark {
+			return true
+		}
+		for _, ps := range keys {
+			in := &triggerInput{window: w, watermark: watermark, now: now, newElements: ps.dirty}
+			if !ps.closed && ss.triggerStrat.Trigger.shouldFire(in, ps.state) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startTriggeredBundle buffers the pending elements into their panes, and
+// produces a bundle with the elements of any panes that fire.
+//
+// Pending elements are evaluated in timestamp order as of the input watermark,
+// then all panes are evaluated as of the given watermark, which expires any
+// windows that are past their allowed lateness.
+//
+// Buffered elements remain pending work for the job until they're emitted,
+// dropped, or expired. The output watermark is held at the end of the window
+// for panes with unemitted elements. On firing, that hold moves to the bundle,
+// and is released once the bundle is persisted. Buffered elements count against
+// the job's memory budget until they're released from their pane.
+//
+// Assumes the stage's lock, and em.refreshCond.L are held.
+func (ss *stageState) startTriggeredBundle(em *ElementManager, watermark, now mtime.Time, genBundID func() string) (string, bool) {
+	strat := ss.triggerStrat
+	if ss.panes == nil {
+		ss.panes = map[typex.Window]map[string]*paneState{}
+	}
+	var toProcess []element
+	var holds []mtime.Time
+	var added, removed int
+	changed := len(ss.pending) > 0
+
+	fire := func(in *triggerInput, ps *paneState, triggered, expired bool) {
+		if triggered {
+			strat.Trigger.onFire(in, ps.state)
+		}
+		finished := ps.state.isFinished(strat.Trigger)
+		if ps.dirty {
+			pane := typex.PaneInfo{
+				IsFirst: ps.index == 0,
+				IsLast:  finished || expired,
+				Index:   ps.index,
+			}
+			switch {
+			case !in.endOfWindowReached():
+				pane.Timing = typex.PaneEarly
+				pane.NonSpeculativeIndex = -1
+			case ps.nonSpeculativeIndex == 0:
+				pane.Timing = typex.PaneOnTime
+			default:
+				pane.Timing = typex.PaneLate
+			}
+			if pane.Timing != typex.PaneEarly {
+				pane.NonSpeculativeIndex = ps.nonSpeculativeIndex
+				ps.nonSpeculativeIndex++
+			}
+			ps.index++
+			for _, e := range ps.buffer {
+				e.pane = pane
+				toProcess = append(toProcess, e)
+			}
+			added += len(ps.buffer)
+			holds = append(holds, in.window.MaxTimestamp())
+			ps.dirty = false
+		}
+		if !strat.Accumulating || finished {
+			removed += len(ps.buffer)
+			ss.pendingRemoved(ps.buffer...)
+			ps.buffer = nil
+		}
+		ps.closed = finished
+	}
+
+	for len(ss.pending) > 0 {
+		e := heap.Pop(&ss.pending).(element)
+		keys, ok := ss.panes[e.window]
+		if !ok {
+			keys = map[string]*paneState{}
+			ss.panes[e.window] = keys
+		}
+		ps, ok := keys[string(e.keyBytes)]
+		if late := strat.gcTime(e.window) < ss.input; late || ok && ps.closed {
+			slog.Debug("startTriggeredBundle: dropping late element", slog.String("stage", ss.ID), slog.Any("window", e.window), slog.Any("timestamp", e.timestamp))
+			if late {
+				ss.droppedLate++
+			}
+			ss.pendingRemoved(e)
+			removed++
+			continue
+		}
+		if !ok {
+			ps = &paneState{state: triggerState{}}
+			keys[string(e.keyBytes)] = ps
+		}
+		ps.buffer = append(ps.buffer, e)
+		if !ps.dirty {
+			ss.addHold(e.window.MaxTimestamp())
+			ps.dirty = true
+		}
+		in := &triggerInput{window: e.window, watermark: ss.input, now: now, newElements: true}
+		strat.Trigger.onElement(in, ps.state)
+		if strat.Trigger.shouldFire(in, ps.state) {
+			fire(in, ps, true, false)
+		}
+	}
+
+	for w, keys := range ss.panes {
+		expired := strat.gcTime(w) < watermark
+		for key, ps := range keys {
+			in := &triggerInput{window: w, watermark: watermark, now: now, newElements: ps.dirty}
+			triggered := !ps.closed && strat.Trigger.shouldFire(in, ps.state)
+			if triggered || expired {
+				fire(in, ps, triggered, expired)
+			}
+			if expired {
+				removed += len(ps.buffer)
+				ss.pendingRemoved(ps.buffer...)
+				delete(keys, key)
+				changed = true
+			}
+		}
+		if len(keys) == 0 {
+			delete(ss.panes, w)
+		}
+	}
+
+	// Emitted elements are counted before removing buffered ones, so the job
+	// doesn't terminate early.
+	em.pendingElements.Add(added)
+	em.pendingElements.Add(-removed)
+	ss.scheduleTriggerWakeup(em, now)
+
+	if len(toProcess) == 0 {
+		// Without a bundle, the stage isn't refreshed on persistence, but the
+		// watermarks may still advance with the buffered or expired elements.
+		if changed {
+			em.watermarkRefreshes.insert(ss.ID)
+		}
+		return "", false
+	}
+	minTs := mtime.MaxTimestamp
+	for _, e := range toProcess {
+		minTs = mtime.Min(minTs, e.timestamp)
+	}
+	if ss.inprogress == nil {
+		ss.inprogress = make(map[string]elements)
+	}
+	bundID := genBundID()
+	ss.inprogress[bundID] = elements{
+		es:           toProcess,
+		minTimestamp: minTs,
+		holds:        holds,
+		started:      time.Now(),
+	}
+	return bundID, true
+}
+
+// scheduleTriggerWakeup schedules a refresh of the stage for the next processing
+// time at which a pane may fire, since processing time doesn't advance with
+// watermark changes. With a TestStream, processing time only advances with the
+// TestStream's events, so no wakeup is needed.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) scheduleTriggerWakeup(em *ElementManager, now mtime.Time) {
+	if em.testStreamHandler != nil {
+		return
+	}
+	next := mtime.MaxTimestamp
+	for _, keys := range ss.panes {
+		for _, ps := range keys {
+			if !ps.closed {
+				next = mtime.Min(next, nextProcessingTimeFiring(ss.triggerStrat.Trigger, ps.state))
+			}
+		}
+	}
+	// Only schedule a wakeup if there isn't already an earlier one pending.
+	if next == mtime.MaxTimestamp || (ss.triggerWakeup > now && ss.triggerWakeup <= next) {
+		return
+	}
+	ss.triggerWakeup = next
+	em.wakeStageAt(ss.ID, next)
+}
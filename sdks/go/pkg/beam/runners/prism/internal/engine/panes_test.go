@@ -0,0 +1,188 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+// paneCount summarizes the elements emitted for a pane.
+type paneCount struct {
+	Pane  typex.PaneInfo
+	Count int
+}
+
+// bundlePanes summarizes the panes of the elements in the given bundle, in order.
+func bundlePanes(ss *stageState, bundID string) []paneCount {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var ret []paneCount
+	for _, e := range ss.inprogress[bundID].es {
+		if n := len(ret); n > 0 && ret[n-1].Pane == e.pane {
+			ret[n-1].Count++
+			continue
+		}
+		ret = append(ret, paneCount{Pane: e.pane, Count: 1})
+	}
+	return ret
+}
+
+func TestTriggeredPanes_AccumulationMode(t *testing.T) {
+	early := func(index int64) typex.PaneInfo {
+		return typex.PaneInfo{Timing: typex.PaneEarly, IsFirst: index == 0, Index: index, NonSpeculativeIndex: -1}
+	}
+	final := typex.PaneInfo{Timing: typex.PaneOnTime, IsLast: true, Index: 2}
+
+	tests := []struct {
+		accumulating bool
+		want         [][]paneCount
+	}{
+		{
+			accumulating: false,
+			want: [][]paneCount{
+				{{Pane: early(0), Count: 2}},
+				{{Pane: early(1), Count: 2}},
+				{{Pane: final, Count: 1}},
+			},
+		}, {
+			accumulating: true,
+			want: [][]paneCount{
+				{{Pane: early(0), Count: 2}},
+				{{Pane: early(1), Count: 4}},
+				{{Pane: final, Count: 5}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("accumulating=%v", test.accumulating), func(t *testing.T) {
+			em := NewElementManager(Config{})
+			em.AddStage("ts", nil, nil, []string{"output"})
+			em.AddStage("gbk", []string{"output"}, nil, nil)
+			em.StageTriggered("gbk", stringKeyDec, TriggerStrat{
+				Trigger:      &TriggerRepeatedly{Repeated: &TriggerAfterCount{ElementCount: 2}},
+				Accumulating: test.accumulating,
+			})
+
+			key := encodeStringKey("a")
+			tsb := em.AddTestStream("ts", map[string]string{"out": "output"})
+			tsb.AddElementEvent("out", []TestStreamElement{{Encoded: key, EventTime: 1}, {Encoded: key, EventTime: 2}})
+			tsb.AddElementEvent("out", []TestStreamElement{{Encoded: key, EventTime: 3}, {Encoded: key, EventTime: 4}})
+			// The last element is only emitted once the window expires.
+			tsb.AddElementEvent("out", []TestStreamElement{{Encoded: key, EventTime: 5}})
+
+			var i int
+			ch := em.Bundles(context.Background(), func() string {
+				defer func() { i++ }()
+				return fmt.Sprintf("%v", i)
+			})
+			var got [][]paneCount
+			for rb := range ch {
+				got = append(got, bundlePanes(em.stages[rb.StageID], rb.BundleID))
+				em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+			}
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("bundle panes diff (-want, +got):\n%v", d)
+			}
+			if got, want := em.stages["gbk"].OutputWatermark(), mtime.MaxTimestamp; got != want {
+				t.Errorf("gbk.OutputWatermark() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTriggeredPanes_Lateness(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("gbk", []string{"input"}, nil, nil)
+	em.StageTriggered("gbk", stringKeyDec, TriggerStrat{
+		Trigger:         &TriggerDefault{},
+		AllowedLateness: 5 * time.Millisecond,
+	})
+	ss := em.stages["gbk"]
+
+	// The window ends at 9, and expires once the watermark passes 14.
+	win := window.IntervalWindow{Start: 0, End: 10}
+	key := encodeStringKey("a")
+	addElement := func(ts mtime.Time) {
+		em.pendingElements.Add(1)
+		heap.Push(&ss.pending, element{window: win, timestamp: ts, pane: typex.NoFiringPane(), elmBytes: key, keyBytes: key})
+	}
+
+	var i int
+	genBundID := func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	}
+	// run starts a bundle at the given watermarks, and persists it, returning the panes emitted.
+	run := func(input, watermark mtime.Time) []paneCount {
+		t.Helper()
+		ss.input = input
+		bundIDs, ok := ss.startBundle(em, watermark, 0, genBundID)
+		if !ok {
+			return nil
+		}
+		bundID := bundIDs[0]
+		got := bundlePanes(ss, bundID)
+		if got, want := ss.minWatermarkHold(), win.MaxTimestamp(); got != want {
+			t.Errorf("minWatermarkHold() with an inprogress pane = %v, want %v", got, want)
+		}
+		em.PersistBundle(RunBundle{StageID: ss.ID, BundleID: bundID}, nil, TentativeData{}, PColInfo{}, nil, nil)
+		return got
+	}
+
+	addElement(1)
+	addElement(2)
+	if got := run(mtime.MinTimestamp, 5); got != nil {
+		t.Errorf("panes before the end of the window = %v, want none", got)
+	}
+	if got, want := ss.minWatermarkHold(), win.MaxTimestamp(); got != want {
+		t.Errorf("minWatermarkHold() with buffered elements = %v, want %v", got, want)
+	}
+	onTime := typex.PaneInfo{Timing: typex.PaneOnTime, IsFirst: true}
+	if d := cmp.Diff([]paneCount{{Pane: onTime, Count: 2}}, run(5, 10)); d != "" {
+		t.Errorf("on time panes diff (-want, +got):\n%v", d)
+	}
+
+	// Late data within the allowed lateness fires a late pane.
+	addElement(3)
+	late := typex.PaneInfo{Timing: typex.PaneLate, Index: 1, NonSpeculativeIndex: 1}
+	if d := cmp.Diff([]paneCount{{Pane: late, Count: 1}}, run(12, 12)); d != "" {
+		t.Errorf("late panes diff (-want, +got):\n%v", d)
+	}
+
+	// Late data past the allowed lateness is dropped, and the window expires.
+	addElement(4)
+	if got := run(15, 15); got != nil {
+		t.Errorf("panes after expiry = %v, want none", got)
+	}
+	if got := len(ss.panes); got != 0 {
+		t.Errorf("len(ss.panes) after expiry = %v, want 0", got)
+	}
+	if got, want := ss.droppedLate, 1; got != want {
+		t.Errorf("droppedLate after expiry = %v, want %v", got, want)
+	}
+	if got, want := ss.minWatermarkHold(), mtime.MaxTimestamp; got != want {
+		t.Errorf("minWatermarkHold() after expiry = %v, want %v", got, want)
+	}
+}
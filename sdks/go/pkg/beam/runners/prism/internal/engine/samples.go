@@ -0,0 +1,95 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+// ElementSample is a recent element of a PCollection, retained for inspection.
+type ElementSample struct {
+	Window    typex.Window
+	Timestamp mtime.Time
+	Pane      typex.PaneInfo
+	Element   []byte // The encoded element, without its windowed value header.
+}
+
+// sampleRing retains the most recent samples of a PCollection, up to its capacity.
+type sampleRing struct {
+	samples []ElementSample
+	next    int // Index of the oldest sample, once the ring is full.
+}
+
+func (r *sampleRing) add(s ElementSample, capacity int) {
+	if len(r.samples) < capacity {
+		r.samples = append(r.samples, s)
+		return
+	}
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % capacity
+}
+
+// ordered returns a copy of the samples, from oldest to newest.
+func (r *sampleRing) ordered() []ElementSample {
+	ret := make([]ElementSample, 0, len(r.samples))
+	ret = append(ret, r.samples[r.next:]...)
+	return append(ret, r.samples[:r.next]...)
+}
+
+// sampleElements retains the most recent of the given elements produced to the PCollection,
+// if sampling is enabled.
+func (em *ElementManager) sampleElements(pcol string, es []element) {
+	n := em.config.SampleSize
+	if n <= 0 || len(es) == 0 {
+		return
+	}
+	// Only the most recent elements could be retained.
+	if len(es) > n {
+		es = es[len(es)-n:]
+	}
+	em.samplesMu.Lock()
+	defer em.samplesMu.Unlock()
+	if em.samples == nil {
+		em.samples = map[string]*sampleRing{}
+	}
+	r, ok := em.samples[pcol]
+	if !ok {
+		r = &sampleRing{}
+		em.samples[pcol] = r
+	}
+	for _, e := range es {
+		r.add(ElementSample{
+			Window:    e.window,
+			Timestamp: e.timestamp,
+			Pane:      e.pane,
+			Element:   e.elmBytes,
+		}, n)
+	}
+}
+
+// ElementSamples returns the most recent elements produced to each PCollection,
+// from oldest to newest, keyed by PCollection ID.
+// The number of elements retained per PCollection is set by Config.SampleSize.
+func (em *ElementManager) ElementSamples() map[string][]ElementSample {
+	em.samplesMu.Lock()
+	defer em.samplesMu.Unlock()
+	ret := make(map[string][]ElementSample, len(em.samples))
+	for pcol, r := range em.samples {
+		ret[pcol] = r.ordered()
+	}
+	return ret
+}
@@ -0,0 +1,83 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestElementManager_ElementSamples(t *testing.T) {
+	elms := func(tss ...mtime.Time) []element {
+		var es []element
+		for _, ts := range tss {
+			es = append(es, element{window: window.GlobalWindow{}, timestamp: ts, pane: typex.NoFiringPane(), elmBytes: []byte{byte(ts)}})
+		}
+		return es
+	}
+	timestamps := func(ss []ElementSample) []mtime.Time {
+		var ret []mtime.Time
+		for _, s := range ss {
+			ret = append(ret, s.Timestamp)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name    string
+		size    int
+		batches [][]element
+		want    []mtime.Time
+	}{
+		{
+			name:    "disabled",
+			size:    0,
+			batches: [][]element{elms(1, 2)},
+			want:    nil,
+		}, {
+			name:    "underCapacity",
+			size:    3,
+			batches: [][]element{elms(1), elms(2)},
+			want:    []mtime.Time{1, 2},
+		}, {
+			name:    "wrapsAround",
+			size:    3,
+			batches: [][]element{elms(1, 2), elms(3, 4), elms(5)},
+			want:    []mtime.Time{3, 4, 5},
+		}, {
+			name:    "largeBatch",
+			size:    2,
+			batches: [][]element{elms(1), elms(2, 3, 4, 5)},
+			want:    []mtime.Time{4, 5},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			em := NewElementManager(Config{SampleSize: test.size})
+			for _, b := range test.batches {
+				em.sampleElements("pcol", b)
+			}
+			got := timestamps(em.ElementSamples()["pcol"])
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("ElementSamples() timestamps (-want, +got):\n%v", d)
+			}
+		})
+	}
+}
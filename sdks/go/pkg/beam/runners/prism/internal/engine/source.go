@@ -0,0 +1,122 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"golang.org/x/exp/slog"
+)
+
+// SourceElement is an encoded element, and its event time, read by a source.
+type SourceElement struct {
+	Encoded   []byte
+	EventTime mtime.Time
+}
+
+// AddSource marks and initializes the given stage as an unbounded source,
+// which is a root transform whose elements are read by the runner, such as
+// from an emulated external service.
+//
+// Unlike an Impulse, the source's output watermark only advances as the
+// runner provides elements and watermarks with SourceElements. The source
+// is pending work until it's finished, so the job runs until the source is
+// finished, the job is drained, or the job is canceled.
+func (em *ElementManager) AddSource(ID string) {
+	ss := em.stages[ID]
+	// Sources have no input, so their watermark is tracked as an upstream
+	// watermark of the stage, which propagates to consumers as it's refreshed.
+	ss.upstreamWatermarks.Store(ID, mtime.MinTimestamp)
+	if em.sources == nil {
+		em.sources = set[string]{}
+	}
+	em.sources.insert(ID)
+	em.pendingElements.Add(1)
+}
+
+// SourceElements adds elements read by the source to the pending elements
+// of the consumers of its output, and advances the source's watermark,
+// if the new watermark is later.
+//
+// Returns false if the source is finished, such as when the job is draining,
+// in which case the elements are not added, and the source should stop reading.
+func (em *ElementManager) SourceElements(ID string, es []SourceElement, watermark mtime.Time) bool {
+	em.refreshCond.L.Lock()
+	defer em.refreshCond.L.Unlock()
+	if _, ok := em.sources[ID]; !ok {
+		return false
+	}
+	ss := em.stages[ID]
+	if len(es) > 0 {
+		var newPending []element
+		for _, e := range es {
+			newPending = append(newPending, element{
+				window:    window.GlobalWindow{},
+				timestamp: e.EventTime,
+				pane:      typex.NoFiringPane(),
+				elmBytes:  e.Encoded,
+			})
+		}
+		output := ss.outputIDs[0]
+		em.sampleElements(output, newPending)
+		consumers := em.consumers[output]
+		slog.Debug("Source: adding elements", slog.String("ID", ID), slog.Int("count", len(newPending)), slog.Any("consumers", consumers))
+		for _, sID := range consumers {
+			em.pendingElements.Add(len(newPending))
+			em.stages[sID].AddPending(newPending)
+			em.watermarkRefreshes.insert(sID)
+		}
+	}
+	em.setSourceWatermark(ss, watermark)
+	em.refreshCond.Broadcast()
+	return true
+}
+
+// FinishSource advances the source's watermark to the end of time, and
+// releases its pending work, so the job may terminate. Later calls to
+// SourceElements return false.
+func (em *ElementManager) FinishSource(ID string) {
+	em.refreshCond.L.Lock()
+	defer em.refreshCond.L.Unlock()
+	em.finishSource(ID)
+	em.refreshCond.Broadcast()
+}
+
+// finishSource finishes the source, if it isn't already finished.
+//
+// Must be called while holding em.refreshCond.L
+func (em *ElementManager) finishSource(ID string) {
+	if _, ok := em.sources[ID]; !ok {
+		return
+	}
+	slog.Debug("Source: finished", slog.String("ID", ID))
+	em.sources.remove(ID)
+	em.setSourceWatermark(em.stages[ID], mtime.MaxTimestamp)
+	em.pendingElements.Done()
+}
+
+// setSourceWatermark advances the watermark of the source, if the new
+// watermark is later, and schedules the source's refresh to propagate it.
+//
+// Must be called while holding em.refreshCond.L
+func (em *ElementManager) setSourceWatermark(ss *stageState, watermark mtime.Time) {
+	if cur, _ := ss.upstreamWatermarks.Load(ss.ID); watermark <= cur.(mtime.Time) {
+		return
+	}
+	ss.upstreamWatermarks.Store(ss.ID, watermark)
+	em.watermarkRefreshes.insert(ss.ID)
+}
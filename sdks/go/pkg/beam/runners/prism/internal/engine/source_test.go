@@ -0,0 +1,121 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSource_Elements(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("src", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+	em.AddSource("src")
+
+	var i int
+	ch := em.Bundles(context.Background(), func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	})
+
+	type bundle struct {
+		Watermark  mtime.Time
+		Timestamps []mtime.Time
+	}
+	// The runner reads elements while bundles execute, so it's driven from another goroutine.
+	reads := []func(){
+		func() {
+			// Elements are processed as they arrive, before the watermark advances.
+			em.SourceElements("src", []SourceElement{{Encoded: []byte{1}, EventTime: 100}}, mtime.MinTimestamp)
+		},
+		func() {
+			em.SourceElements("src", []SourceElement{{Encoded: []byte{2}, EventTime: 120}}, 110)
+		},
+		func() {
+			em.FinishSource("src")
+			if em.SourceElements("src", []SourceElement{{Encoded: []byte{3}, EventTime: 130}}, 130) {
+				t.Error("SourceElements() after FinishSource = true, want false")
+			}
+		},
+	}
+	go reads[0]()
+	reads = reads[1:]
+
+	var got []bundle
+	for rb := range ch {
+		ss := em.stages[rb.StageID]
+		ss.mu.Lock()
+		var ts []mtime.Time
+		for _, e := range ss.inprogress[rb.BundleID].es {
+			ts = append(ts, e.timestamp)
+		}
+		ss.mu.Unlock()
+		got = append(got, bundle{Watermark: rb.Watermark, Timestamps: ts})
+		em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+		if len(reads) > 0 {
+			go reads[0]()
+			reads = reads[1:]
+		}
+	}
+	want := []bundle{
+		{Watermark: mtime.MinTimestamp, Timestamps: []mtime.Time{100}},
+		{Watermark: 110, Timestamps: []mtime.Time{120}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("bundles diff (-want, +got):\n%v", d)
+	}
+	if got, want := em.stages["dofn"].InputWatermark(), mtime.MaxTimestamp; got != want {
+		t.Errorf("dofn.InputWatermark() = %v, want %v", got, want)
+	}
+}
+
+func TestSource_Drain(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("src", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+	em.AddSource("src")
+	em.SourceElements("src", []SourceElement{{Encoded: []byte{1}, EventTime: 100}}, mtime.MinTimestamp)
+
+	var i int
+	ch := em.Bundles(context.Background(), func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	})
+	var got []RunBundle
+	for rb := range ch {
+		got = append(got, rb)
+		if !em.Draining() {
+			em.Drain()
+		}
+		// Draining finishes the source, so it stops reading.
+		if em.SourceElements("src", []SourceElement{{Encoded: []byte{2}, EventTime: 110}}, 110) {
+			t.Error("SourceElements() while draining = true, want false")
+		}
+		em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+	}
+	want := []RunBundle{{StageID: "dofn", BundleID: "0", Watermark: mtime.MinTimestamp}}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("bundles diff (-want, +got):\n%v", d)
+	}
+	if got, want := em.stages["dofn"].InputWatermark(), mtime.MaxTimestamp; got != want {
+		t.Errorf("dofn.InputWatermark() = %v, want %v", got, want)
+	}
+}
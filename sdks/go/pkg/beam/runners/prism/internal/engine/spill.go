@@ -0,0 +1,382 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"golang.org/x/exp/slog"
+)
+
+// Spiller pages buffered data out to segment files on local disk, once the
+// estimated bytes buffered in memory exceed a budget. A job's Spiller is shared
+// between the pending elements of its stages, and its side input data.
+//
+// A nil Spiller never spills.
+type Spiller struct {
+	parent string // Directory the spill directory is created in. Empty uses the OS temp directory.
+	budget int64  // Bytes of buffered data permitted in memory.
+
+	resident atomic.Int64 // Estimated bytes of spillable data held in memory.
+	spilled  atomic.Int64 // Total bytes written to segments.
+
+	mu     sync.RWMutex // Held for reading segments, and exclusively for writing them, or closing.
+	dir    string       // Created on the first spill, and removed on Close.
+	next   int          // Sequence number of the next segment file.
+	closed bool
+}
+
+// ErrSpillerClosed is returned for segments accessed after their Spiller is closed,
+// such as by stages still being evaluated after their job has terminated.
+var ErrSpillerClosed = errors.New("spiller closed")
+
+// NewSpiller returns a Spiller that pages data out to a directory created
+// under dir, once more than budget bytes are buffered in memory.
+// Returns nil, which never spills, if the budget is 0 or less.
+func NewSpiller(dir string, budget int64) *Spiller {
+	if budget <= 0 {
+		return nil
+	}
+	return &Spiller{parent: dir, budget: budget}
+}
+
+// Track adjusts the estimate of the spillable bytes held in memory by delta.
+func (s *Spiller) Track(delta int64) {
+	if s == nil {
+		return
+	}
+	s.resident.Add(delta)
+}
+
+// OverBudget returns whether the spillable bytes held in memory exceed the budget.
+func (s *Spiller) OverBudget() bool {
+	if s == nil {
+		return false
+	}
+	return s.resident.Load() > s.budget
+}
+
+// SpilledBytes returns the total bytes written to disk.
+func (s *Spiller) SpilledBytes() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.spilled.Load()
+}
+
+// Close removes all segment files written by the Spiller.
+func (s *Spiller) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	return err
+}
+
+// Segment is a file of records paged out to disk.
+type Segment struct {
+	path  string
+	Count int   // Number of records in the segment.
+	Bytes int64 // Size of the segment file.
+}
+
+// Write pages the records out to a new segment file.
+func (s *Spiller) Write(records [][]byte) (*Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrSpillerClosed
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp(s.parent, "prism-spill-")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create spill directory: %w", err)
+		}
+		s.dir = dir
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("segment-%06d", s.next))
+	s.next++
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create spill segment: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	var n int64
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, r := range records {
+		l := binary.PutUvarint(lenBuf[:], uint64(len(r)))
+		w.Write(lenBuf[:l])
+		w.Write(r)
+		n += int64(l + len(r))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("unable to write spill segment: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("unable to write spill segment: %w", err)
+	}
+	s.spilled.Add(n)
+	return &Segment{path: path, Count: len(records), Bytes: n}, nil
+}
+
+// Read reads the segment's records back into memory, in the order they were written.
+func (s *Spiller) Read(seg *Segment) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrSpillerClosed
+	}
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spill segment: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	records := make([][]byte, 0, seg.Count)
+	for {
+		l, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read spill segment %v: %w", seg.path, err)
+		}
+		rec := make([]byte, l)
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return nil, fmt.Errorf("unable to read spill segment %v: %w", seg.path, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Remove deletes the segment file. Segments of a closed Spiller are already removed.
+func (s *Spiller) Remove(seg *Segment) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	return os.Remove(seg.path)
+}
+
+// elementOverhead approximates the in memory size of an element, beyond its encoded bytes.
+const elementOverhead = 96
+
+// elementSize estimates the bytes an element holds in memory.
+func elementSize(e element) int64 {
+	return int64(len(e.elmBytes) + len(e.keyBytes) + elementOverhead)
+}
+
+// spilledElements is a segment of a stage's pending elements paged out to disk.
+type spilledElements struct {
+	seg          *Segment
+	minTimestamp mtime.Time // Minimum timestamp of the segment's elements.
+	minComplete  mtime.Time // Earliest completion of the segment's element windows.
+}
+
+// spillOverBudget spills the stage's pending elements to disk if the job is
+// over its memory budget.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) spillOverBudget() {
+	if ss.spill.OverBudget() && len(ss.pending) > 0 {
+		ss.spillPending()
+	}
+}
+
+// pendingAdded adds the elements to the estimate of the bytes held in memory by
+// the stage's pending and buffered elements.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) pendingAdded(es ...element) {
+	ss.trackElements(es, 1)
+}
+
+// pendingRemoved removes the elements from the estimate of the bytes held in
+// memory by the stage's pending and buffered elements.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) pendingRemoved(es ...element) {
+	ss.trackElements(es, -1)
+}
+
+func (ss *stageState) trackElements(es []element, sign int64) {
+	if ss.spill == nil {
+		return
+	}
+	var n int64
+	for _, e := range es {
+		n += elementSize(e)
+	}
+	ss.pendingBytes += sign * n
+	ss.spill.Track(sign * n)
+}
+
+// spillPending pages the stage's pending elements out to a segment on disk.
+// Elements that can't be encoded remain in memory.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) spillPending() {
+	var keep, spilled []element
+	var records [][]byte
+	minTs, minComplete := mtime.MaxTimestamp, mtime.MaxTimestamp
+	for _, e := range ss.pending {
+		b, ok := encodeElement(e)
+		if !ok || e.IsTimer() {
+			keep = append(keep, e)
+			continue
+		}
+		records = append(records, b)
+		spilled = append(spilled, e)
+		minTs = mtime.Min(minTs, e.timestamp)
+		minComplete = mtime.Min(minComplete, ss.strat.EarliestCompletion(e.window))
+	}
+	if len(records) == 0 {
+		return
+	}
+	seg, err := ss.spill.Write(records)
+	if errors.Is(err, ErrSpillerClosed) {
+		return
+	}
+	if err != nil {
+		slog.Warn("unable to spill pending elements, keeping them in memory", slog.String("stage", ss.ID), slog.Any("error", err))
+		return
+	}
+	ss.spilled = append(ss.spilled, spilledElements{seg: seg, minTimestamp: minTs, minComplete: minComplete})
+	ss.spilledCount += seg.Count
+	ss.spilledBytes += seg.Bytes
+	ss.pending = keep
+	heap.Init(&ss.pending)
+	ss.pendingRemoved(spilled...)
+	slog.Debug("spilled pending elements", slog.String("stage", ss.ID), slog.Int("elements", seg.Count), slog.Int64("bytes", seg.Bytes))
+}
+
+// unspill reads back the spilled segments that may contain elements ready to process
+// as of the watermark, and returns them to the pending heap.
+//
+// Aggregations read back the segments with completed windows, and time sorted stages
+// those with elements the watermark has passed. Other stateful and stateless stages
+// read back a single segment once their pending elements are processed, so only one
+// segment is held in memory at a time.
+//
+// Triggered and session stages read back all segments, since any pending element may
+// contribute to a pane or merged window. They aren't bounded by the memory budget.
+//
+// Returns an error if a segment can't be read back, since its elements are then lost,
+// and the job can't complete correctly.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) unspill(watermark mtime.Time) error {
+	if len(ss.spilled) == 0 {
+		return nil
+	}
+	defer heap.Init(&ss.pending)
+	_, sessions := ss.strat.(sessionStrat)
+	var remaining []spilledElements
+	for i, s := range ss.spilled {
+		var ready bool
+		switch {
+		case ss.triggerStrat != nil || sessions:
+			ready = true
+		case ss.aggregate:
+			ready = s.minComplete < watermark
+		case ss.timeSorted:
+			ready = watermark == mtime.MaxTimestamp || s.minTimestamp < watermark
+		default:
+			ready = len(ss.pending) == 0
+		}
+		if !ready {
+			remaining = append(remaining, s)
+			continue
+		}
+		es, err := ss.readSpilled(s.seg)
+		if errors.Is(err, ErrSpillerClosed) {
+			// The job has terminated, so the elements will never be processed.
+			remaining = append(remaining, s)
+			continue
+		}
+		if err != nil {
+			// Segments not yet read back remain spilled.
+			ss.spilled = append(remaining, ss.spilled[i:]...)
+			return fmt.Errorf("stage %v: %w", ss.ID, err)
+		}
+		ss.pending = append(ss.pending, es...)
+		ss.pendingAdded(es...)
+		ss.spilledCount -= s.seg.Count
+		if err := ss.spill.Remove(s.seg); err != nil {
+			slog.Warn("unable to remove spill segment", slog.String("stage", ss.ID), slog.Any("error", err))
+		}
+	}
+	ss.spilled = remaining
+	return nil
+}
+
+// readSpilled reads back and decodes the elements of a spilled segment.
+func (ss *stageState) readSpilled(seg *Segment) ([]element, error) {
+	records, err := ss.spill.Read(seg)
+	if err != nil {
+		return nil, err
+	}
+	es := make([]element, 0, len(records))
+	for _, r := range records {
+		e, err := decodeElement(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode spilled element: %w", err)
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// minSpilledTimestamp returns the minimum timestamp of the stage's spilled elements.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) minSpilledTimestamp() mtime.Time {
+	minTs := mtime.MaxTimestamp
+	for _, s := range ss.spilled {
+		minTs = mtime.Min(minTs, s.minTimestamp)
+	}
+	return minTs
+}
+
+// hasPending returns whether the stage has pending elements, in memory or on disk.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) hasPending() bool {
+	return len(ss.pending) > 0 || len(ss.spilled) > 0
+}
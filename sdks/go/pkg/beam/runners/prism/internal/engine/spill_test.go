@@ -0,0 +1,201 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpiller(t *testing.T) {
+	if s := NewSpiller("", 0); s != nil {
+		t.Errorf("NewSpiller with no budget = %v, want nil", s)
+	}
+	s := NewSpiller(t.TempDir(), 10)
+	s.Track(11)
+	if !s.OverBudget() {
+		t.Error("OverBudget() = false, want true")
+	}
+	want := [][]byte{[]byte("one"), {}, []byte("three")}
+	seg, err := s.Write(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Read(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("Read() (-want, +got):\n%v", d)
+	}
+	if got, want := s.SpilledBytes(), seg.Bytes; got != want || want == 0 {
+		t.Errorf("SpilledBytes() = %v, want %v", got, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(seg.path); !os.IsNotExist(err) {
+		t.Errorf("segment remains after Close(): %v", err)
+	}
+	if _, err := s.Read(seg); !errors.Is(err, ErrSpillerClosed) {
+		t.Errorf("Read() after Close() error = %v, want %v", err, ErrSpillerClosed)
+	}
+}
+
+func TestStageState_spill(t *testing.T) {
+	em := NewElementManager(Config{MemoryBudget: 1, SpillDir: t.TempDir()})
+	defer em.Spiller().Close()
+	em.AddStage("agg", []string{"input"}, nil, nil)
+	em.StageAggregates("agg")
+	ss := em.stages["agg"]
+
+	early := window.IntervalWindow{Start: 0, End: 10}
+	late := window.IntervalWindow{Start: 10, End: 20}
+	em.pendingElements.Add(3)
+	ss.AddPending([]element{
+		{window: early, timestamp: 5, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+		{window: early, timestamp: 6, pane: typex.NoFiringPane(), elmBytes: []byte("b")},
+	})
+	ss.AddPending([]element{
+		{window: late, timestamp: 15, pane: typex.NoFiringPane(), elmBytes: []byte("c")},
+	})
+
+	if got := len(ss.pending); got != 0 {
+		t.Errorf("len(pending) = %v, want all elements spilled", got)
+	}
+	stats := em.StageStats()[0]
+	if stats.PendingElements != 3 || stats.SpilledElements != 3 || stats.SpilledBytes == 0 {
+		t.Errorf("StageStats() = %+v, want 3 pending and spilled elements", stats)
+	}
+	if got, want := ss.minPendingTimestamp(), mtime.Time(5); got != want {
+		t.Errorf("minPendingTimestamp() = %v, want %v", got, want)
+	}
+
+	// Only the segment with the completed window is read back.
+	bundIDs, ok := ss.startBundle(em, 15, 0, func() string { return "0" })
+	if !ok || len(bundIDs) != 1 {
+		t.Fatalf("startBundle() = %v, %v, want a single bundle", bundIDs, ok)
+	}
+	var got []string
+	for _, e := range ss.inprogress[bundIDs[0]].es {
+		got = append(got, string(e.elmBytes))
+	}
+	if d := cmp.Diff([]string{"a", "b"}, got); d != "" {
+		t.Errorf("startBundle() elements (-want, +got):\n%v", d)
+	}
+	if got, want := ss.spilledCount, 1; got != want {
+		t.Errorf("spilledCount = %v, want %v", got, want)
+	}
+	// Processing and spilled elements no longer count as held in memory.
+	if got := em.Spiller().resident.Load(); got != 0 || ss.pendingBytes != 0 {
+		t.Errorf("resident bytes = %v, pendingBytes = %v, want 0", got, ss.pendingBytes)
+	}
+}
+
+func TestStageState_unspillError(t *testing.T) {
+	em := NewElementManager(Config{MemoryBudget: 1, SpillDir: t.TempDir()})
+	defer em.Spiller().Close()
+	em.AddStage("stage", []string{"input"}, nil, nil)
+	ss := em.stages["stage"]
+
+	em.pendingElements.Add(1)
+	ss.AddPending([]element{
+		{window: window.GlobalWindow{}, timestamp: 5, pane: typex.NoFiringPane(), elmBytes: []byte("a")},
+	})
+	if len(ss.spilled) != 1 {
+		t.Fatalf("len(spilled) = %v, want 1", len(ss.spilled))
+	}
+	if err := os.Remove(ss.spilled[0].seg.path); err != nil {
+		t.Fatal(err)
+	}
+
+	if bundIDs, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, func() string { return "0" }); ok {
+		t.Errorf("startBundle() = %v, %v, want no bundle", bundIDs, ok)
+	}
+	if err := em.Err(); err == nil {
+		t.Error("Err() = nil, want an error for the unreadable segment")
+	}
+	if got := len(ss.spilled); got != 1 {
+		t.Errorf("len(spilled) = %v, want the unreadable segment to remain", got)
+	}
+}
+
+func TestStageState_unspillIncremental(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(em *ElementManager)
+		// The number of segments read back by each bundle.
+		want []int
+	}{
+		{
+			name: "stateful",
+			setup: func(em *ElementManager) {
+				em.StageStateful("stage", stringKeyDec)
+			},
+			want: []int{1, 1, 1},
+		}, {
+			name:  "stateless",
+			setup: func(em *ElementManager) {},
+			want:  []int{1, 1, 1},
+		}, {
+			name: "sessions",
+			setup: func(em *ElementManager) {
+				em.StageSessions("stage", time.Millisecond, 0)
+			},
+			want: []int{3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			em := NewElementManager(Config{MemoryBudget: 1, SpillDir: t.TempDir()})
+			defer em.Spiller().Close()
+			em.AddStage("stage", []string{"input"}, nil, nil)
+			test.setup(em)
+			ss := em.stages["stage"]
+
+			em.pendingElements.Add(3)
+			for i, k := range []string{"a", "b", "c"} {
+				ts := mtime.Time(i * 10)
+				ss.AddPending([]element{
+					{window: window.IntervalWindow{Start: ts, End: ts + 5}, timestamp: ts, pane: typex.NoFiringPane(), elmBytes: encodeStringKey(k)},
+				})
+			}
+			if got := len(ss.spilled); got != 3 {
+				t.Fatalf("len(spilled) = %v, want 3 segments", got)
+			}
+
+			var got []int
+			for i := 0; len(ss.spilled) > 0 && i < 3; i++ {
+				before := len(ss.spilled)
+				if _, ok := ss.startBundle(em, mtime.MaxTimestamp, 0, func() string { return fmt.Sprint(i) }); !ok {
+					t.Fatalf("startBundle() = false, want a bundle with %v segments spilled", before)
+				}
+				got = append(got, before-len(ss.spilled))
+			}
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("segments read back by each bundle (-want, +got):\n%v", d)
+			}
+		})
+	}
+}
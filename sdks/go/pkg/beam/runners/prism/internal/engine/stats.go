@@ -0,0 +1,102 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+)
+
+// BundleLatencyBuckets are the upper bounds of the buckets for bundle latency histograms.
+var BundleLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// Histogram counts durations in the buckets bounded by BundleLatencyBuckets.
+type Histogram struct {
+	// Buckets holds the count of durations within each bucket, with a final
+	// bucket for durations beyond the largest bound. Buckets aren't cumulative.
+	Buckets []int64
+	Count   int64
+	Sum     time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]int64, len(BundleLatencyBuckets)+1)
+	}
+	i := sort.Search(len(BundleLatencyBuckets), func(i int) bool {
+		return d <= BundleLatencyBuckets[i]
+	})
+	h.Buckets[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h Histogram) clone() Histogram {
+	h.Buckets = append([]int64(nil), h.Buckets...)
+	return h
+}
+
+// StageStats is a snapshot of the execution of a stage, for monitoring.
+type StageStats struct {
+	ID                string
+	PendingElements   int        // Elements waiting to be processed by the stage.
+	InprogressBundles int        // Bundles currently being processed by the stage.
+	InputWatermark    mtime.Time // Input watermark for the stage's parallel input.
+	OutputWatermark   mtime.Time
+	BundleLatency     Histogram // Time from starting to persisting the stage's bundles.
+	SpilledElements   int       // Pending elements currently paged out to disk.
+	SpilledBytes      int64     // Total bytes of pending elements paged out to disk.
+	DroppedLate       int       // Elements dropped for arriving after their window expired.
+}
+
+// StageStats returns a snapshot of the execution of each stage, ordered by stage ID.
+func (em *ElementManager) StageStats() []StageStats {
+	stats := make([]StageStats, 0, len(em.stages))
+	for _, ss := range em.stages {
+		ss.mu.Lock()
+		stats = append(stats, StageStats{
+			ID:                ss.ID,
+			PendingElements:   len(ss.pending) + ss.spilledCount,
+			InprogressBundles: len(ss.inprogress),
+			InputWatermark:    ss.input,
+			OutputWatermark:   ss.output,
+			BundleLatency:     ss.bundleLatency.clone(),
+			SpilledElements:   ss.spilledCount,
+			SpilledBytes:      ss.spilledBytes,
+			DroppedLate:       ss.droppedLate,
+		})
+		ss.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ID < stats[j].ID
+	})
+	return stats
+}
@@ -0,0 +1,80 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistogram_observe(t *testing.T) {
+	var h Histogram
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Second, time.Hour} {
+		h.observe(d)
+	}
+	want := make([]int64, len(BundleLatencyBuckets)+1)
+	want[0] = 2                         // 0 and 1ms are within the first bound.
+	want[1] = 1                         // 2ms
+	want[8] = 1                         // 1s
+	want[len(BundleLatencyBuckets)] = 1 // 1h is beyond all bounds.
+	if d := cmp.Diff(want, h.Buckets); d != "" {
+		t.Errorf("observe() buckets (-want, +got):\n%v", d)
+	}
+	if got, want := h.Count, int64(5); got != want {
+		t.Errorf("observe() count = %v, want %v", got, want)
+	}
+	if got, want := h.Sum, time.Hour+time.Second+3*time.Millisecond; got != want {
+		t.Errorf("observe() sum = %v, want %v", got, want)
+	}
+}
+
+func TestElementManager_StageStats(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("impulse", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+	em.Impulse("impulse")
+
+	ch := em.Bundles(context.Background(), func() string { return "0" })
+	rb := <-ch
+
+	stats := em.StageStats()
+	if got, want := len(stats), 2; got != want {
+		t.Fatalf("len(StageStats()) = %v, want %v", got, want)
+	}
+	dofn := stats[0]
+	if got, want := dofn.ID, "dofn"; got != want {
+		t.Fatalf("StageStats()[0].ID = %v, want %v", got, want)
+	}
+	if got, want := dofn.InprogressBundles, 1; got != want {
+		t.Errorf("InprogressBundles = %v, want %v", got, want)
+	}
+	if got, want := stats[1].OutputWatermark, mtime.MaxTimestamp; got != want {
+		t.Errorf("impulse OutputWatermark = %v, want %v", got, want)
+	}
+
+	em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+	dofn = em.StageStats()[0]
+	if got, want := dofn.InprogressBundles, 0; got != want {
+		t.Errorf("InprogressBundles after persisting = %v, want %v", got, want)
+	}
+	if got, want := dofn.BundleLatency.Count, int64(1); got != want {
+		t.Errorf("BundleLatency.Count after persisting = %v, want %v", got, want)
+	}
+}
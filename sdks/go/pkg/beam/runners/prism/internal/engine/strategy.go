@@ -17,9 +17,11 @@ package engine
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 )
 
@@ -45,6 +47,63 @@ func (ws sessionStrat) EarliestCompletion(w typex.Window) mtime.Time {
 	return w.MaxTimestamp().Add(ws.GapSize)
 }
 
+// mergeSessions returns the merged session window for each of the windows of the
+// given elements. Windows are merged when they're within the gap size of each
+// other, matching how session windows are merged when they're aggregated.
+func (ws sessionStrat) mergeSessions(es []element) map[typex.Window]typex.Window {
+	var wins []window.IntervalWindow
+	seen := map[typex.Window]bool{}
+	for _, e := range es {
+		iw, ok := e.window.(window.IntervalWindow)
+		if !ok || seen[iw] {
+			continue
+		}
+		seen[iw] = true
+		wins = append(wins, iw)
+	}
+	sort.Slice(wins, func(i, j int) bool {
+		return wins[i].Start < wins[j].Start
+	})
+	gap := mtime.Time(ws.GapSize.Milliseconds())
+	merged := map[typex.Window]typex.Window{}
+	for i := 0; i < len(wins); {
+		session := wins[i]
+		j := i + 1
+		for ; j < len(wins) && wins[j].Start <= session.End+gap; j++ {
+			if wins[j].End > session.End {
+				session.End = wins[j].End
+			}
+		}
+		for _, w := range wins[i:j] {
+			merged[w] = session
+		}
+		i = j
+	}
+	return merged
+}
+
 func (ws sessionStrat) String() string {
 	return fmt.Sprintf("session[GapSize:%v]", ws.GapSize)
 }
+
+// TriggerStrat is the triggering portion of a windowing strategy, which
+// determines when panes are produced for each key and window of an aggregation.
+type TriggerStrat struct {
+	Trigger         Trigger
+	Accumulating    bool          // Whether fired elements are retained, and included in later panes.
+	AllowedLateness time.Duration // How long after the end of a window late data is still accepted.
+}
+
+// gcTime returns the time after which the window is expired, and its state
+// may be garbage collected. Late elements for expired windows are dropped.
+func (ts *TriggerStrat) gcTime(w typex.Window) mtime.Time {
+	return gcTime(w, ts.AllowedLateness)
+}
+
+func (ts *TriggerStrat) String() string {
+	mode := "discarding"
+	if ts.Accumulating {
+		mode = "accumulating"
+	}
+	return fmt.Sprintf("trigger[%v, %v, AllowedLateness:%v]", ts.Trigger, mode, ts.AllowedLateness)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestEarliestCompletion(t *testing.T) {
@@ -43,3 +44,26 @@ func TestEarliestCompletion(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionStrat_mergeSessions(t *testing.T) {
+	ws := sessionStrat{GapSize: 3 * time.Millisecond}
+	iw := func(start, end mtime.Time) window.IntervalWindow {
+		return window.IntervalWindow{Start: start, End: end}
+	}
+	var es []element
+	for _, w := range []window.IntervalWindow{iw(10, 13), iw(0, 3), iw(4, 7), iw(5, 8), iw(20, 23)} {
+		es = append(es, element{window: w})
+	}
+	got := ws.mergeSessions(es)
+	// Windows starting within the gap size of a session are merged into it.
+	want := map[typex.Window]typex.Window{
+		iw(0, 3):   iw(0, 13),
+		iw(4, 7):   iw(0, 13),
+		iw(5, 8):   iw(0, 13),
+		iw(10, 13): iw(0, 13),
+		iw(20, 23): iw(20, 23),
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("mergeSessions() diff (-want, +got):\n%v", d)
+	}
+}
@@ -0,0 +1,271 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"golang.org/x/exp/slog"
+)
+
+// TestStreamElement is an encoded element, and it's event time, to be
+// emitted by a TestStream.
+type TestStreamElement struct {
+	Encoded   []byte
+	EventTime mtime.Time
+}
+
+// TestStreamBuilder adds events to a TestStream's script.
+// Events are executed in the order they are added.
+type TestStreamBuilder interface {
+	// AddElementEvent emits the elements to the output PCollection for the tag.
+	AddElementEvent(tag string, elements []TestStreamElement)
+	// AddWatermarkEvent advances the watermark of the output PCollection for the tag.
+	AddWatermarkEvent(tag string, newWatermark mtime.Time)
+	// AddProcessingTimeEvent advances the processing time of the job.
+	// The maximum duration advances the processing time to the maximum timestamp.
+	AddProcessingTimeEvent(d time.Duration)
+	// OnElementEvent sets a callback that's called with the output PCollection
+	// and elements of each element event, as the event executes.
+	OnElementEvent(fn func(pcollection string, elements []TestStreamElement))
+}
+
+// testStreamHandler manages the events of a TestStream for the ElementManager.
+//
+// TestStreams are a root of the pipeline, like an Impulse. Unlike an Impulse,
+// they strictly control the watermarks of their outputs, and the processing
+// time of the job. Events are only executed once the rest of the pipeline
+// has no work it can do, so the pipeline follows the script deterministically.
+//
+// A pipeline may only have a single TestStream, since it coordinates execution
+// for the whole pipeline.
+//
+// All fields are protected by the ElementManager's refreshCond lock.
+type testStreamHandler struct {
+	ID string // ID of the TestStream stage.
+
+	events         []tsEvent
+	nextEventIndex int
+	completed      bool
+	onElementEvent func(pcollection string, elements []TestStreamElement)
+
+	tagState       map[string]tagState // Output state, keyed by the output tag.
+	processingTime mtime.Time          // Synthetic processing time for the job.
+}
+
+// tagState is the state of a single TestStream output.
+type tagState struct {
+	pcollection string
+	watermark   mtime.Time
+}
+
+// tsEvent is a single scripted event of a TestStream.
+type tsEvent interface {
+	// Execute applies the event to the ElementManager.
+	// Must be called while holding em.refreshCond.L
+	Execute(em *ElementManager)
+}
+
+// AddTestStream marks and initializes the given stage as a TestStream, which
+// is a root transform that emits elements and advances watermarks according
+// to its script. The tagToPCol map relates the output tags used in events to
+// the output PCollection IDs.
+//
+// The TestStream is pending work until all of its events have executed,
+// after which its outputs' watermarks are advanced to the end of time.
+func (em *ElementManager) AddTestStream(ID string, tagToPCol map[string]string) TestStreamBuilder {
+	if em.testStreamHandler != nil {
+		panic(fmt.Sprintf("unable to add TestStream %v, pipeline already has TestStream %v", ID, em.testStreamHandler.ID))
+	}
+	ts := &testStreamHandler{
+		ID:             ID,
+		tagState:       map[string]tagState{},
+		processingTime: mtime.Now(),
+	}
+	for tag, pcol := range tagToPCol {
+		ts.tagState[tag] = tagState{pcollection: pcol, watermark: mtime.MinTimestamp}
+	}
+	em.testStreamHandler = ts
+	em.pendingElements.Add(1)
+	return ts
+}
+
+// AddElementEvent adds an element event to the script.
+func (ts *testStreamHandler) AddElementEvent(tag string, elements []TestStreamElement) {
+	ts.events = append(ts.events, tsElementEvent{Tag: tag, Elements: elements})
+}
+
+// AddWatermarkEvent adds a watermark event to the script.
+func (ts *testStreamHandler) AddWatermarkEvent(tag string, newWatermark mtime.Time) {
+	ts.events = append(ts.events, tsWatermarkEvent{Tag: tag, NewWatermark: newWatermark})
+}
+
+// AddProcessingTimeEvent adds a processing time event to the script.
+func (ts *testStreamHandler) AddProcessingTimeEvent(d time.Duration) {
+	ts.events = append(ts.events, tsProcessingTimeEvent{AdvanceBy: d})
+}
+
+// OnElementEvent sets the callback for executed element events.
+func (ts *testStreamHandler) OnElementEvent(fn func(pcollection string, elements []TestStreamElement)) {
+	ts.onElementEvent = fn
+}
+
+// NextEvent returns the next event to execute, or nil if the TestStream
+// has completed, or if there's no TestStream at all.
+// Once the scripted events are exhausted, a final event completes the stream.
+func (ts *testStreamHandler) NextEvent() tsEvent {
+	if ts == nil || ts.completed {
+		return nil
+	}
+	if ts.nextEventIndex >= len(ts.events) {
+		ts.completed = true
+		return tsFinalEvent{}
+	}
+	ev := ts.events[ts.nextEventIndex]
+	ts.nextEventIndex++
+	return ev
+}
+
+// skipRemainingEvents drops the unexecuted events of the script, so the
+// TestStream completes with its next event. Used when the job drains.
+func (ts *testStreamHandler) skipRemainingEvents() {
+	if ts == nil {
+		return
+	}
+	ts.nextEventIndex = len(ts.events)
+}
+
+// setWatermark advances the watermark for the given tag, and updates the
+// consumers of the related PCollection.
+func (ts *testStreamHandler) setWatermark(em *ElementManager, tag string, newWatermark mtime.Time) {
+	t, ok := ts.tagState[tag]
+	if !ok {
+		panic(fmt.Sprintf("TestStream %v: unknown output tag %q", ts.ID, tag))
+	}
+	if newWatermark <= t.watermark {
+		return
+	}
+	t.watermark = newWatermark
+	ts.tagState[tag] = t
+
+	for _, sID := range em.consumers[t.pcollection] {
+		em.stages[sID].updateUpstreamWatermark(t.pcollection, newWatermark)
+		em.watermarkRefreshes.insert(sID)
+	}
+	for _, sID := range em.sideConsumers[t.pcollection] {
+		em.watermarkRefreshes.insert(sID)
+	}
+
+	// The stage's output watermark is only used to determine side input readiness,
+	// so it's the minimum of all the output watermarks.
+	minW := mtime.MaxTimestamp
+	for _, t := range ts.tagState {
+		minW = mtime.Min(minW, t.watermark)
+	}
+	ss := em.stages[ts.ID]
+	ss.mu.Lock()
+	ss.input = minW
+	ss.output = minW
+	ss.mu.Unlock()
+}
+
+// tsElementEvent emits elements to the consumers of an output.
+type tsElementEvent struct {
+	Tag      string
+	Elements []TestStreamElement
+}
+
+// Execute adds the elements to the pending elements of the consumers of the output.
+func (ev tsElementEvent) Execute(em *ElementManager) {
+	t, ok := em.testStreamHandler.tagState[ev.Tag]
+	if !ok {
+		panic(fmt.Sprintf("TestStream %v: unknown output tag %q", em.testStreamHandler.ID, ev.Tag))
+	}
+	var newPending []element
+	for _, e := range ev.Elements {
+		newPending = append(newPending, element{
+			window:    window.GlobalWindow{},
+			timestamp: e.EventTime,
+			pane:      typex.NoFiringPane(),
+			elmBytes:  e.Encoded,
+		})
+	}
+	if fn := em.testStreamHandler.onElementEvent; fn != nil {
+		fn(t.pcollection, ev.Elements)
+	}
+	em.sampleElements(t.pcollection, newPending)
+	consumers := em.consumers[t.pcollection]
+	slog.Debug("TestStream: adding elements", slog.String("tag", ev.Tag), slog.Int("count", len(newPending)), slog.Any("consumers", consumers))
+	for _, sID := range consumers {
+		em.pendingElements.Add(len(newPending))
+		em.stages[sID].AddPending(newPending)
+		em.watermarkRefreshes.insert(sID)
+	}
+}
+
+// tsWatermarkEvent advances the watermark of an output.
+type tsWatermarkEvent struct {
+	Tag          string
+	NewWatermark mtime.Time
+}
+
+// Execute advances the watermark for the output, informing consumers.
+func (ev tsWatermarkEvent) Execute(em *ElementManager) {
+	slog.Debug("TestStream: advancing watermark", slog.String("tag", ev.Tag), slog.Any("watermark", ev.NewWatermark))
+	em.testStreamHandler.setWatermark(em, ev.Tag, ev.NewWatermark)
+}
+
+// tsProcessingTimeEvent advances the processing time of the job.
+type tsProcessingTimeEvent struct {
+	AdvanceBy time.Duration
+}
+
+// Execute advances the synthetic processing time, and refreshes stages
+// with processing time timers or triggers, so they may fire.
+func (ev tsProcessingTimeEvent) Execute(em *ElementManager) {
+	ts := em.testStreamHandler
+	// Avoid overflowing when advancing to "infinity".
+	if ev.AdvanceBy == math.MaxInt64 || ev.AdvanceBy.Milliseconds() >= int64(mtime.MaxTimestamp-ts.processingTime) {
+		ts.processingTime = mtime.MaxTimestamp
+	} else {
+		ts.processingTime = ts.processingTime.Add(ev.AdvanceBy)
+	}
+	slog.Debug("TestStream: advancing processing time", slog.Any("processingTime", ts.processingTime))
+	for sID, ss := range em.stages {
+		if len(ss.processingTimeTimers) > 0 || ss.triggerStrat != nil {
+			em.watermarkRefreshes.insert(sID)
+		}
+	}
+}
+
+// tsFinalEvent completes the TestStream, advancing all outputs to the end of time.
+type tsFinalEvent struct{}
+
+// Execute advances all output watermarks to the maximum timestamp, and releases
+// the TestStream's pending work so the job may terminate.
+func (tsFinalEvent) Execute(em *ElementManager) {
+	ts := em.testStreamHandler
+	slog.Debug("TestStream: completed", slog.String("ID", ts.ID))
+	for tag := range ts.tagState {
+		ts.setWatermark(em, tag, mtime.MaxTimestamp)
+	}
+	em.pendingElements.Done()
+}
@@ -0,0 +1,166 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTestStream_Script(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("ts", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+
+	tsb := em.AddTestStream("ts", map[string]string{"out": "output"})
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{1}, EventTime: 100}})
+	tsb.AddWatermarkEvent("out", 110)
+	// Elements are processed as they arrive, including late data.
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{2}, EventTime: 90}, {Encoded: []byte{3}, EventTime: 120}})
+	tsb.AddWatermarkEvent("out", 130)
+
+	var i int
+	ch := em.Bundles(context.Background(), func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	})
+
+	type bundle struct {
+		Watermark  mtime.Time
+		Timestamps []mtime.Time
+	}
+	var got []bundle
+	for rb := range ch {
+		ss := em.stages[rb.StageID]
+		ss.mu.Lock()
+		var ts []mtime.Time
+		for _, e := range ss.inprogress[rb.BundleID].es {
+			ts = append(ts, e.timestamp)
+		}
+		ss.mu.Unlock()
+		got = append(got, bundle{Watermark: rb.Watermark, Timestamps: ts})
+		em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+	}
+	want := []bundle{
+		{Watermark: mtime.MinTimestamp, Timestamps: []mtime.Time{100}},
+		{Watermark: 110, Timestamps: []mtime.Time{90, 120}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("bundles diff (-want, +got):\n%v", d)
+	}
+	if got, want := em.stages["dofn"].InputWatermark(), mtime.MaxTimestamp; got != want {
+		t.Errorf("dofn.InputWatermark() = %v, want %v", got, want)
+	}
+}
+
+func TestTestStream_OnElementEvent(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("ts", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+
+	tsb := em.AddTestStream("ts", map[string]string{"out": "output"})
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{1}, EventTime: 100}})
+	tsb.AddWatermarkEvent("out", 110)
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{2}, EventTime: 120}})
+
+	var events [][]byte
+	tsb.OnElementEvent(func(pcollection string, elements []TestStreamElement) {
+		if pcollection != "output" {
+			t.Errorf("OnElementEvent pcollection = %v, want output", pcollection)
+		}
+		var encoded []byte
+		for _, e := range elements {
+			encoded = append(encoded, e.Encoded...)
+		}
+		events = append(events, encoded)
+	})
+
+	var got [][][]byte
+	ch := em.Bundles(context.Background(), func() string { return "b" })
+	for rb := range ch {
+		// Only events that have executed have been seen.
+		got = append(got, append([][]byte(nil), events...))
+		em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+	}
+	want := [][][]byte{{{1}}, {{1}, {2}}}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("element events diff (-want, +got):\n%v", d)
+	}
+}
+
+func TestTestStream_Drain(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("ts", nil, nil, []string{"output"})
+	em.AddStage("dofn", []string{"output"}, nil, nil)
+
+	tsb := em.AddTestStream("ts", map[string]string{"out": "output"})
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{1}, EventTime: 100}})
+	// Draining skips the remaining events.
+	tsb.AddElementEvent("out", []TestStreamElement{{Encoded: []byte{2}, EventTime: 110}})
+	tsb.AddWatermarkEvent("out", 120)
+
+	var i int
+	ch := em.Bundles(context.Background(), func() string {
+		defer func() { i++ }()
+		return fmt.Sprintf("%v", i)
+	})
+	var got []RunBundle
+	for rb := range ch {
+		got = append(got, rb)
+		if !em.Draining() {
+			em.Drain()
+		}
+		em.PersistBundle(rb, nil, TentativeData{}, PColInfo{}, nil, nil)
+	}
+	want := []RunBundle{{StageID: "dofn", BundleID: "0", Watermark: mtime.MinTimestamp}}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("bundles diff (-want, +got):\n%v", d)
+	}
+	if got, want := em.stages["dofn"].InputWatermark(), mtime.MaxTimestamp; got != want {
+		t.Errorf("dofn.InputWatermark() = %v, want %v", got, want)
+	}
+}
+
+func TestTestStream_ProcessingTime(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("ts", nil, nil, []string{"output"})
+
+	tsb := em.AddTestStream("ts", map[string]string{"out": "output"})
+	tsb.AddProcessingTimeEvent(time.Second)
+	tsb.AddProcessingTimeEvent(time.Duration(math.MaxInt64))
+
+	start := em.processingTimeNow()
+	em.testStreamHandler.NextEvent().Execute(em)
+	if got, want := em.processingTimeNow(), start.Add(time.Second); got != want {
+		t.Errorf("after advancing by a second: processingTimeNow() = %v, want %v", got, want)
+	}
+	em.testStreamHandler.NextEvent().Execute(em)
+	if got, want := em.processingTimeNow(), mtime.MaxTimestamp; got != want {
+		t.Errorf("after advancing to infinity: processingTimeNow() = %v, want %v", got, want)
+	}
+	if _, ok := em.testStreamHandler.NextEvent().(tsFinalEvent); !ok {
+		t.Error("expected final event after scripted events")
+	}
+	if ev := em.testStreamHandler.NextEvent(); ev != nil {
+		t.Errorf("NextEvent() after completion = %v, want nil", ev)
+	}
+}
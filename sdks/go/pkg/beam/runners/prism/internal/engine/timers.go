@@ -0,0 +1,253 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+// timerKey uniquely identifies a timer. Only the most recent setting
+// of a timer is retained, so setting a timer with the same key replaces
+// the earlier firing, and clearing a timer removes it.
+type timerKey struct {
+	transform, family, tag string
+	window                 typex.Window
+	key                    string
+}
+
+// sortTimers orders fired timers by their firing timestamp, then by family and tag,
+// with the transform, key and window breaking any remaining ties.
+func sortTimers(ts []element) {
+	sort.Slice(ts, func(i, j int) bool {
+		a, b := ts[i], ts[j]
+		switch {
+		case a.timestamp != b.timestamp:
+			return a.timestamp < b.timestamp
+		case a.family != b.family:
+			return a.family < b.family
+		case a.tag != b.tag:
+			return a.tag < b.tag
+		case a.transform != b.transform:
+			return a.transform < b.transform
+		case !bytes.Equal(a.keyBytes, b.keyBytes):
+			return bytes.Compare(a.keyBytes, b.keyBytes) < 0
+		default:
+			return a.window.MaxTimestamp() < b.window.MaxTimestamp()
+		}
+	})
+}
+
+// timerChange is a single timer modification decoded from SDK output.
+type timerChange struct {
+	key   timerKey
+	clear bool
+	timer element // Only valid if clear is false.
+}
+
+// decodeTimers decodes the encoded timers written by a bundle for a given transform and timer family.
+//
+// Timers are encoded with the standard timer coder: the user key, the timer tag, the windows,
+// whether the timer is cleared, and if not, the fire time, hold time, and pane.
+func decodeTimers(link LinkID, keyDec func(io.Reader) []byte, wDec exec.WindowDecoder, data []byte) ([]timerChange, error) {
+	var ret []timerChange
+	buf := bytes.NewBuffer(data)
+	for buf.Len() > 0 {
+		keyBytes := keyDec(buf)
+		tag, err := coder.DecodeStringUTF8(buf)
+		if err != nil {
+			return nil, fmt.Errorf("decoding timer tag for %v: %w", link, err)
+		}
+		ws, err := wDec.Decode(buf)
+		if err != nil {
+			return nil, fmt.Errorf("decoding timer windows for %v: %w", link, err)
+		}
+		clear, err := coder.DecodeBool(buf)
+		if err != nil {
+			return nil, fmt.Errorf("decoding timer clear bit for %v: %w", link, err)
+		}
+		var fire, hold mtime.Time
+		var pane typex.PaneInfo
+		if !clear {
+			if fire, err = coder.DecodeEventTime(buf); err != nil {
+				return nil, fmt.Errorf("decoding timer fire time for %v: %w", link, err)
+			}
+			if hold, err = coder.DecodeEventTime(buf); err != nil {
+				return nil, fmt.Errorf("decoding timer hold time for %v: %w", link, err)
+			}
+			if pane, err = coder.DecodePane(buf); err != nil {
+				return nil, fmt.Errorf("decoding timer pane for %v: %w", link, err)
+			}
+		}
+		for _, w := range ws {
+			ret = append(ret, timerChange{
+				key: timerKey{
+					transform: link.Transform,
+					family:    link.Local,
+					tag:       tag,
+					window:    w,
+					key:       string(keyBytes),
+				},
+				clear: clear,
+				timer: element{
+					window:        w,
+					timestamp:     fire,
+					holdTimestamp: hold,
+					pane:          pane,
+					transform:     link.Transform,
+					family:        link.Local,
+					tag:           tag,
+					keyBytes:      keyBytes,
+				},
+			})
+		}
+	}
+	return ret, nil
+}
+
+// ToTimers encodes the fired timers in the elements with the standard timer coder,
+// grouped by their transform and timer family.
+func (es elements) ToTimers(info PColInfo) map[LinkID][]byte {
+	bufs := map[LinkID]*bytes.Buffer{}
+	for _, e := range es.es {
+		if !e.IsTimer() {
+			continue
+		}
+		link := LinkID{Transform: e.transform, Local: e.family}
+		buf, ok := bufs[link]
+		if !ok {
+			buf = &bytes.Buffer{}
+			bufs[link] = buf
+		}
+		buf.Write(e.keyBytes)
+		coder.EncodeStringUTF8(e.tag, buf)
+		info.WEnc.Encode([]typex.Window{e.window}, buf)
+		coder.EncodeBool(false, buf)
+		coder.EncodeEventTime(e.timestamp, buf)
+		coder.EncodeEventTime(e.holdTimestamp, buf)
+		coder.EncodePane(e.pane, buf)
+	}
+	ret := map[LinkID][]byte{}
+	for link, buf := range bufs {
+		ret[link] = buf.Bytes()
+	}
+	return ret
+}
+
+// commitTimers applies the timer modifications from a bundle to the stage's set timers,
+// adjusting the watermark holds accordingly. It returns the change in the number of
+// set timers, and the firing times of any newly set processing time timers.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) commitTimers(d TentativeData, wDec exec.WindowDecoder) (int, []mtime.Time) {
+	var delta int
+	var procTimes []mtime.Time
+	for link, data := range d.timers {
+		for _, datum := range data {
+			changes, err := decodeTimers(link, ss.keyDec, wDec, datum)
+			if err != nil {
+				panic(fmt.Sprintf("stage %v: %v", ss.ID, err))
+			}
+			for _, c := range changes {
+				if old, ok := ss.timers[c.key]; ok {
+					ss.releaseHold(old.holdTimestamp)
+					delete(ss.timers, c.key)
+					delta--
+				}
+				if c.clear {
+					continue
+				}
+				if ss.timers == nil {
+					ss.timers = map[timerKey]element{}
+				}
+				ss.timers[c.key] = c.timer
+				ss.addHold(c.timer.holdTimestamp)
+				delta++
+				if ss.processingTimeTimers[link] {
+					procTimes = append(procTimes, c.timer.timestamp)
+				}
+			}
+		}
+	}
+	return delta, procTimes
+}
+
+// timerReady returns whether the given set timer may fire.
+//
+// Event time timers fire once the input watermark has passed their firing time.
+// Processing time timers fire once the processing clock has passed their firing
+// time, or once the input is complete, since no further input will arrive.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) timerReady(t element, now mtime.Time) bool {
+	if ss.processingTimeTimers[LinkID{Transform: t.transform, Local: t.family}] {
+		return t.timestamp <= now || ss.input == mtime.MaxTimestamp
+	}
+	return t.timestamp < ss.input
+}
+
+// hasReadyTimers returns whether any set timers may fire for keys that aren't
+// currently being processed, as of the given processing time.
+//
+// Assumes the stage's lock is held.
+func (ss *stageState) hasReadyTimers(now mtime.Time) bool {
+	for _, t := range ss.timers {
+		if _, ok := ss.inprogressKeys[string(t.keyBytes)]; ok {
+			continue
+		}
+		if ss.timerReady(t, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// addHold adds a watermark hold at the given time.
+// Assumes the stage's lock is held.
+func (ss *stageState) addHold(t mtime.Time) {
+	if ss.watermarkHolds == nil {
+		ss.watermarkHolds = map[mtime.Time]int{}
+	}
+	ss.watermarkHolds[t]++
+}
+
+// releaseHold removes a watermark hold at the given time.
+// Assumes the stage's lock is held.
+func (ss *stageState) releaseHold(t mtime.Time) {
+	ss.watermarkHolds[t]--
+	if ss.watermarkHolds[t] <= 0 {
+		delete(ss.watermarkHolds, t)
+	}
+}
+
+// minWatermarkHold returns the earliest watermark hold for the stage,
+// or the maximum timestamp if there are no holds.
+func (ss *stageState) minWatermarkHold() mtime.Time {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	minHold := mtime.MaxTimestamp
+	for t := range ss.watermarkHolds {
+		minHold = mtime.Min(minHold, t)
+	}
+	return minHold
+}
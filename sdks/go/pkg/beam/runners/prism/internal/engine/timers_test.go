@@ -0,0 +1,150 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	"github.com/google/go-cmp/cmp"
+)
+
+func stringKeyDec(r io.Reader) []byte {
+	var buf bytes.Buffer
+	coder.DecodeStringUTF8(io.TeeReader(r, &buf))
+	return buf.Bytes()
+}
+
+func encodeStringKey(k string) []byte {
+	var buf bytes.Buffer
+	coder.EncodeStringUTF8(k, &buf)
+	return buf.Bytes()
+}
+
+// encodeTestTimer encodes a global window timer set or clear with the standard timer coder.
+func encodeTestTimer(key, tag string, clear bool, fire, hold mtime.Time) []byte {
+	var buf bytes.Buffer
+	coder.EncodeStringUTF8(key, &buf)
+	coder.EncodeStringUTF8(tag, &buf)
+	exec.MakeWindowEncoder(coder.NewGlobalWindow()).Encode([]typex.Window{window.GlobalWindow{}}, &buf)
+	coder.EncodeBool(clear, &buf)
+	if !clear {
+		coder.EncodeEventTime(fire, &buf)
+		coder.EncodeEventTime(hold, &buf)
+		coder.EncodePane(typex.NoFiringPane(), &buf)
+	}
+	return buf.Bytes()
+}
+
+func TestTimers_RoundTrip(t *testing.T) {
+	wc := coder.NewGlobalWindow()
+	info := PColInfo{
+		WDec: exec.MakeWindowDecoder(wc),
+		WEnc: exec.MakeWindowEncoder(wc),
+	}
+	fired := elements{es: []element{
+		{elmBytes: []byte{1}}, // Data elements are ignored.
+		{
+			window: window.GlobalWindow{}, timestamp: 10, holdTimestamp: 5, pane: typex.NoFiringPane(),
+			transform: "t1", family: "f1", tag: "", keyBytes: encodeStringKey("a"),
+		}, {
+			window: window.GlobalWindow{}, timestamp: 20, holdTimestamp: 20, pane: typex.NoFiringPane(),
+			transform: "t1", family: "f1", tag: "tag", keyBytes: encodeStringKey("b"),
+		},
+	}}
+	encoded := fired.ToTimers(info)
+	link := LinkID{Transform: "t1", Local: "f1"}
+	if got, want := len(encoded), 1; got != want {
+		t.Fatalf("len(ToTimers()) = %v, want %v", got, want)
+	}
+	changes, err := decodeTimers(link, stringKeyDec, info.WDec, encoded[link])
+	if err != nil {
+		t.Fatalf("decodeTimers() = %v", err)
+	}
+	var got []element
+	for _, c := range changes {
+		if c.clear {
+			t.Errorf("decodeTimers() returned cleared timer %+v", c)
+		}
+		got = append(got, c.timer)
+	}
+	if d := cmp.Diff(fired.es[1:], got, cmp.AllowUnexported(element{})); d != "" {
+		t.Errorf("decodeTimers(ToTimers()) diff (-want, +got):\n%v", d)
+	}
+}
+
+func TestStageState_commitTimers(t *testing.T) {
+	wDec := exec.MakeWindowDecoder(coder.NewGlobalWindow())
+	ss := makeStageState("test", []string{"testInput"}, nil, []string{"testOutput"})
+	ss.keyDec = stringKeyDec
+
+	commit := func(timers ...[]byte) int {
+		var d TentativeData
+		for _, tm := range timers {
+			d.WriteTimers("t1", "f1", tm)
+		}
+		delta, _ := ss.commitTimers(d, wDec)
+		return delta
+	}
+
+	if got, want := commit(
+		encodeTestTimer("a", "", false, 10, 10),
+		encodeTestTimer("a", "tag", false, 20, 15),
+		encodeTestTimer("b", "", false, 30, 30),
+	), 3; got != want {
+		t.Errorf("setting timers: delta = %v, want %v", got, want)
+	}
+	if got, want := ss.minWatermarkHold(), mtime.Time(10); got != want {
+		t.Errorf("after setting timers: minWatermarkHold() = %v, want %v", got, want)
+	}
+
+	// Resetting a timer replaces the earlier firing and hold.
+	if got, want := commit(encodeTestTimer("a", "", false, 40, 40)), 0; got != want {
+		t.Errorf("resetting timer: delta = %v, want %v", got, want)
+	}
+	if got, want := ss.minWatermarkHold(), mtime.Time(15); got != want {
+		t.Errorf("after resetting timer: minWatermarkHold() = %v, want %v", got, want)
+	}
+
+	// Clearing only affects the timer with the given tag.
+	if got, want := commit(encodeTestTimer("a", "tag", true, 0, 0), encodeTestTimer("c", "", true, 0, 0)), -1; got != want {
+		t.Errorf("clearing timers: delta = %v, want %v", got, want)
+	}
+	if got, want := ss.minWatermarkHold(), mtime.Time(30); got != want {
+		t.Errorf("after clearing timer: minWatermarkHold() = %v, want %v", got, want)
+	}
+	if got, want := len(ss.timers), 2; got != want {
+		t.Errorf("after clearing timer: len(timers) = %v, want %v", got, want)
+	}
+
+	// Event time timers are ready once the input watermark passes them.
+	ss.input = 35
+	var ready []string
+	for k, tm := range ss.timers {
+		if ss.timerReady(tm, mtime.Now()) {
+			ready = append(ready, k.key)
+		}
+	}
+	if d := cmp.Diff([]string{string(encodeStringKey("b"))}, ready); d != "" {
+		t.Errorf("ready timers diff (-want, +got):\n%v", d)
+	}
+}
@@ -0,0 +1,541 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+// Trigger is a state machine that determines when the pane for a key and window
+// of an aggregation fires.
+//
+// Triggers are stateless descriptions, and are evaluated against a triggerState
+// which holds the state of every trigger in the tree for a single pane.
+// Each trigger is responsible for invoking its subtriggers.
+type Trigger interface {
+	// onElement updates the trigger state for a new element in the pane.
+	onElement(in *triggerInput, st triggerState)
+	// shouldFire returns whether the pane should fire. It must not modify the state.
+	shouldFire(in *triggerInput, st triggerState) bool
+	// onFire updates the trigger state after the pane fires.
+	onFire(in *triggerInput, st triggerState)
+	// reset clears the trigger state, so the trigger may fire again.
+	reset(st triggerState)
+
+	fmt.Stringer
+}
+
+// triggerInput is the context a trigger is evaluated in.
+type triggerInput struct {
+	window    typex.Window
+	watermark mtime.Time // The input watermark of the aggregation.
+	now       mtime.Time // The current processing time.
+
+	newElements bool // Whether the pane has elements that haven't yet fired.
+}
+
+// endOfWindowReached returns whether the watermark has passed the end of the window.
+func (in *triggerInput) endOfWindowReached() bool {
+	return in.watermark > in.window.MaxTimestamp()
+}
+
+// nodeState is the state of a single trigger in the tree for a pane.
+// Triggers only use the fields relevant to them.
+type nodeState struct {
+	finished bool // Whether the trigger will no longer fire.
+
+	count               int        // Elements seen since the last reset, for element count triggers.
+	started             bool       // Whether an element has been seen, for processing time triggers.
+	firstProcessingTime mtime.Time // Processing time of the first element, for processing time triggers.
+	current             int        // Index of the current subtrigger, for AfterEach.
+	endOfWindowFired    bool       // Whether the on time pane has fired, for AfterEndOfWindow.
+}
+
+// triggerState is the state of all triggers in a tree, for a single pane.
+//
+// State is keyed by the trigger, so triggers with state must not be zero sized,
+// as pointers to distinct zero sized values may be equal.
+type triggerState map[Trigger]*nodeState
+
+// get returns the state for the given trigger, initializing it if necessary.
+func (st triggerState) get(t Trigger) *nodeState {
+	ns, ok := st[t]
+	if !ok {
+		ns = &nodeState{}
+		st[t] = ns
+	}
+	return ns
+}
+
+// isFinished returns whether the given trigger has finished.
+func (st triggerState) isFinished(t Trigger) bool {
+	ns, ok := st[t]
+	return ok && ns.finished
+}
+
+// TriggerNever never fires. Panes are only produced when the window expires.
+type TriggerNever struct{}
+
+func (t *TriggerNever) onElement(*triggerInput, triggerState)       {}
+func (t *TriggerNever) shouldFire(*triggerInput, triggerState) bool { return false }
+func (t *TriggerNever) onFire(*triggerInput, triggerState)          {}
+func (t *TriggerNever) reset(st triggerState)                       { delete(st, t) }
+func (t *TriggerNever) String() string                              { return "Never" }
+
+// TriggerAlways fires for every element, and never finishes.
+type TriggerAlways struct{}
+
+func (t *TriggerAlways) onElement(*triggerInput, triggerState)            {}
+func (t *TriggerAlways) shouldFire(in *triggerInput, _ triggerState) bool { return in.newElements }
+func (t *TriggerAlways) onFire(*triggerInput, triggerState)               {}
+func (t *TriggerAlways) reset(st triggerState)                            { delete(st, t) }
+func (t *TriggerAlways) String() string                                   { return "Always" }
+
+// TriggerAfterCount fires once the pane has at least ElementCount elements.
+type TriggerAfterCount struct {
+	ElementCount int
+}
+
+func (t *TriggerAfterCount) onElement(_ *triggerInput, st triggerState) {
+	st.get(t).count++
+}
+
+func (t *TriggerAfterCount) shouldFire(_ *triggerInput, st triggerState) bool {
+	ns := st.get(t)
+	return !ns.finished && ns.count >= t.ElementCount
+}
+
+func (t *TriggerAfterCount) onFire(_ *triggerInput, st triggerState) {
+	st.get(t).finished = true
+}
+
+func (t *TriggerAfterCount) reset(st triggerState) { delete(st, t) }
+func (t *TriggerAfterCount) String() string        { return fmt.Sprintf("AfterCount[%v]", t.ElementCount) }
+
+// TriggerAfterAll fires once all of its subtriggers are ready to fire,
+// and then finishes.
+type TriggerAfterAll struct {
+	SubTriggers []Trigger
+}
+
+func (t *TriggerAfterAll) onElement(in *triggerInput, st triggerState) {
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) {
+			sub.onElement(in, st)
+		}
+	}
+}
+
+func (t *TriggerAfterAll) shouldFire(in *triggerInput, st triggerState) bool {
+	if st.isFinished(t) {
+		return false
+	}
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) && !sub.shouldFire(in, st) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TriggerAfterAll) onFire(in *triggerInput, st triggerState) {
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) {
+			sub.onFire(in, st)
+		}
+	}
+	st.get(t).finished = true
+}
+
+func (t *TriggerAfterAll) reset(st triggerState) {
+	for _, sub := range t.SubTriggers {
+		sub.reset(st)
+	}
+	delete(st, t)
+}
+
+func (t *TriggerAfterAll) String() string { return "AfterAll" + subtriggersString(t.SubTriggers) }
+
+// TriggerAfterAny fires once any of its subtriggers are ready to fire,
+// and then finishes.
+type TriggerAfterAny struct {
+	SubTriggers []Trigger
+}
+
+func (t *TriggerAfterAny) onElement(in *triggerInput, st triggerState) {
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) {
+			sub.onElement(in, st)
+		}
+	}
+}
+
+func (t *TriggerAfterAny) shouldFire(in *triggerInput, st triggerState) bool {
+	if st.isFinished(t) {
+		return false
+	}
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) && sub.shouldFire(in, st) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TriggerAfterAny) onFire(in *triggerInput, st triggerState) {
+	for _, sub := range t.SubTriggers {
+		if !st.isFinished(sub) && sub.shouldFire(in, st) {
+			sub.onFire(in, st)
+		}
+	}
+	st.get(t).finished = true
+}
+
+func (t *TriggerAfterAny) reset(st triggerState) {
+	for _, sub := range t.SubTriggers {
+		sub.reset(st)
+	}
+	delete(st, t)
+}
+
+func (t *TriggerAfterAny) String() string { return "AfterAny" + subtriggersString(t.SubTriggers) }
+
+// TriggerAfterEach fires according to each of its subtriggers in turn,
+// moving to the next subtrigger once the current one finishes.
+// It finishes once the last subtrigger finishes.
+type TriggerAfterEach struct {
+	SubTriggers []Trigger
+}
+
+func (t *TriggerAfterEach) onElement(in *triggerInput, st triggerState) {
+	if ns := st.get(t); ns.current < len(t.SubTriggers) {
+		t.SubTriggers[ns.current].onElement(in, st)
+	}
+}
+
+func (t *TriggerAfterEach) shouldFire(in *triggerInput, st triggerState) bool {
+	ns := st.get(t)
+	return ns.current < len(t.SubTriggers) && t.SubTriggers[ns.current].shouldFire(in, st)
+}
+
+func (t *TriggerAfterEach) onFire(in *triggerInput, st triggerState) {
+	ns := st.get(t)
+	sub := t.SubTriggers[ns.current]
+	sub.onFire(in, st)
+	if st.isFinished(sub) {
+		ns.current++
+	}
+	ns.finished = ns.current >= len(t.SubTriggers)
+}
+
+func (t *TriggerAfterEach) reset(st triggerState) {
+	for _, sub := range t.SubTriggers {
+		sub.reset(st)
+	}
+	delete(st, t)
+}
+
+func (t *TriggerAfterEach) String() string { return "AfterEach" + subtriggersString(t.SubTriggers) }
+
+// TriggerRepeatedly fires whenever its subtrigger fires, resetting the
+// subtrigger when it finishes. It never finishes.
+type TriggerRepeatedly struct {
+	Repeated Trigger
+}
+
+func (t *TriggerRepeatedly) onElement(in *triggerInput, st triggerState) {
+	t.Repeated.onElement(in, st)
+}
+
+func (t *TriggerRepeatedly) shouldFire(in *triggerInput, st triggerState) bool {
+	return t.Repeated.shouldFire(in, st)
+}
+
+func (t *TriggerRepeatedly) onFire(in *triggerInput, st triggerState) {
+	t.Repeated.onFire(in, st)
+	if st.isFinished(t.Repeated) {
+		t.Repeated.reset(st)
+	}
+}
+
+func (t *TriggerRepeatedly) reset(st triggerState) {
+	t.Repeated.reset(st)
+	delete(st, t)
+}
+
+func (t *TriggerRepeatedly) String() string { return fmt.Sprintf("Repeat[%v]", t.Repeated) }
+
+// TriggerOrFinally fires whenever the main trigger fires, until the finally
+// trigger fires, which finishes the trigger.
+type TriggerOrFinally struct {
+	Main, Finally Trigger
+}
+
+func (t *TriggerOrFinally) onElement(in *triggerInput, st triggerState) {
+	t.Main.onElement(in, st)
+	t.Finally.onElement(in, st)
+}
+
+func (t *TriggerOrFinally) shouldFire(in *triggerInput, st triggerState) bool {
+	if st.isFinished(t) {
+		return false
+	}
+	return t.Main.shouldFire(in, st) || t.Finally.shouldFire(in, st)
+}
+
+func (t *TriggerOrFinally) onFire(in *triggerInput, st triggerState) {
+	if t.Finally.shouldFire(in, st) {
+		t.Finally.onFire(in, st)
+		st.get(t).finished = true
+		return
+	}
+	t.Main.onFire(in, st)
+	if st.isFinished(t.Main) {
+		st.get(t).finished = true
+	}
+}
+
+func (t *TriggerOrFinally) reset(st triggerState) {
+	t.Main.reset(st)
+	t.Finally.reset(st)
+	delete(st, t)
+}
+
+func (t *TriggerOrFinally) String() string {
+	return fmt.Sprintf("OrFinally[%v,%v]", t.Main, t.Finally)
+}
+
+// TriggerAfterEndOfWindow fires once the watermark passes the end of the window.
+//
+// Before then, the optional Early trigger may fire speculative panes, and
+// afterwards, the optional Late trigger may fire panes for late data.
+// Early and Late triggers are implicitly repeated. Without a Late trigger,
+// the trigger finishes once the watermark passes the end of the window.
+type TriggerAfterEndOfWindow struct {
+	Early, Late Trigger
+}
+
+func (t *TriggerAfterEndOfWindow) onElement(in *triggerInput, st triggerState) {
+	if !st.get(t).endOfWindowFired {
+		if t.Early != nil {
+			t.Early.onElement(in, st)
+		}
+		return
+	}
+	if t.Late != nil {
+		t.Late.onElement(in, st)
+	}
+}
+
+func (t *TriggerAfterEndOfWindow) shouldFire(in *triggerInput, st triggerState) bool {
+	ns := st.get(t)
+	if ns.finished {
+		return false
+	}
+	if !ns.endOfWindowFired {
+		return in.endOfWindowReached() || (t.Early != nil && t.Early.shouldFire(in, st))
+	}
+	return t.Late != nil && t.Late.shouldFire(in, st)
+}
+
+func (t *TriggerAfterEndOfWindow) onFire(in *triggerInput, st triggerState) {
+	ns := st.get(t)
+	if !ns.endOfWindowFired {
+		if !in.endOfWindowReached() {
+			// An early firing.
+			t.Early.onFire(in, st)
+			if st.isFinished(t.Early) {
+				t.Early.reset(st)
+			}
+			return
+		}
+		// The on time firing.
+		ns.endOfWindowFired = true
+		if t.Early != nil {
+			t.Early.reset(st)
+		}
+		ns.finished = t.Late == nil
+		return
+	}
+	t.Late.onFire(in, st)
+	if st.isFinished(t.Late) {
+		t.Late.reset(st)
+	}
+}
+
+func (t *TriggerAfterEndOfWindow) reset(st triggerState) {
+	if t.Early != nil {
+		t.Early.reset(st)
+	}
+	if t.Late != nil {
+		t.Late.reset(st)
+	}
+	delete(st, t)
+}
+
+func (t *TriggerAfterEndOfWindow) String() string {
+	return fmt.Sprintf("AfterEndOfWindow[Early: %v, Late: %v]", t.Early, t.Late)
+}
+
+// TriggerAfterProcessingTime fires once processing time has passed the
+// processing time of the first element in the pane, adjusted by the
+// timestamp transforms. It then finishes.
+type TriggerAfterProcessingTime struct {
+	Transforms []TimestampTransform
+}
+
+// TimestampTransform adjusts the processing time at which a
+// TriggerAfterProcessingTime fires.
+type TimestampTransform struct {
+	Delay         time.Duration // Added to the time, if non-zero.
+	AlignToPeriod time.Duration // Rounds the time up to the next period boundary, if non-zero.
+	AlignToOffset time.Duration // Offsets the period when aligning.
+}
+
+// apply adjusts the given time by the transform.
+func (tt TimestampTransform) apply(t mtime.Time) mtime.Time {
+	if tt.AlignToPeriod > 0 {
+		period := int64(tt.AlignToPeriod / time.Millisecond)
+		offset := int64(tt.AlignToOffset / time.Millisecond)
+		since := (int64(t) - offset) % period
+		if since == 0 {
+			return t // Already aligned.
+		}
+		return mtime.Time(int64(t) - since + period)
+	}
+	return t.Add(tt.Delay)
+}
+
+// firingTime returns the processing time at which the trigger fires,
+// and whether the trigger has seen an element yet.
+func (t *TriggerAfterProcessingTime) firingTime(st triggerState) (mtime.Time, bool) {
+	ns := st.get(t)
+	if !ns.started {
+		return mtime.MaxTimestamp, false
+	}
+	ft := ns.firstProcessingTime
+	for _, tt := range t.Transforms {
+		ft = tt.apply(ft)
+	}
+	return ft, true
+}
+
+func (t *TriggerAfterProcessingTime) onElement(in *triggerInput, st triggerState) {
+	if ns := st.get(t); !ns.started {
+		ns.started = true
+		ns.firstProcessingTime = in.now
+	}
+}
+
+func (t *TriggerAfterProcessingTime) shouldFire(in *triggerInput, st triggerState) bool {
+	if st.isFinished(t) {
+		return false
+	}
+	ft, ok := t.firingTime(st)
+	return ok && ft <= in.now
+}
+
+func (t *TriggerAfterProcessingTime) onFire(_ *triggerInput, st triggerState) {
+	st.get(t).finished = true
+}
+
+func (t *TriggerAfterProcessingTime) reset(st triggerState) { delete(st, t) }
+
+func (t *TriggerAfterProcessingTime) String() string {
+	return fmt.Sprintf("AfterProcessingTime[%v]", t.Transforms)
+}
+
+// TriggerAfterSynchronizedProcessingTime would fire once processing time is
+// synchronized across all upstream workers. Prism doesn't track synchronized
+// processing time, so panes are only produced when the window expires.
+type TriggerAfterSynchronizedProcessingTime struct{}
+
+func (t *TriggerAfterSynchronizedProcessingTime) onElement(*triggerInput, triggerState) {}
+func (t *TriggerAfterSynchronizedProcessingTime) shouldFire(*triggerInput, triggerState) bool {
+	return false
+}
+func (t *TriggerAfterSynchronizedProcessingTime) onFire(*triggerInput, triggerState) {}
+func (t *TriggerAfterSynchronizedProcessingTime) reset(st triggerState)              { delete(st, t) }
+func (t *TriggerAfterSynchronizedProcessingTime) String() string {
+	return "AfterSynchronizedProcessingTime"
+}
+
+// TriggerDefault fires once the watermark passes the end of the window,
+// and then for every late element. It never finishes.
+type TriggerDefault struct{}
+
+func (t *TriggerDefault) onElement(*triggerInput, triggerState) {}
+
+func (t *TriggerDefault) shouldFire(in *triggerInput, _ triggerState) bool {
+	return in.endOfWindowReached() && in.newElements
+}
+
+func (t *TriggerDefault) onFire(*triggerInput, triggerState) {}
+func (t *TriggerDefault) reset(st triggerState)              { delete(st, t) }
+func (t *TriggerDefault) String() string                     { return "Default" }
+
+func subtriggersString(subs []Trigger) string {
+	var strs []string
+	for _, sub := range subs {
+		strs = append(strs, sub.String())
+	}
+	return "[" + strings.Join(strs, ",") + "]"
+}
+
+// nextProcessingTimeFiring returns the earliest processing time at which the
+// trigger may fire, or the maximum timestamp if it doesn't depend on processing time.
+func nextProcessingTimeFiring(t Trigger, st triggerState) mtime.Time {
+	if st.isFinished(t) {
+		return mtime.MaxTimestamp
+	}
+	next := mtime.MaxTimestamp
+	switch t := t.(type) {
+	case *TriggerAfterProcessingTime:
+		if ft, ok := t.firingTime(st); ok {
+			next = ft
+		}
+	case *TriggerAfterAll:
+		for _, sub := range t.SubTriggers {
+			next = mtime.Min(next, nextProcessingTimeFiring(sub, st))
+		}
+	case *TriggerAfterAny:
+		for _, sub := range t.SubTriggers {
+			next = mtime.Min(next, nextProcessingTimeFiring(sub, st))
+		}
+	case *TriggerAfterEach:
+		if ns := st.get(t); ns.current < len(t.SubTriggers) {
+			next = nextProcessingTimeFiring(t.SubTriggers[ns.current], st)
+		}
+	case *TriggerRepeatedly:
+		next = nextProcessingTimeFiring(t.Repeated, st)
+	case *TriggerOrFinally:
+		next = mtime.Min(nextProcessingTimeFiring(t.Main, st), nextProcessingTimeFiring(t.Finally, st))
+	case *TriggerAfterEndOfWindow:
+		if !st.get(t).endOfWindowFired {
+			if t.Early != nil {
+				next = nextProcessingTimeFiring(t.Early, st)
+			}
+		} else if t.Late != nil {
+			next = nextProcessingTimeFiring(t.Late, st)
+		}
+	}
+	return next
+}
@@ -0,0 +1,193 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTriggers(t *testing.T) {
+	// triggerStep is a single evaluation of the trigger for a pane.
+	type triggerStep struct {
+		element   bool // Whether an element arrives before the evaluation.
+		watermark mtime.Time
+		now       mtime.Time
+	}
+	elm := triggerStep{element: true}
+	// The end of the window is at 9, so the watermark passes it at 10.
+	win := window.IntervalWindow{Start: 0, End: 10}
+
+	tests := []struct {
+		name         string
+		trig         Trigger
+		steps        []triggerStep
+		wantFired    []int // Indices of the steps where the trigger fired.
+		wantFinished bool
+	}{
+		{
+			name:  "Never",
+			trig:  &TriggerNever{},
+			steps: []triggerStep{elm, elm, {watermark: 20}},
+		}, {
+			name:      "Always",
+			trig:      &TriggerAlways{},
+			steps:     []triggerStep{elm, elm, {watermark: 20}, elm},
+			wantFired: []int{0, 1, 3},
+		}, {
+			name:         "AfterCount",
+			trig:         &TriggerAfterCount{ElementCount: 2},
+			steps:        []triggerStep{elm, elm, elm, elm},
+			wantFired:    []int{1},
+			wantFinished: true,
+		}, {
+			name:      "Repeatedly",
+			trig:      &TriggerRepeatedly{Repeated: &TriggerAfterCount{ElementCount: 2}},
+			steps:     []triggerStep{elm, elm, elm, elm, elm},
+			wantFired: []int{1, 3},
+		}, {
+			name: "AfterAll",
+			trig: &TriggerAfterAll{SubTriggers: []Trigger{
+				&TriggerAfterCount{ElementCount: 2},
+				&TriggerAfterCount{ElementCount: 3},
+			}},
+			steps:        []triggerStep{elm, elm, elm, elm},
+			wantFired:    []int{2},
+			wantFinished: true,
+		}, {
+			name: "AfterAny",
+			trig: &TriggerAfterAny{SubTriggers: []Trigger{
+				&TriggerAfterCount{ElementCount: 2},
+				&TriggerAfterCount{ElementCount: 3},
+			}},
+			steps:        []triggerStep{elm, elm, elm, elm},
+			wantFired:    []int{1},
+			wantFinished: true,
+		}, {
+			name: "AfterEach",
+			trig: &TriggerAfterEach{SubTriggers: []Trigger{
+				&TriggerAfterCount{ElementCount: 1},
+				&TriggerAfterCount{ElementCount: 2},
+			}},
+			steps:        []triggerStep{elm, elm, elm, elm},
+			wantFired:    []int{0, 2},
+			wantFinished: true,
+		}, {
+			name: "OrFinally",
+			trig: &TriggerOrFinally{
+				Main:    &TriggerRepeatedly{Repeated: &TriggerAfterCount{ElementCount: 1}},
+				Finally: &TriggerAfterCount{ElementCount: 3},
+			},
+			steps:        []triggerStep{elm, elm, elm, elm},
+			wantFired:    []int{0, 1, 2},
+			wantFinished: true,
+		}, {
+			name:         "AfterEndOfWindow",
+			trig:         &TriggerAfterEndOfWindow{},
+			steps:        []triggerStep{elm, {watermark: 9}, {watermark: 10}, {element: true, watermark: 10}},
+			wantFired:    []int{2},
+			wantFinished: true,
+		}, {
+			name: "AfterEndOfWindow_EarlyAndLate",
+			trig: &TriggerAfterEndOfWindow{
+				Early: &TriggerAfterCount{ElementCount: 2},
+				Late:  &TriggerAfterCount{ElementCount: 1},
+			},
+			steps: []triggerStep{
+				elm, elm, elm, // Early firing for the first two elements.
+				{watermark: 10},                // On time firing.
+				{element: true, watermark: 10}, // Late firing.
+				{element: true, watermark: 20}, // Late firing.
+			},
+			wantFired: []int{1, 3, 4, 5},
+		}, {
+			name:         "AfterProcessingTime_Delay",
+			trig:         &TriggerAfterProcessingTime{Transforms: []TimestampTransform{{Delay: 5 * time.Millisecond}}},
+			steps:        []triggerStep{{element: true, now: 1}, {now: 5}, {now: 6}, {element: true, now: 7}},
+			wantFired:    []int{2},
+			wantFinished: true,
+		}, {
+			name:         "AfterProcessingTime_AlignTo",
+			trig:         &TriggerAfterProcessingTime{Transforms: []TimestampTransform{{AlignToPeriod: 10 * time.Millisecond, AlignToOffset: 2 * time.Millisecond}}},
+			steps:        []triggerStep{{element: true, now: 3}, {now: 11}, {now: 12}, {element: true, now: 22}},
+			wantFired:    []int{2},
+			wantFinished: true,
+		}, {
+			name:  "AfterSynchronizedProcessingTime",
+			trig:  &TriggerAfterSynchronizedProcessingTime{},
+			steps: []triggerStep{elm, {now: 100, watermark: 20}},
+		}, {
+			name:      "Default",
+			trig:      &TriggerDefault{},
+			steps:     []triggerStep{elm, {watermark: 10}, {watermark: 20}, {element: true, watermark: 20}},
+			wantFired: []int{1, 3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := triggerState{}
+			var newElements bool
+			var fired []int
+			for i, step := range test.steps {
+				in := &triggerInput{window: win, watermark: step.watermark, now: step.now}
+				if step.element {
+					newElements = true
+					in.newElements = true
+					test.trig.onElement(in, st)
+				}
+				in.newElements = newElements
+				if test.trig.shouldFire(in, st) {
+					test.trig.onFire(in, st)
+					fired = append(fired, i)
+					newElements = false
+				}
+			}
+			if d := cmp.Diff(test.wantFired, fired); d != "" {
+				t.Errorf("%v fired at steps diff (-want, +got):\n%v", test.trig, d)
+			}
+			if got, want := st.isFinished(test.trig), test.wantFinished; got != want {
+				t.Errorf("%v finished = %v, want %v", test.trig, got, want)
+			}
+		})
+	}
+}
+
+func TestNextProcessingTimeFiring(t *testing.T) {
+	apt := &TriggerAfterProcessingTime{Transforms: []TimestampTransform{{Delay: 5 * time.Millisecond}}}
+	trig := &TriggerAfterEndOfWindow{
+		Early: &TriggerRepeatedly{Repeated: apt},
+	}
+	win := window.IntervalWindow{Start: 0, End: 10}
+	st := triggerState{}
+
+	if got, want := nextProcessingTimeFiring(trig, st), mtime.MaxTimestamp; got != want {
+		t.Errorf("before elements: nextProcessingTimeFiring() = %v, want %v", got, want)
+	}
+	trig.onElement(&triggerInput{window: win, now: 10, newElements: true}, st)
+	if got, want := nextProcessingTimeFiring(trig, st), mtime.Time(15); got != want {
+		t.Errorf("after element: nextProcessingTimeFiring() = %v, want %v", got, want)
+	}
+	// Once the on time pane fires, the early firings no longer apply.
+	in := &triggerInput{window: win, watermark: 10, now: 11}
+	trig.onFire(in, st)
+	if got, want := nextProcessingTimeFiring(trig, st), mtime.MaxTimestamp; got != want {
+		t.Errorf("after on time firing: nextProcessingTimeFiring() = %v, want %v", got, want)
+	}
+}
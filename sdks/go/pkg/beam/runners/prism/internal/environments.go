@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"runtime"
+	"strings"
 
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
 	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
@@ -54,8 +57,9 @@ func runEnvironment(ctx context.Context, j *jobservices.Job, env string, wk *wor
 		if err := (proto.UnmarshalOptions{}).Unmarshal(e.GetPayload(), ep); err != nil {
 			logger.Error("unmarshing external environment payload", "error", err)
 		}
+		workerID := externalWorkerID(wk)
 		go func() {
-			externalEnvironment(ctx, ep, wk)
+			externalEnvironment(ctx, ep, wk, workerID)
 			slog.Debug("environment stopped", slog.String("job", j.String()))
 		}()
 		return nil
@@ -65,12 +69,27 @@ func runEnvironment(ctx context.Context, j *jobservices.Job, env string, wk *wor
 			logger.Error("unmarshing docker environment payload", "error", err)
 		}
 		return dockerEnvironment(ctx, logger, dp, wk, j.ArtifactEndpoint())
+	case urns.EnvProcess:
+		pp := &pipepb.ProcessPayload{}
+		if err := (proto.UnmarshalOptions{}).Unmarshal(e.GetPayload(), pp); err != nil {
+			logger.Error("unmarshing process environment payload", "error", err)
+		}
+		return processEnvironment(ctx, logger, pp, wk, j.ArtifactEndpoint())
 	default:
 		return fmt.Errorf("environment %v with urn %v unimplemented", env, e.GetUrn())
 	}
 }
 
-func externalEnvironment(ctx context.Context, ep *pipepb.ExternalPayload, wk *worker.W) {
+// externalWorkerID returns the ID the worker pool knows the SDK worker by.
+// Restarted workers get a new ID, since pools reject reused IDs.
+func externalWorkerID(wk *worker.W) string {
+	if n := wk.Restarts(); n > 0 {
+		return fmt.Sprintf("%v_restart%d", wk.ID, n)
+	}
+	return wk.ID
+}
+
+func externalEnvironment(ctx context.Context, ep *pipepb.ExternalPayload, wk *worker.W, workerID string) {
 	conn, err := grpc.Dial(ep.GetEndpoint().GetUrl(), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		panic(fmt.Sprintf("unable to dial sdk worker %v: %v", ep.GetEndpoint().GetUrl(), err))
@@ -82,7 +101,7 @@ func externalEnvironment(ctx context.Context, ep *pipepb.ExternalPayload, wk *wo
 		Url: wk.Endpoint(),
 	}
 	pool.StartWorker(ctx, &fnpb.StartWorkerRequest{
-		WorkerId:          wk.ID,
+		WorkerId:          workerID,
 		ControlEndpoint:   endpoint,
 		LoggingEndpoint:   endpoint,
 		ArtifactEndpoint:  endpoint,
@@ -97,7 +116,7 @@ func externalEnvironment(ctx context.Context, ep *pipepb.ExternalPayload, wk *wo
 	// Previous context cancelled so we need a new one
 	// for this request.
 	pool.StopWorker(context.Background(), &fnpb.StopWorkerRequest{
-		WorkerId: wk.ID,
+		WorkerId: workerID,
 	})
 	wk.Stop()
 }
@@ -170,9 +189,9 @@ func dockerEnvironment(ctx context.Context, logger *slog.Logger, dp *pipepb.Dock
 	}
 
 	// Start goroutine to wait on container state.
+	restarts := wk.Restarts()
 	go func() {
 		defer cli.Close()
-		defer wk.Stop()
 
 		statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
 		select {
@@ -182,11 +201,18 @@ func dockerEnvironment(ctx context.Context, logger *slog.Logger, dp *pipepb.Dock
 			if err != nil {
 				logger.Error("docker container kill error", "error", err)
 			}
+			wk.Stop()
 		case err := <-errCh:
 			if err != nil {
 				logger.Error("docker container wait error", "error", err)
 			}
+			wk.Stop()
 		case resp := <-statusCh:
+			if workerRestarting(wk, restarts) {
+				logger.Debug("docker container of killed worker terminated", "status_code", resp.StatusCode)
+				return
+			}
+			defer wk.Stop()
 			logger.Info("docker container has self terminated", "status_code", resp.StatusCode)
 
 			rc, err := cli.ContainerLogs(ctx, containerID, dtyp.ContainerLogsOptions{Details: true, ShowStdout: true, ShowStderr: true})
@@ -202,3 +228,114 @@ func dockerEnvironment(ctx context.Context, logger *slog.Logger, dp *pipepb.Dock
 
 	return nil
 }
+
+// processEnvironment starts the SDK worker as a local subprocess, from the command
+// in the payload. The process is killed, along with any processes it started,
+// once the job completes.
+func processEnvironment(ctx context.Context, logger *slog.Logger, pp *pipepb.ProcessPayload, wk *worker.W, artifactEndpoint string) error {
+	logger = logger.With("worker_id", wk.ID, "command", pp.GetCommand())
+
+	if want := pp.GetOs(); want != "" && !strings.EqualFold(want, runtime.GOOS) {
+		return fmt.Errorf("unable to start process for env %v: requires os %v, but prism is running on %v", wk.Env, want, runtime.GOOS)
+	}
+	if want := pp.GetArch(); want != "" && !strings.EqualFold(want, runtime.GOARCH) {
+		return fmt.Errorf("unable to start process for env %v: requires arch %v, but prism is running on %v", wk.Env, want, runtime.GOARCH)
+	}
+
+	cmd := exec.Command(pp.GetCommand(),
+		fmt.Sprintf("--id=%v-%v", wk.JobKey, wk.Env),
+		fmt.Sprintf("--control_endpoint=%v", wk.Endpoint()),
+		fmt.Sprintf("--artifact_endpoint=%v", artifactEndpoint),
+		fmt.Sprintf("--provision_endpoint=%v", wk.Endpoint()),
+		fmt.Sprintf("--logging_endpoint=%v", wk.Endpoint()),
+	)
+	cmd.Env = os.Environ()
+	for k, v := range pp.GetEnv() {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// The SDK logs through the logging endpoint, so the process output is
+	// only reported if the process terminates by itself. Only its tail is
+	// kept, since a long running process may write without bound.
+	buf := &tailBuffer{max: maxProcessOutput}
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start process %v for env %v, err: %w", pp.GetCommand(), wk.Env, err)
+	}
+	logger = logger.With("pid", cmd.Process.Pid)
+
+	// Start goroutine to wait on the process state.
+	restarts := wk.Restarts()
+	go func() {
+		waitCh := make(chan error, 1)
+		go func() {
+			waitCh <- cmd.Wait()
+		}()
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				logger.Error("process kill error", "error", err)
+			}
+			// Reap the process.
+			<-waitCh
+			wk.Stop()
+		case err := <-waitCh:
+			if workerRestarting(wk, restarts) {
+				logger.Debug("process of killed worker terminated", "error", err)
+				return
+			}
+			logger.Error("process self terminated", "error", err, "log", buf.String())
+			wk.Stop()
+		}
+	}()
+
+	return nil
+}
+
+// workerRestarting returns whether the SDK worker started when the worker had
+// the given number of restarts was killed, so the worker is, or will be, served
+// by a restarted SDK worker instead of being stopped.
+func workerRestarting(wk *worker.W, restarts int) bool {
+	return wk.Killed() || wk.Restarts() != restarts
+}
+
+// maxProcessOutput is the number of bytes of process environment output
+// retained for reporting.
+const maxProcessOutput = 64 << 10
+
+// tailBuffer is an io.Writer that retains only the last max bytes written
+// to it.
+//
+// It isn't safe for concurrent use, but exec.Cmd serializes writes when
+// Stdout and Stderr are the same writer.
+type tailBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= b.max {
+		b.buf = append(b.buf[:0], p[n-b.max:]...)
+		b.truncated = true
+		return n, nil
+	}
+	if over := len(b.buf) + n - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// String returns the retained output, marking whether earlier output was
+// discarded.
+func (b *tailBuffer) String() string {
+	if b.truncated {
+		return "...(truncated) " + string(b.buf)
+	}
+	return string(b.buf)
+}
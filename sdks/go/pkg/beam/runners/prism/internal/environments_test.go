@@ -0,0 +1,168 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+// +build unix
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
+	"golang.org/x/exp/slog"
+)
+
+func TestProcessEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process environment test requires a unix shell")
+	}
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	childFile := filepath.Join(dir, "child")
+	// The fake SDK harness records its arguments and environment, and starts a
+	// child process that must be killed along with it.
+	script := filepath.Join(dir, "boot.sh")
+	content := fmt.Sprintf(`#!/bin/sh
+echo "$@ $PRISM_TEST_ENV" > %q.tmp
+mv %q.tmp %q
+sleep 300 &
+echo $! > %q.tmp
+mv %q.tmp %q
+wait
+`, argsFile, argsFile, argsFile, childFile, childFile, childFile)
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	wk := worker.New("testWorker", "testEnv")
+	wk.JobKey = "job-001"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := processEnvironment(ctx, slog.Default(), &pipepb.ProcessPayload{
+		Command: script,
+		Env:     map[string]string{"PRISM_TEST_ENV": "fromPayload"},
+	}, wk, "artifacts:1234")
+	if err != nil {
+		t.Fatalf("processEnvironment() = %v, want nil", err)
+	}
+
+	readFile := func(path string) string {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if b, err := os.ReadFile(path); err == nil {
+				return strings.TrimSpace(string(b))
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("process didn't write %v", path)
+		return ""
+	}
+	args := readFile(argsFile)
+	for _, want := range []string{
+		"--id=job-001-testEnv",
+		"--control_endpoint=" + wk.Endpoint(),
+		"--logging_endpoint=" + wk.Endpoint(),
+		"--provision_endpoint=" + wk.Endpoint(),
+		"--artifact_endpoint=artifacts:1234",
+		"fromPayload",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("process arguments %q missing %q", args, want)
+		}
+	}
+	child, err := strconv.Atoi(readFile(childFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Completing the job kills the process and its children, and stops the worker.
+	cancel()
+	for i := 0; i < 100 && !wk.Stopped(); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !wk.Stopped() {
+		t.Fatal("worker not stopped after the job completed")
+	}
+	if running(child) {
+		syscall.Kill(child, syscall.SIGKILL)
+		t.Errorf("child process %v still running after the job completed", child)
+	}
+}
+
+// running returns whether the process exists, and isn't a zombie waiting
+// to be reaped by its new parent.
+func running(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	// The state follows the parenthesized command name.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestProcessEnvironment_Platform(t *testing.T) {
+	wk := worker.New("testWorker", "testEnv")
+	defer wk.Stop()
+	err := processEnvironment(context.Background(), slog.Default(), &pipepb.ProcessPayload{
+		Os:      "plan9" + runtime.GOOS,
+		Command: "unused",
+	}, wk, "")
+	if err == nil || !strings.Contains(err.Error(), "requires os") {
+		t.Errorf("processEnvironment() = %v, want os mismatch error", err)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"under", []string{"ab", "cd"}, "abcd"},
+		{"exact", []string{"abc", "de"}, "abcde"},
+		{"over", []string{"abc", "def"}, "...(truncated) bcdef"},
+		{"large write", []string{"ab", "cdefghij"}, "...(truncated) fghij"},
+		{"many", []string{"ab", "cd", "ef", "gh"}, "...(truncated) defgh"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &tailBuffer{max: 5}
+			for _, w := range test.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %v, %v, want %v, nil", w, n, err, len(w))
+				}
+			}
+			if got := b.String(); got != test.want {
+				t.Errorf("String() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -17,14 +17,19 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"sort"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
 	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
@@ -32,9 +37,15 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 )
 
+// optDrainAfter drains the job once it has run for the given duration, as a
+// Go duration string. Pipelines that otherwise run until drained, such as those
+// reading unbounded input, may use it to terminate.
+const optDrainAfter = "drain_after"
+
 // RunPipeline starts the main thread fo executing this job.
 // It's analoguous to the manager side process for a distributed pipeline.
 // It will begin "workers"
@@ -65,24 +76,91 @@ func RunPipeline(j *jobservices.Job) {
 	j.SendMsg("running " + j.String())
 	j.Running()
 
+	if v, ok := jobOption(j.PipelineOptions(), optDrainAfter); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			j.Failed(fmt.Errorf("invalid %v pipeline option %q: %w", optDrainAfter, v, err))
+			return
+		}
+		drain := time.AfterFunc(d, func() {
+			if _, err := j.Drain(); err != nil {
+				slog.Warn("unable to drain job", slog.Any("job", j), slog.Any("error", err))
+			}
+		})
+		defer drain.Stop()
+	}
+
 	if err := executePipeline(j.RootCtx, wks, j); err != nil {
+		if errors.Is(err, jobservices.ErrCancel) {
+			j.SendMsg("pipeline canceled " + j.String())
+			j.Canceled()
+			return
+		}
 		j.Failed(err)
 		return
 	}
 	j.SendMsg("pipeline completed " + j.String())
 
 	j.SendMsg("terminating " + j.String())
-	j.Done()
+	select {
+	case <-j.DrainRequested():
+		j.Drained()
+	default:
+		j.Done()
+	}
+}
+
+// transformStages relates the transforms of the submitted pipeline to the stages
+// executing them. Transforms created by preprocessing, such as lifted combines,
+// are attributed to their nearest composite from the submitted pipeline.
+func transformStages(orig, comps *pipepb.Components, stages []*stage) map[string][]string {
+	parents := map[string]string{}
+	for tid, t := range comps.GetTransforms() {
+		for _, sub := range t.GetSubtransforms() {
+			parents[sub] = tid
+		}
+	}
+	ret := map[string][]string{}
+	for _, stg := range stages {
+		for _, tid := range stg.transforms {
+			for tid != "" && orig.GetTransforms()[tid] == nil {
+				tid = parents[tid]
+			}
+			if tid == "" {
+				continue
+			}
+			if ids := ret[tid]; len(ids) == 0 || ids[len(ids)-1] != stg.ID {
+				ret[tid] = append(ids, stg.ID)
+			}
+		}
+	}
+	return ret
 }
 
 // makeWorker creates a worker for that environment.
 func makeWorker(env string, j *jobservices.Job) (*worker.W, error) {
+	pageSize, err := jobStatePageSize(j)
+	if err != nil {
+		return nil, err
+	}
 	wk := worker.New(j.String()+"_"+env, env)
+	wk.StatePageSize = pageSize
 
 	wk.EnvPb = j.Pipeline.GetComponents().GetEnvironments()[env]
 	wk.PipelineOptions = j.PipelineOptions()
 	wk.JobKey = j.JobKey()
 	wk.ArtifactEndpoint = j.ArtifactEndpoint()
+	wk.Logs = func(l *fnpb.LogEntry, stageID string) {
+		j.SendMessage(jobservices.JobMessage{
+			Importance: logImportance(l.GetSeverity()),
+			Time:       l.GetTimestamp().AsTime(),
+			Text:       l.GetMessage(),
+			Stage:      stageID,
+			Bundle:     l.GetInstructionId(),
+			Transform:  l.GetTransformId(),
+			Worker:     wk.ID,
+		})
+	}
 
 	go wk.Serve()
 
@@ -102,6 +180,20 @@ func makeWorker(env string, j *jobservices.Job) (*worker.W, error) {
 	return wk, nil
 }
 
+// logImportance returns the job message importance of an SDK log entry severity.
+func logImportance(sev fnpb.LogEntry_Severity_Enum) jobpb.JobMessage_MessageImportance {
+	switch {
+	case sev <= fnpb.LogEntry_Severity_DEBUG:
+		return jobpb.JobMessage_JOB_MESSAGE_DEBUG
+	case sev <= fnpb.LogEntry_Severity_NOTICE:
+		return jobpb.JobMessage_JOB_MESSAGE_BASIC
+	case sev == fnpb.LogEntry_Severity_WARN:
+		return jobpb.JobMessage_JOB_MESSAGE_WARNING
+	default:
+		return jobpb.JobMessage_JOB_MESSAGE_ERROR
+	}
+}
+
 type transformExecuter interface {
 	ExecuteUrns() []string
 	ExecuteWith(t *pipepb.PTransform) string
@@ -116,17 +208,9 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 	pipeline := j.Pipeline
 	comps := proto.Clone(pipeline.GetComponents()).(*pipepb.Components)
 
-	// TODO, configure the preprocessor from pipeline options.
-	// Maybe change these returns to a single struct for convenience and further
-	// annotation?
-
-	handlers := []any{
-		Combine(CombineCharacteristic{EnableLifting: true}),
-		ParDo(ParDoCharacteristic{DisableSDF: true}),
-		Runner(RunnerCharacteristic{
-			SDKFlatten:   false,
-			SDKReshuffle: false,
-		}),
+	handlers, faults, err := jobHandlers(j)
+	if err != nil {
+		return err
 	}
 
 	proc := processor{
@@ -150,15 +234,49 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 	topo := prepro.preProcessGraph(comps)
 	ts := comps.GetTransforms()
 
-	em := engine.NewElementManager(engine.Config{})
+	parallelism := jobParallelism(j)
+	partitionMode, err := jobPartitionMode(j)
+	if err != nil {
+		return err
+	}
+	retries, err := jobRetryPolicy(j)
+	if err != nil {
+		return err
+	}
+	sampleSize, err := jobSampleSize(j)
+	if err != nil {
+		return err
+	}
+	budget, spillDir, err := jobMemoryBudget(j)
+	if err != nil {
+		return err
+	}
+	checkpoints, err := jobCheckpointConfig(j)
+	if err != nil {
+		return err
+	}
+	em := engine.NewElementManager(engine.Config{
+		TargetParallelism: parallelism,
+		PartitionMode:     partitionMode,
+		SampleSize:        sampleSize,
+		MemoryBudget:      budget,
+		SpillDir:          spillDir,
+	})
+	defer func() {
+		if err := em.Spiller().Close(); err != nil {
+			slog.Warn("unable to remove spilled data", slog.String("job", j.String()), slog.Any("error", err))
+		}
+	}()
 
 	// TODO move this loop and code into the preprocessor instead.
 	stages := map[string]*stage{}
 	var impulses []string
+	var testStreamID string
+	var pubsubReads []*pubsubRead
 
 	// Inialize the "dataservice cache" to support side inputs.
 	// TODO(https://github.com/apache/beam/issues/28543), remove this concept.
-	ds := &worker.DataService{}
+	ds := &worker.DataService{Spill: em.Spiller()}
 
 	for i, stage := range topo {
 		tid := stage.transforms[0]
@@ -173,6 +291,9 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 		}
 		stage.ID = fmt.Sprintf("stage-%03d", i)
 		wk := wks[stage.envID]
+		if stage.faults = faults.stageFaults(stage, comps); stage.faults != nil {
+			j.SendMsg(fmt.Sprintf("injecting faults into %v: %v", stage.ID, stage.faults))
+		}
 
 		switch stage.envID {
 		case "": // Runner Transforms
@@ -182,17 +303,20 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 			}
 			stage.OutputsToCoders = map[string]engine.PColInfo{}
 			coders := map[string]*pipepb.Coder{}
-			makeWindowedValueCoder(onlyOut, comps, coders)
+			// Sinks, like Pub/Sub writes, have no output.
+			if onlyOut != "" {
+				makeWindowedValueCoder(onlyOut, comps, coders)
 
-			col := comps.GetPcollections()[onlyOut]
-			ed := collectionPullDecoder(col.GetCoderId(), coders, comps)
-			wDec, wEnc := getWindowValueCoders(comps, col, coders)
+				col := comps.GetPcollections()[onlyOut]
+				ed := collectionPullDecoder(col.GetCoderId(), coders, comps)
+				wDec, wEnc := getWindowValueCoders(comps, col, coders)
 
-			stage.OutputsToCoders[onlyOut] = engine.PColInfo{
-				GlobalID: onlyOut,
-				WDec:     wDec,
-				WEnc:     wEnc,
-				EDec:     ed,
+				stage.OutputsToCoders[onlyOut] = engine.PColInfo{
+					GlobalID: onlyOut,
+					WDec:     wDec,
+					WEnc:     wEnc,
+					EDec:     ed,
+				}
 			}
 
 			// There's either 0, 1 or many inputs, but they should be all the same
@@ -224,14 +348,62 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 						EDec:     ed,
 					}
 				}
-				em.StageAggregates(stage.ID)
+				ws := windowingStrategy(comps, tid)
+				// Merging windows are merged when the aggregation executes, so they
+				// only use the default trigger.
+				if ws.GetWindowFn().GetUrn() == urns.WindowFnSession {
+					session := &pipepb.SessionWindowsPayload{}
+					if err := (proto.UnmarshalOptions{}).Unmarshal(ws.GetWindowFn().GetPayload(), session); err != nil {
+						return fmt.Errorf("prism error building stage %v: unable to decode SessionWindowsPayload: %w", stage.ID, err)
+					}
+					em.StageSessions(stage.ID, session.GetGapSize().AsDuration(), allowedLateness(ws))
+					break
+				}
+				strat, err := buildTriggerStrat(ws)
+				if err != nil {
+					return fmt.Errorf("prism error building stage %v: \n%w", stage.ID, err)
+				}
+				col := comps.GetPcollections()[getOnlyValue(t.GetInputs())]
+				cID, err := lpUnknownCoders(col.GetCoderId(), coders, comps.GetCoders())
+				if err != nil {
+					return fmt.Errorf("prism error building stage %v: \n%w", stage.ID, err)
+				}
+				kcID, ok := kvKeyCoderID(cID, coders)
+				if !ok {
+					return fmt.Errorf("prism error building stage %v: GroupByKey requires a KV coded input, pcol %v", stage.ID, prototext.Format(col))
+				}
+				em.StageTriggered(stage.ID, pullDecoder(coders[kcID], coders), strat)
 			case urns.TransformImpulse:
 				impulses = append(impulses, stage.ID)
 				em.AddStage(stage.ID, nil, nil, []string{getOnlyValue(t.GetOutputs())})
+			case urns.TransformTestStream:
+				if testStreamID != "" {
+					return fmt.Errorf("prism error building stage %v: pipeline may only have a single TestStream, already has TestStream in %v", stage.ID, testStreamID)
+				}
+				testStreamID = stage.ID
+				outputs := maps.Values(t.GetOutputs())
+				sort.Strings(outputs)
+				em.AddStage(stage.ID, nil, nil, outputs)
+				if err := handleTestStream(stage.ID, t, comps, em, ds); err != nil {
+					return fmt.Errorf("prism error building stage %v: \n%w", stage.ID, err)
+				}
 			case urns.TransformFlatten:
 				inputs := maps.Values(t.GetInputs())
 				sort.Strings(inputs)
 				em.AddStage(stage.ID, inputs, nil, []string{getOnlyValue(t.GetOutputs())})
+			case urns.TransformPubSubRead:
+				r, err := preparePubSubRead(ctx, j, stage.ID, t, comps)
+				if err != nil {
+					return fmt.Errorf("prism error building stage %v: \n%w", stage.ID, err)
+				}
+				em.AddStage(stage.ID, nil, nil, []string{getOnlyValue(t.GetOutputs())})
+				em.AddSource(stage.ID)
+				pubsubReads = append(pubsubReads, r)
+			case urns.TransformPubSubWrite:
+				if err := preparePubSubWrite(ctx, t, comps); err != nil {
+					return fmt.Errorf("prism error building stage %v: \n%w", stage.ID, err)
+				}
+				em.AddStage(stage.ID, []string{getOnlyValue(t.GetInputs())}, nil, nil)
 			}
 			stages[stage.ID] = stage
 		case wk.Env:
@@ -243,27 +415,90 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 			outputs := maps.Keys(stage.OutputsToCoders)
 			sort.Strings(outputs)
 			em.AddStage(stage.ID, []string{stage.primaryInput}, stage.sides, outputs)
+			if !stage.stateful && stage.keyDec != nil && partitionMode == engine.PartitionByKey {
+				em.StageKeyed(stage.ID, stage.keyDec)
+			}
+			if stage.stateful {
+				em.StageStateful(stage.ID, stage.keyDec)
+				em.StageProcessingTimeTimers(stage.ID, stage.processingTimeTimers)
+				ws := comps.GetWindowingStrategies()[comps.GetPcollections()[stage.primaryInput].GetWindowingStrategyId()]
+				em.StageWindowExpiration(stage.ID, allowedLateness(ws), stage.expirationTimers)
+			}
+			if stage.timeSorted {
+				em.StageTimeSorted(stage.ID)
+			}
 		default:
 			err := fmt.Errorf("unknown environment[%v]", t.GetEnvironmentId())
 			slog.Error("Execute", err)
 			return err
 		}
+		if stage.faults != nil && stage.faults.reorder {
+			em.StageReorder(stage.ID, stage.faults.h.shuffle)
+		}
 	}
 
-	// Prime the initial impulses, since we now know what consumes them.
-	for _, id := range impulses {
-		em.Impulse(id)
+	j.SetExecutionGraph(transformStages(pipeline.GetComponents(), comps, topo), em.PCollectionWatermarks)
+	j.SetStageStats(em.StageStats)
+	j.SetElementSamples(elementSamples(em, comps))
+
+	if checkpoints.Dir != "" {
+		var unresumable string
+		switch {
+		case testStreamID != "":
+			unresumable = "a TestStream"
+		case len(pubsubReads) > 0:
+			// Messages are acknowledged once read, so they can't be read again.
+			unresumable = "a Pub/Sub read"
+		}
+		if err := configureCheckpoints(j, em, ds, checkpoints, unresumable); err != nil {
+			return err
+		}
+	}
+	if checkpoints.ResumeJob == "" {
+		// Prime the initial impulses, since we now know what consumes them.
+		for _, id := range impulses {
+			em.Impulse(id)
+		}
 	}
 
 	// Use a channel to limit max parallelism for the pipeline.
-	maxParallelism := make(chan struct{}, 8)
+	// Bundles may wait on the progress of others, such as split residuals,
+	// so a minimum number of bundles may always be in progress.
+	maxBundles := 8
+	if parallelism > maxBundles {
+		maxBundles = parallelism
+	}
+	maxParallelism := make(chan struct{}, maxBundles)
 	// Execute stages here
 	bundleFailed := make(chan error)
 
 	var instID uint64
-	bundles := em.Bundles(ctx, func() string {
+	nextBundID := func() string {
 		return fmt.Sprintf("inst%03d", atomic.AddUint64(&instID, 1))
-	})
+	}
+	bundles := em.Bundles(ctx, nextBundID)
+
+	// Read from Pub/Sub, now that the consumers of the reads are known.
+	// Read failures fail the job, like failed bundles.
+	for _, r := range pubsubReads {
+		go func(r *pubsubRead) {
+			if err := r.read(ctx, em); err != nil {
+				select {
+				case bundleFailed <- err:
+				case <-ctx.Done():
+				}
+			}
+		}(r)
+	}
+
+	// Put the ElementManager into drain mode if the job is requested to drain.
+	go func() {
+		select {
+		case <-j.DrainRequested():
+			em.Drain()
+		case <-ctx.Done():
+		}
+	}()
 
 	for {
 		select {
@@ -271,18 +506,66 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 			return context.Cause(ctx)
 		case rb, ok := <-bundles:
 			if !ok {
+				if err := em.Err(); err != nil {
+					return err
+				}
 				slog.Debug("pipeline done!", slog.String("job", j.String()))
 				return nil
 			}
-			maxParallelism <- struct{}{}
+			// Wait for capacity before starting the bundle, while still
+			// receiving failures from the bundles in progress.
+			select {
+			case maxParallelism <- struct{}{}:
+			case err := <-bundleFailed:
+				return err
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
 			go func(rb engine.RunBundle) {
 				defer func() { <-maxParallelism }()
 				s := stages[rb.StageID]
 				wk := wks[s.envID]
-				if err := s.Execute(ctx, j, wk, ds, comps, em, rb); err != nil {
-					// Ensure we clean up on bundle failure
-					em.FailBundle(rb)
-					bundleFailed <- err
+				var restarts int
+				for attempt := 1; ; attempt++ {
+					var before int
+					if wk != nil {
+						before = wk.Restarts()
+					}
+					err := s.Execute(ctx, j, wk, ds, comps, em, rb)
+					if err == nil {
+						return
+					}
+					if wk != nil && (wk.Killed() || wk.Restarts() != before) && restarts < maxWorkerRestarts && ctx.Err() == nil {
+						// The bundle was lost with its worker, so it's retried once the
+						// worker is restarted, without counting as a failed attempt.
+						restarts++
+						attempt--
+						if err := restartWorker(ctx, j, wk); err != nil {
+							em.FailBundle(rb)
+							bundleFailed <- err
+							return
+						}
+						j.SendMsg(fmt.Sprintf("bundle %v of stage %v was lost with %v, retrying: %v", rb.BundleID, rb.StageID, wk, err))
+						rb = em.RetryBundle(rb, nextBundID())
+						continue
+					}
+					backoff, retry := retries.shouldRetry(attempt, err)
+					if !retry || ctx.Err() != nil || (wk != nil && !wk.Connected()) {
+						// Ensure we clean up on bundle failure
+						em.FailBundle(rb)
+						bundleFailed <- err
+						return
+					}
+					slog.Warn("retrying failed bundle", "bundle", rb, slog.Int("attempt", attempt), slog.Duration("backoff", backoff), "error", err)
+					j.SendMsg(fmt.Sprintf("bundle %v of stage %v failed attempt %v of %v, retrying in %v: %v", rb.BundleID, rb.StageID, attempt, retries.MaxAttempts, backoff, err))
+					select {
+					case <-time.After(backoff):
+					case <-ctx.Done():
+						em.FailBundle(rb)
+						return
+					}
+					// The retry uses a new instruction, so the SDK doesn't confuse it with the failed attempt.
+					rb = em.RetryBundle(rb, nextBundID())
 				}
 			}(rb)
 		case err := <-bundleFailed:
@@ -291,6 +574,95 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 	}
 }
 
+// maxWorkerRestarts is the number of times a bundle is retried after its SDK
+// worker is killed, before the job fails.
+const maxWorkerRestarts = 3
+
+// restartWorker starts a new SDK worker for a killed worker, and waits for it
+// to connect. Workers are restarted once per kill, so callers for bundles lost
+// in the same kill wait on the same SDK worker.
+func restartWorker(ctx context.Context, j *jobservices.Job, wk *worker.W) error {
+	const timeout = time.Minute
+	deadline := time.After(timeout)
+	for {
+		if wk.Revive() {
+			j.SendMsg(fmt.Sprintf("restarting killed %v, restart %v", wk, wk.Restarts()))
+			if err := runEnvironment(j.RootCtx, j, wk.Env, wk); err != nil {
+				return fmt.Errorf("failed to restart environment %v for job %v: %w", wk.Env, j, err)
+			}
+		}
+		if wk.Connected() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-deadline:
+			return fmt.Errorf("prism %v didn't get control connection to restarted %v after %v", wk, wk.Endpoint(), timeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// jobParallelism returns the number of bundles the ready elements of a stage
+// are partitioned into, from the job's parallelism pipeline option.
+// Jobs without the option partition ready elements by the number of CPUs.
+func jobParallelism(j *jobservices.Job) int {
+	if v, ok := j.PipelineOptions().GetFields()["beam:option:parallelism:v1"]; ok {
+		if n := int(v.GetNumberValue()); n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+// optPartitionMode is the pipeline option selecting how the ready elements of
+// a stage are partitioned into bundles:
+//
+//   - "auto", the default, partitions stateful stages by key, and other stages evenly.
+//   - "key" also partitions the other stages with KV input by key.
+//   - "none" processes the ready elements of a stage in a single bundle.
+const optPartitionMode = "partition_mode"
+
+// jobPartitionMode returns how the job partitions the ready elements of stages,
+// from the job's partition_mode pipeline option.
+func jobPartitionMode(j *jobservices.Job) (engine.PartitionMode, error) {
+	v, ok := jobOption(j.PipelineOptions(), optPartitionMode)
+	if !ok {
+		return engine.PartitionAuto, nil
+	}
+	switch v {
+	case "auto":
+		return engine.PartitionAuto, nil
+	case "key":
+		return engine.PartitionByKey, nil
+	case "none":
+		return engine.PartitionNone, nil
+	}
+	return 0, fmt.Errorf("invalid %v pipeline option %q: want auto, key or none", optPartitionMode, v)
+}
+
+// optStatePageBytes is the pipeline option for the maximum bytes of data in each
+// response to an SDK's state requests. Larger side inputs and user state are paged
+// with continuation tokens. 0 disables paging.
+const optStatePageBytes = "state_page_bytes"
+
+const defaultStatePageBytes = 1 << 20
+
+// jobStatePageSize returns the maximum bytes of data in each state response,
+// from the job's pipeline options.
+func jobStatePageSize(j *jobservices.Job) (int, error) {
+	v, ok := jobOption(j.PipelineOptions(), optStatePageBytes)
+	if !ok {
+		return defaultStatePageBytes, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %v pipeline option %q: must be a non-negative integer", optStatePageBytes, v)
+	}
+	return n, nil
+}
+
 func collectionPullDecoder(coldCId string, coders map[string]*pipepb.Coder, comps *pipepb.Components) func(io.Reader) []byte {
 	cID, err := lpUnknownCoders(coldCId, coders, comps.GetCoders())
 	if err != nil {
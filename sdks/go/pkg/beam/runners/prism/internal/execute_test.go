@@ -16,31 +16,49 @@
 package internal_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window/trigger"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/io/pubsubio"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/log"
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/options/jobopts"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/pubsub"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/universal"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/teststream"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/transforms/filter"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/transforms/stats"
 	"github.com/apache/beam/sdks/v2/go/test/integration/primitives"
+	"github.com/google/go-cmp/cmp"
+	pb "google.golang.org/genproto/googleapis/pubsub/v1"
 )
 
-func initRunner(t *testing.T) {
+// initRunner starts a job server for the test, unless an endpoint is already set.
+// It returns the started server, or nil if a server wasn't started.
+func initRunner(t *testing.T) *jobservices.Server {
 	t.Helper()
+	var s *jobservices.Server
 	if *jobopts.Endpoint == "" {
-		s := jobservices.NewServer(0, internal.RunPipeline)
+		s = jobservices.NewServer(0, internal.RunPipeline)
+		s.SetOptionDescriptors(internal.OptionDescriptors())
 		*jobopts.Endpoint = s.Endpoint()
 		go s.Serve()
 		t.Cleanup(func() {
@@ -58,6 +76,7 @@ func initRunner(t *testing.T) {
 	}
 	t.Cleanup(func() { os.Remove(f.Name()) })
 	*jobopts.WorkerBinary = f.Name()
+	return s
 }
 
 func execute(ctx context.Context, p *beam.Pipeline) (beam.PipelineResult, error) {
@@ -461,6 +480,21 @@ func TestRunner_Pipelines(t *testing.T) {
 				passert.Equals(s, got, want)
 			},
 		},
+		{
+			name: "processing_time_trigger",
+			pipeline: func(s beam.Scope) {
+				con := teststream.NewConfig()
+				con.AdvanceProcessingTime(100)
+				con.AddElements(1000, 1.0, 2.0, 3.0)
+				// The trigger fires once processing time passes its delay,
+				// so the later element is dropped from the closed window.
+				con.AdvanceProcessingTime(5000)
+				con.AddElements(22000, 4.0)
+				windowed := beam.WindowInto(s, window.NewGlobalWindows(), teststream.Create(s, con),
+					beam.Trigger(trigger.AfterProcessingTime().PlusDelay(5*time.Second)))
+				passert.Equals(s, stats.Sum(s, windowed), 6.0)
+			},
+		},
 	}
 	// TODO: Explicit DoFn Failure case.
 	// TODO: Session windows, where some are not merged.
@@ -499,6 +533,50 @@ func TestRunner_Metrics(t *testing.T) {
 	})
 }
 
+func TestRunner_Parallelism(t *testing.T) {
+	initRunner(t)
+	parallelism := *jobopts.Parallelism
+	*jobopts.Parallelism = 4
+	t.Cleanup(func() { *jobopts.Parallelism = parallelism })
+
+	tests := []struct {
+		name     string
+		pipeline func(s beam.Scope)
+	}{
+		{name: "Checkpoints", pipeline: primitives.Checkpoints},
+		{name: "CoGBK", pipeline: primitives.CoGBK},
+		{name: "Reshuffle", pipeline: primitives.Reshuffle},
+		{name: "BagStateParDo", pipeline: primitives.BagStateParDo},
+		{name: "TimersEventTimeBounded", pipeline: primitives.TimersEventTimeBounded},
+		{name: "WindowedSideInputs", pipeline: primitives.ValidateWindowedSideInputs},
+		{name: "WindowSums_GBK", pipeline: primitives.WindowSums_GBK},
+		{name: "WindowSums_Lifted", pipeline: primitives.WindowSums_Lifted},
+		{name: "TriggerElementCount", pipeline: primitives.TriggerElementCount},
+		{
+			name: "sdf_multiple_splits",
+			pipeline: func(s beam.Scope) {
+				configs := beam.Create(s, SourceConfig{NumElements: 10, InitialSplits: 4}, SourceConfig{NumElements: 10, InitialSplits: 4})
+				in := beam.ParDo(s, &intRangeFn{}, configs)
+				passert.Sum(s, beam.ParDo(s, toInt, in), "sdf sum", 20, 110)
+			},
+		},
+	}
+	for _, mode := range []string{"auto", "key", "none"} {
+		t.Run(mode, func(t *testing.T) {
+			setOption(t, "partition_mode", mode)
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					p, s := beam.NewPipelineWithRoot()
+					test.pipeline(s)
+					if _, err := executeWithT(context.Background(), t, p); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
+
 func TestFailure(t *testing.T) {
 	initRunner(t)
 
@@ -514,6 +592,494 @@ func TestFailure(t *testing.T) {
 	}
 }
 
+// startUnbounded starts a pipeline that doesn't terminate on its own, and waits
+// until it's processing elements. It returns the job's ID, and a channel that
+// receives the pipeline's error once it terminates.
+func startUnbounded(t *testing.T, s *jobservices.Server) (string, <-chan error) {
+	t.Helper()
+	p, root := beam.NewPipelineWithRoot()
+	beam.ParDo(root, &unboundedDoFn{}, beam.Impulse(root))
+
+	done := make(chan error, 1)
+	claims := unboundedClaims.Load()
+	go func() {
+		_, err := executeWithT(context.Background(), t, p)
+		done <- err
+	}()
+
+	ctx := context.Background()
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if unboundedClaims.Load() == claims {
+			continue
+		}
+		resp, err := s.GetJobs(ctx, &jobpb.GetJobsRequest{})
+		if err != nil {
+			t.Fatalf("GetJobs() = %v, want nil", err)
+		}
+		for _, info := range resp.GetJobInfo() {
+			if info.GetState() == jobpb.JobState_RUNNING {
+				return info.GetJobId(), done
+			}
+		}
+	}
+	t.Fatal("pipeline didn't start processing elements")
+	return "", nil
+}
+
+// waitForState waits for the pipeline to terminate, and validates the job's final state.
+func waitForState(t *testing.T, s *jobservices.Server, jobID string, done <-chan error, want jobpb.JobState_Enum) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("pipeline failed: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("pipeline didn't terminate")
+	}
+	resp, err := s.GetState(context.Background(), &jobpb.GetJobStateRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetState(%v) = %v, want nil", jobID, err)
+	}
+	if got := resp.GetState(); got != want {
+		t.Errorf("GetState(%v) = %v, want %v", jobID, got, want)
+	}
+}
+
+// setOption sets a pipeline option for the duration of the test.
+func setOption(t *testing.T, name, value string) {
+	beam.PipelineOptions.Set(name, value)
+	t.Cleanup(func() { beam.PipelineOptions.Set(name, "") })
+}
+
+func TestRunner_Retry(t *testing.T) {
+	initRunner(t)
+	flakyPipeline := func() *beam.Pipeline {
+		p, s := beam.NewPipelineWithRoot()
+		imp := beam.Impulse(s)
+		out := beam.ParDo(s, flakyFn, beam.ParDo(s, dofn1, imp))
+		passert.Sum(s, beam.ParDo(s, toInt, out), "sum", 3, 6)
+		return p
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		setOption(t, "bundle_max_attempts", "3")
+		setOption(t, "bundle_retry_backoff", "1ms")
+		flakyAttempts.Store(0)
+		if _, err := executeWithT(context.Background(), t, flakyPipeline()); err != nil {
+			t.Fatal(err)
+		}
+		// Each failed attempt stops at the first element, and the final attempt processes all 3.
+		if got, want := flakyAttempts.Load(), int64(flakyFailures+3); got != want {
+			t.Errorf("flakyFn calls = %v, want %v", got, want)
+		}
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		setOption(t, "bundle_max_attempts", "2")
+		setOption(t, "bundle_retry_backoff", "1ms")
+		flakyAttempts.Store(0)
+		_, err := executeWithT(context.Background(), t, flakyPipeline())
+		if err == nil || !strings.Contains(err.Error(), "flakyFn: transient failure") {
+			t.Fatalf("execute() = %v, want flakyFn failure", err)
+		}
+	})
+	t.Run("notRetryable", func(t *testing.T) {
+		setOption(t, "bundle_max_attempts", "3")
+		setOption(t, "bundle_retry_backoff", "1ms")
+		setOption(t, "bundle_retry_errors", "RESOURCE_EXHAUSTED")
+		flakyAttempts.Store(0)
+		_, err := executeWithT(context.Background(), t, flakyPipeline())
+		if err == nil || !strings.Contains(err.Error(), "flakyFn: transient failure") {
+			t.Fatalf("execute() = %v, want flakyFn failure", err)
+		}
+		if got, want := flakyAttempts.Load(), int64(1); got != want {
+			t.Errorf("flakyFn calls = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRunner_BundleFinalization(t *testing.T) {
+	initRunner(t)
+	p, s := beam.NewPipelineWithRoot()
+	imp := beam.Impulse(s)
+	out := beam.ParDo(s, finalizingFn, beam.ParDo(s, dofn1, imp))
+	passert.Sum(s, beam.ParDo(s, toInt, out), "sum", 3, 6)
+
+	finalizedBundles.Store(0)
+	if _, err := executeWithT(context.Background(), t, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := finalizedBundles.Load(); got == 0 {
+		t.Errorf("finalizingFn bundles finalized = %v, want at least 1", got)
+	}
+}
+
+func TestRunner_StatePaging(t *testing.T) {
+	initRunner(t)
+	// Every value of side inputs and user state is sent in its own page.
+	setOption(t, "state_page_bytes", "1")
+
+	tests := []struct {
+		name     string
+		pipeline func(s beam.Scope)
+	}{
+		{
+			name: "sideinput_iterable",
+			pipeline: func(s beam.Scope) {
+				var vs []int64
+				for i := int64(1); i <= 100; i++ {
+					vs = append(vs, i)
+				}
+				imp := beam.Impulse(s)
+				sum := beam.ParDo(s, dofn2x1, imp, beam.SideInput{Input: beam.CreateList(s, vs)})
+				beam.ParDo(s, &int64Check{
+					Name: "paged iter sideinput check",
+					Want: []int{5050},
+				}, sum)
+			},
+		}, {
+			name: "sideinput_multimap",
+			pipeline: func(s beam.Scope) {
+				imp := beam.Impulse(s)
+				col1 := beam.ParDo(s, dofnKV, imp)
+				keys := filter.Distinct(s, beam.DropValue(s, col1))
+				ks, sum := beam.ParDo2(s, dofnMultiMap, keys, beam.SideInput{Input: col1})
+				beam.ParDo(s, &stringCheck{
+					Name: "paged multiMap sideinput check K",
+					Want: []string{"a", "b"},
+				}, ks)
+				beam.ParDo(s, &int64Check{
+					Name: "paged multiMap sideinput check V",
+					Want: []int{9, 12},
+				}, sum)
+			},
+		},
+		{name: "BagStateParDo", pipeline: primitives.BagStateParDo},
+		{name: "BagStateParDoClear", pipeline: primitives.BagStateParDoClear},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, s := beam.NewPipelineWithRoot()
+			test.pipeline(s)
+			if _, err := executeWithT(context.Background(), t, p); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// setVariant configures the runner's handlers with the variant for the duration of the test.
+func setVariant(t *testing.T, variant string) {
+	path := filepath.Join(t.TempDir(), "variants.yaml")
+	if err := os.WriteFile(path, []byte(variant), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setOption(t, "variant_config", path)
+	setOption(t, "variant", "test")
+}
+
+func TestRunner_Faults(t *testing.T) {
+	initRunner(t)
+	sumPipeline := func() *beam.Pipeline {
+		p, s := beam.NewPipelineWithRoot()
+		in := beam.CreateList(s, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+		passert.Sum(s, beam.Reshuffle(s, in), "sum", 10, 55)
+		return p
+	}
+
+	t.Run("failBundles", func(t *testing.T) {
+		setVariant(t, `
+test:
+  fault:
+    seed: 1
+    faults:
+      - failbundles: 50
+`)
+		setOption(t, "bundle_max_attempts", "20")
+		setOption(t, "bundle_retry_backoff", "1ms")
+		if _, err := executeWithT(context.Background(), t, sumPipeline()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("failBundlesWithoutRetries", func(t *testing.T) {
+		setVariant(t, `
+test:
+  fault:
+    faults:
+      - failbundles: 100
+`)
+		_, err := executeWithT(context.Background(), t, sumPipeline())
+		if err == nil || !strings.Contains(err.Error(), "injected fault") {
+			t.Fatalf("execute() = %v, want injected fault", err)
+		}
+	})
+	t.Run("splitReorderDelay", func(t *testing.T) {
+		setVariant(t, `
+test:
+  fault:
+    seed: 1
+    faults:
+      - splitfraction: 0.5
+        reorder: true
+        datadelay: 1ms
+`)
+		if _, err := executeWithT(context.Background(), t, sumPipeline()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("splitThenFail", func(t *testing.T) {
+		// Bundles that fail after splitting are retried with only their primary,
+		// so each output is produced exactly once.
+		setVariant(t, `
+test:
+  fault:
+    seed: 1
+    faults:
+      - splitfraction: 0.5
+        failbundles: 50
+`)
+		setOption(t, "bundle_max_attempts", "20")
+		setOption(t, "bundle_retry_backoff", "1ms")
+		p, s := beam.NewPipelineWithRoot()
+		configs := beam.Create(s, SourceConfig{NumElements: 100, InitialSplits: 1}, SourceConfig{NumElements: 100, InitialSplits: 1})
+		in := beam.ParDo(s, &intRangeFn{Sleep: 5 * time.Millisecond}, configs)
+		passert.Sum(s, beam.ParDo(s, toInt, in), "sdf sum", 200, 10100)
+		if _, err := executeWithT(context.Background(), t, p); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("killWorkerRestarts", func(t *testing.T) {
+		setVariant(t, `
+test:
+  fault:
+    seed: 1
+    faults:
+      - transform: passert.Sum(sum)
+        killworker: 50
+`)
+		if _, err := executeWithT(context.Background(), t, sumPipeline()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("killWorker", func(t *testing.T) {
+		setVariant(t, `
+test:
+  fault:
+    faults:
+      - transform: passert.Sum(sum)
+        killworker: 100
+`)
+		_, err := executeWithT(context.Background(), t, sumPipeline())
+		if err == nil || !strings.Contains(err.Error(), "SDK worker killed") {
+			t.Fatalf("execute() = %v, want SDK worker killed", err)
+		}
+	})
+	t.Run("unknownVariant", func(t *testing.T) {
+		setVariant(t, `
+other:
+  fault:
+    faults:
+      - failbundles: 100
+`)
+		_, err := executeWithT(context.Background(), t, sumPipeline())
+		if err == nil || !strings.Contains(err.Error(), `"test" isn't in`) {
+			t.Fatalf("execute() = %v, want unknown variant error", err)
+		}
+	})
+}
+
+func TestRunner_CheckpointResume(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	dir := t.TempDir()
+	setOption(t, "checkpoint_dir", dir)
+	setOption(t, "checkpoint_interval", "20ms")
+
+	jobID, done := startUnbounded(t, s)
+	// Wait for a checkpoint after the job has made some progress.
+	claims := unboundedClaims.Load()
+	for unboundedClaims.Load() < claims+100 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	progressed := time.Now()
+	path := filepath.Join(dir, jobID, "checkpoint")
+	for deadline := time.Now().Add(time.Minute); ; time.Sleep(10 * time.Millisecond) {
+		if fi, err := os.Stat(path); err == nil && fi.ModTime().After(progressed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %v wasn't checkpointed to %v", jobID, path)
+		}
+	}
+	if _, err := s.Cancel(context.Background(), &jobpb.CancelJobRequest{JobId: jobID}); err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", jobID, err)
+	}
+	waitForState(t, s, jobID, done, jobpb.JobState_CANCELLED)
+
+	// The resumed job continues from the checkpointed restriction, rather than the start.
+	setOption(t, "resume_job", jobID)
+	unboundedFirstStart.Store(-1)
+	resumedID, done := startUnbounded(t, s)
+	if got := unboundedFirstStart.Load(); got < 50 {
+		t.Errorf("resumed job started at position %v, want the checkpointed position of at least 50", got)
+	}
+	if _, err := s.Cancel(context.Background(), &jobpb.CancelJobRequest{JobId: resumedID}); err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", resumedID, err)
+	}
+	waitForState(t, s, resumedID, done, jobpb.JobState_CANCELLED)
+}
+
+func TestCancel(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	jobID, done := startUnbounded(t, s)
+
+	resp, err := s.Cancel(context.Background(), &jobpb.CancelJobRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", jobID, err)
+	}
+	if got, want := resp.GetState(), jobpb.JobState_CANCELLING; got != want {
+		t.Errorf("Cancel(%v) = %v, want %v", jobID, got, want)
+	}
+	waitForState(t, s, jobID, done, jobpb.JobState_CANCELLED)
+}
+
+func TestDrain(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	jobID, done := startUnbounded(t, s)
+
+	truncations := unboundedTruncations.Load()
+	state, err := s.Drain(context.Background(), jobID)
+	if err != nil {
+		t.Fatalf("Drain(%v) = %v, want nil", jobID, err)
+	}
+	if got, want := state, jobpb.JobState_DRAINING; got != want {
+		t.Errorf("Drain(%v) = %v, want %v", jobID, got, want)
+	}
+	waitForState(t, s, jobID, done, jobpb.JobState_DRAINED)
+	if unboundedTruncations.Load() == truncations {
+		t.Error("pipeline drained without truncating any restrictions")
+	}
+}
+
+func TestDrain_After(t *testing.T) {
+	initRunner(t)
+	setOption(t, "drain_after", "100ms")
+
+	p, root := beam.NewPipelineWithRoot()
+	beam.ParDo(root, &unboundedDoFn{}, beam.Impulse(root))
+	truncations := unboundedTruncations.Load()
+	if _, err := executeWithT(context.Background(), t, p); err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if unboundedTruncations.Load() == truncations {
+		t.Error("pipeline drained without truncating any restrictions")
+	}
+}
+
+// shoutMessage uppercases the data of Pub/Sub messages, retaining their attributes.
+func shoutMessage(m *pb.PubsubMessage) *pb.PubsubMessage {
+	return &pb.PubsubMessage{Data: bytes.ToUpper(m.GetData()), Attributes: m.GetAttributes()}
+}
+
+func init() {
+	register.Function1x1(shoutMessage)
+}
+
+func TestRunner_PubSub(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	ctx := context.Background()
+	emu, err := pubsub.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const inTopic, inSub = "projects/prism/topics/in", "projects/prism/subscriptions/in"
+	const outTopic, outSub = "projects/prism/topics/out", "projects/prism/subscriptions/out"
+	for sub, topic := range map[string]string{inSub: inTopic, outSub: outTopic} {
+		if err := emu.EnsureSubscription(ctx, sub, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages published before the job starts are read from the existing subscription,
+	// and redelivered messages are dropped by their ID attribute.
+	if _, err := emu.Publish(ctx, inTopic, []*pubsubpb.PubsubMessage{
+		{Data: []byte("a"), Attributes: map[string]string{"id": "1", "ts": "1000"}},
+		{Data: []byte("b"), Attributes: map[string]string{"id": "2", "ts": "1970-01-01T00:00:02Z"}},
+		{Data: []byte("a"), Attributes: map[string]string{"id": "1", "ts": "1000"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, root := beam.NewPipelineWithRoot()
+	msgs := pubsubio.Read(root, "prism", "in", &pubsubio.ReadOptions{
+		Subscription:       "in",
+		IDAttribute:        "id",
+		TimestampAttribute: "ts",
+		WithAttributes:     true,
+	})
+	pubsubio.Write(root, "prism", "out", beam.ParDo(root, shoutMessage, msgs))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := executeWithT(ctx, t, p)
+		done <- err
+	}()
+
+	pull := func() []string {
+		t.Helper()
+		rms, err := emu.Pull(ctx, outSub, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, ackIDs []string
+		for _, rm := range rms {
+			got = append(got, string(rm.GetMessage().GetData())+":"+rm.GetMessage().GetAttributes()["id"])
+			ackIDs = append(ackIDs, rm.GetAckId())
+		}
+		if err := emu.Ack(ctx, outSub, ackIDs); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	var got []string
+	for deadline := time.Now().Add(time.Minute); len(got) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		got = append(got, pull()...)
+	}
+	sort.Strings(got)
+	if d := cmp.Diff([]string{"A:1", "B:2"}, got); d != "" {
+		t.Errorf("messages published to %v diff (-want, +got):\n%v", outTopic, d)
+	}
+
+	// Pub/Sub reads are unbounded, so the job runs until it's drained.
+	resp, err := s.GetJobs(ctx, &jobpb.GetJobsRequest{})
+	if err != nil {
+		t.Fatalf("GetJobs() = %v, want nil", err)
+	}
+	var jobID string
+	for _, info := range resp.GetJobInfo() {
+		if info.GetState() == jobpb.JobState_RUNNING {
+			jobID = info.GetJobId()
+		}
+	}
+	if _, err := s.Drain(ctx, jobID); err != nil {
+		t.Fatalf("Drain(%v) = %v, want nil", jobID, err)
+	}
+	waitForState(t, s, jobID, done, jobpb.JobState_DRAINED)
+	if got := pull(); len(got) != 0 {
+		t.Errorf("messages published to %v after draining = %v, want none", outTopic, got)
+	}
+}
+
 func TestRunner_Passert(t *testing.T) {
 	initRunner(t)
 	tests := []struct {
@@ -580,6 +1146,116 @@ func init() {
 	register.Function4x1(toID)
 }
 
+// warnOdd logs a warning for each odd element.
+func warnOdd(ctx context.Context, v int64) int64 {
+	if v%2 == 1 {
+		log.Warnf(ctx, "odd element %v", v)
+	}
+	return v
+}
+
+func init() {
+	register.Function2x1(warnOdd)
+}
+
+func TestRunner_JobMessages(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	p, root := beam.NewPipelineWithRoot()
+	checked := beam.ParDo(root.Scope("Checker"), warnOdd, beam.ParDo(root, dofn1, beam.Impulse(root)))
+	passert.Count(root, checked, "count", 3)
+	pr, err := executeWithT(context.Background(), t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SDK logs arrive asynchronously, and may follow the job's completion.
+	filter := jobservices.MessageFilter{MinImportance: jobpb.JobMessage_JOB_MESSAGE_WARNING, Transform: "Checker"}
+	var got []jobservices.JobMessage
+	for deadline := time.Now().Add(10 * time.Second); len(got) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		got = s.JobMessages(pr.JobID(), filter)
+	}
+	var texts []string
+	for _, m := range got {
+		if m.Stage == "" || m.Bundle == "" || m.Transform == "" || m.Worker == "" {
+			t.Errorf("JobMessages() message %+v is missing its stage, bundle, transform, or worker", m)
+		}
+		texts = append(texts, m.Text)
+	}
+	sort.Strings(texts)
+	if d := cmp.Diff([]string{"odd element 1", "odd element 3"}, texts); d != "" {
+		t.Errorf("JobMessages(%+v) diff (-want, +got):\n%v", filter, d)
+	}
+}
+
+func groupKey(k string, _, _ func(*int64) bool, emit func(string)) {
+	emit(k)
+}
+
+func init() {
+	register.Function4x0(groupKey)
+}
+
+func TestRunner_ElementSamples(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	setOption(t, "element_samples", "5")
+	p, root := beam.NewPipelineWithRoot()
+	imp := beam.Impulse(root)
+	grouped := beam.CoGroupByKey(root.Scope("Group"), beam.ParDo(root, dofnKV, imp), beam.ParDo(root, dofnKV, imp))
+	passert.Count(root, beam.ParDo(root.Scope("Key"), groupKey, grouped), "count", 2)
+	pr, err := executeWithT(context.Background(), t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.GetPipeline(context.Background(), &jobpb.GetJobPipelineRequest{JobId: pr.JobID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := func(name string) string {
+		for _, tr := range resp.GetPipeline().GetComponents().GetTransforms() {
+			if tr.GetUniqueName() == name {
+				for _, pcol := range tr.GetOutputs() {
+					return pcol
+				}
+			}
+		}
+		t.Fatalf("no transform %q in the pipeline", name)
+		return ""
+	}
+	samples := s.ElementSamples(pr.JobID())
+	// Go's CoGroupByKey expands the grouped values in a transform fused with
+	// its consumers, so the expanded PCollection isn't sampled, while the
+	// outputs of stages are.
+	if got, ok := samples[output("Group")]; ok {
+		t.Errorf("ElementSamples(Group) = %v, want no samples for a PCollection internal to a fused stage", got)
+	}
+	if got, want := len(samples[output("Key")]), 2; got != want {
+		t.Errorf("len(ElementSamples(Key)) = %v, want %v", got, want)
+	}
+}
+
+func TestRunner_ElementSamples_Default(t *testing.T) {
+	s := initRunner(t)
+	if s == nil {
+		t.Skip("requires an in process job server")
+	}
+	p, root := beam.NewPipelineWithRoot()
+	passert.Count(root, beam.ParDo(root, dofn1, beam.Impulse(root)), "count", 3)
+	pr, err := executeWithT(context.Background(), t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.ElementSamples(pr.JobID()); len(got) != 0 {
+		t.Errorf("ElementSamples() = %v, want no samples unless element_samples is set", got)
+	}
+}
+
 // TODO: PCollection metrics tests, in particular for element counts, in multi transform pipelines
 // There's a doubling bug since we re-use the same pcollection IDs for the source & sink, and
 // don't do any re-writing.
@@ -114,6 +114,11 @@ func (h *combine) PrepareTransform(tid string, t *pipepb.PTransform, comps *pipe
 		pcolInID = pcol
 	}
 	inputPCol := comps.GetPcollections()[pcolInID]
+	// Lifted combines pre-aggregate elements before the GBK, which would break
+	// triggers that depend on the elements reaching the GBK, such as element counts.
+	if ws := comps.GetWindowingStrategies()[inputPCol.GetWindowingStrategyId()]; ws.GetTrigger().GetDefault() == nil {
+		return nil, nil
+	}
 	kvkiID := inputPCol.GetCoderId()
 	kID := comps.GetCoders()[kvkiID].GetComponentCoderIds()[0]
 
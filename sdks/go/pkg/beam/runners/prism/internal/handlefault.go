@@ -0,0 +1,227 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+)
+
+// This file retains the logic for the fault injection handler
+
+// FaultCharacteristic holds the configuration for injecting faults into bundles,
+// to test how pipelines behave when bundles fail, workers are lost, or data is slow.
+// No faults are injected by default.
+type FaultCharacteristic struct {
+	Seed   int64       // Seeds the random choice of faulted bundles. 0 uses the current time.
+	Faults []FaultRule // Faults to inject, and the stages they're injected into.
+}
+
+// FaultRule configures faults injected into the bundles of matching stages.
+//
+// A rule matches stages executing the transform, or any transform within the
+// composite, with the given unique name, and the stage with the given ID.
+// Rules without either match all stages. Where rules overlap, the most
+// disruptive configuration of each fault applies.
+type FaultRule struct {
+	Transform string // Unique name of a transform or composite.
+	Stage     string // ID of a stage, such as "stage-003".
+
+	FailBundles   float64       // Percentage of bundles that fail after processing, discarding their output.
+	KillWorker    float64       // Percentage of bundles whose SDK worker is killed once their input is sent.
+	SplitFraction float64       // Fraction of the remainder at which bundles are split once their input is sent. 0 disables.
+	DataDelay     time.Duration // Delay before each input element is sent to the SDK.
+	Reorder       bool          // Sets whether elements ready at each watermark are shuffled, within and across bundles. Time sorted input is never reordered.
+}
+
+func Fault(config any) *fault {
+	c := config.(FaultCharacteristic)
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &fault{config: c, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// fault represents an instance of the fault injection handler.
+type fault struct {
+	config FaultCharacteristic
+
+	mu  sync.Mutex
+	rnd *rand.Rand // Chooses faulted bundles. Shared by all stages.
+}
+
+// ConfigURN returns the name for fault injection in the configuration file.
+func (*fault) ConfigURN() string {
+	return "fault"
+}
+
+func (*fault) ConfigCharacteristic() reflect.Type {
+	return reflect.TypeOf((*FaultCharacteristic)(nil)).Elem()
+}
+
+// validate checks the configured faults are in range.
+func (h *fault) validate() error {
+	for i, r := range h.config.Faults {
+		if r.FailBundles < 0 || r.FailBundles > 100 {
+			return fmt.Errorf("fault %v: failbundles must be a percentage, got %v", i, r.FailBundles)
+		}
+		if r.KillWorker < 0 || r.KillWorker > 100 {
+			return fmt.Errorf("fault %v: killworker must be a percentage, got %v", i, r.KillWorker)
+		}
+		if r.SplitFraction < 0 || r.SplitFraction >= 1 {
+			return fmt.Errorf("fault %v: splitfraction must be in [0, 1), got %v", i, r.SplitFraction)
+		}
+		if r.DataDelay < 0 {
+			return fmt.Errorf("fault %v: datadelay must not be negative, got %v", i, r.DataDelay)
+		}
+	}
+	return nil
+}
+
+// matches returns whether the rule applies to the stage.
+func (r *FaultRule) matches(stg *stage, comps *pipepb.Components) bool {
+	if r.Stage != "" && r.Stage != stg.ID {
+		return false
+	}
+	if r.Transform == "" {
+		return true
+	}
+	for _, tid := range stg.transforms {
+		name := comps.GetTransforms()[tid].GetUniqueName()
+		if name == r.Transform || strings.HasPrefix(name, r.Transform+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stageFaults returns the faults injected into bundles of the stage, combining all
+// rules that match it. Returns nil if no faults are injected into the stage.
+func (h *fault) stageFaults(stg *stage, comps *pipepb.Components) *stageFaults {
+	var sf *stageFaults
+	for _, r := range h.config.Faults {
+		if !r.matches(stg, comps) {
+			continue
+		}
+		if sf == nil {
+			sf = &stageFaults{h: h}
+		}
+		if r.FailBundles > sf.failBundles {
+			sf.failBundles = r.FailBundles
+		}
+		if r.KillWorker > sf.killWorker {
+			sf.killWorker = r.KillWorker
+		}
+		// Smaller fractions split off more of the remainder.
+		if r.SplitFraction > 0 && (sf.splitFraction == 0 || r.SplitFraction < sf.splitFraction) {
+			sf.splitFraction = r.SplitFraction
+		}
+		if r.DataDelay > sf.dataDelay {
+			sf.dataDelay = r.DataDelay
+		}
+		sf.reorder = sf.reorder || r.Reorder
+	}
+	if sf == nil {
+		return nil
+	}
+	if stg.envID == "" {
+		// Runner transforms don't have a worker or data channel.
+		sf.killWorker, sf.splitFraction, sf.dataDelay = 0, 0, 0
+	}
+	if stg.timeSorted {
+		sf.reorder = false
+	}
+	if *sf == (stageFaults{h: h}) {
+		return nil
+	}
+	return sf
+}
+
+// chance returns true with the given percentage probability.
+func (h *fault) chance(percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rnd.Float64()*100 < percent
+}
+
+// shuffle randomly permutes n elements, like rand.Shuffle.
+func (h *fault) shuffle(n int, swap func(i, j int)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rnd.Shuffle(n, swap)
+}
+
+// stageFaults is the combined configuration of faults injected into a stage's bundles.
+type stageFaults struct {
+	h *fault
+
+	failBundles, killWorker float64
+	splitFraction           float64
+	dataDelay               time.Duration
+	reorder                 bool
+}
+
+// String describes the faults, for job messages.
+func (sf *stageFaults) String() string {
+	var fs []string
+	if sf.failBundles > 0 {
+		fs = append(fs, fmt.Sprintf("failing %v%% of bundles", sf.failBundles))
+	}
+	if sf.killWorker > 0 {
+		fs = append(fs, fmt.Sprintf("killing the worker in %v%% of bundles", sf.killWorker))
+	}
+	if sf.splitFraction > 0 {
+		fs = append(fs, fmt.Sprintf("splitting bundles at %v", sf.splitFraction))
+	}
+	if sf.dataDelay > 0 {
+		fs = append(fs, fmt.Sprintf("delaying input elements by %v", sf.dataDelay))
+	}
+	if sf.reorder {
+		fs = append(fs, "reordering elements")
+	}
+	return strings.Join(fs, ", ")
+}
+
+// bundleFaults are the faults chosen for a single bundle.
+type bundleFaults struct {
+	fail, kill    bool
+	splitFraction float64
+	dataDelay     time.Duration
+}
+
+// forBundle chooses the faults injected into a bundle of the stage.
+// A nil stageFaults injects no faults.
+func (sf *stageFaults) forBundle() bundleFaults {
+	if sf == nil {
+		return bundleFaults{}
+	}
+	return bundleFaults{
+		fail:          sf.h.chance(sf.failBundles),
+		kill:          sf.h.chance(sf.killWorker),
+		splitFraction: sf.splitFraction,
+		dataDelay:     sf.dataDelay,
+	}
+}
@@ -0,0 +1,71 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+)
+
+func TestFault_stageFaults(t *testing.T) {
+	comps := &pipepb.Components{
+		Transforms: map[string]*pipepb.PTransform{
+			"t1": {UniqueName: "Parse/Split"},
+			"t2": {UniqueName: "Count"},
+		},
+	}
+	parse := &stage{ID: "stage-001", transforms: []string{"t1"}, envID: "go"}
+	count := &stage{ID: "stage-002", transforms: []string{"t2"}, envID: "go"}
+	sorted := &stage{ID: "stage-003", transforms: []string{"t2"}, envID: "go", timeSorted: true}
+	runner := &stage{ID: "stage-004", transforms: []string{"t2"}}
+
+	h := Fault(FaultCharacteristic{Seed: 1, Faults: []FaultRule{
+		{Transform: "Parse", FailBundles: 10, SplitFraction: 0.5},
+		{Stage: "stage-001", FailBundles: 20, SplitFraction: 0.25, DataDelay: time.Millisecond},
+		{Transform: "Count", Reorder: true, KillWorker: 5},
+		{Transform: "Pars", FailBundles: 100},
+	}})
+	if err := h.validate(); err != nil {
+		t.Fatalf("validate() = %v, want nil", err)
+	}
+
+	tests := []struct {
+		stg  *stage
+		want *stageFaults
+	}{
+		{parse, &stageFaults{h: h, failBundles: 20, splitFraction: 0.25, dataDelay: time.Millisecond}},
+		{count, &stageFaults{h: h, killWorker: 5, reorder: true}},
+		{sorted, &stageFaults{h: h, killWorker: 5}},
+		{runner, &stageFaults{h: h, reorder: true}}, // Runner transforms have no worker to kill.
+	}
+	for _, test := range tests {
+		got := h.stageFaults(test.stg, comps)
+		if got == nil || *got != *test.want {
+			t.Errorf("stageFaults(%v) = %+v, want %+v", test.stg.ID, got, *test.want)
+		}
+	}
+
+	if got := h.stageFaults(&stage{ID: "stage-005", transforms: []string{"t1"}}, &pipepb.Components{}); got != nil {
+		t.Errorf("stageFaults(stage-005) = %+v, want nil", *got)
+	}
+
+	invalid := Fault(FaultCharacteristic{Faults: []FaultRule{{SplitFraction: 1}}})
+	if err := invalid.validate(); err == nil {
+		t.Error("validate() with splitfraction 1 = nil, want error")
+	}
+}
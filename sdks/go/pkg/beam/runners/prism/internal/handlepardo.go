@@ -78,15 +78,20 @@ func (h *pardo) PrepareTransform(tid string, t *pipepb.PTransform, comps *pipepb
 	}
 
 	// Lets check for and remove anything that makes things less simple.
-	if pdo.OnWindowExpirationTimerFamilySpec == "" &&
-		!pdo.RequestsFinalization &&
-		!pdo.RequiresStableInput &&
-		!pdo.RequiresTimeSortedInput &&
-		len(pdo.StateSpecs) == 0 &&
-		len(pdo.TimerFamilySpecs) == 0 &&
-		pdo.RestrictionCoderId == "" {
+	if pdo.RestrictionCoderId == "" {
 		// Which inputs are Side inputs don't change the graph further,
 		// so they're not included here. Any nearly any ParDo can have them.
+		//
+		// User state doesn't change the graph either, since stateful stages
+		// are marked as such, and processed by key by the ElementManager.
+		// Nor does OnWindowExpiration, since its timer family is fired by the
+		// ElementManager as each key's windows expire.
+		//
+		// Neither do Bundle Finalization, Stable Input, or Time Sorted Input.
+		// Finalization is requested after the bundle's output is committed,
+		// stage inputs are always materialized by the ElementManager, and
+		// time sorted stages are marked, and have their input sorted by the
+		// ElementManager.
 
 		// At their simplest, we don't need to do anything special at pre-processing time, and simply pass through as normal.
 		return &pipepb.Components{
@@ -124,7 +129,8 @@ func (h *pardo) PrepareTransform(tid string, t *pipepb.PTransform, comps *pipepb
 	//
 	// TRUNCATE_SIZED_RESTRICTION is how the runner has an SDK turn an
 	// unbounded transform into a bound one. Not needed until the pipeline
-	// is told to drain.
+	// is told to drain, so it's only added to the stage's drain descriptor.
+	// See buildDrainDescriptor.
 	// Input: KV(KV(element, restriction), float64) := synthetic split results from above
 	// Output: KV(KV(element, restriction), float64). := synthetic, truncated results sent as Split n Sized
 	//
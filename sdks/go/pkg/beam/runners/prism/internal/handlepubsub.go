@@ -0,0 +1,336 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/exec"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/pubsub"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// This file retains the logic for emulating Pub/Sub reads and writes
+// against the in process Pub/Sub emulator.
+
+const (
+	pubsubPullSize     = 1000                   // Maximum messages read from a subscription at once.
+	pubsubPollInterval = 100 * time.Millisecond // How long to wait before reading an empty subscription again.
+	pubsubDedupePeriod = 10 * time.Minute       // How long message IDs from the ID attribute are remembered.
+)
+
+// pubsubRead reads messages from a subscription of the emulator, into a
+// source stage of the ElementManager.
+type pubsubRead struct {
+	stageID string
+	emu     *pubsub.Emulator
+	pyld    *pipepb.PubSubReadPayload
+
+	sub       string // Fully qualified subscription to read from.
+	temporary bool   // Whether the subscription was created for the job, and is deleted once it's done.
+
+	// How far the watermark trails processing time while the subscription is idle,
+	// from the allowed lateness of the output. Negative if lateness is unbounded.
+	idleLateness time.Duration
+}
+
+// preparePubSubRead decodes the PubSubReadPayload, and prepares the subscription
+// for the read. Reads of a topic create a subscription for the job, so they only
+// read messages published after the job starts.
+func preparePubSubRead(ctx context.Context, j *jobservices.Job, stageID string, t *pipepb.PTransform, comps *pipepb.Components) (*pubsubRead, error) {
+	pyld := &pipepb.PubSubReadPayload{}
+	if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pyld); err != nil {
+		return nil, fmt.Errorf("unable to decode PubSubReadPayload for transform[%v]: %w", t.GetUniqueName(), err)
+	}
+	col := comps.GetPcollections()[getOnlyValue(t.GetOutputs())]
+	if urn := comps.GetCoders()[col.GetCoderId()].GetSpec().GetUrn(); urn != urns.CoderBytes {
+		return nil, fmt.Errorf("Pub/Sub read transform[%v] must output bytes, but has coder %v", t.GetUniqueName(), urn)
+	}
+	emu, err := pubsub.Start(0)
+	if err != nil {
+		return nil, err
+	}
+	r := &pubsubRead{stageID: stageID, emu: emu, pyld: pyld, sub: pyld.GetSubscription(), idleLateness: -1}
+	if lateness := allowedLateness(comps.GetWindowingStrategies()[col.GetWindowingStrategyId()]); lateness < time.Duration(math.MaxInt64) {
+		r.idleLateness = lateness
+	}
+	switch {
+	case r.sub != "" && pyld.GetTopic() == "":
+		// Without a topic, the subscription must already exist.
+	case r.sub != "":
+		if err := emu.EnsureSubscription(ctx, r.sub, pyld.GetTopic()); err != nil {
+			return nil, fmt.Errorf("Pub/Sub read transform[%v]: %w", t.GetUniqueName(), err)
+		}
+	case pyld.GetTopic() != "":
+		project, _, _ := strings.Cut(strings.TrimPrefix(pyld.GetTopic(), "projects/"), "/")
+		r.sub = fmt.Sprintf("projects/%v/subscriptions/prism_%v_%v", project, j.JobKey(), stageID)
+		r.temporary = true
+		if err := emu.EnsureSubscription(ctx, r.sub, pyld.GetTopic()); err != nil {
+			return nil, fmt.Errorf("Pub/Sub read transform[%v]: %w", t.GetUniqueName(), err)
+		}
+	default:
+		return nil, fmt.Errorf("Pub/Sub read transform[%v] has neither a topic nor a subscription", t.GetUniqueName())
+	}
+	return r, nil
+}
+
+// read pulls messages from the subscription into the source stage, until the
+// source is finished, or the job's context is done. Messages are acknowledged
+// once they're added to the ElementManager.
+//
+// Messages are timestamped with their publish time, or the read's timestamp
+// attribute. The watermark is advanced by advanceWatermark after each pull.
+func (r *pubsubRead) read(ctx context.Context, em *engine.ElementManager) error {
+	if r.temporary {
+		defer func() {
+			if err := r.emu.DeleteSubscription(context.Background(), r.sub); err != nil {
+				slog.Warn("unable to delete Pub/Sub subscription", slog.String("subscription", r.sub), slog.Any("error", err))
+			}
+		}()
+	}
+	seen := map[string]time.Time{} // Message IDs from the ID attribute, and when they were read.
+	watermark := mtime.MinTimestamp
+	for {
+		start := time.Now()
+		msgs, err := r.emu.Pull(ctx, r.sub, pubsubPullSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to read Pub/Sub subscription %v: %w", r.sub, err)
+		}
+		for id, t := range seen {
+			if start.Sub(t) > pubsubDedupePeriod {
+				delete(seen, id)
+			}
+		}
+		var es []engine.SourceElement
+		var ackIDs []string
+		minEventTime := mtime.MaxTimestamp
+		for _, rm := range msgs {
+			ackIDs = append(ackIDs, rm.GetAckId())
+			m := rm.GetMessage()
+			if attr := r.pyld.GetIdAttribute(); attr != "" {
+				if id, ok := m.GetAttributes()[attr]; ok {
+					if _, ok := seen[id]; ok {
+						continue
+					}
+					seen[id] = start
+				}
+			}
+			et, err := r.eventTime(m)
+			if err != nil {
+				return err
+			}
+			minEventTime = mtime.Min(minEventTime, et)
+			encoded, err := r.encode(m)
+			if err != nil {
+				return err
+			}
+			es = append(es, engine.SourceElement{Encoded: encoded, EventTime: et})
+		}
+		watermark = r.advanceWatermark(watermark, start, len(msgs), len(es), minEventTime)
+		if !em.SourceElements(r.stageID, es, watermark) {
+			return nil
+		}
+		if err := r.emu.Ack(ctx, r.sub, ackIDs); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to acknowledge messages of Pub/Sub subscription %v: %w", r.sub, err)
+		}
+		if len(msgs) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pubsubPollInterval):
+		}
+	}
+}
+
+// advanceWatermark returns the read's watermark after a pull that started at start,
+// and returned pulled messages, of which read weren't duplicates, with the earliest
+// event time minEventTime. The watermark never moves backwards.
+//
+// With publish times, the watermark advances to when the subscription was last read
+// without a backlog, since later messages are published after the pull started.
+// With a timestamp attribute, it advances to the earliest timestamp of each read,
+// so later messages with earlier timestamps are late. While the subscription is
+// idle, it advances to processing time less the allowed lateness of the output,
+// unless that's unbounded.
+func (r *pubsubRead) advanceWatermark(watermark mtime.Time, start time.Time, pulled, read int, minEventTime mtime.Time) mtime.Time {
+	switch {
+	case r.pyld.GetTimestampAttribute() == "":
+		if pulled < pubsubPullSize {
+			watermark = mtime.Max(watermark, mtime.FromTime(start))
+		}
+	case read > 0:
+		watermark = mtime.Max(watermark, minEventTime)
+	case pulled == 0 && r.idleLateness >= 0:
+		watermark = mtime.Max(watermark, mtime.FromTime(start.Add(-r.idleLateness)))
+	}
+	return watermark
+}
+
+// eventTime returns the event time of the message, from the read's timestamp
+// attribute if set, as milliseconds since the epoch or an RFC 3339 timestamp,
+// or from its publish time otherwise.
+func (r *pubsubRead) eventTime(m *pubsubpb.PubsubMessage) (mtime.Time, error) {
+	attr := r.pyld.GetTimestampAttribute()
+	if attr == "" {
+		return mtime.FromTime(m.GetPublishTime().AsTime()), nil
+	}
+	v, ok := m.GetAttributes()[attr]
+	if !ok {
+		return 0, fmt.Errorf("Pub/Sub message %v is missing timestamp attribute %q", m.GetMessageId(), attr)
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return mtime.Time(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return 0, fmt.Errorf("Pub/Sub message %v has invalid timestamp attribute %q value %q: must be milliseconds since the epoch, or RFC 3339", m.GetMessageId(), attr, v)
+	}
+	return mtime.FromTime(t), nil
+}
+
+// encode returns the message as a nested bytes element, with the message data,
+// or the whole marshalled message if the read is with attributes.
+func (r *pubsubRead) encode(m *pubsubpb.PubsubMessage) ([]byte, error) {
+	data := m.GetData()
+	if r.pyld.GetWithAttributes() {
+		var err error
+		if data, err = proto.Marshal(m); err != nil {
+			return nil, fmt.Errorf("unable to marshal Pub/Sub message %v: %w", m.GetMessageId(), err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := coder.EncodeBytes(data, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// preparePubSubWrite validates the PubSubWritePayload, and creates the topic
+// for the write if it doesn't exist.
+func preparePubSubWrite(ctx context.Context, t *pipepb.PTransform, comps *pipepb.Components) error {
+	pyld := &pipepb.PubSubWritePayload{}
+	if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pyld); err != nil {
+		return fmt.Errorf("unable to decode PubSubWritePayload for transform[%v]: %w", t.GetUniqueName(), err)
+	}
+	col := comps.GetPcollections()[getOnlyValue(t.GetInputs())]
+	if urn := comps.GetCoders()[col.GetCoderId()].GetSpec().GetUrn(); urn != urns.CoderBytes {
+		return fmt.Errorf("Pub/Sub write transform[%v] must consume bytes, but has coder %v", t.GetUniqueName(), urn)
+	}
+	if pyld.GetTopic() == "" {
+		return fmt.Errorf("Pub/Sub write transform[%v] has no topic", t.GetUniqueName())
+	}
+	emu, err := pubsub.Start(0)
+	if err != nil {
+		return err
+	}
+	return emu.EnsureTopic(ctx, pyld.GetTopic())
+}
+
+// publishToPubSub publishes the input elements of a Pub/Sub write to its topic.
+// Elements are marshalled PubsubMessages. If the write has a timestamp attribute,
+// it's set to the element's event time, in milliseconds since the epoch, and if
+// it has an ID attribute, it's set to a unique ID, unless the message has one.
+func publishToPubSub(stageID, tid string, t *pipepb.PTransform, comps *pipepb.Components, inputData [][]byte) error {
+	pyld := &pipepb.PubSubWritePayload{}
+	if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pyld); err != nil {
+		return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: unable to decode PubSubWritePayload: %w", stageID, tid, err)
+	}
+	ws := windowingStrategy(comps, tid)
+	coders := map[string]*pipepb.Coder{}
+	wcID, err := lpUnknownCoders(ws.GetWindowCoderId(), coders, comps.GetCoders())
+	if err != nil {
+		return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q %v: couldn't process window coder:\n%w", stageID, tid, prototext.Format(t), err)
+	}
+	wDec, _ := makeWindowCoders(coders[wcID])
+
+	var msgs []*pubsubpb.PubsubMessage
+	for _, data := range inputData {
+		buf := bytes.NewBuffer(data)
+		for {
+			_, et, _, err := exec.DecodeWindowedValueHeader(wDec, buf)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: can't decode windowed value header: %w", stageID, tid, err)
+			}
+			b, err := coder.DecodeBytes(buf)
+			if err != nil {
+				return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: can't decode element: %w", stageID, tid, err)
+			}
+			m := &pubsubpb.PubsubMessage{}
+			if err := proto.Unmarshal(b, m); err != nil {
+				return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: can't unmarshal PubsubMessage: %w", stageID, tid, err)
+			}
+			setPubSubAttributes(pyld, m, et)
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	emu, err := pubsub.Start(0)
+	if err != nil {
+		return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: %w", stageID, tid, err)
+	}
+	if _, err := emu.Publish(context.Background(), pyld.GetTopic(), msgs); err != nil {
+		return fmt.Errorf("ExecuteTransform[PubSubWrite] stage %v, transform %q: unable to publish to %v: %w", stageID, tid, pyld.GetTopic(), err)
+	}
+	return nil
+}
+
+// setPubSubAttributes sets the timestamp and ID attributes of the write on the
+// message, for the element's event time. Reads with the same attributes use them
+// as the message's event time, and to deduplicate messages.
+func setPubSubAttributes(pyld *pipepb.PubSubWritePayload, m *pubsubpb.PubsubMessage, et mtime.Time) {
+	tsAttr, idAttr := pyld.GetTimestampAttribute(), pyld.GetIdAttribute()
+	if tsAttr == "" && idAttr == "" {
+		return
+	}
+	if m.Attributes == nil {
+		m.Attributes = map[string]string{}
+	}
+	if tsAttr != "" {
+		m.Attributes[tsAttr] = strconv.FormatInt(int64(et), 10)
+	}
+	if _, ok := m.Attributes[idAttr]; idAttr != "" && !ok {
+		m.Attributes[idAttr] = uuid.NewString()
+	}
+}
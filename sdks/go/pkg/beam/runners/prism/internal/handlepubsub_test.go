@@ -0,0 +1,118 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+)
+
+func TestSetPubSubAttributes(t *testing.T) {
+	pyld := &pipepb.PubSubWritePayload{IdAttribute: "id", TimestampAttribute: "ts"}
+
+	m := &pubsubpb.PubsubMessage{Data: []byte("a")}
+	setPubSubAttributes(pyld, m, 1500)
+	if got, want := m.GetAttributes()["ts"], "1500"; got != want {
+		t.Errorf("timestamp attribute = %q, want %q", got, want)
+	}
+	id := m.GetAttributes()["id"]
+	if id == "" {
+		t.Error("ID attribute unset, want a unique ID")
+	}
+	other := &pubsubpb.PubsubMessage{Data: []byte("a")}
+	setPubSubAttributes(pyld, other, 1500)
+	if got := other.GetAttributes()["id"]; got == id {
+		t.Errorf("ID attributes of distinct messages are both %q, want unique IDs", got)
+	}
+
+	// Messages with IDs retain them.
+	withID := &pubsubpb.PubsubMessage{Attributes: map[string]string{"id": "mine"}}
+	setPubSubAttributes(pyld, withID, 0)
+	if got, want := withID.GetAttributes()["id"], "mine"; got != want {
+		t.Errorf("ID attribute = %q, want %q", got, want)
+	}
+
+	// Writes without the attributes leave messages as is.
+	plain := &pubsubpb.PubsubMessage{Data: []byte("a")}
+	setPubSubAttributes(&pipepb.PubSubWritePayload{}, plain, 1500)
+	if plain.Attributes != nil {
+		t.Errorf("attributes = %v, want none", plain.GetAttributes())
+	}
+}
+
+func TestPubSubRead_advanceWatermark(t *testing.T) {
+	start := time.UnixMilli(10_000)
+	withAttr := &pipepb.PubSubReadPayload{TimestampAttribute: "ts"}
+	tests := []struct {
+		name         string
+		pyld         *pipepb.PubSubReadPayload
+		idleLateness time.Duration
+		watermark    mtime.Time
+		pulled, read int
+		minEventTime mtime.Time
+		want         mtime.Time
+	}{
+		{
+			name: "publishTimeBacklogRead", pyld: &pipepb.PubSubReadPayload{},
+			watermark: 5_000, pulled: 3, read: 3, minEventTime: 4_000,
+			want: 10_000,
+		}, {
+			name: "publishTimeBacklogRemains", pyld: &pipepb.PubSubReadPayload{},
+			watermark: 5_000, pulled: pubsubPullSize, read: pubsubPullSize, minEventTime: 4_000,
+			want: 5_000,
+		}, {
+			name: "publishTimeNeverBackwards", pyld: &pipepb.PubSubReadPayload{},
+			watermark: 20_000, pulled: 0,
+			want: 20_000,
+		}, {
+			name: "attributeAdvances", pyld: withAttr,
+			watermark: 5_000, pulled: 2, read: 2, minEventTime: 7_000,
+			want: 7_000,
+		}, {
+			name: "attributeNeverBackwards", pyld: withAttr,
+			watermark: 5_000, pulled: 2, read: 2, minEventTime: 3_000,
+			want: 5_000,
+		}, {
+			name: "attributeDuplicates", pyld: withAttr,
+			watermark: 5_000, pulled: 2, read: 0, minEventTime: mtime.MaxTimestamp,
+			want: 5_000,
+		}, {
+			name: "attributeIdle", pyld: withAttr, idleLateness: 2 * time.Second,
+			watermark: 5_000, pulled: 0, minEventTime: mtime.MaxTimestamp,
+			want: 8_000,
+		}, {
+			name: "attributeIdleNeverBackwards", pyld: withAttr, idleLateness: 2 * time.Second,
+			watermark: 9_000, pulled: 0, minEventTime: mtime.MaxTimestamp,
+			want: 9_000,
+		}, {
+			name: "attributeIdleUnboundedLateness", pyld: withAttr, idleLateness: -1,
+			watermark: 5_000, pulled: 0, minEventTime: mtime.MaxTimestamp,
+			want: 5_000,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &pubsubRead{pyld: test.pyld, idleLateness: test.idleLateness}
+			if got := r.advanceWatermark(test.watermark, start, test.pulled, test.read, test.minEventTime); got != test.want {
+				t.Errorf("advanceWatermark(%v, %v, %v, %v, %v) = %v, want %v", test.watermark, start, test.pulled, test.read, test.minEventTime, got, test.want)
+			}
+		})
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"sort"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
@@ -126,7 +128,7 @@ func (h *runner) PrepareTransform(tid string, t *pipepb.PTransform, comps *pipep
 var _ transformExecuter = (*runner)(nil)
 
 func (*runner) ExecuteUrns() []string {
-	return []string{urns.TransformFlatten, urns.TransformGBK, urns.TransformReshuffle}
+	return []string{urns.TransformFlatten, urns.TransformGBK, urns.TransformReshuffle, urns.TransformTestStream, urns.TransformPubSubRead, urns.TransformPubSubWrite}
 }
 
 // ExecuteWith returns what environment the transform should execute in.
@@ -138,6 +140,13 @@ func (h *runner) ExecuteWith(t *pipepb.PTransform) string {
 	if urn == urns.TransformGBK && !h.config.SDKGBK {
 		return ""
 	}
+	if urn == urns.TransformTestStream {
+		return ""
+	}
+	// Pub/Sub is emulated in process, though SDKs may set an environment.
+	if urn == urns.TransformPubSubRead || urn == urns.TransformPubSubWrite {
+		return ""
+	}
 	return t.GetEnvironmentId()
 }
 
@@ -184,6 +193,9 @@ func (h *runner) ExecuteTransform(stageID, tid string, t *pipepb.PTransform, com
 		if len(data[0]) == 0 {
 			panic("no data for GBK")
 		}
+	case urns.TransformPubSubWrite:
+		// Sinks have no outputs. Failures to publish fail the job.
+		return &worker.B{BundleErr: publishToPubSub(stageID, tid, t, comps, inputData)}
 	default:
 		panic(fmt.Sprintf("unimplemented runner transform[%v]", urn))
 	}
@@ -214,6 +226,98 @@ func (h *runner) ExecuteTransform(stageID, tid string, t *pipepb.PTransform, com
 	return b
 }
 
+// handleTestStream decodes the TestStream payload, and adds its events to the
+// ElementManager, which executes them in order.
+//
+// Side inputs are served from the DataService, so each event's elements are
+// committed to it as the event executes.
+func handleTestStream(stageID string, t *pipepb.PTransform, comps *pipepb.Components, em *engine.ElementManager, ds *worker.DataService) error {
+	pyld := &pipepb.TestStreamPayload{}
+	if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pyld); err != nil {
+		return fmt.Errorf("unable to decode TestStreamPayload for transform[%v]: %w", t.GetUniqueName(), err)
+	}
+	if pyld.GetEndpoint().GetUrl() != "" {
+		return fmt.Errorf("TestStream transform[%v] uses an event endpoint, which is unsupported", t.GetUniqueName())
+	}
+
+	// Elements are encoded with the output PCollection's coder, in the outer context.
+	// The runner handles elements in the nested context, where bytes and strings
+	// are length prefixed. Coders the runner doesn't understand are length prefixed
+	// too, so the elements must be as well.
+	outputs := t.GetOutputs()
+	lengthPrefix := map[string]bool{}
+	coders := map[string]*pipepb.Coder{}
+	for tag, global := range outputs {
+		cID := comps.GetPcollections()[global].GetCoderId()
+		lpcID, err := lpUnknownCoders(cID, coders, comps.GetCoders())
+		if err != nil {
+			return fmt.Errorf("TestStream transform[%v]: couldn't process coder for output %q: %w", t.GetUniqueName(), tag, err)
+		}
+		if lpcID == cID {
+			switch coders[cID].GetSpec().GetUrn() {
+			case urns.CoderBytes, urns.CoderStringUTF8:
+				lengthPrefix[tag] = true
+			}
+			continue
+		}
+		if c := coders[lpcID]; c.GetSpec().GetUrn() != urns.CoderLengthPrefix || c.GetComponentCoderIds()[0] != cID {
+			return fmt.Errorf("TestStream transform[%v]: output %q has unsupported coder with nested unknown coders: %v", t.GetUniqueName(), tag, prototext.Format(comps.GetCoders()[cID]))
+		}
+		lengthPrefix[tag] = true
+	}
+
+	// Events may omit the tag if there's a single output.
+	tagFor := func(tag string) string {
+		if tag == "" && len(outputs) == 1 {
+			tag, _ = getOnlyPair(outputs)
+		}
+		return tag
+	}
+
+	tsb := em.AddTestStream(stageID, outputs)
+	tsb.OnElementEvent(func(pcollection string, elements []engine.TestStreamElement) {
+		var sideData engine.TentativeData
+		for _, e := range elements {
+			var buf bytes.Buffer
+			exec.EncodeWindowedValueHeader(exec.MakeWindowEncoder(coder.NewGlobalWindow()), window.SingleGlobalWindow, e.EventTime, typex.NoFiringPane(), &buf)
+			buf.Write(e.Encoded)
+			sideData.WriteData(pcollection, buf.Bytes())
+		}
+		ds.Commit(sideData)
+	})
+	for _, event := range pyld.GetEvents() {
+		switch ev := event.GetEvent().(type) {
+		case *pipepb.TestStreamPayload_Event_ElementEvent:
+			tag := tagFor(ev.ElementEvent.GetTag())
+			var elms []engine.TestStreamElement
+			for _, e := range ev.ElementEvent.GetElements() {
+				encoded := e.GetEncodedElement()
+				if lengthPrefix[tag] {
+					var buf bytes.Buffer
+					coder.EncodeVarInt(int64(len(encoded)), &buf)
+					buf.Write(encoded)
+					encoded = buf.Bytes()
+				}
+				elms = append(elms, engine.TestStreamElement{Encoded: encoded, EventTime: mtime.Time(e.GetTimestamp())})
+			}
+			tsb.AddElementEvent(tag, elms)
+		case *pipepb.TestStreamPayload_Event_WatermarkEvent:
+			tsb.AddWatermarkEvent(tagFor(ev.WatermarkEvent.GetTag()), mtime.Time(ev.WatermarkEvent.GetNewWatermark()))
+		case *pipepb.TestStreamPayload_Event_ProcessingTimeEvent:
+			ms := ev.ProcessingTimeEvent.GetAdvanceDuration()
+			d := time.Duration(math.MaxInt64)
+			// Durations that would overflow advance to "infinity".
+			if ms < int64(d/time.Millisecond) {
+				d = time.Duration(ms) * time.Millisecond
+			}
+			tsb.AddProcessingTimeEvent(d)
+		default:
+			return fmt.Errorf("TestStream transform[%v] has unknown event type: %v", t.GetUniqueName(), prototext.Format(event))
+		}
+	}
+	return nil
+}
+
 // windowingStrategy sources the transform's windowing strategy from a single parallel input.
 func windowingStrategy(comps *pipepb.Components, tid string) *pipepb.WindowingStrategy {
 	t := comps.GetTransforms()[tid]
@@ -225,6 +329,127 @@ func windowingStrategy(comps *pipepb.Components, tid string) *pipepb.WindowingSt
 	return comps.GetWindowingStrategies()[pcol.GetWindowingStrategyId()]
 }
 
+// buildTriggerStrat converts the triggering portion of a windowing strategy
+// for the ElementManager.
+func buildTriggerStrat(ws *pipepb.WindowingStrategy) (engine.TriggerStrat, error) {
+	trigger, err := buildTrigger(ws.GetTrigger())
+	if err != nil {
+		return engine.TriggerStrat{}, err
+	}
+	return engine.TriggerStrat{
+		Trigger:         trigger,
+		Accumulating:    ws.GetAccumulationMode() == pipepb.AccumulationMode_ACCUMULATING,
+		AllowedLateness: allowedLateness(ws),
+	}, nil
+}
+
+// allowedLateness returns how long after the end of a window late data is
+// still accepted by the windowing strategy.
+func allowedLateness(ws *pipepb.WindowingStrategy) time.Duration {
+	// Lateness beyond the end of the global window is equivalent to infinite lateness.
+	lateness := time.Duration(math.MaxInt64)
+	if ms := ws.GetAllowedLateness(); ms < int64(lateness/time.Millisecond) {
+		lateness = time.Duration(ms) * time.Millisecond
+	}
+	return lateness
+}
+
+// buildTrigger converts a trigger proto into the ElementManager's trigger
+// state machines.
+func buildTrigger(tpb *pipepb.Trigger) (engine.Trigger, error) {
+	buildSubs := func(subs []*pipepb.Trigger) ([]engine.Trigger, error) {
+		var ret []engine.Trigger
+		for _, sub := range subs {
+			t, err := buildTrigger(sub)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, t)
+		}
+		return ret, nil
+	}
+	switch at := tpb.GetTrigger().(type) {
+	case *pipepb.Trigger_Default_:
+		return &engine.TriggerDefault{}, nil
+	case *pipepb.Trigger_Always_:
+		return &engine.TriggerAlways{}, nil
+	case *pipepb.Trigger_Never_:
+		return &engine.TriggerNever{}, nil
+	case *pipepb.Trigger_ElementCount_:
+		return &engine.TriggerAfterCount{ElementCount: int(at.ElementCount.GetElementCount())}, nil
+	case *pipepb.Trigger_AfterAll_:
+		subs, err := buildSubs(at.AfterAll.GetSubtriggers())
+		if err != nil {
+			return nil, err
+		}
+		return &engine.TriggerAfterAll{SubTriggers: subs}, nil
+	case *pipepb.Trigger_AfterAny_:
+		subs, err := buildSubs(at.AfterAny.GetSubtriggers())
+		if err != nil {
+			return nil, err
+		}
+		return &engine.TriggerAfterAny{SubTriggers: subs}, nil
+	case *pipepb.Trigger_AfterEach_:
+		subs, err := buildSubs(at.AfterEach.GetSubtriggers())
+		if err != nil {
+			return nil, err
+		}
+		return &engine.TriggerAfterEach{SubTriggers: subs}, nil
+	case *pipepb.Trigger_Repeat_:
+		sub, err := buildTrigger(at.Repeat.GetSubtrigger())
+		if err != nil {
+			return nil, err
+		}
+		return &engine.TriggerRepeatedly{Repeated: sub}, nil
+	case *pipepb.Trigger_OrFinally_:
+		main, err := buildTrigger(at.OrFinally.GetMain())
+		if err != nil {
+			return nil, err
+		}
+		finally, err := buildTrigger(at.OrFinally.GetFinally())
+		if err != nil {
+			return nil, err
+		}
+		return &engine.TriggerOrFinally{Main: main, Finally: finally}, nil
+	case *pipepb.Trigger_AfterEndOfWindow_:
+		t := &engine.TriggerAfterEndOfWindow{}
+		var err error
+		if early := at.AfterEndOfWindow.GetEarlyFirings(); early != nil {
+			if t.Early, err = buildTrigger(early); err != nil {
+				return nil, err
+			}
+		}
+		if late := at.AfterEndOfWindow.GetLateFirings(); late != nil {
+			if t.Late, err = buildTrigger(late); err != nil {
+				return nil, err
+			}
+		}
+		return t, nil
+	case *pipepb.Trigger_AfterProcessingTime_:
+		t := &engine.TriggerAfterProcessingTime{}
+		for _, transform := range at.AfterProcessingTime.GetTimestampTransforms() {
+			switch tt := transform.GetTimestampTransform().(type) {
+			case *pipepb.TimestampTransform_Delay_:
+				t.Transforms = append(t.Transforms, engine.TimestampTransform{
+					Delay: time.Duration(tt.Delay.GetDelayMillis()) * time.Millisecond,
+				})
+			case *pipepb.TimestampTransform_AlignTo_:
+				t.Transforms = append(t.Transforms, engine.TimestampTransform{
+					AlignToPeriod: time.Duration(tt.AlignTo.GetPeriod()) * time.Millisecond,
+					AlignToOffset: time.Duration(tt.AlignTo.GetOffset()) * time.Millisecond,
+				})
+			default:
+				return nil, fmt.Errorf("unknown timestamp transform: %v", prototext.Format(transform))
+			}
+		}
+		return t, nil
+	case *pipepb.Trigger_AfterSynchronizedProcessingTime_:
+		return &engine.TriggerAfterSynchronizedProcessingTime{}, nil
+	default:
+		return nil, fmt.Errorf("unknown trigger type: %v", prototext.Format(tpb))
+	}
+}
+
 // gbkBytes re-encodes gbk inputs in a gbk result.
 func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregate [][]byte, coders map[string]*pipepb.Coder, watermark mtime.Time) []byte {
 	var outputTime func(typex.Window, mtime.Time) mtime.Time
@@ -243,12 +468,19 @@ func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregat
 		key    []byte
 		w      typex.Window
 		time   mtime.Time
+		pane   typex.PaneInfo
 		values [][]byte
 	}
+	// Elements are grouped by their key and pane, since triggered aggregations
+	// may provide multiple panes for a key and window in a single bundle.
+	type keyPane struct {
+		key  string
+		pane typex.PaneInfo
+	}
 	// Map windows to a map of keys to a map of keys to time.
 	// We ultimately emit the window, the key, the time, and the iterable of elements,
 	// all contained in the final value.
-	windows := map[typex.Window]map[string]keyTime{}
+	windows := map[typex.Window]map[keyPane]keyTime{}
 
 	kd := pullDecoder(kc, coders)
 	vd := pullDecoder(vc, coders)
@@ -260,7 +492,7 @@ func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregat
 		// Parse out each element's data, and repeat.
 		buf := bytes.NewBuffer(data)
 		for {
-			ws, tm, _, err := exec.DecodeWindowedValueHeader(wDec, buf)
+			ws, tm, pn, err := exec.DecodeWindowedValueHeader(wDec, buf)
 			if err == io.EOF {
 				break
 			}
@@ -269,19 +501,20 @@ func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregat
 			}
 
 			keyByt := kd(buf)
-			key := string(keyByt)
+			key := keyPane{key: string(keyByt), pane: pn}
 			value := vd(buf)
 			for _, w := range ws {
 				ft := outputTime(w, tm)
 				wk, ok := windows[w]
 				if !ok {
-					wk = make(map[string]keyTime)
+					wk = make(map[keyPane]keyTime)
 					windows[w] = wk
 				}
 				kt := wk[key]
 				kt.time = ft
 				kt.key = keyByt
 				kt.w = w
+				kt.pane = pn
 				kt.values = append(kt.values, value)
 				wk[key] = kt
 			}
@@ -328,6 +561,7 @@ func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregat
 				skt := sessionData[k]
 				skt.key = kt.key
 				skt.w = cur
+				skt.pane = kt.pane
 				skt.values = append(skt.values, kt.values...)
 				sessionData[k] = skt
 			}
@@ -343,7 +577,7 @@ func gbkBytes(ws *pipepb.WindowingStrategy, wc, kc, vc *pipepb.Coder, toAggregat
 				wEnc,
 				[]typex.Window{kt.w},
 				kt.time,
-				typex.NoFiringPane(),
+				kt.pane,
 				&buf,
 			)
 			buf.Write(kt.key)
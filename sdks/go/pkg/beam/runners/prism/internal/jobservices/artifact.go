@@ -99,6 +99,10 @@ func (s *Server) ResolveArtifacts(_ context.Context, req *jobpb.ResolveArtifacts
 func (s *Server) GetArtifact(req *jobpb.GetArtifactRequest, stream jobpb.ArtifactRetrievalService_GetArtifactServer) error {
 	info := req.GetArtifact()
 	buf, ok := s.artifacts[string(info.GetTypePayload())]
+	if !ok && s.store != nil {
+		// Artifacts of jobs from before a restart are only in the store.
+		buf, ok = s.store.artifact(string(info.GetTypePayload()))
+	}
 	if !ok {
 		pt := prototext.Format(info)
 		slog.Warn("unable to provide artifact to worker", "artifact_info", pt)
@@ -26,23 +26,37 @@ package jobservices
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
 	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
 	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
 	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// ErrCancel is the cause of a job's root context being canceled, when the job
+// is canceled by request.
+var ErrCancel = errors.New("pipeline canceled")
+
 var supportedRequirements = map[string]struct{}{
-	urns.RequirementSplittableDoFn: {},
+	urns.RequirementSplittableDoFn:     {},
+	urns.RequirementStatefulProcessing: {},
+	urns.RequirementBundleFinalization: {},
+	urns.RequirementStableInput:        {},
+	urns.RequirementTimeSortedInput:    {},
+	urns.RequirementOnWindowExpiration: {},
 }
 
 // TODO, move back to main package, and key off of executor handlers?
@@ -76,18 +90,41 @@ type Job struct {
 	// Management side concerns.
 	streamCond *sync.Cond
 	// TODO, consider unifying messages and state to a single ordered buffer.
-	minMsg, maxMsg int // logical indices into the message slice
-	msgs           []string
-	stateIdx       int
-	state          atomic.Value // jobpb.JobState_Enum
-	stateTime      time.Time
-	failureErr     error
+	maxMsg     int          // logical index of the next message
+	msgs       []JobMessage // buffered messages, oldest first
+	msgIDs     []int        // logical indices of the buffered messages, ascending
+	numLogs    int          // number of buffered messages logged by SDK workers
+	stateIdx   int
+	state      atomic.Value // jobpb.JobState_Enum
+	stateTime  time.Time
+	failureErr error
 
 	// Context used to terminate this job.
 	RootCtx  context.Context
 	CancelFn context.CancelCauseFunc
 
+	// drainCh is closed when the job is requested to drain.
+	drainCh   chan struct{}
+	drainOnce sync.Once
+
 	metrics metricsStore
+	// restoredMetrics are the final metrics of a job restored from a JobStore.
+	restoredMetrics *jobpb.MetricResults
+
+	// Execution details set by the executor, used to annotate the pipeline.
+	execMu          sync.Mutex
+	transformStages map[string][]string          // Stage IDs executing each transform, keyed by transform ID.
+	watermarks      func() map[string]mtime.Time // Current watermarks, keyed by PCollection ID.
+	stageStats      func() []engine.StageStats   // Current execution statistics of the job's stages.
+	elementSamples  func() map[string][]ElementSample
+}
+
+// ElementSample is a recent element of a PCollection, in readable form.
+type ElementSample struct {
+	Element   string `json:"element"`
+	Window    string `json:"window"`
+	Timestamp string `json:"timestamp"`
+	Pane      string `json:"pane"`
 }
 
 func (j *Job) ArtifactEndpoint() string {
@@ -113,6 +150,109 @@ func (j *Job) AddMetricShortIDs(ids *fnpb.MonitoringInfosMetadataResponse) {
 	j.metrics.AddShortIDs(ids)
 }
 
+// SetExecutionGraph records the stages that execute each of the pipeline's transforms,
+// keyed by transform ID, and a function returning the current watermarks of the
+// pipeline's PCollections, keyed by PCollection ID.
+//
+// They annotate the pipeline returned for the job, so the execution may be inspected.
+func (j *Job) SetExecutionGraph(transformStages map[string][]string, watermarks func() map[string]mtime.Time) {
+	j.execMu.Lock()
+	defer j.execMu.Unlock()
+	j.transformStages = transformStages
+	j.watermarks = watermarks
+}
+
+// SetStageStats records a function returning the current execution statistics
+// of the job's stages, for monitoring.
+func (j *Job) SetStageStats(stats func() []engine.StageStats) {
+	j.execMu.Lock()
+	defer j.execMu.Unlock()
+	j.stageStats = stats
+}
+
+// StageStats returns the current execution statistics of the job's stages,
+// or nil if the job isn't executing in this process.
+func (j *Job) StageStats() []engine.StageStats {
+	j.execMu.Lock()
+	stats := j.stageStats
+	j.execMu.Unlock()
+	if stats == nil {
+		return nil
+	}
+	return stats()
+}
+
+// SetElementSamples records a function returning the recent elements of the job's
+// PCollections, keyed by PCollection ID, for inspection.
+func (j *Job) SetElementSamples(samples func() map[string][]ElementSample) {
+	j.execMu.Lock()
+	defer j.execMu.Unlock()
+	j.elementSamples = samples
+}
+
+// ElementSamples returns the recent elements of the job's PCollections, keyed by
+// PCollection ID, or nil if the job isn't executing in this process.
+func (j *Job) ElementSamples() map[string][]ElementSample {
+	j.execMu.Lock()
+	samples := j.elementSamples
+	j.execMu.Unlock()
+	if samples == nil {
+		return nil
+	}
+	return samples()
+}
+
+// annotatedPipeline returns a copy of the job's pipeline, with transforms annotated
+// with the stages executing them, and the current watermarks of their outputs.
+// See urns.AnnotationStages and urns.AnnotationOutputWatermarkPrefix.
+func (j *Job) annotatedPipeline() *pipepb.Pipeline {
+	j.execMu.Lock()
+	transformStages, watermarks := j.transformStages, j.watermarks
+	j.execMu.Unlock()
+	if transformStages == nil && watermarks == nil {
+		return j.Pipeline
+	}
+	p := proto.Clone(j.Pipeline).(*pipepb.Pipeline)
+	annotate := func(t *pipepb.PTransform, key string, value string) {
+		if t.Annotations == nil {
+			t.Annotations = map[string][]byte{}
+		}
+		t.Annotations[key] = []byte(value)
+	}
+	ts := p.GetComponents().GetTransforms()
+	for tid, stageIDs := range transformStages {
+		if t, ok := ts[tid]; ok {
+			annotate(t, urns.AnnotationStages, strings.Join(stageIDs, ","))
+		}
+	}
+	if watermarks != nil {
+		wms := watermarks()
+		for _, t := range ts {
+			// Only leaf transforms produce PCollections.
+			if len(t.GetSubtransforms()) > 0 {
+				continue
+			}
+			for local, global := range t.GetOutputs() {
+				if wm, ok := wms[global]; ok {
+					annotate(t, urns.AnnotationOutputWatermarkPrefix+local, strconv.FormatInt(int64(wm), 10))
+				}
+			}
+		}
+	}
+	return p
+}
+
+// metricResults returns the job's current metrics.
+func (j *Job) metricResults() *jobpb.MetricResults {
+	if j.restoredMetrics != nil {
+		return j.restoredMetrics
+	}
+	return &jobpb.MetricResults{
+		Attempted: j.metrics.Results(tentative),
+		Committed: j.metrics.Results(committed),
+	}
+}
+
 func (j *Job) String() string {
 	return fmt.Sprintf("%v[%v]", j.key, j.jobName)
 }
@@ -127,38 +267,112 @@ func (j *Job) JobKey() string {
 	return j.key
 }
 
+// SendMsg adds a runner message of basic importance to the job's message stream.
 func (j *Job) SendMsg(msg string) {
+	j.SendMessage(JobMessage{Importance: jobpb.JobMessage_JOB_MESSAGE_BASIC, Text: msg})
+}
+
+// SendMessage adds a structured message to the job's message stream.
+// Messages without a time are sent at the current time.
+//
+// Runner messages and SDK logs, the messages with a Worker, are buffered
+// separately, so chatty SDK workers don't evict the runner's messages.
+func (j *Job) SendMessage(msg JobMessage) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
 	j.streamCond.L.Lock()
 	defer j.streamCond.L.Unlock()
-	j.maxMsg++
-	// Trim so we never have more than 120 messages, keeping the last 100 for sure
-	// but amortize it so that messages are only trimmed every 20 messages beyond
-	// that.
+	// Trim so we never have more than 120 messages of each kind, keeping the
+	// last 100 for sure but amortize it so that messages are only trimmed every
+	// 20 messages beyond that.
 	// TODO, make this configurable
 	const buffered, trigger = 100, 20
-	if len(j.msgs) > buffered+trigger {
-		copy(j.msgs[0:], j.msgs[trigger:])
-		for k, n := len(j.msgs)-trigger, len(j.msgs); k < n; k++ {
-			j.msgs[k] = ""
-		}
-		j.msgs = j.msgs[:len(j.msgs)-trigger]
-		j.minMsg += trigger // increase the "min" message higher as a result.
+	isLog := msg.Worker != ""
+	n := len(j.msgs) - j.numLogs
+	if isLog {
+		n = j.numLogs
+	}
+	if n > buffered+trigger {
+		j.trimMessages(isLog, trigger)
 	}
 	j.msgs = append(j.msgs, msg)
+	j.msgIDs = append(j.msgIDs, j.maxMsg)
+	j.maxMsg++
+	if isLog {
+		j.numLogs++
+	}
 	j.streamCond.Broadcast()
 }
 
+// trimMessages removes the oldest n buffered SDK logs, or runner messages.
+//
+// Assumes the streamCond lock is held.
+func (j *Job) trimMessages(logs bool, n int) {
+	k := 0
+	for i, m := range j.msgs {
+		if n > 0 && (m.Worker != "") == logs {
+			n--
+			continue
+		}
+		j.msgs[k], j.msgIDs[k] = m, j.msgIDs[i]
+		k++
+	}
+	for i := k; i < len(j.msgs); i++ {
+		j.msgs[i] = JobMessage{}
+	}
+	if logs {
+		j.numLogs -= len(j.msgs) - k
+	}
+	j.msgs, j.msgIDs = j.msgs[:k], j.msgIDs[:k]
+}
+
 func (j *Job) sendState(state jobpb.JobState_Enum) {
 	j.streamCond.L.Lock()
 	defer j.streamCond.L.Unlock()
 	old := j.state.Load()
-	// Never overwrite a failed state with another one.
-	if old != jobpb.JobState_FAILED {
-		j.state.Store(state)
-		j.stateTime = time.Now()
-		j.stateIdx++
+	// Never overwrite a failed or canceled state with another one.
+	if old != jobpb.JobState_FAILED && old != jobpb.JobState_CANCELLED {
+		j.setStateLocked(state)
+	}
+	j.streamCond.Broadcast()
+}
+
+// wakeOnDone wakes the job's streams when the context is done, so a stream
+// waiting for changes notices that its client has gone. The returned function
+// stops watching the context.
+func (j *Job) wakeOnDone(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			j.streamCond.L.Lock()
+			j.streamCond.Broadcast()
+			j.streamCond.L.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// compareAndSendState changes the job's state to new, only if it's currently old,
+// and reports whether it did.
+func (j *Job) compareAndSendState(old, new jobpb.JobState_Enum) bool {
+	j.streamCond.L.Lock()
+	defer j.streamCond.L.Unlock()
+	if j.state.Load() != old {
+		return false
 	}
+	j.setStateLocked(new)
 	j.streamCond.Broadcast()
+	return true
+}
+
+// setStateLocked changes the job's state. Must be called while holding streamCond.L.
+func (j *Job) setStateLocked(state jobpb.JobState_Enum) {
+	j.state.Store(state)
+	j.stateTime = time.Now()
+	j.stateIdx++
 }
 
 // Start indicates that the job is preparing to execute.
@@ -166,9 +380,59 @@ func (j *Job) Start() {
 	j.sendState(jobpb.JobState_STARTING)
 }
 
-// Running indicates that the job is executing.
+// Running indicates that the job is executing. The job only becomes RUNNING
+// from STARTING, so a cancel requested while the job starts isn't lost.
 func (j *Job) Running() {
-	j.sendState(jobpb.JobState_RUNNING)
+	j.compareAndSendState(jobpb.JobState_STARTING, jobpb.JobState_RUNNING)
+}
+
+// Canceling indicates that the job has been requested to cancel.
+func (j *Job) Canceling() {
+	j.sendState(jobpb.JobState_CANCELLING)
+}
+
+// Canceled indicates that the job has stopped executing, after a cancel request.
+func (j *Job) Canceled() {
+	j.sendState(jobpb.JobState_CANCELLED)
+}
+
+// Draining changes a running job's state to DRAINING, and closes the channel
+// returned by DrainRequested. It reports whether the job was running, since
+// the state is only changed if a concurrent cancel or completion hasn't.
+func (j *Job) Draining() bool {
+	if !j.compareAndSendState(jobpb.JobState_RUNNING, jobpb.JobState_DRAINING) {
+		return false
+	}
+	j.drainOnce.Do(func() {
+		close(j.drainCh)
+	})
+	return true
+}
+
+// Drain requests that the running job drain, and returns its resulting state.
+// Jobs that aren't running can't be drained.
+func (j *Job) Drain() (jobpb.JobState_Enum, error) {
+	if !j.Draining() {
+		state := j.state.Load().(jobpb.JobState_Enum)
+		if state == jobpb.JobState_DRAINING {
+			return state, nil
+		}
+		return state, fmt.Errorf("job %v can't be drained from state %v", j, state)
+	}
+	j.SendMsg("draining " + j.String())
+	return jobpb.JobState_DRAINING, nil
+}
+
+// DrainRequested returns a channel that is closed when the job is requested to
+// drain. The executor should then stop reading new input, and finish the
+// work in progress.
+func (j *Job) DrainRequested() <-chan struct{} {
+	return j.drainCh
+}
+
+// Drained indicates that the job completed successfully, after a drain request.
+func (j *Job) Drained() {
+	j.sendState(jobpb.JobState_DRAINED)
 }
 
 // Done indicates that the job completed successfully.
@@ -18,6 +18,7 @@ package jobservices
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -79,6 +80,7 @@ func (s *Server) Prepare(ctx context.Context, req *jobpb.PrepareJobRequest) (*jo
 		streamCond: sync.NewCond(&sync.Mutex{}),
 		RootCtx:    rootCtx,
 		CancelFn:   cancelFn,
+		drainCh:    make(chan struct{}),
 
 		artifactEndpoint: s.Endpoint(),
 	}
@@ -120,7 +122,10 @@ func (s *Server) Prepare(ctx context.Context, req *jobpb.PrepareJobRequest) (*jo
 			urns.TransformCombinePerKey,
 			urns.TransformCombineGlobally,      // Used by Java SDK
 			urns.TransformCombineGroupedValues, // Used by Java SDK
-			urns.TransformAssignWindows:
+			urns.TransformAssignWindows,
+			urns.TransformTestStream,
+			urns.TransformPubSubRead, // Emulated in process.
+			urns.TransformPubSubWrite:
 		// Very few expected transforms types for submitted pipelines.
 		// Most URNs are for the runner to communicate back to the SDK for execution.
 		case urns.TransformReshuffle:
@@ -153,18 +158,27 @@ func (s *Server) Prepare(ctx context.Context, req *jobpb.PrepareJobRequest) (*jo
 
 	// Inspect Windowing strategies for unsupported features.
 	for wsID, ws := range job.Pipeline.GetComponents().GetWindowingStrategies() {
-		check("WindowingStrategy.AllowedLateness", ws.GetAllowedLateness(), int64(0))
 		check("WindowingStrategy.ClosingBehaviour", ws.GetClosingBehavior(), pipepb.ClosingBehavior_EMIT_IF_NONEMPTY)
-		check("WindowingStrategy.AccumulationMode", ws.GetAccumulationMode(), pipepb.AccumulationMode_DISCARDING)
+		check("WindowingStrategy.AccumulationMode", ws.GetAccumulationMode(), pipepb.AccumulationMode_DISCARDING, pipepb.AccumulationMode_ACCUMULATING)
 		if ws.GetWindowFn().GetUrn() != urns.WindowFnSession {
 			check("WindowingStrategy.MergeStatus", ws.GetMergeStatus(), pipepb.MergeStatus_NON_MERGING)
 		}
+		// Custom WindowFns are supported, so long as they produce global or interval windows.
+		// Prism needs the end of each window to aggregate and hold watermarks, and can't
+		// decode windows with the custom_window coder, so they're rejected.
+		wc := job.Pipeline.GetComponents().GetCoders()[ws.GetWindowCoderId()]
+		check("WindowingStrategy.WindowCoder", wc.GetSpec().GetUrn(), urns.CoderGlobalWindow, urns.CoderIntervalWindow)
 		if !bypassedWindowingStrategies[wsID] {
 			check("WindowingStrategy.OnTimeBehavior", ws.GetOnTimeBehavior(), pipepb.OnTimeBehavior_FIRE_IF_NONEMPTY, pipepb.OnTimeBehavior_FIRE_ALWAYS)
 			check("WindowingStrategy.OutputTime", ws.GetOutputTime(), pipepb.OutputTime_END_OF_WINDOW)
-			// Non nil triggers should fail.
-			if ws.GetTrigger().GetDefault() == nil {
-				check("WindowingStrategy.Trigger", ws.GetTrigger(), &pipepb.Trigger_Default{})
+			// Session windows are merged during aggregation, so only the default triggering is supported.
+			if ws.GetWindowFn().GetUrn() == urns.WindowFnSession {
+				check("WindowingStrategy.AllowedLateness", ws.GetAllowedLateness(), int64(0))
+				check("WindowingStrategy.AccumulationMode", ws.GetAccumulationMode(), pipepb.AccumulationMode_DISCARDING)
+				// Non default triggers should fail.
+				if ws.GetTrigger().GetDefault() == nil {
+					check("WindowingStrategy.Trigger", ws.GetTrigger(), &pipepb.Trigger_Default{})
+				}
 			}
 		}
 	}
@@ -186,11 +200,20 @@ func (s *Server) Prepare(ctx context.Context, req *jobpb.PrepareJobRequest) (*jo
 
 func (s *Server) Run(ctx context.Context, req *jobpb.RunJobRequest) (*jobpb.RunJobResponse, error) {
 	s.mu.Lock()
-	job := s.jobs[req.GetPreparationId()]
+	job, ok := s.jobs[req.GetPreparationId()]
 	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("job with preparation id %v not found", req.GetPreparationId())
+	}
+	if state := job.state.Load().(jobpb.JobState_Enum); state != jobpb.JobState_STOPPED {
+		return nil, fmt.Errorf("job %v can't be run from state %v", job, state)
+	}
 
 	// Bring up a background goroutine to allow the job to continue processing.
-	go s.execute(job)
+	go func() {
+		s.execute(job)
+		s.storeJob(job)
+	}()
 
 	return &jobpb.RunJobResponse{
 		JobId: job.key,
@@ -199,6 +222,9 @@ func (s *Server) Run(ctx context.Context, req *jobpb.RunJobRequest) (*jobpb.RunJ
 
 // GetMessageStream subscribes to a stream of state changes and messages from the job. If throughput
 // is high, this may cause losses of messages.
+//
+// Messages may be filtered with request metadata, by minimum importance ("prism-message-importance"),
+// by transform ("prism-message-transform"), and by text ("prism-message-text"). See MessageFilter.
 func (s *Server) GetMessageStream(req *jobpb.JobMessagesRequest, stream jobpb.JobService_GetMessageStreamServer) error {
 	s.mu.Lock()
 	job, ok := s.jobs[req.GetJobId()]
@@ -206,15 +232,20 @@ func (s *Server) GetMessageStream(req *jobpb.JobMessagesRequest, stream jobpb.Jo
 	if !ok {
 		return fmt.Errorf("job with id %v not found", req.GetJobId())
 	}
+	filter, err := messageFilterFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
 
 	job.streamCond.L.Lock()
 	defer job.streamCond.L.Unlock()
-	curMsg := job.minMsg
+	defer job.wakeOnDone(stream.Context())()
+	curMsg := 0 // logical index of the next message to send
 	curState := job.stateIdx
 
 	state := job.state.Load().(jobpb.JobState_Enum)
 	for {
-		for (curMsg >= job.maxMsg || len(job.msgs) == 0) && curState > job.stateIdx {
+		for curMsg >= job.maxMsg && curState > job.stateIdx {
 			switch state {
 			case jobpb.JobState_CANCELLED, jobpb.JobState_DONE, jobpb.JobState_DRAINED, jobpb.JobState_UPDATED:
 				// Reached terminal state.
@@ -231,30 +262,28 @@ func (s *Server) GetMessageStream(req *jobpb.JobMessagesRequest, stream jobpb.Jo
 				})
 				return nil
 			}
-			job.streamCond.Wait()
 			select { // Quit out if the external connection is done.
 			case <-stream.Context().Done():
 				return context.Cause(stream.Context())
 			default:
 			}
+			job.streamCond.Wait()
 		}
 
-		if curMsg < job.minMsg {
-			// TODO report missed messages for this stream.
-			curMsg = job.minMsg
-		}
-		for curMsg < job.maxMsg && len(job.msgs) > 0 {
-			msg := job.msgs[curMsg-job.minMsg]
-			stream.Send(&jobpb.JobMessagesResponse{
-				Response: &jobpb.JobMessagesResponse_MessageResponse{
-					MessageResponse: &jobpb.JobMessage{
-						MessageText: msg,
-						Importance:  jobpb.JobMessage_JOB_MESSAGE_BASIC,
+		// Messages trimmed from the buffer since the last send are skipped.
+		// TODO report missed messages for this stream.
+		// Rebuilt each time, since the stages executing transforms are known after the job starts.
+		match := job.messageMatcher(filter)
+		for i := sort.SearchInts(job.msgIDs, curMsg); i < len(job.msgs); i++ {
+			if msg := job.msgs[i]; match(msg) {
+				stream.Send(&jobpb.JobMessagesResponse{
+					Response: &jobpb.JobMessagesResponse_MessageResponse{
+						MessageResponse: msg.toProto(job.msgIDs[i]),
 					},
-				},
-			})
-			curMsg++
+				})
+			}
 		}
+		curMsg = job.maxMsg
 		if curState <= job.stateIdx {
 			state = job.state.Load().(jobpb.JobState_Enum)
 			curState = job.stateIdx + 1
@@ -271,6 +300,101 @@ func (s *Server) GetMessageStream(req *jobpb.JobMessagesRequest, stream jobpb.Jo
 	}
 }
 
+// isTerminal returns whether the job state is one a job can't leave.
+func isTerminal(state jobpb.JobState_Enum) bool {
+	switch state {
+	case jobpb.JobState_CANCELLED, jobpb.JobState_DONE, jobpb.JobState_DRAINED, jobpb.JobState_UPDATED, jobpb.JobState_FAILED:
+		return true
+	}
+	return false
+}
+
+// Cancel requests that the job stop executing. Bundle scheduling stops, and the
+// job's workers and environments are torn down, after which the job is CANCELLED.
+// Jobs in a terminal state are unaffected, and their state is returned.
+func (s *Server) Cancel(_ context.Context, req *jobpb.CancelJobRequest) (*jobpb.CancelJobResponse, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[req.GetJobId()]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("job with id %v not found", req.GetJobId())
+	}
+
+	state := job.state.Load().(jobpb.JobState_Enum)
+	switch {
+	case isTerminal(state):
+		return &jobpb.CancelJobResponse{State: state}, nil
+	case state == jobpb.JobState_STOPPED:
+		// The job was never run, so there's nothing to wait on.
+		job.Canceled()
+		job.CancelFn(ErrCancel)
+		s.storeJob(job)
+		return &jobpb.CancelJobResponse{State: jobpb.JobState_CANCELLED}, nil
+	}
+	job.SendMsg("canceling " + job.String())
+	job.Canceling()
+	job.CancelFn(ErrCancel)
+	return &jobpb.CancelJobResponse{State: jobpb.JobState_CANCELLING}, nil
+}
+
+// Drain requests that the running job with the given id stop consuming new
+// input, and finish the work in progress, after which the job is DRAINED.
+// Unbounded splittable DoFns have their restrictions truncated, and all
+// windows are flushed, as watermarks advance to the end of time.
+//
+// The Job Management API has no drain request, so this is available to
+// callers within the runner, such as the web UI.
+func (s *Server) Drain(_ context.Context, jobID string) (jobpb.JobState_Enum, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[jobID]
+	s.mu.Unlock()
+	if !ok {
+		return jobpb.JobState_UNSPECIFIED, fmt.Errorf("job with id %v not found", jobID)
+	}
+	return job.Drain()
+}
+
+// GetStateStream subscribes to a stream of state changes for the job, starting
+// with the current state. The stream ends once the job reaches a terminal state.
+func (s *Server) GetStateStream(req *jobpb.GetJobStateRequest, stream jobpb.JobService_GetStateStreamServer) error {
+	s.mu.Lock()
+	job, ok := s.jobs[req.GetJobId()]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("job with id %v not found", req.GetJobId())
+	}
+
+	job.streamCond.L.Lock()
+	defer job.streamCond.L.Unlock()
+	defer job.wakeOnDone(stream.Context())()
+	curState := job.stateIdx
+	for {
+		for curState > job.stateIdx {
+			select { // Quit out if the external connection is done.
+			case <-stream.Context().Done():
+				return context.Cause(stream.Context())
+			default:
+			}
+			job.streamCond.Wait()
+		}
+		state := job.state.Load().(jobpb.JobState_Enum)
+		curState = job.stateIdx + 1
+		event := &jobpb.JobStateEvent{
+			State:     state,
+			Timestamp: timestamppb.New(job.stateTime),
+		}
+		job.streamCond.L.Unlock()
+		err := stream.Send(event)
+		job.streamCond.L.Lock()
+		if err != nil {
+			return err
+		}
+		if isTerminal(state) {
+			return nil
+		}
+	}
+}
+
 // GetJobMetrics Fetch metrics for a given job.
 func (s *Server) GetJobMetrics(ctx context.Context, req *jobpb.GetJobMetricsRequest) (*jobpb.GetJobMetricsResponse, error) {
 	j := s.getJob(req.GetJobId())
@@ -278,14 +402,12 @@ func (s *Server) GetJobMetrics(ctx context.Context, req *jobpb.GetJobMetricsRequ
 		return nil, fmt.Errorf("GetJobMetrics: unknown jobID: %v", req.GetJobId())
 	}
 	return &jobpb.GetJobMetricsResponse{
-		Metrics: &jobpb.MetricResults{
-			Attempted: j.metrics.Results(tentative),
-			Committed: j.metrics.Results(committed),
-		},
+		Metrics: j.metricResults(),
 	}, nil
 }
 
-// GetJobs returns the set of active jobs and associated metadata.
+// GetJobs returns the set of active and completed jobs and associated metadata.
+// With a JobStore, completed jobs include those from before prism restarted.
 func (s *Server) GetJobs(context.Context, *jobpb.GetJobsRequest) (*jobpb.GetJobsResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -303,6 +425,7 @@ func (s *Server) GetJobs(context.Context, *jobpb.GetJobsRequest) (*jobpb.GetJobs
 }
 
 // GetPipeline returns pipeline proto of the requested job id.
+// Transforms are annotated with how they're executed, once the job is running.
 func (s *Server) GetPipeline(_ context.Context, req *jobpb.GetJobPipelineRequest) (*jobpb.GetJobPipelineResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -312,7 +435,7 @@ func (s *Server) GetPipeline(_ context.Context, req *jobpb.GetJobPipelineRequest
 		return nil, fmt.Errorf("job with id %v not found", req.GetJobId())
 	}
 	return &jobpb.GetJobPipelineResponse{
-		Pipeline: j.Pipeline,
+		Pipeline: j.annotatedPipeline(),
 	}, nil
 }
 
@@ -330,3 +453,10 @@ func (s *Server) GetState(_ context.Context, req *jobpb.GetJobStateRequest) (*jo
 		Timestamp: timestamppb.New(j.stateTime),
 	}, nil
 }
+
+// DescribePipelineOptions returns the pipeline options understood by the runner.
+func (s *Server) DescribePipelineOptions(context.Context, *jobpb.DescribePipelineOptionsRequest) (*jobpb.DescribePipelineOptionsResponse, error) {
+	return &jobpb.DescribePipelineOptionsResponse{
+		Options: s.optionDescriptors,
+	}, nil
+}
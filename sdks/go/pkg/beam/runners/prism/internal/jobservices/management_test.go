@@ -21,9 +21,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/runtime/metricsx"
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
 	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
@@ -225,6 +228,53 @@ func TestServer(t *testing.T) {
 	}
 }
 
+func TestPrepare_WindowCoders(t *testing.T) {
+	tests := []struct {
+		coderURN string
+		wantErr  bool
+	}{
+		{urns.CoderGlobalWindow, false},
+		{urns.CoderIntervalWindow, false},
+		// Prism can't decode custom windows, so custom window types are rejected.
+		{urns.CoderCustomWindow, true},
+	}
+	for _, test := range tests {
+		t.Run(test.coderURN, func(t *testing.T) {
+			undertest := NewServer(0, func(j *Job) {})
+			pipeline := &pipepb.Pipeline{
+				Components: &pipepb.Components{
+					WindowingStrategies: map[string]*pipepb.WindowingStrategy{
+						"ws": {
+							WindowFn:         &pipepb.FunctionSpec{Urn: "beam:go:windowfn:custom:v1"},
+							WindowCoderId:    "wc",
+							MergeStatus:      pipepb.MergeStatus_NON_MERGING,
+							ClosingBehavior:  pipepb.ClosingBehavior_EMIT_IF_NONEMPTY,
+							AccumulationMode: pipepb.AccumulationMode_DISCARDING,
+							OnTimeBehavior:   pipepb.OnTimeBehavior_FIRE_IF_NONEMPTY,
+							OutputTime:       pipepb.OutputTime_END_OF_WINDOW,
+							Trigger:          &pipepb.Trigger{Trigger: &pipepb.Trigger_Default_{Default: &pipepb.Trigger_Default{}}},
+						},
+					},
+					Coders: map[string]*pipepb.Coder{
+						"wc": {Spec: &pipepb.FunctionSpec{Urn: test.coderURN}},
+					},
+				},
+			}
+			_, err := undertest.Prepare(context.Background(), &jobpb.PrepareJobRequest{
+				Pipeline: pipeline,
+				JobName:  "windowCoders",
+			})
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "WindowingStrategy.WindowCoder") {
+					t.Errorf("Prepare() = %v, want unsupported WindowingStrategy.WindowCoder error", err)
+				}
+			} else if err != nil {
+				t.Errorf("Prepare() = %v, want nil", err)
+			}
+		})
+	}
+}
+
 func TestGetMessageStream(t *testing.T) {
 	wantName := "testJob"
 	wantPipeline := &pipepb.Pipeline{
@@ -428,6 +478,340 @@ func TestGetMessageStream_BufferCycling(t *testing.T) {
 
 }
 
+// recvStates returns the states sent on the state stream, until it ends.
+func recvStates(t *testing.T, stateStream jobpb.JobService_GetStateStreamClient) []jobpb.JobState_Enum {
+	t.Helper()
+	var states []jobpb.JobState_Enum
+	for {
+		resp, err := stateStream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("GetStateStream().Recv() = %v, want nil", err)
+			}
+			return states
+		}
+		states = append(states, resp.GetState())
+	}
+}
+
+// nextState returns the next state sent on the state stream.
+func nextState(t *testing.T, stateStream jobpb.JobService_GetStateStreamClient) jobpb.JobState_Enum {
+	t.Helper()
+	resp, err := stateStream.Recv()
+	if err != nil {
+		t.Fatalf("GetStateStream().Recv() = %v, want nil", err)
+	}
+	if resp.GetTimestamp() == nil {
+		t.Errorf("GetStateStream().Recv() = %v, want a timestamp", resp)
+	}
+	return resp.GetState()
+}
+
+func TestGetStateStream(t *testing.T) {
+	wantName := "testJob"
+	wantPipeline := &pipepb.Pipeline{
+		Requirements: []string{urns.RequirementSplittableDoFn},
+	}
+	// Each state change waits for the previous one to be received, so none are coalesced.
+	step := make(chan struct{})
+	ctx, _, clientConn := serveTestServer(t, func(j *Job) {
+		j.Start()
+		<-step
+		j.Running()
+		<-step
+		j.Done()
+	})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+
+	stateStream, err := jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: "job-001"})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if _, err := stateStream.Recv(); err == nil {
+		t.Error("wanted error on non-existent job, but didn't happen.")
+	}
+
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: wantPipeline,
+		JobName:  wantName,
+	})
+	if err != nil {
+		t.Fatalf("Prepare(%v) = %v, want nil", wantName, err)
+	}
+	stateStream, err = jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: prepResp.GetPreparationId()})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if got, want := nextState(t, stateStream), jobpb.JobState_STOPPED; got != want {
+		t.Errorf("GetStateStream().Recv() = %v, want %v", got, want)
+	}
+
+	if _, err := jobCli.Run(ctx, &jobpb.RunJobRequest{PreparationId: prepResp.GetPreparationId()}); err != nil {
+		t.Fatalf("Run(%v) = %v, want nil", wantName, err)
+	}
+	for _, want := range []jobpb.JobState_Enum{jobpb.JobState_STARTING, jobpb.JobState_RUNNING} {
+		if got := nextState(t, stateStream); got != want {
+			t.Errorf("GetStateStream().Recv() = %v, want %v", got, want)
+		}
+		step <- struct{}{}
+	}
+	if d := cmp.Diff([]jobpb.JobState_Enum{jobpb.JobState_DONE}, recvStates(t, stateStream)); d != "" {
+		t.Errorf("GetStateStream() final states (-want, +got):\n%v", d)
+	}
+
+	// A new stream for a terminated job only sends the final state.
+	stateStream, err = jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: prepResp.GetPreparationId()})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if d := cmp.Diff([]jobpb.JobState_Enum{jobpb.JobState_DONE}, recvStates(t, stateStream)); d != "" {
+		t.Errorf("GetStateStream() after termination (-want, +got):\n%v", d)
+	}
+}
+
+// fakeStateStream is a state stream whose client may go away.
+type fakeStateStream struct {
+	jobpb.JobService_GetStateStreamServer
+	ctx    context.Context
+	states chan jobpb.JobState_Enum
+}
+
+func (s *fakeStateStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStateStream) Send(e *jobpb.JobStateEvent) error {
+	s.states <- e.GetState()
+	return nil
+}
+
+func TestGetStateStream_ClientGone(t *testing.T) {
+	ctx, undertest, clientConn := serveTestServer(t, func(j *Job) {})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: &pipepb.Pipeline{},
+		JobName:  "testJob",
+	})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream := &fakeStateStream{ctx: streamCtx, states: make(chan jobpb.JobState_Enum, 1)}
+	done := make(chan error)
+	go func() {
+		done <- undertest.GetStateStream(&jobpb.GetJobStateRequest{JobId: prepResp.GetPreparationId()}, stream)
+	}()
+	if got, want := <-stream.states, jobpb.JobState_STOPPED; got != want {
+		t.Errorf("GetStateStream() sent %v, want %v", got, want)
+	}
+	// The job's state doesn't change, so only the client going away ends the stream.
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetStateStream() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GetStateStream() didn't return after the client went away")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	wantName := "testJob"
+	wantPipeline := &pipepb.Pipeline{
+		Requirements: []string{urns.RequirementSplittableDoFn},
+	}
+	ctx, _, clientConn := serveTestServer(t, func(j *Job) {
+		j.Start()
+		j.Running()
+		<-j.RootCtx.Done()
+		if !errors.Is(context.Cause(j.RootCtx), ErrCancel) {
+			j.Failed(context.Cause(j.RootCtx))
+			return
+		}
+		j.Canceled()
+	})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+
+	if _, err := jobCli.Cancel(ctx, &jobpb.CancelJobRequest{JobId: "job-001"}); err == nil {
+		t.Error("Cancel on non-existent job: wanted error, but didn't happen.")
+	}
+
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: wantPipeline,
+		JobName:  wantName,
+	})
+	if err != nil {
+		t.Fatalf("Prepare(%v) = %v, want nil", wantName, err)
+	}
+	jobID := prepResp.GetPreparationId()
+	stateStream, err := jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if _, err := jobCli.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err != nil {
+		t.Fatalf("Run(%v) = %v, want nil", wantName, err)
+	}
+	for nextState(t, stateStream) != jobpb.JobState_RUNNING {
+	}
+
+	resp, err := jobCli.Cancel(ctx, &jobpb.CancelJobRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", jobID, err)
+	}
+	if got, want := resp.GetState(), jobpb.JobState_CANCELLING; got != want {
+		t.Errorf("Cancel(%v) = %v, want %v", jobID, got, want)
+	}
+	if got, want := recvStates(t, stateStream), jobpb.JobState_CANCELLED; len(got) == 0 || got[len(got)-1] != want {
+		t.Errorf("GetStateStream() after Cancel = %v, want final state %v", got, want)
+	}
+
+	// Canceling a terminated job returns its state.
+	resp, err = jobCli.Cancel(ctx, &jobpb.CancelJobRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("Cancel(%v) after termination = %v, want nil", jobID, err)
+	}
+	if got, want := resp.GetState(), jobpb.JobState_CANCELLED; got != want {
+		t.Errorf("Cancel(%v) after termination = %v, want %v", jobID, got, want)
+	}
+}
+
+func TestCancel_Starting(t *testing.T) {
+	canceled := make(chan struct{})
+	ctx, _, clientConn := serveTestServer(t, func(j *Job) {
+		j.Start()
+		<-canceled
+		// Must not overwrite the cancel requested while starting.
+		j.Running()
+		<-j.RootCtx.Done()
+		j.Canceled()
+	})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: &pipepb.Pipeline{},
+		JobName:  "testJob",
+	})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+	jobID := prepResp.GetPreparationId()
+	stateStream, err := jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if _, err := jobCli.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err != nil {
+		t.Fatalf("Run(%v) = %v, want nil", jobID, err)
+	}
+	for nextState(t, stateStream) != jobpb.JobState_STARTING {
+	}
+	if _, err := jobCli.Cancel(ctx, &jobpb.CancelJobRequest{JobId: jobID}); err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", jobID, err)
+	}
+	close(canceled)
+	for _, state := range recvStates(t, stateStream) {
+		if state == jobpb.JobState_RUNNING {
+			t.Errorf("GetStateStream() sent %v after Cancel", state)
+		}
+	}
+}
+
+func TestCancel_NotRun(t *testing.T) {
+	ctx, _, clientConn := serveTestServer(t, func(j *Job) {
+		t.Error("canceled job was executed")
+	})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: &pipepb.Pipeline{},
+		JobName:  "testJob",
+	})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+	jobID := prepResp.GetPreparationId()
+	resp, err := jobCli.Cancel(ctx, &jobpb.CancelJobRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("Cancel(%v) = %v, want nil", jobID, err)
+	}
+	if got, want := resp.GetState(), jobpb.JobState_CANCELLED; got != want {
+		t.Errorf("Cancel(%v) = %v, want %v", jobID, got, want)
+	}
+	if _, err := jobCli.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err == nil {
+		t.Errorf("Run(%v) on canceled job: wanted error, but didn't happen.", jobID)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx, undertest, clientConn := serveTestServer(t, func(j *Job) {
+		j.Start()
+		j.Running()
+		<-j.DrainRequested()
+		j.Drained()
+	})
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+
+	prepResp, err := jobCli.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: &pipepb.Pipeline{},
+		JobName:  "testJob",
+	})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+	jobID := prepResp.GetPreparationId()
+	if _, err := undertest.Drain(ctx, jobID); err == nil {
+		t.Errorf("Drain(%v) before running: wanted error, but didn't happen.", jobID)
+	}
+
+	stateStream, err := jobCli.GetStateStream(ctx, &jobpb.GetJobStateRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetStateStream: wanted successful connection, got %v", err)
+	}
+	if _, err := jobCli.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err != nil {
+		t.Fatalf("Run(%v) = %v, want nil", jobID, err)
+	}
+	for nextState(t, stateStream) != jobpb.JobState_RUNNING {
+	}
+
+	state, err := undertest.Drain(ctx, jobID)
+	if err != nil {
+		t.Fatalf("Drain(%v) = %v, want nil", jobID, err)
+	}
+	if got, want := state, jobpb.JobState_DRAINING; got != want {
+		t.Errorf("Drain(%v) = %v, want %v", jobID, got, want)
+	}
+	if got, want := recvStates(t, stateStream), jobpb.JobState_DRAINED; len(got) == 0 || got[len(got)-1] != want {
+		t.Errorf("GetStateStream() after Drain = %v, want final state %v", got, want)
+	}
+	if _, err := undertest.Drain(ctx, jobID); err == nil {
+		t.Errorf("Drain(%v) after termination: wanted error, but didn't happen.", jobID)
+	}
+}
+
+func TestJob_DrainRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		j := &Job{streamCond: sync.NewCond(&sync.Mutex{}), drainCh: make(chan struct{})}
+		j.state.Store(jobpb.JobState_RUNNING)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			j.Done()
+		}()
+		var drained bool
+		go func() {
+			defer wg.Done()
+			_, err := j.Drain()
+			drained = err == nil
+		}()
+		wg.Wait()
+		// A drain never overwrites the completed state.
+		want := jobpb.JobState_DONE
+		if got := j.state.Load(); got != want {
+			t.Fatalf("state after concurrent Done and Drain (drained=%v) = %v, want %v", drained, got, want)
+		}
+	}
+}
+
 func serveTestServer(t *testing.T, execute func(j *Job)) (context.Context, *Server, *grpc.ClientConn) {
 	t.Helper()
 	ctx, cancelFn := context.WithCancel(context.Background())
@@ -447,3 +831,45 @@ func serveTestServer(t *testing.T, execute func(j *Job)) (context.Context, *Serv
 	}
 	return ctx, s, clientConn
 }
+
+func TestGetPipeline_Annotated(t *testing.T) {
+	ctx, undertest, _ := serveTestServer(t, func(j *Job) {})
+	prepResp, err := undertest.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline: &pipepb.Pipeline{
+			Components: &pipepb.Components{
+				Transforms: map[string]*pipepb.PTransform{
+					"impulse": {UniqueName: "Impulse", Spec: &pipepb.FunctionSpec{Urn: urns.TransformImpulse}, Outputs: map[string]string{"o": "p0"}},
+					"comp":    {UniqueName: "Composite", Subtransforms: []string{"impulse"}, Outputs: map[string]string{"o": "p0"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+	jobID := prepResp.GetPreparationId()
+	job := undertest.getJob(jobID)
+	job.SetExecutionGraph(map[string][]string{"impulse": {"stage-000"}}, func() map[string]mtime.Time {
+		return map[string]mtime.Time{"p0": 1234}
+	})
+
+	resp, err := undertest.GetPipeline(ctx, &jobpb.GetJobPipelineRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetPipeline() = %v, want nil", err)
+	}
+	ts := resp.GetPipeline().GetComponents().GetTransforms()
+	want := map[string][]byte{
+		urns.AnnotationStages:                      []byte("stage-000"),
+		urns.AnnotationOutputWatermarkPrefix + "o": []byte("1234"),
+	}
+	if d := cmp.Diff(want, ts["impulse"].GetAnnotations()); d != "" {
+		t.Errorf("GetPipeline() impulse annotations (-want, +got):\n%v", d)
+	}
+	if got := ts["comp"].GetAnnotations(); len(got) != 0 {
+		t.Errorf("GetPipeline() composite annotations = %v, want none", got)
+	}
+	// The job's own pipeline isn't modified.
+	if got := job.Pipeline.GetComponents().GetTransforms()["impulse"].GetAnnotations(); len(got) != 0 {
+		t.Errorf("job pipeline annotations = %v, want none", got)
+	}
+}
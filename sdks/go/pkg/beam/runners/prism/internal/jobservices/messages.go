@@ -0,0 +1,216 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobservices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// JobMessage is a message about the execution of a job, sent by the runner,
+// or logged by the job's SDK workers.
+type JobMessage struct {
+	Importance jobpb.JobMessage_MessageImportance
+	Time       time.Time
+	Text       string
+
+	Stage     string `json:",omitempty"` // ID of the stage the message is about, if any.
+	Bundle    string `json:",omitempty"` // ID of the bundle the message is about, if any.
+	Transform string `json:",omitempty"` // ID or unique name of the transform that logged the message, if any.
+	Worker    string `json:",omitempty"` // ID of the SDK worker that logged the message, if any.
+}
+
+// UnmarshalJSON decodes a JobMessage, or the plain text of a message, as
+// stored for jobs before messages were structured.
+func (m *JobMessage) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = JobMessage{Importance: jobpb.JobMessage_JOB_MESSAGE_BASIC, Text: text}
+		return nil
+	}
+	type plain JobMessage // Avoids recursing into UnmarshalJSON.
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// toProto converts the message for the Job Management API, which has no
+// structured fields, so they're described in the message text instead.
+// They precede the text, so SDKs reporting the text of a failed job's last
+// error still end with the original error.
+func (m JobMessage) toProto(id int) *jobpb.JobMessage {
+	var attrs []string
+	for _, a := range []struct{ k, v string }{
+		{"stage", m.Stage}, {"bundle", m.Bundle}, {"transform", m.Transform}, {"worker", m.Worker},
+	} {
+		if a.v != "" {
+			attrs = append(attrs, a.k+"="+a.v)
+		}
+	}
+	text := m.Text
+	if len(attrs) > 0 {
+		text = fmt.Sprintf("[%v] %v", strings.Join(attrs, " "), text)
+	}
+	pb := &jobpb.JobMessage{
+		MessageId:   strconv.Itoa(id),
+		MessageText: text,
+		Importance:  m.Importance,
+	}
+	if !m.Time.IsZero() {
+		pb.Time = m.Time.Format(time.RFC3339Nano)
+	}
+	return pb
+}
+
+// MessageFilter selects job messages. The zero value selects all messages.
+type MessageFilter struct {
+	// MinImportance excludes messages of lower importance.
+	MinImportance jobpb.JobMessage_MessageImportance
+	// Transform is the ID or unique name of a transform or composite of the
+	// submitted pipeline. If set, only messages logged by the transform or its
+	// subtransforms, or about the stages executing them, are selected.
+	// SDKs may identify the transforms that log messages by ID or unique name.
+	Transform string
+	// Text is a case insensitive substring of the text of selected messages.
+	Text string
+}
+
+// Metadata keys of GetMessageStream requests that filter the streamed messages.
+const (
+	mdMessageImportance = "prism-message-importance" // Name or number of the minimum importance, such as "WARNING".
+	mdMessageTransform  = "prism-message-transform"  // ID or unique name of a transform or composite.
+	mdMessageText       = "prism-message-text"       // Case insensitive substring of message text.
+)
+
+// ParseImportance parses the name of a message importance, with or without its
+// "JOB_MESSAGE_" prefix and in any case, or its number.
+func ParseImportance(s string) (jobpb.JobMessage_MessageImportance, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if _, ok := jobpb.JobMessage_MessageImportance_name[int32(n)]; ok {
+			return jobpb.JobMessage_MessageImportance(n), nil
+		}
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "JOB_MESSAGE_") {
+		name = "JOB_MESSAGE_" + name
+	}
+	if v, ok := jobpb.JobMessage_MessageImportance_value[name]; ok {
+		return jobpb.JobMessage_MessageImportance(v), nil
+	}
+	return 0, fmt.Errorf("unknown message importance %q", s)
+}
+
+// messageFilterFromContext returns the message filter from the metadata of an
+// incoming request.
+func messageFilterFromContext(ctx context.Context) (MessageFilter, error) {
+	var f MessageFilter
+	md, _ := metadata.FromIncomingContext(ctx)
+	last := func(key string) string {
+		if vs := md.Get(key); len(vs) > 0 {
+			return vs[len(vs)-1]
+		}
+		return ""
+	}
+	if v := last(mdMessageImportance); v != "" {
+		imp, err := ParseImportance(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid %v metadata: %w", mdMessageImportance, err)
+		}
+		f.MinImportance = imp
+	}
+	f.Transform = last(mdMessageTransform)
+	f.Text = last(mdMessageText)
+	return f, nil
+}
+
+// messageMatcher returns a function reporting whether messages of the job
+// are selected by the filter.
+func (j *Job) messageMatcher(f MessageFilter) func(JobMessage) bool {
+	var transforms, stages map[string]bool
+	if f.Transform != "" {
+		transforms, stages = j.transformScope(f.Transform)
+	}
+	text := strings.ToLower(f.Text)
+	return func(m JobMessage) bool {
+		if m.Importance < f.MinImportance {
+			return false
+		}
+		if transforms != nil {
+			switch {
+			case m.Transform != "":
+				if !transforms[m.Transform] {
+					return false
+				}
+			case !stages[m.Stage]:
+				return false
+			}
+		}
+		return text == "" || strings.Contains(strings.ToLower(m.Text), text)
+	}
+}
+
+// transformScope returns the IDs and unique names of the transform with the given
+// ID or unique name, and of all its subtransforms, along with the IDs of the stages
+// executing them.
+func (j *Job) transformScope(transform string) (transforms, stages map[string]bool) {
+	ts := j.Pipeline.GetComponents().GetTransforms()
+	ids := map[string]bool{}
+	var add func(tid string)
+	add = func(tid string) {
+		if ids[tid] {
+			return
+		}
+		ids[tid] = true
+		for _, sub := range ts[tid].GetSubtransforms() {
+			add(sub)
+		}
+	}
+	for tid, t := range ts {
+		if tid == transform || t.GetUniqueName() == transform {
+			add(tid)
+		}
+	}
+	transforms, stages = map[string]bool{}, map[string]bool{}
+	j.execMu.Lock()
+	defer j.execMu.Unlock()
+	for tid := range ids {
+		transforms[tid] = true
+		transforms[ts[tid].GetUniqueName()] = true
+		for _, sID := range j.transformStages[tid] {
+			stages[sID] = true
+		}
+	}
+	return transforms, stages
+}
+
+// Messages returns the job's buffered messages selected by the filter, oldest first.
+func (j *Job) Messages(f MessageFilter) []JobMessage {
+	match := j.messageMatcher(f)
+	j.streamCond.L.Lock()
+	defer j.streamCond.L.Unlock()
+	var ret []JobMessage
+	for _, m := range j.msgs {
+		if match(m) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,221 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobservices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+var messagesPipeline = &pipepb.Pipeline{
+	Components: &pipepb.Components{
+		Transforms: map[string]*pipepb.PTransform{
+			"read":  {UniqueName: "Read", Spec: &pipepb.FunctionSpec{Urn: urns.TransformImpulse}},
+			"parse": {UniqueName: "Parse", Spec: &pipepb.FunctionSpec{Urn: urns.TransformImpulse}},
+			"comp":  {UniqueName: "Composite", Subtransforms: []string{"read", "parse"}},
+			"write": {UniqueName: "Write", Spec: &pipepb.FunctionSpec{Urn: urns.TransformImpulse}},
+		},
+	},
+}
+
+func TestJob_Messages(t *testing.T) {
+	j := &Job{
+		Pipeline:   messagesPipeline,
+		streamCond: sync.NewCond(&sync.Mutex{}),
+	}
+	j.SetExecutionGraph(map[string][]string{"read": {"stage-001"}, "parse": {"stage-001"}, "write": {"stage-002"}}, nil)
+
+	msgs := []JobMessage{
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_BASIC, Text: "starting job-001"},
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_DEBUG, Text: "parsed line", Stage: "stage-001", Bundle: "inst001", Transform: "Parse", Worker: "w1"}, // Logged by unique name.
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_WARNING, Text: "stage-001 is slow", Stage: "stage-001"},
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_ERROR, Text: "Write failed: BOOM", Stage: "stage-002", Bundle: "inst002", Transform: "write", Worker: "w1"},
+	}
+	for _, m := range msgs {
+		j.SendMessage(m)
+	}
+
+	tests := []struct {
+		name   string
+		filter MessageFilter
+		want   []JobMessage
+	}{
+		{"all", MessageFilter{}, msgs},
+		{"importance", MessageFilter{MinImportance: jobpb.JobMessage_JOB_MESSAGE_WARNING}, msgs[2:]},
+		{"transformID", MessageFilter{Transform: "write"}, msgs[3:]},
+		// Composites include their subtransforms, and the stages executing them.
+		{"compositeName", MessageFilter{Transform: "Composite"}, msgs[1:3]},
+		// Messages from other transforms of a stage aren't selected.
+		{"transformName", MessageFilter{Transform: "Read"}, msgs[2:3]},
+		{"text", MessageFilter{Text: "boom"}, msgs[3:]},
+		{"combined", MessageFilter{MinImportance: jobpb.JobMessage_JOB_MESSAGE_BASIC, Transform: "comp", Text: "SLOW"}, msgs[2:3]},
+		{"none", MessageFilter{Transform: "unknown"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := cmp.Diff(test.want, j.Messages(test.filter), cmpopts.IgnoreFields(JobMessage{}, "Time")); d != "" {
+				t.Errorf("Messages(%+v) diff (-want, +got):\n%v", test.filter, d)
+			}
+		})
+	}
+}
+
+func TestJob_MessagesTrimLogs(t *testing.T) {
+	j := &Job{streamCond: sync.NewCond(&sync.Mutex{})}
+	j.SendMsg("runner error")
+	for i := 0; i < 1000; i++ {
+		j.SendMessage(JobMessage{Text: fmt.Sprint("log ", i), Worker: "w1"})
+	}
+	j.SendMsg("runner done")
+
+	got := j.Messages(MessageFilter{})
+	if got[0].Text != "runner error" || got[len(got)-1].Text != "runner done" {
+		t.Errorf("Messages() = [%q ... %q], want runner messages retained", got[0].Text, got[len(got)-1].Text)
+	}
+	if n := len(got) - 2; n < 100 || n > 120 {
+		t.Errorf("Messages() has %v SDK logs, want between 100 and 120", n)
+	}
+	if got, want := got[len(got)-2].Text, "log 999"; got != want {
+		t.Errorf("last SDK log = %q, want %q", got, want)
+	}
+	for i := 1; i < len(j.msgIDs); i++ {
+		if j.msgIDs[i] <= j.msgIDs[i-1] {
+			t.Fatalf("msgIDs = %v, want ascending", j.msgIDs)
+		}
+	}
+	if got, want := j.msgIDs[len(j.msgIDs)-1], 1001; got != want {
+		t.Errorf("last message ID = %v, want %v", got, want)
+	}
+}
+
+func TestParseImportance(t *testing.T) {
+	for _, s := range []string{"warning", "WARNING", "JOB_MESSAGE_WARNING", "4"} {
+		if got, err := ParseImportance(s); err != nil || got != jobpb.JobMessage_JOB_MESSAGE_WARNING {
+			t.Errorf("ParseImportance(%q) = %v, %v, want %v", s, got, err, jobpb.JobMessage_JOB_MESSAGE_WARNING)
+		}
+	}
+	for _, s := range []string{"loud", "42"} {
+		if got, err := ParseImportance(s); err == nil {
+			t.Errorf("ParseImportance(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestGetMessageStream_Filter(t *testing.T) {
+	var called sync.WaitGroup
+	called.Add(1)
+	ctx, undertest, clientConn := serveTestServer(t, func(j *Job) {
+		defer called.Done()
+		j.Start()
+		j.Running()
+		j.SendMessage(JobMessage{Importance: jobpb.JobMessage_JOB_MESSAGE_DEBUG, Text: "debugging", Transform: "parse"})
+		j.SendMessage(JobMessage{Importance: jobpb.JobMessage_JOB_MESSAGE_WARNING, Text: "warned", Stage: "stage-001", Transform: "parse", Worker: "w1"})
+		j.SendMessage(JobMessage{Importance: jobpb.JobMessage_JOB_MESSAGE_ERROR, Text: "failed", Transform: "write"})
+		j.Done()
+	})
+	prepResp, err := undertest.Prepare(ctx, &jobpb.PrepareJobRequest{Pipeline: messagesPipeline})
+	if err != nil {
+		t.Fatalf("Prepare() = %v, want nil", err)
+	}
+	jobID := prepResp.GetPreparationId()
+	if _, err := undertest.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	called.Wait()
+
+	jobCli := jobpb.NewJobServiceClient(clientConn)
+	mdCtx := metadata.AppendToOutgoingContext(ctx, mdMessageImportance, "warning", mdMessageTransform, "Composite")
+	msgStream, err := jobCli.GetMessageStream(mdCtx, &jobpb.JobMessagesRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetMessageStream() = %v, want nil", err)
+	}
+	var got []*jobpb.JobMessage
+	for {
+		resp, err := msgStream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("GetMessageStream().Recv() = %v, want nil", err)
+		}
+		if m := resp.GetMessageResponse(); m != nil {
+			got = append(got, m)
+		}
+	}
+	want := []*jobpb.JobMessage{{
+		MessageId:   "1",
+		MessageText: "[stage=stage-001 transform=parse worker=w1] warned",
+		Importance:  jobpb.JobMessage_JOB_MESSAGE_WARNING,
+	}}
+	if d := cmp.Diff(want, got, protocmp.Transform(), protocmp.IgnoreFields(&jobpb.JobMessage{}, "time")); d != "" {
+		t.Errorf("GetMessageStream() diff (-want, +got):\n%v", d)
+	}
+
+	badCtx := metadata.AppendToOutgoingContext(ctx, mdMessageImportance, "loud")
+	msgStream, err = jobCli.GetMessageStream(badCtx, &jobpb.JobMessagesRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetMessageStream() = %v, want nil", err)
+	}
+	if _, err := msgStream.Recv(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("GetMessageStream(importance=loud).Recv() = %v, want error", err)
+	}
+}
+
+func TestDescribePipelineOptions(t *testing.T) {
+	ctx, undertest, clientConn := serveTestServer(t, func(j *Job) {})
+	want := []*jobpb.PipelineOptionDescriptor{{
+		Name:         "parallelism",
+		Type:         jobpb.PipelineOptionType_INTEGER,
+		DefaultValue: "1",
+		Group:        "prism",
+	}}
+	undertest.SetOptionDescriptors(want)
+
+	resp, err := jobpb.NewJobServiceClient(clientConn).DescribePipelineOptions(ctx, &jobpb.DescribePipelineOptionsRequest{})
+	if err != nil {
+		t.Fatalf("DescribePipelineOptions() = %v, want nil", err)
+	}
+	if d := cmp.Diff(want, resp.GetOptions(), protocmp.Transform()); d != "" {
+		t.Errorf("DescribePipelineOptions() diff (-want, +got):\n%v", d)
+	}
+}
+
+func TestJobRecord_LegacyMessages(t *testing.T) {
+	var rec jobRecord
+	in := `{"ID": "job-001", "Messages": ["starting", {"Importance": 5, "Text": "failed", "Stage": "stage-001"}]}`
+	if err := json.Unmarshal([]byte(in), &rec); err != nil {
+		t.Fatalf("json.Unmarshal(%v) = %v", in, err)
+	}
+	want := []JobMessage{
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_BASIC, Text: "starting"},
+		{Importance: jobpb.JobMessage_JOB_MESSAGE_ERROR, Text: "failed", Stage: "stage-001"},
+	}
+	if d := cmp.Diff(want, rec.Messages); d != "" {
+		t.Errorf("jobRecord.Messages diff (-want, +got):\n%v", d)
+	}
+}
@@ -172,7 +172,8 @@ func buildUrnToOpsMap(mUrn2Spec map[string]*pipepb.MonitoringInfoSpec) map[strin
 			// Defaults should be safe since the metric only exists if we get any values at all.
 			return &distributionInt64{dist: metrics.DistributionValue{Min: math.MaxInt64, Max: math.MinInt64}}
 		},
-		getMetTyp(pipepb.MonitoringInfoTypeUrns_PROGRESS_TYPE): func() metricAccumulator { return &progress{} },
+		getMetTyp(pipepb.MonitoringInfoTypeUrns_LATEST_INT64_TYPE): func() metricAccumulator { return &latestInt64{} },
+		getMetTyp(pipepb.MonitoringInfoTypeUrns_PROGRESS_TYPE):     func() metricAccumulator { return &progress{} },
 	}
 
 	ret := make(map[string]urnOps)
@@ -253,6 +254,39 @@ func (m *sumFloat64) toProto(key metricKey) *pipepb.MonitoringInfo {
 	}
 }
 
+// latestInt64 retains the value with the latest timestamp, in milliseconds since the epoch.
+type latestInt64 struct {
+	timestamp, value int64
+}
+
+func (m *latestInt64) accumulate(pyld []byte) error {
+	buf := bytes.NewBuffer(pyld)
+	ts, err := coder.DecodeVarInt(buf)
+	if err != nil {
+		return err
+	}
+	v, err := coder.DecodeVarInt(buf)
+	if err != nil {
+		return err
+	}
+	if ts >= m.timestamp {
+		m.timestamp, m.value = ts, v
+	}
+	return nil
+}
+
+func (m *latestInt64) toProto(key metricKey) *pipepb.MonitoringInfo {
+	var buf bytes.Buffer
+	coder.EncodeVarInt(m.timestamp, &buf)
+	coder.EncodeVarInt(m.value, &buf)
+	return &pipepb.MonitoringInfo{
+		Urn:     key.Urn(),
+		Type:    getMetTyp(pipepb.MonitoringInfoTypeUrns_LATEST_INT64_TYPE),
+		Payload: buf.Bytes(),
+		Labels:  key.Labels(),
+	}
+}
+
 type progress struct {
 	snap []float64
 }
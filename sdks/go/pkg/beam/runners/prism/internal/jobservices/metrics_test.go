@@ -128,6 +128,19 @@ func Test_metricsStore_ContributeMetrics(t *testing.T) {
 			want: []*pipepb.MonitoringInfo{
 				makeInfoWBytes(pipepb.MonitoringInfoSpecs_USER_DISTRIBUTION_INT64, []byte{4, 19, 2, 7}),
 			},
+		}, {
+			name: "int64Latest",
+			input: []map[string][]byte{
+				{"a": []byte{5, 1}},
+				{"a": []byte{3, 2}}, // Earlier values are dropped.
+				{"a": []byte{7, 3}},
+			},
+			shortIDs: map[string]*pipepb.MonitoringInfo{
+				"a": makeInfo(pipepb.MonitoringInfoSpecs_USER_LATEST_INT64),
+			},
+			want: []*pipepb.MonitoringInfo{
+				makeInfoWBytes(pipepb.MonitoringInfoSpecs_USER_LATEST_INT64, []byte{7, 3}),
+			},
 		},
 	}
 
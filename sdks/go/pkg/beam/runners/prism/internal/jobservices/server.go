@@ -22,6 +22,7 @@ import (
 
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
 	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
 	"golang.org/x/exp/slog"
 	"google.golang.org/grpc"
 )
@@ -46,6 +47,12 @@ type Server struct {
 
 	// Artifact hack
 	artifacts map[string][]byte
+
+	// store persists completed jobs, if set.
+	store *JobStore
+
+	// optionDescriptors describe the pipeline options understood by the runner.
+	optionDescriptors []*jobpb.PipelineOptionDescriptor
 }
 
 // NewServer acquires the indicated port.
@@ -68,12 +75,96 @@ func NewServer(port int, execute func(*Job)) *Server {
 	return s
 }
 
+// UseJobStore restores the jobs in the store, and persists jobs to it as they complete.
+// Must be called before serving.
+func (s *Server) UseJobStore(store *JobStore) error {
+	jobs, err := store.load()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range jobs {
+		s.jobs[j.key] = j
+		// Continue numbering after restored jobs, so new job IDs don't collide.
+		var index uint32
+		if _, err := fmt.Sscanf(j.key, "job-%d", &index); err == nil && index > s.index {
+			s.index = index
+		}
+	}
+	s.store = store
+	slog.Info("Restored jobs from job store", slog.Int("jobs", len(jobs)), slog.String("dir", store.dir))
+	return nil
+}
+
+// storeJob persists the completed job, if the server has a JobStore, and
+// forgets jobs that the store evicts.
+func (s *Server) storeJob(j *Job) {
+	if s.store == nil || !isTerminal(j.state.Load().(jobpb.JobState_Enum)) {
+		return
+	}
+	artifacts := map[string][]byte{}
+	for _, env := range j.Pipeline.GetComponents().GetEnvironments() {
+		for _, dep := range env.GetDependencies() {
+			if data, ok := s.artifacts[string(dep.GetTypePayload())]; ok {
+				artifacts[string(dep.GetTypePayload())] = data
+			}
+		}
+	}
+	evicted, err := s.store.save(j, artifacts)
+	if err != nil {
+		slog.Warn("unable to store job", slog.Any("job", j), slog.Any("error", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range evicted {
+		delete(s.jobs, id)
+	}
+}
+
+// SetOptionDescriptors sets the descriptions of the pipeline options understood
+// by the runner, returned by DescribePipelineOptions. Must be called before serving.
+func (s *Server) SetOptionDescriptors(descs []*jobpb.PipelineOptionDescriptor) {
+	s.optionDescriptors = descs
+}
+
 func (s *Server) getJob(id string) *Job {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.jobs[id]
 }
 
+// StageStats returns the current execution statistics of the stages of the
+// given job, or nil if the job is unknown or not executing.
+func (s *Server) StageStats(jobID string) []engine.StageStats {
+	j := s.getJob(jobID)
+	if j == nil {
+		return nil
+	}
+	return j.StageStats()
+}
+
+// ElementSamples returns the recent elements of the PCollections of the given job,
+// keyed by PCollection ID, or nil if the job is unknown or not executing.
+func (s *Server) ElementSamples(jobID string) map[string][]ElementSample {
+	j := s.getJob(jobID)
+	if j == nil {
+		return nil
+	}
+	return j.ElementSamples()
+}
+
+// JobMessages returns the buffered messages of the given job selected by the filter,
+// oldest first, or nil if the job is unknown.
+func (s *Server) JobMessages(jobID string, filter MessageFilter) []JobMessage {
+	j := s.getJob(jobID)
+	if j == nil {
+		return nil
+	}
+	return j.Messages(filter)
+}
+
 func (s *Server) Endpoint() string {
 	_, port, _ := net.SplitHostPort(s.lis.Addr().String())
 	return fmt.Sprintf("localhost:%v", port)
@@ -0,0 +1,331 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobservices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Files and directories within a stored job's directory.
+const (
+	storeRecordFile   = "job.json"
+	storePipelineFile = "pipeline.pb"
+	storeOptionsFile  = "options.pb"
+	storeMetricsFile  = "metrics.pb"
+	storeArtifactsDir = "artifacts"
+)
+
+// Retention bounds the completed jobs kept by a JobStore.
+// Zero values leave the corresponding bound unlimited.
+type Retention struct {
+	MaxJobs int           // Maximum number of stored jobs. The earliest completed jobs are evicted first.
+	MaxAge  time.Duration // Maximum time a job is stored after it completes.
+}
+
+// JobStore persists completed jobs to disk, so their pipelines, messages,
+// metrics, and artifacts remain available when prism restarts.
+//
+// Each job is stored in a directory named by its job ID, beneath the root
+// directory of the store. Retention is enforced when the store is opened,
+// and whenever a job is saved.
+type JobStore struct {
+	dir       string
+	retention Retention
+
+	mu    sync.Mutex
+	saved map[string]time.Time // Completion time of stored jobs, keyed by job ID.
+}
+
+// OpenJobStore opens the job store in the given directory, creating the
+// directory if necessary.
+func OpenJobStore(dir string, retention Retention) (*JobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create job store directory %v: %w", dir, err)
+	}
+	return &JobStore{
+		dir:       dir,
+		retention: retention,
+		saved:     map[string]time.Time{},
+	}, nil
+}
+
+// jobRecord is the stored form of a job's metadata and message log.
+type jobRecord struct {
+	ID        string
+	Name      string
+	State     string // Name of the jobpb.JobState_Enum.
+	StateTime time.Time
+	Failure   string       `json:",omitempty"`
+	Messages  []JobMessage // Plain strings in stores written before messages were structured.
+}
+
+// load reads all jobs in the store, after evicting those outside of the retention bounds.
+// Directories that aren't complete stored jobs are skipped.
+func (s *JobStore) load() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read job store directory %v: %w", s.dir, err)
+	}
+	var jobs []*Job
+	for _, e := range entries {
+		// Partially written jobs are in hidden directories.
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		j, err := s.readJob(e.Name())
+		if err != nil {
+			slog.Warn("skipping unreadable stored job", slog.String("job", e.Name()), slog.Any("error", err))
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range jobs {
+		s.saved[j.key] = j.stateTime
+	}
+	evicted := map[string]bool{}
+	for _, id := range s.evict(time.Now()) {
+		evicted[id] = true
+	}
+	retained := jobs[:0]
+	for _, j := range jobs {
+		if !evicted[j.key] {
+			retained = append(retained, j)
+		}
+	}
+	return retained, nil
+}
+
+// readJob reads the stored job with the given ID.
+func (s *JobStore) readJob(id string) (*Job, error) {
+	dir := filepath.Join(s.dir, id)
+	b, err := os.ReadFile(filepath.Join(dir, storeRecordFile))
+	if err != nil {
+		return nil, err
+	}
+	var rec jobRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("decoding %v: %w", storeRecordFile, err)
+	}
+	state, ok := jobpb.JobState_Enum_value[rec.State]
+	if !ok {
+		return nil, fmt.Errorf("unknown job state %q", rec.State)
+	}
+	pipeline := &pipepb.Pipeline{}
+	if err := readProto(filepath.Join(dir, storePipelineFile), pipeline); err != nil {
+		return nil, err
+	}
+	options := &structpb.Struct{}
+	if err := readProto(filepath.Join(dir, storeOptionsFile), options); err != nil {
+		return nil, err
+	}
+	metrics := &jobpb.MetricResults{}
+	if err := readProto(filepath.Join(dir, storeMetricsFile), metrics); err != nil {
+		return nil, err
+	}
+
+	// Stored jobs are complete, so their context is already done.
+	rootCtx, cancelFn := context.WithCancelCause(context.Background())
+	cancelFn(fmt.Errorf("job %v restored from the job store", rec.ID))
+	j := &Job{
+		key:             rec.ID,
+		jobName:         rec.Name,
+		Pipeline:        pipeline,
+		options:         options,
+		streamCond:      sync.NewCond(&sync.Mutex{}),
+		msgs:            rec.Messages,
+		maxMsg:          len(rec.Messages),
+		stateTime:       rec.StateTime,
+		RootCtx:         rootCtx,
+		CancelFn:        cancelFn,
+		drainCh:         make(chan struct{}),
+		restoredMetrics: metrics,
+	}
+	for i, m := range rec.Messages {
+		j.msgIDs = append(j.msgIDs, i)
+		if m.Worker != "" {
+			j.numLogs++
+		}
+	}
+	j.state.Store(jobpb.JobState_Enum(state))
+	if rec.Failure != "" {
+		j.failureErr = errors.New(rec.Failure)
+	}
+	return j, nil
+}
+
+// save writes the completed job, and the given artifacts keyed by their type
+// payloads, to the store. It returns the IDs of jobs evicted from the store as a result.
+func (s *JobStore) save(j *Job, artifacts map[string][]byte) ([]string, error) {
+	j.streamCond.L.Lock()
+	rec := jobRecord{
+		ID:        j.key,
+		Name:      j.jobName,
+		State:     j.state.Load().(jobpb.JobState_Enum).String(),
+		StateTime: j.stateTime,
+		Messages:  append([]JobMessage(nil), j.msgs...),
+	}
+	if j.failureErr != nil {
+		rec.Failure = j.failureErr.Error()
+	}
+	j.streamCond.L.Unlock()
+
+	// Write to a hidden directory first, so partially written jobs aren't loaded.
+	tmp := filepath.Join(s.dir, "."+j.key)
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := s.writeJob(tmp, rec, j, artifacts); err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("unable to store job %v: %w", j, err)
+	}
+	dir := filepath.Join(s.dir, j.key)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("unable to store job %v: %w", j, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved[j.key] = rec.StateTime
+	return s.evict(time.Now()), nil
+}
+
+func (s *JobStore) writeJob(dir string, rec jobRecord, j *Job, artifacts map[string][]byte) error {
+	if err := os.MkdirAll(filepath.Join(dir, storeArtifactsDir), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, storeRecordFile), b, 0o644); err != nil {
+		return err
+	}
+	if err := writeProto(filepath.Join(dir, storePipelineFile), j.annotatedPipeline()); err != nil {
+		return err
+	}
+	if err := writeProto(filepath.Join(dir, storeOptionsFile), j.options); err != nil {
+		return err
+	}
+	if err := writeProto(filepath.Join(dir, storeMetricsFile), j.metricResults()); err != nil {
+		return err
+	}
+	for payload, data := range artifacts {
+		if err := os.WriteFile(filepath.Join(dir, storeArtifactsDir, artifactFile(payload)), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict removes stored jobs outside of the retention bounds, returning their IDs.
+// Must be called while holding s.mu.
+func (s *JobStore) evict(now time.Time) []string {
+	ids := make([]string, 0, len(s.saved))
+	for id := range s.saved {
+		ids = append(ids, id)
+	}
+	// Order from the most recently completed job to the earliest.
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.saved[ids[i]], s.saved[ids[j]]
+		if a.Equal(b) {
+			return ids[i] > ids[j]
+		}
+		return a.After(b)
+	})
+	var evicted []string
+	for i, id := range ids {
+		tooMany := s.retention.MaxJobs > 0 && i >= s.retention.MaxJobs
+		tooOld := s.retention.MaxAge > 0 && now.Sub(s.saved[id]) > s.retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+			slog.Warn("unable to evict stored job", slog.String("job", id), slog.Any("error", err))
+			continue
+		}
+		delete(s.saved, id)
+		evicted = append(evicted, id)
+	}
+	return evicted
+}
+
+// artifact returns the stored artifact with the given type payload, if any
+// stored job staged it.
+func (s *JobStore) artifact(payload string) ([]byte, bool) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.saved))
+	for id := range s.saved {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	name := artifactFile(payload)
+	for _, id := range ids {
+		b, err := os.ReadFile(filepath.Join(s.dir, id, storeArtifactsDir, name))
+		if err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// artifactFile returns the file name for an artifact, from its type payload.
+func artifactFile(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeProto(path string, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+func readProto(path string, m proto.Message) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("decoding %v: %w", filepath.Base(path), err)
+	}
+	return nil
+}
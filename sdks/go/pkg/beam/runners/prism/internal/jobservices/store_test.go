@@ -0,0 +1,322 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobservices
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// TestJobStore_Restart validates that completed jobs are available from a new
+// server using the same job store.
+func TestJobStore_Restart(t *testing.T) {
+	dir := t.TempDir()
+	wantName := "testJob"
+	wantPipeline := &pipepb.Pipeline{
+		Requirements: []string{urns.RequirementSplittableDoFn},
+	}
+	wantOptions, err := structpb.NewStruct(map[string]any{"beam:option:job_name:v1": wantName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMsgs := []string{"job starting", "job running", "job done"}
+
+	var called sync.WaitGroup
+	called.Add(1)
+	ctx, undertest, _ := serveTestServer(t, func(j *Job) {
+		j.Start()
+		j.SendMsg(wantMsgs[0])
+		j.Running()
+		j.SendMsg(wantMsgs[1])
+		j.SendMsg(wantMsgs[2])
+		j.Done()
+		called.Done()
+	})
+	store, err := OpenJobStore(dir, Retention{})
+	if err != nil {
+		t.Fatalf("OpenJobStore() = %v, want nil", err)
+	}
+	if err := undertest.UseJobStore(store); err != nil {
+		t.Fatalf("UseJobStore() = %v, want nil", err)
+	}
+
+	prepResp, err := undertest.Prepare(ctx, &jobpb.PrepareJobRequest{
+		Pipeline:        wantPipeline,
+		PipelineOptions: wantOptions,
+		JobName:         wantName,
+	})
+	if err != nil {
+		t.Fatalf("Prepare(%v) = %v, want nil", wantName, err)
+	}
+	jobID := prepResp.GetPreparationId()
+	if _, err := undertest.Run(ctx, &jobpb.RunJobRequest{PreparationId: jobID}); err != nil {
+		t.Fatalf("Run(%v) = %v, want nil", jobID, err)
+	}
+	called.Wait()
+	waitForStoredJob(t, dir, jobID)
+
+	// "Restart" prism with a new server against the same store.
+	ctx, restarted, clientConn := serveTestServer(t, func(j *Job) {
+		j.Done()
+	})
+	store, err = OpenJobStore(dir, Retention{})
+	if err != nil {
+		t.Fatalf("OpenJobStore() = %v, want nil", err)
+	}
+	if err := restarted.UseJobStore(store); err != nil {
+		t.Fatalf("UseJobStore() = %v, want nil", err)
+	}
+
+	jobsResp, err := restarted.GetJobs(ctx, &jobpb.GetJobsRequest{})
+	if err != nil {
+		t.Fatalf("GetJobs() = %v, want nil", err)
+	}
+	wantJobs := []*jobpb.JobInfo{{
+		JobId:           jobID,
+		JobName:         wantName,
+		State:           jobpb.JobState_DONE,
+		PipelineOptions: wantOptions,
+	}}
+	if d := cmp.Diff(wantJobs, jobsResp.GetJobInfo(), protocmp.Transform()); d != "" {
+		t.Errorf("GetJobs() (-want, +got):\n%v", d)
+	}
+
+	pipeResp, err := restarted.GetPipeline(ctx, &jobpb.GetJobPipelineRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetPipeline(%v) = %v, want nil", jobID, err)
+	}
+	if d := cmp.Diff(wantPipeline, pipeResp.GetPipeline(), protocmp.Transform()); d != "" {
+		t.Errorf("GetPipeline(%v) (-want, +got):\n%v", jobID, d)
+	}
+
+	if _, err := restarted.GetJobMetrics(ctx, &jobpb.GetJobMetricsRequest{JobId: jobID}); err != nil {
+		t.Errorf("GetJobMetrics(%v) = %v, want nil", jobID, err)
+	}
+
+	msgStream, err := jobpb.NewJobServiceClient(clientConn).GetMessageStream(ctx, &jobpb.JobMessagesRequest{JobId: jobID})
+	if err != nil {
+		t.Fatalf("GetMessageStream(%v) = %v, want nil", jobID, err)
+	}
+	var gotMsgs []string
+	var gotState jobpb.JobState_Enum
+	for {
+		resp, err := msgStream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("GetMessageStream(%v).Recv() = %v, want nil", jobID, err)
+		}
+		if msg := resp.GetMessageResponse(); msg != nil {
+			gotMsgs = append(gotMsgs, msg.GetMessageText())
+		} else {
+			gotState = resp.GetStateResponse().GetState()
+		}
+	}
+	if d := cmp.Diff(wantMsgs, gotMsgs); d != "" {
+		t.Errorf("GetMessageStream(%v) messages (-want, +got):\n%v", jobID, d)
+	}
+	if got, want := gotState, jobpb.JobState_DONE; got != want {
+		t.Errorf("GetMessageStream(%v) state = %v, want %v", jobID, got, want)
+	}
+
+	// New jobs don't reuse the IDs of restored jobs.
+	newResp, err := restarted.Prepare(ctx, &jobpb.PrepareJobRequest{Pipeline: wantPipeline, JobName: wantName})
+	if err != nil {
+		t.Fatalf("Prepare(%v) = %v, want nil", wantName, err)
+	}
+	if got := newResp.GetPreparationId(); got == jobID {
+		t.Errorf("Prepare() after restart = %v, want a new job ID", got)
+	}
+}
+
+func waitForStoredJob(t *testing.T, dir, jobID string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(dir, jobID, storeRecordFile)); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %v wasn't stored", jobID)
+}
+
+func makeStoreTestJob(id string, state jobpb.JobState_Enum, stateTime time.Time) *Job {
+	j := &Job{
+		key:        id,
+		jobName:    "name-" + id,
+		Pipeline:   &pipepb.Pipeline{},
+		options:    &structpb.Struct{},
+		streamCond: sync.NewCond(&sync.Mutex{}),
+		stateTime:  stateTime,
+	}
+	j.state.Store(state)
+	return j
+}
+
+func TestJobStore_Retention(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		retention Retention
+		ages      map[string]time.Duration // Time since completion of the saved jobs.
+
+		wantEvicted, wantLoaded []string
+	}{
+		{
+			name:       "unbounded",
+			ages:       map[string]time.Duration{"job-001": 3 * time.Hour, "job-002": 2 * time.Hour, "job-003": time.Hour},
+			wantLoaded: []string{"job-001", "job-002", "job-003"},
+		}, {
+			name:        "maxJobs",
+			retention:   Retention{MaxJobs: 2},
+			ages:        map[string]time.Duration{"job-001": 3 * time.Hour, "job-002": 2 * time.Hour, "job-003": time.Hour},
+			wantEvicted: []string{"job-001"},
+			wantLoaded:  []string{"job-002", "job-003"},
+		}, {
+			name:        "maxAge",
+			retention:   Retention{MaxAge: 90 * time.Minute},
+			ages:        map[string]time.Duration{"job-001": 3 * time.Hour, "job-002": 2 * time.Hour, "job-003": time.Hour},
+			wantEvicted: []string{"job-001", "job-002"},
+			wantLoaded:  []string{"job-003"},
+		}, {
+			name:        "maxJobsEvictsEarliestCompleted",
+			retention:   Retention{MaxJobs: 1},
+			ages:        map[string]time.Duration{"job-001": time.Hour, "job-002": 2 * time.Hour},
+			wantEvicted: []string{"job-002"},
+			wantLoaded:  []string{"job-001"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenJobStore(dir, test.retention)
+			if err != nil {
+				t.Fatalf("OpenJobStore() = %v, want nil", err)
+			}
+			// Only evict when the jobs are stored, so age bounds don't evict on save.
+			saving, err := OpenJobStore(dir, Retention{})
+			if err != nil {
+				t.Fatalf("OpenJobStore() = %v, want nil", err)
+			}
+			for id, age := range test.ages {
+				if _, err := saving.save(makeStoreTestJob(id, jobpb.JobState_DONE, now.Add(-age)), nil); err != nil {
+					t.Fatalf("save(%v) = %v, want nil", id, err)
+				}
+			}
+			jobs, err := store.load()
+			if err != nil {
+				t.Fatalf("load() = %v, want nil", err)
+			}
+			var gotLoaded []string
+			for _, j := range jobs {
+				gotLoaded = append(gotLoaded, j.key)
+			}
+			if d := cmp.Diff(test.wantLoaded, gotLoaded); d != "" {
+				t.Errorf("load() (-want, +got):\n%v", d)
+			}
+			for _, id := range test.wantEvicted {
+				if _, err := os.Stat(filepath.Join(dir, id)); !os.IsNotExist(err) {
+					t.Errorf("evicted job %v still stored: %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestJobStore_SaveEvicts(t *testing.T) {
+	store, err := OpenJobStore(t.TempDir(), Retention{MaxJobs: 2})
+	if err != nil {
+		t.Fatalf("OpenJobStore() = %v, want nil", err)
+	}
+	now := time.Now()
+	var gotEvicted []string
+	for i, id := range []string{"job-001", "job-002", "job-003"} {
+		evicted, err := store.save(makeStoreTestJob(id, jobpb.JobState_FAILED, now.Add(time.Duration(i)*time.Second)), nil)
+		if err != nil {
+			t.Fatalf("save(%v) = %v, want nil", id, err)
+		}
+		gotEvicted = append(gotEvicted, evicted...)
+	}
+	if d := cmp.Diff([]string{"job-001"}, gotEvicted); d != "" {
+		t.Errorf("save() evicted (-want, +got):\n%v", d)
+	}
+}
+
+func TestJobStore_Artifacts(t *testing.T) {
+	store, err := OpenJobStore(t.TempDir(), Retention{})
+	if err != nil {
+		t.Fatalf("OpenJobStore() = %v, want nil", err)
+	}
+	payload, want := "artifact/path", []byte("artifact data")
+	if _, err := store.save(makeStoreTestJob("job-001", jobpb.JobState_DONE, time.Now()), map[string][]byte{payload: want}); err != nil {
+		t.Fatalf("save() = %v, want nil", err)
+	}
+	got, ok := store.artifact(payload)
+	if !ok {
+		t.Fatalf("artifact(%q) = not found, want %q", payload, want)
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("artifact(%q) (-want, +got):\n%v", payload, d)
+	}
+	if _, ok := store.artifact("unknown"); ok {
+		t.Errorf("artifact(%q) = found, want not found", "unknown")
+	}
+}
+
+// TestJobStore_Failed validates that failures are restored.
+func TestJobStore_Failed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenJobStore(dir, Retention{})
+	if err != nil {
+		t.Fatalf("OpenJobStore() = %v, want nil", err)
+	}
+	j := makeStoreTestJob("job-001", jobpb.JobState_FAILED, time.Now())
+	j.failureErr = errors.New("bundle failed")
+	if _, err := store.save(j, nil); err != nil {
+		t.Fatalf("save() = %v, want nil", err)
+	}
+	jobs, err := store.load()
+	if err != nil {
+		t.Fatalf("load() = %v, want nil", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("load() = %v jobs, want 1", len(jobs))
+	}
+	got := jobs[0]
+	if got, want := got.state.Load(), jobpb.JobState_FAILED; got != want {
+		t.Errorf("restored state = %v, want %v", got, want)
+	}
+	if got.failureErr == nil || got.failureErr.Error() != "bundle failed" {
+		t.Errorf("restored failure = %v, want %v", got.failureErr, "bundle failed")
+	}
+	if context.Cause(got.RootCtx) == nil {
+		t.Errorf("restored job context isn't done")
+	}
+}
@@ -0,0 +1,136 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"golang.org/x/exp/maps"
+)
+
+// Groups of the pipeline options described by OptionDescriptors.
+const (
+	optionGroup  = "prism"
+	variantGroup = "prism.variant"
+)
+
+// OptionDescriptors describes the pipeline options prism understands, for the
+// Job Management API's DescribePipelineOptions.
+//
+// Handler characteristics aren't set as pipeline options directly, but by the
+// variant selected with the variant_config and variant options. They're described
+// in the "prism.variant" group, named as "<handler>.<characteristic>", with
+// prism's defaults.
+func OptionDescriptors() []*jobpb.PipelineOptionDescriptor {
+	opt := func(name string, typ jobpb.PipelineOptionType_Enum, def, desc string) *jobpb.PipelineOptionDescriptor {
+		return &jobpb.PipelineOptionDescriptor{
+			Name:         name,
+			Type:         typ,
+			Description:  desc,
+			DefaultValue: def,
+			Group:        optionGroup,
+		}
+	}
+	const (
+		str = jobpb.PipelineOptionType_STRING
+		num = jobpb.PipelineOptionType_INTEGER
+	)
+	descs := []*jobpb.PipelineOptionDescriptor{
+		opt("parallelism", num, strconv.Itoa(runtime.NumCPU()),
+			"Number of bundles the ready elements of a stage are partitioned into. Defaults to the number of CPUs."),
+		opt(optPartitionMode, str, "auto",
+			"How the ready elements of a stage are partitioned: auto partitions stateful stages by key and others evenly, key also partitions stages with KV input by key, and none uses a single bundle."),
+		opt(optVariantConfig, str, "",
+			"Path of a YAML file configuring variants of prism's handlers. Set with variant."),
+		opt(optVariant, str, "",
+			"Name of the variant in the variant_config file the job executes with."),
+		opt(optBundleMaxAttempts, num, "1",
+			"Number of times a bundle is attempted, including the first."),
+		opt(optBundleRetryBackoff, str, defaultRetryBackoff.String(),
+			"Delay before the first retry of a bundle, as a Go duration. Doubles with each retry."),
+		opt(optBundleRetryErrors, str, "",
+			"Regular expression matching the SDK failure messages to retry. All failures are retried if unset."),
+		opt(optCheckpointDir, str, "",
+			"Directory snapshots of the job's progress are written under. Jobs aren't checkpointed if unset."),
+		opt(optCheckpointInterval, str, defaultCheckpointInterval.String(),
+			"How often snapshots of the job's progress are taken, as a Go duration."),
+		opt(optResumeJob, str, "",
+			"ID of an earlier job of the same pipeline, whose latest snapshot in checkpoint_dir the job resumes from."),
+		opt(optMemoryBudgetMB, num, "0",
+			"Megabytes of element data the job holds in memory before paging it to disk. 0 always holds data in memory."),
+		opt(optSpillDir, str, "",
+			"Directory element data is paged out to. Defaults to the OS temporary directory."),
+		opt(optElementSamples, num, strconv.Itoa(defaultElementSamples),
+			"Number of recent elements retained for each PCollection produced at a stage boundary, for inspection. 0 disables sampling."),
+		opt(optStatePageBytes, num, strconv.Itoa(defaultStatePageBytes),
+			"Maximum bytes of data in each response to an SDK's state requests. 0 disables paging."),
+		opt(optDrainAfter, str, "",
+			"How long the job runs before it's drained, as a Go duration. Jobs aren't drained if unset."),
+	}
+
+	handlers := maps.Keys(defaultCharacteristics)
+	sort.Strings(handlers)
+	for _, h := range handlers {
+		def := reflect.ValueOf(defaultCharacteristics[h])
+		for i := 0; i < def.NumField(); i++ {
+			f := def.Type().Field(i)
+			descs = append(descs, &jobpb.PipelineOptionDescriptor{
+				Name:         h + "." + strings.ToLower(f.Name),
+				Type:         optionType(f.Type),
+				Description:  fmt.Sprintf("%v characteristic of the %v handler, configured by the job's variant.", f.Name, h),
+				DefaultValue: defaultValue(def.Field(i)),
+				Group:        variantGroup,
+			})
+		}
+	}
+	return descs
+}
+
+// optionType returns the pipeline option type of a characteristic's field type.
+func optionType(t reflect.Type) jobpb.PipelineOptionType_Enum {
+	switch t.Kind() {
+	case reflect.Bool:
+		return jobpb.PipelineOptionType_BOOLEAN
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jobpb.PipelineOptionType_INTEGER
+	case reflect.Float32, reflect.Float64:
+		return jobpb.PipelineOptionType_NUMBER
+	case reflect.Slice, reflect.Array:
+		return jobpb.PipelineOptionType_ARRAY
+	case reflect.Struct, reflect.Map:
+		return jobpb.PipelineOptionType_OBJECT
+	}
+	return jobpb.PipelineOptionType_STRING
+}
+
+// defaultValue returns the default value of a characteristic's field, or "" for
+// empty composite values.
+func defaultValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map:
+		if v.IsZero() || (v.Kind() != reflect.Struct && v.Len() == 0) {
+			return ""
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,58 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestOptionDescriptors(t *testing.T) {
+	got := map[string]*jobpb.PipelineOptionDescriptor{}
+	for _, d := range OptionDescriptors() {
+		if _, ok := got[d.GetName()]; ok {
+			t.Errorf("OptionDescriptors() describes %v more than once", d.GetName())
+		}
+		if d.GetDescription() == "" {
+			t.Errorf("OptionDescriptors() %v has no description", d.GetName())
+		}
+		got[d.GetName()] = d
+	}
+	tests := []struct {
+		name, def, group string
+		typ              jobpb.PipelineOptionType_Enum
+	}{
+		{"parallelism", strconv.Itoa(runtime.NumCPU()), optionGroup, jobpb.PipelineOptionType_INTEGER},
+		{optVariant, "", optionGroup, jobpb.PipelineOptionType_STRING},
+		{optBundleRetryBackoff, "100ms", optionGroup, jobpb.PipelineOptionType_STRING},
+		{optStatePageBytes, "1048576", optionGroup, jobpb.PipelineOptionType_INTEGER},
+		{"combine.enablelifting", "true", variantGroup, jobpb.PipelineOptionType_BOOLEAN},
+		{"runner.sdkgbk", "false", variantGroup, jobpb.PipelineOptionType_BOOLEAN},
+		{"fault.seed", "0", variantGroup, jobpb.PipelineOptionType_INTEGER},
+		{"fault.faults", "", variantGroup, jobpb.PipelineOptionType_ARRAY},
+	}
+	for _, test := range tests {
+		want := &jobpb.PipelineOptionDescriptor{Name: test.name, Type: test.typ, DefaultValue: test.def, Group: test.group}
+		if d := cmp.Diff(want, got[test.name], protocmp.Transform(), protocmp.IgnoreFields(want, "description")); d != "" {
+			t.Errorf("OptionDescriptors() %v diff (-want, +got):\n%v", test.name, d)
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slog"
 	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
 )
 
 // transformPreparer is an interface for handling different urns in the preprocessor
@@ -186,7 +187,7 @@ func (p *preprocessor) preProcessGraph(comps *pipepb.Components) []*stage {
 //
 // If a transform, after a GBK step, has a single input with a KV<K, Iter<X>> coder
 // and a single output O with a KV<K, Iter<Y>> coder, and if then it must be fused with
-// the consumers of O.
+// the consumers of O, unless a consumer requires stable input.
 func defaultFusion(topological []string, comps *pipepb.Components) []*stage {
 	var stages []*stage
 
@@ -220,9 +221,19 @@ func defaultFusion(topological []string, comps *pipepb.Components) []*stage {
 		iCID := comps.GetPcollections()[inputID].GetCoderId()
 		oCID := comps.GetPcollections()[outputID].GetCoderId()
 
-		if checkForExpandCoderPattern(iCID, oCID, comps) {
-			fuseWithConsumers[tid] = outputID
+		if !checkForExpandCoderPattern(iCID, oCID, comps) {
+			continue
+		}
+		// Consumers that require stable input must be in their own stage, so their
+		// input is persisted by the ElementManager, and identical on retries.
+		var consumerIDs []string
+		for _, c := range pcolConsumers[outputID] {
+			consumerIDs = append(consumerIDs, c.transform)
 		}
+		if requiresStableInput(consumerIDs, comps) {
+			continue
+		}
+		fuseWithConsumers[tid] = outputID
 	}
 
 	// Since we iterate in topological order, we're guaranteed to process producers before consumers.
@@ -373,6 +384,8 @@ func prepareStage(stg *stage, comps *pipepb.Components, pipelineConsumers map[st
 	stg.internalCols = internal
 	stg.outputs = maps.Values(outputs)
 	stg.sideInputs = sideInputs
+	stg.stateful = isStateful(stg.transforms, comps)
+	stg.timeSorted = isTimeSorted(stg.transforms, comps)
 
 	defer func() {
 		if e := recover(); e != nil {
@@ -391,3 +404,46 @@ func prepareStage(stg *stage, comps *pipepb.Components, pipelineConsumers map[st
 		}
 	}
 }
+
+// isStateful returns whether any of the given transforms is a ParDo that
+// uses user state or timers.
+func isStateful(tids []string, comps *pipepb.Components) bool {
+	return anyParDo(tids, comps, func(pdo *pipepb.ParDoPayload) bool {
+		return len(pdo.GetStateSpecs())+len(pdo.GetTimerFamilySpecs()) > 0
+	})
+}
+
+// isTimeSorted returns whether any of the given transforms is a ParDo that
+// requires its input to be sorted by timestamp.
+func isTimeSorted(tids []string, comps *pipepb.Components) bool {
+	return anyParDo(tids, comps, func(pdo *pipepb.ParDoPayload) bool {
+		return pdo.GetRequiresTimeSortedInput()
+	})
+}
+
+// requiresStableInput returns whether any of the given transforms is a ParDo
+// that requires stable input.
+func requiresStableInput(tids []string, comps *pipepb.Components) bool {
+	return anyParDo(tids, comps, func(pdo *pipepb.ParDoPayload) bool {
+		return pdo.GetRequiresStableInput()
+	})
+}
+
+// anyParDo returns whether any of the given transforms is a ParDo with a
+// payload that satisfies the predicate.
+func anyParDo(tids []string, comps *pipepb.Components, pred func(*pipepb.ParDoPayload) bool) bool {
+	for _, tid := range tids {
+		t := comps.GetTransforms()[tid]
+		if t.GetSpec().GetUrn() != urns.TransformParDo {
+			continue
+		}
+		pdo := &pipepb.ParDoPayload{}
+		if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pdo); err != nil {
+			panic(fmt.Sprintf("unable to decode ParDoPayload for transform[%v]", t.GetUniqueName()))
+		}
+		if pred(pdo) {
+			return true
+		}
+	}
+	return false
+}
@@ -19,8 +19,10 @@ import (
 	"testing"
 
 	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 )
 
@@ -139,6 +141,69 @@ func Test_preprocessor_preProcessGraph(t *testing.T) {
 	}
 }
 
+func Test_defaultFusion_RequiresStableInput(t *testing.T) {
+	// Builds GBK -> expand -> consumer, where expand has the Go SDK's
+	// KV<K, Iter<V>> expansion pattern, and so is normally fused with its consumer.
+	comps := func(stable bool) *pipepb.Components {
+		payload, err := proto.Marshal(&pipepb.ParDoPayload{RequiresStableInput: stable})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pipepb.Components{
+			Transforms: map[string]*pipepb.PTransform{
+				"gbk": {
+					UniqueName: "gbk",
+					Spec:       &pipepb.FunctionSpec{Urn: urns.TransformGBK},
+					Outputs:    map[string]string{"o0": "grouped"},
+				},
+				"expand": {
+					UniqueName:    "expand",
+					Spec:          &pipepb.FunctionSpec{Urn: urns.TransformParDo},
+					Inputs:        map[string]string{"i0": "grouped"},
+					Outputs:       map[string]string{"o0": "expanded"},
+					EnvironmentId: "env1",
+				},
+				"consumer": {
+					UniqueName:    "consumer",
+					Spec:          &pipepb.FunctionSpec{Urn: urns.TransformParDo, Payload: payload},
+					Inputs:        map[string]string{"i0": "expanded"},
+					EnvironmentId: "env1",
+				},
+			},
+			Pcollections: map[string]*pipepb.PCollection{
+				"grouped":  {UniqueName: "grouped", CoderId: "kvIter"},
+				"expanded": {UniqueName: "expanded", CoderId: "kvIter"},
+			},
+			Coders: map[string]*pipepb.Coder{
+				"kvIter": {Spec: &pipepb.FunctionSpec{Urn: urns.CoderKV}, ComponentCoderIds: []string{"key", "iter"}},
+				"iter":   {Spec: &pipepb.FunctionSpec{Urn: urns.CoderIterable}, ComponentCoderIds: []string{"value"}},
+				"key":    {Spec: &pipepb.FunctionSpec{Urn: urns.CoderBytes}},
+				"value":  {Spec: &pipepb.FunctionSpec{Urn: urns.CoderBytes}},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		stable bool
+		want   [][]string
+	}{
+		{"fused", false, [][]string{{"gbk"}, {"expand", "consumer"}}},
+		{"stableInput", true, [][]string{{"gbk"}, {"expand"}, {"consumer"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stages := defaultFusion([]string{"gbk", "expand", "consumer"}, comps(test.stable))
+			var got [][]string
+			for _, stg := range stages {
+				got = append(got, stg.transforms)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("defaultFusion() stage transforms diff (-want,+got)\n%v", diff)
+			}
+		})
+	}
+}
+
 type testPreparer struct{}
 
 func (p *testPreparer) PrepareUrns() []string {
@@ -0,0 +1,147 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub emulates Google Cloud Pub/Sub in process, so pipelines
+// reading and writing with pubsubio may be executed and tested on Prism,
+// without access to the cloud.
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/pstest"
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Emulator is an in process Pub/Sub service, with topics, subscriptions,
+// and message attributes.
+//
+// The emulator serves the Pub/Sub gRPC API on its address, so test code may
+// publish to and read from topics with an ordinary Pub/Sub client, such as
+// by setting PUBSUB_EMULATOR_HOST to the address.
+type Emulator struct {
+	srv *pstest.Server
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   *Emulator
+)
+
+// Start starts the process' shared emulator on the given port, or on any
+// available port if 0. If the shared emulator is already running, it's
+// returned regardless of the port.
+func Start(port int) (emu *Emulator, err error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared != nil {
+		return shared, nil
+	}
+	// The fake server panics if it's unable to listen on the port.
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("unable to start Pub/Sub emulator on port %v: %v", port, e)
+		}
+	}()
+	shared = &Emulator{srv: pstest.NewServerWithPort(port)}
+	slog.Info("Pub/Sub emulator started", slog.String("endpoint", shared.Addr()))
+	return shared, nil
+}
+
+// Addr returns the host:port the emulator serves the Pub/Sub API on.
+func (e *Emulator) Addr() string {
+	return e.srv.Addr
+}
+
+// EnsureTopic creates the topic, if it doesn't already exist.
+// Topics are fully qualified, as in "projects/<project>/topics/<topic>".
+func (e *Emulator) EnsureTopic(ctx context.Context, topic string) error {
+	_, err := e.srv.GServer.CreateTopic(ctx, &pubsubpb.Topic{Name: topic})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+// EnsureSubscription creates the subscription to the topic, if it doesn't
+// already exist, creating the topic as well if necessary. Subscriptions only
+// receive messages published after they are created.
+func (e *Emulator) EnsureSubscription(ctx context.Context, sub, topic string) error {
+	if err := e.EnsureTopic(ctx, topic); err != nil {
+		return err
+	}
+	_, err := e.srv.GServer.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:               sub,
+		Topic:              topic,
+		AckDeadlineSeconds: 60,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+// DeleteSubscription deletes the subscription.
+func (e *Emulator) DeleteSubscription(ctx context.Context, sub string) error {
+	_, err := e.srv.GServer.DeleteSubscription(ctx, &pubsubpb.DeleteSubscriptionRequest{Subscription: sub})
+	return err
+}
+
+// Publish publishes the messages to the topic, and returns their message IDs.
+// The emulator assigns the message IDs and publish times of the messages.
+func (e *Emulator) Publish(ctx context.Context, topic string, msgs []*pubsubpb.PubsubMessage) ([]string, error) {
+	resp, err := e.srv.GServer.Publish(ctx, &pubsubpb.PublishRequest{Topic: topic, Messages: msgs})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetMessageIds(), nil
+}
+
+// Pull returns up to max outstanding messages of the subscription, ordered by
+// their publish times. It returns immediately if there are no messages.
+//
+// Pulled messages must be acknowledged with Ack, or they are delivered again
+// once their acknowledgement deadline expires.
+func (e *Emulator) Pull(ctx context.Context, sub string, max int) ([]*pubsubpb.ReceivedMessage, error) {
+	resp, err := e.srv.GServer.Pull(ctx, &pubsubpb.PullRequest{
+		Subscription:      sub,
+		MaxMessages:       int32(max),
+		ReturnImmediately: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msgs := resp.GetReceivedMessages()
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].GetMessage().GetPublishTime().AsTime().Before(msgs[j].GetMessage().GetPublishTime().AsTime())
+	})
+	return msgs, nil
+}
+
+// Ack acknowledges the pulled messages of the subscription, so they aren't
+// delivered again.
+func (e *Emulator) Ack(ctx context.Context, sub string, ackIDs []string) error {
+	if len(ackIDs) == 0 {
+		return nil
+	}
+	_, err := e.srv.GServer.Acknowledge(ctx, &pubsubpb.AcknowledgeRequest{Subscription: sub, AckIds: ackIDs})
+	return err
+}
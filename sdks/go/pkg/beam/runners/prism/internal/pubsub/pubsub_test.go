@@ -0,0 +1,88 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestEmulator(t *testing.T) {
+	ctx := context.Background()
+	emu, err := Start(0)
+	if err != nil {
+		t.Fatalf("Start(0) = %v", err)
+	}
+	if again, err := Start(0); err != nil || again != emu {
+		t.Errorf("Start(0) again = %v, %v, want the shared emulator", again, err)
+	}
+
+	const topic, sub = "projects/p/topics/emulator", "projects/p/subscriptions/emulator"
+	// Subscriptions create their topic, and may be ensured repeatedly.
+	for i := 0; i < 2; i++ {
+		if err := emu.EnsureSubscription(ctx, sub, topic); err != nil {
+			t.Fatalf("EnsureSubscription(%v, %v) = %v", sub, topic, err)
+		}
+	}
+	if err := emu.EnsureTopic(ctx, topic); err != nil {
+		t.Fatalf("EnsureTopic(%v) = %v", topic, err)
+	}
+
+	published := []*pubsubpb.PubsubMessage{
+		{Data: []byte("a"), Attributes: map[string]string{"k": "1"}},
+		{Data: []byte("b")},
+	}
+	ids, err := emu.Publish(ctx, topic, published)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Publish(%v) = %v, %v, want 2 message IDs", topic, ids, err)
+	}
+
+	got, err := emu.Pull(ctx, sub, 10)
+	if err != nil {
+		t.Fatalf("Pull(%v) = %v", sub, err)
+	}
+	var msgs []*pubsubpb.PubsubMessage
+	var ackIDs []string
+	for _, rm := range got {
+		msgs = append(msgs, rm.GetMessage())
+		ackIDs = append(ackIDs, rm.GetAckId())
+	}
+	want := []*pubsubpb.PubsubMessage{
+		{Data: []byte("a"), Attributes: map[string]string{"k": "1"}, MessageId: ids[0]},
+		{Data: []byte("b"), MessageId: ids[1]},
+	}
+	if d := cmp.Diff(want, msgs, protocmp.Transform(), protocmp.IgnoreFields(&pubsubpb.PubsubMessage{}, "publish_time")); d != "" {
+		t.Errorf("Pull(%v) diff (-want, +got):\n%v", sub, d)
+	}
+	if err := emu.Ack(ctx, sub, ackIDs); err != nil {
+		t.Fatalf("Ack(%v) = %v", sub, err)
+	}
+
+	// Acknowledged messages aren't delivered again.
+	if got, err := emu.Pull(ctx, sub, 10); err != nil || len(got) != 0 {
+		t.Errorf("Pull(%v) after Ack = %v, %v, want no messages", sub, got, err)
+	}
+	if err := emu.DeleteSubscription(ctx, sub); err != nil {
+		t.Fatalf("DeleteSubscription(%v) = %v", sub, err)
+	}
+	if _, err := emu.Pull(ctx, sub, 10); err == nil {
+		t.Errorf("Pull(%v) after DeleteSubscription = nil, want error", sub)
+	}
+}
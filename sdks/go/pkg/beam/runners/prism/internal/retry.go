@@ -0,0 +1,135 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Pipeline options that configure bundle retries.
+const (
+	// optBundleMaxAttempts is the number of times a bundle is attempted,
+	// including the first. Bundles aren't retried by default.
+	optBundleMaxAttempts = "bundle_max_attempts"
+	// optBundleRetryBackoff is the delay before the first retry of a bundle,
+	// as a Go duration string. The delay doubles with each subsequent retry.
+	optBundleRetryBackoff = "bundle_retry_backoff"
+	// optBundleRetryErrors is a regular expression matching the SDK failure
+	// messages to retry. By default, all SDK bundle failures are retried.
+	optBundleRetryErrors = "bundle_retry_errors"
+)
+
+const (
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = time.Minute
+)
+
+// retryPolicy determines whether, and when, failed bundles are retried.
+//
+// Only failures reported by the SDK are retried. Failures of the runner,
+// cancellations, and lost workers always fail the job. Bundles of killed
+// workers are retried outside the policy, once the worker is restarted.
+type retryPolicy struct {
+	MaxAttempts int            // Total attempts for a bundle, including the first. 1 or less disables retries.
+	Backoff     time.Duration  // Delay before the first retry, doubling for each subsequent retry.
+	Retryable   *regexp.Regexp // Matches retryable SDK failure messages. Nil matches all failures.
+}
+
+// jobRetryPolicy returns the retry policy configured by the job's pipeline options.
+func jobRetryPolicy(j *jobservices.Job) (retryPolicy, error) {
+	p := retryPolicy{MaxAttempts: 1, Backoff: defaultRetryBackoff}
+	opts := j.PipelineOptions()
+	if v, ok := jobOption(opts, optBundleMaxAttempts); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v pipeline option %q: %w", optBundleMaxAttempts, v, err)
+		}
+		p.MaxAttempts = n
+	}
+	if v, ok := jobOption(opts, optBundleRetryBackoff); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v pipeline option %q: %w", optBundleRetryBackoff, v, err)
+		}
+		p.Backoff = d
+	}
+	if v, ok := jobOption(opts, optBundleRetryErrors); ok {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %v pipeline option %q: %w", optBundleRetryErrors, v, err)
+		}
+		p.Retryable = re
+	}
+	return p, nil
+}
+
+// shouldRetry returns whether a bundle that failed the given attempt with the
+// given error should be retried, and how long to wait before doing so.
+// Attempts start at 1.
+func (p retryPolicy) shouldRetry(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	var bErr *worker.BundleError
+	if !errors.As(err, &bErr) {
+		return 0, false
+	}
+	if p.Retryable != nil && !p.Retryable.MatchString(bErr.Msg) {
+		return 0, false
+	}
+	backoff := p.Backoff
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff, true
+}
+
+// jobOption returns the named pipeline option as a string, if it's set.
+//
+// Options are looked up by their portable form, beam:option:<name>:v1, and
+// then among Go SDK options, which are nested within the Go options.
+// Empty values are treated as unset.
+func jobOption(opts *structpb.Struct, name string) (string, bool) {
+	v, ok := opts.GetFields()["beam:option:"+name+":v1"]
+	if !ok {
+		goOpts := opts.GetFields()["beam:option:go_options:v1"].GetStructValue()
+		v, ok = goOpts.GetFields()["options"].GetStructValue().GetFields()[name]
+	}
+	if !ok {
+		return "", false
+	}
+	var s string
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		s = k.StringValue
+	case *structpb.Value_NumberValue:
+		s = strconv.FormatFloat(k.NumberValue, 'f', -1, 64)
+	case *structpb.Value_BoolValue:
+		s = strconv.FormatBool(k.BoolValue)
+	}
+	return s, s != ""
+}
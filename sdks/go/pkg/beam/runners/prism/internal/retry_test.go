@@ -0,0 +1,89 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRetryPolicy_shouldRetry(t *testing.T) {
+	sdkErr := fmt.Errorf("stage failed: %w", &worker.BundleError{InstID: "inst001", PBDID: "stage-001", Msg: "DEADLINE_EXCEEDED: timeout"})
+	policy := retryPolicy{MaxAttempts: 4, Backoff: time.Second}
+
+	tests := []struct {
+		name        string
+		policy      retryPolicy
+		attempt     int
+		err         error
+		wantBackoff time.Duration
+		wantRetry   bool
+	}{
+		{"default", retryPolicy{MaxAttempts: 1, Backoff: time.Second}, 1, sdkErr, 0, false},
+		{"first", policy, 1, sdkErr, time.Second, true},
+		{"doubled", policy, 3, sdkErr, 4 * time.Second, true},
+		{"exhausted", policy, 4, sdkErr, 0, false},
+		{"capped", retryPolicy{MaxAttempts: 100, Backoff: time.Second}, 90, sdkErr, maxRetryBackoff, true},
+		{"runnerError", policy, 1, context.Canceled, 0, false},
+		{"retryable", retryPolicy{MaxAttempts: 2, Backoff: time.Second, Retryable: regexp.MustCompile("DEADLINE_EXCEEDED")}, 1, sdkErr, time.Second, true},
+		{"notRetryable", retryPolicy{MaxAttempts: 2, Backoff: time.Second, Retryable: regexp.MustCompile("^INTERNAL")}, 1, sdkErr, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backoff, retry := test.policy.shouldRetry(test.attempt, test.err)
+			if backoff != test.wantBackoff || retry != test.wantRetry {
+				t.Errorf("shouldRetry(%v, %v) = %v, %v; want %v, %v", test.attempt, test.err, backoff, retry, test.wantBackoff, test.wantRetry)
+			}
+		})
+	}
+}
+
+func TestJobOption(t *testing.T) {
+	opts, err := structpb.NewStruct(map[string]any{
+		"beam:option:bundle_max_attempts:v1": 3,
+		"beam:option:empty:v1":               "",
+		"beam:option:go_options:v1": map[string]any{
+			"options": map[string]any{
+				"bundle_retry_backoff": "5ms",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"bundle_max_attempts", "3", true},
+		{"bundle_retry_backoff", "5ms", true},
+		{"empty", "", false},
+		{"unset", "", false},
+	}
+	for _, test := range tests {
+		got, ok := jobOption(opts, test.name)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("jobOption(%q) = %q, %v; want %q, %v", test.name, got, ok, test.want, test.wantOK)
+		}
+	}
+}
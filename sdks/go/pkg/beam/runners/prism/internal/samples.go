@@ -0,0 +1,118 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+)
+
+// optElementSamples is the pipeline option for the number of recent elements
+// retained for each PCollection, for inspection. 0 disables sampling.
+//
+// Elements are sampled as the runner receives them, so only PCollections
+// produced at the boundaries of stages are sampled. PCollections internal to
+// fused stages never leave the SDK, and the Go SDK doesn't support the FnAPI's
+// data sampling, so they have no samples.
+const optElementSamples = "element_samples"
+
+// defaultElementSamples disables sampling, since retaining copies of elements
+// costs memory that jobs don't otherwise use.
+const defaultElementSamples = 0
+
+// jobSampleSize returns the number of elements to sample per PCollection,
+// from the job's pipeline options.
+func jobSampleSize(j *jobservices.Job) (int, error) {
+	v, ok := jobOption(j.PipelineOptions(), optElementSamples)
+	if !ok {
+		return defaultElementSamples, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %v pipeline option %q: must be a non-negative integer", optElementSamples, v)
+	}
+	return n, nil
+}
+
+// elementSamples returns a function that decodes the ElementManager's samples
+// into readable form, using the coders of the PCollections in the components.
+func elementSamples(em *engine.ElementManager, comps *pipepb.Components) func() map[string][]jobservices.ElementSample {
+	return func() map[string][]jobservices.ElementSample {
+		coders := map[string]*pipepb.Coder{}
+		ret := map[string][]jobservices.ElementSample{}
+		for pcol, samples := range em.ElementSamples() {
+			format := elementFormatter(nil, coders) // Renders elements as opaque bytes.
+			if col, ok := comps.GetPcollections()[pcol]; ok {
+				if cID, err := lpUnknownCoders(col.GetCoderId(), coders, comps.GetCoders()); err == nil {
+					format = elementFormatter(coders[cID], coders)
+				}
+			}
+			for _, s := range samples {
+				ret[pcol] = append(ret[pcol], jobservices.ElementSample{
+					Element:   formatSample(format, s.Element),
+					Window:    fmt.Sprint(s.Window),
+					Timestamp: s.Timestamp.String(),
+					Pane:      formatPane(s.Pane),
+				})
+			}
+		}
+		return ret
+	}
+}
+
+// formatSample decodes a sampled element, falling back to its bytes if it can't be decoded.
+func formatSample(format func(io.Reader) (string, error), b []byte) (ret string) {
+	defer func() {
+		if e := recover(); e != nil {
+			ret = fmt.Sprintf("undecodable element 0x%x: %v", b, e)
+		}
+	}()
+	s, err := format(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Sprintf("undecodable element 0x%x: %v", b, err)
+	}
+	return s
+}
+
+func formatPane(p typex.PaneInfo) string {
+	var timing string
+	switch p.Timing {
+	case typex.PaneEarly:
+		timing = "EARLY"
+	case typex.PaneOnTime:
+		timing = "ON_TIME"
+	case typex.PaneLate:
+		timing = "LATE"
+	default:
+		timing = "UNKNOWN"
+	}
+	parts := []string{timing, "index " + strconv.FormatInt(p.Index, 10)}
+	if p.IsFirst {
+		parts = append(parts, "first")
+	}
+	if p.IsLast {
+		parts = append(parts, "last")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,53 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestElementSamples(t *testing.T) {
+	comps := &pipepb.Components{
+		Pcollections: map[string]*pipepb.PCollection{
+			"impulse.out": {UniqueName: "Impulse.out", CoderId: "bytes"},
+		},
+		Coders: map[string]*pipepb.Coder{
+			"bytes": {Spec: &pipepb.FunctionSpec{Urn: urns.CoderBytes}},
+		},
+	}
+	em := engine.NewElementManager(engine.Config{SampleSize: 5})
+	em.AddStage("impulse", nil, nil, []string{"impulse.out"})
+	em.Impulse("impulse")
+
+	got := elementSamples(em, comps)()
+	want := map[string][]jobservices.ElementSample{
+		"impulse.out": {{
+			Element:   `""`,
+			Window:    "[*]",
+			Timestamp: "-inf",
+			Pane:      "UNKNOWN, index 0, first, last",
+		}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("elementSamples() (-want, +got):\n%v", d)
+	}
+}
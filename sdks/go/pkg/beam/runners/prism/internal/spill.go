@@ -0,0 +1,49 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+)
+
+// Pipeline options that configure paging buffered data out to disk.
+const (
+	// optMemoryBudgetMB is the estimated megabytes of pending elements and side input
+	// data a job holds in memory, before paging them out to disk. Unset or 0 means
+	// data is always held in memory.
+	optMemoryBudgetMB = "memory_budget_mb"
+	// optSpillDir is the directory data is paged out to. Defaults to the OS temporary directory.
+	optSpillDir = "spill_dir"
+)
+
+// jobMemoryBudget returns the memory budget in bytes, and the spill directory,
+// configured by the job's pipeline options.
+func jobMemoryBudget(j *jobservices.Job) (int64, string, error) {
+	opts := j.PipelineOptions()
+	dir, _ := jobOption(opts, optSpillDir)
+	v, ok := jobOption(opts, optMemoryBudgetMB)
+	if !ok {
+		return 0, dir, nil
+	}
+	mb, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || mb < 0 {
+		return 0, dir, fmt.Errorf("invalid %v pipeline option %q: must be a non-negative integer", optMemoryBudgetMB, v)
+	}
+	return mb << 20, dir, nil
+}
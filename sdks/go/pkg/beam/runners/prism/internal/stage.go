@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
@@ -63,13 +64,21 @@ type stage struct {
 	sideInputs   []link   // Non-parallel input PCollections and their consumers
 	internalCols []string // PCollections that escape. Used for precise coder sending.
 	envID        string
-
-	exe              transformExecuter
-	inputTransformID string
-	inputInfo        engine.PColInfo
-	desc             *fnpb.ProcessBundleDescriptor
-	sides            []string
-	prepareSides     func(b *worker.B, tid string, watermark mtime.Time)
+	stateful     bool // Whether the stage uses user state or timers, and must be processed by key.
+	timeSorted   bool // Whether the stage requires its input sorted by timestamp.
+
+	exe                  transformExecuter
+	inputTransformID     string
+	inputInfo            engine.PColInfo
+	keyDec               func(io.Reader) []byte // Extracts keys from primary input elements, if they're KV coded.
+	hasTimers            []engine.LinkID        // Transform and timer family pairs, sorted by transform.
+	processingTimeTimers map[engine.LinkID]bool // Timer families in the processing time domain.
+	expirationTimers     []engine.LinkID        // Timer families fired when a key's window expires, for OnWindowExpiration.
+	desc                 *fnpb.ProcessBundleDescriptor
+	drainDesc            *fnpb.ProcessBundleDescriptor // Truncates restrictions before processing, for splittable DoFn stages.
+	sides                []string
+	prepareSides         func(b *worker.B, tid string, watermark mtime.Time) error
+	faults               *stageFaults // Faults injected into the stage's bundles, for resilience testing.
 
 	SinkToPCollection map[string]string
 	OutputsToCoders   map[string]engine.PColInfo
@@ -79,6 +88,7 @@ func (s *stage) Execute(ctx context.Context, j *jobservices.Job, wk *worker.W, d
 	slog.Debug("Execute: starting bundle", "bundle", rb)
 
 	var b *worker.B
+	bf := s.faults.forBundle()
 	inputData := em.InputForBundle(rb, s.inputInfo)
 	var dataReady <-chan struct{}
 	switch s.envID {
@@ -90,6 +100,7 @@ func (s *stage) Execute(ctx context.Context, j *jobservices.Job, wk *worker.W, d
 		// Runner transforms are processed immeadiately.
 		b = s.exe.ExecuteTransform(s.ID, tid, comps.GetTransforms()[tid], comps, rb.Watermark, inputData)
 		b.InstID = rb.BundleID
+		b.OutputData.Track(em.Spiller())
 		slog.Debug("Execute: runner transform", "bundle", rb, slog.String("tid", tid))
 
 		// Do some accounting for the fake bundle.
@@ -99,34 +110,77 @@ func (s *stage) Execute(ctx context.Context, j *jobservices.Job, wk *worker.W, d
 		close(closed)
 		dataReady = closed
 	case wk.Env:
+		pbdID := s.ID
+		if rb.Draining && s.drainDesc != nil {
+			pbdID = s.drainDesc.GetId()
+		}
 		b = &worker.B{
-			PBDID:  s.ID,
+			PBDID:  pbdID,
 			InstID: rb.BundleID,
 
 			InputTransformID: s.inputTransformID,
 
-			// TODO Here's where we can split data for processing in multiple bundles.
 			InputData: inputData,
+			DataDelay: bf.dataDelay,
+
+			HasTimers:   s.hasTimers,
+			InputTimers: em.TimersForBundle(rb, s.inputInfo),
 
 			SinkToPCollection: s.SinkToPCollection,
-			OutputCount:       len(s.outputs),
+			// The SDK closes each timer family's output, in addition to data outputs.
+			OutputCount: len(s.outputs) + len(s.hasTimers),
+
+			// Any committed user state is the basis for the bundle's tentative state.
+			OutputData: em.StateForBundle(rb),
 		}
 		b.Init()
 
-		s.prepareSides(b, s.transforms[0], rb.Watermark)
+		if err := s.prepareSides(b, s.transforms[0], rb.Watermark); err != nil {
+			// Side input data that can't be read won't be readable on a retry, so
+			// this fails the job.
+			return fmt.Errorf("unable to prepare side inputs for bundle %v of %v: %w", rb.BundleID, rb.StageID, err)
+		}
 
 		slog.Debug("Execute: processing", "bundle", rb)
 		defer b.Cleanup(wk)
 		dataReady = b.ProcessOn(ctx, wk)
+		if bf.kill {
+			j.SendMsg(fmt.Sprintf("injected fault: killing %v during bundle %v of %v", wk, rb.BundleID, rb.StageID))
+			wk.Kill()
+		} else if bf.splitFraction > 0 {
+			before := len(b.InputData)
+			split, err := s.split(ctx, wk, em, b, rb, bf.splitFraction)
+			switch {
+			case err != nil:
+				j.SendMsg(fmt.Sprintf("injected fault: split of bundle %v of %v at %v failed: %v", rb.BundleID, rb.StageID, bf.splitFraction, err))
+			case split:
+				j.SendMsg(fmt.Sprintf("injected fault: split bundle %v of %v at %v, with %v of %v input elements in the residual", rb.BundleID, rb.StageID, bf.splitFraction, before-len(b.InputData), before))
+			default:
+				j.SendMsg(fmt.Sprintf("injected fault: SDK declined to split bundle %v of %v at %v", rb.BundleID, rb.StageID, bf.splitFraction))
+			}
+		}
 	default:
 		err := fmt.Errorf("unknown environment[%v]", s.envID)
 		slog.Error("Execute", "error", err)
 		panic(err)
 	}
+	// The bundle's output counts against the job's memory budget until it's
+	// persisted, or the bundle fails.
+	defer b.OutputData.Release()
 
 	// Progress + split loop.
 	previousIndex := int64(-2)
 	var splitsDone bool
+	var resp *fnpb.ProcessBundleResponse
+	var responded bool
+	// Bundles without outputs have their data ready as soon as they start,
+	// so they report progress until the SDK responds instead. They're only
+	// split to checkpoint them when the job drains.
+	var respReady <-chan *fnpb.ProcessBundleResponse
+	if b.OutputCount == 0 {
+		dataReady, respReady = nil, b.Resp
+		splitsDone = true
+	}
 	progTick := time.NewTicker(100 * time.Millisecond)
 progress:
 	for {
@@ -134,6 +188,10 @@ progress:
 		case <-dataReady:
 			progTick.Stop()
 			break progress // exit progress loop on close.
+		case resp = <-respReady:
+			progTick.Stop()
+			responded = true
+			break progress
 		case <-progTick.C:
 			resp, err := b.Progress(ctx, wk)
 			if err != nil {
@@ -146,39 +204,28 @@ progress:
 				j.AddMetricShortIDs(md)
 			}
 			slog.Debug("progress report", "bundle", rb, "index", index)
+			// Splittable DoFn bundles started before a drain checkpoint immediately,
+			// so their remaining work is truncated in a later bundle. Truncated
+			// bundles aren't split, since their residuals would be truncated again.
+			drainCheckpoint := s.drainDesc != nil && !rb.Draining && em.Draining()
+			truncated := s.drainDesc != nil && rb.Draining
 			// Progress for the bundle hasn't advanced. Try splitting.
-			if previousIndex == index && !splitsDone {
-				sr, err := b.Split(ctx, wk, 0.5 /* fraction of remainder */, nil /* allowed splits */)
+			// Drain checkpoints are retried, even if the SDK declined earlier splits.
+			if ((previousIndex == index && !splitsDone) || drainCheckpoint) && !truncated {
+				fraction := 0.5 // fraction of remainder
+				if drainCheckpoint {
+					fraction = 0
+				}
+				split, err := s.split(ctx, wk, em, b, rb, fraction)
 				if err != nil {
 					slog.Warn("SDK Error from split, aborting splits", "bundle", rb, "error", err.Error())
 					break progress
 				}
-				if sr.GetChannelSplits() == nil {
+				if !split {
 					slog.Debug("SDK returned no splits", "bundle", rb)
 					splitsDone = true
 					continue progress
 				}
-				// TODO sort out rescheduling primary Roots on bundle failure.
-				var residualData [][]byte
-				for _, rr := range sr.GetResidualRoots() {
-					ba := rr.GetApplication()
-					residualData = append(residualData, ba.GetElement())
-					if len(ba.GetElement()) == 0 {
-						slog.LogAttrs(context.TODO(), slog.LevelError, "returned empty residual application", slog.Any("bundle", rb))
-						panic("sdk returned empty residual application")
-					}
-					// TODO what happens to output watermarks on splits?
-				}
-				if len(sr.GetChannelSplits()) != 1 {
-					slog.Warn("received non-single channel split", "bundle", rb)
-				}
-				cs := sr.GetChannelSplits()[0]
-				fr := cs.GetFirstResidualElement()
-				// The first residual can be after the end of data, so filter out those cases.
-				if len(b.InputData) >= int(fr) {
-					b.InputData = b.InputData[:int(fr)]
-					em.ReturnResiduals(rb, int(fr), s.inputInfo, residualData)
-				}
 			} else {
 				previousIndex = index
 			}
@@ -187,14 +234,20 @@ progress:
 	// Tentative Data is ready, commit it to the main datastore.
 	slog.Debug("Execute: commiting data", "bundle", rb, slog.Any("outputsWithData", maps.Keys(b.OutputData.Raw)), slog.Any("outputs", maps.Keys(s.OutputsToCoders)))
 
-	var resp *fnpb.ProcessBundleResponse
-	select {
-	case resp = <-b.Resp:
-		if b.BundleErr != nil {
-			return b.BundleErr
+	if !responded {
+		select {
+		case resp = <-b.Resp:
+		case <-ctx.Done():
+			return context.Cause(ctx)
 		}
-	case <-ctx.Done():
-		return context.Cause(ctx)
+	}
+	if b.BundleErr != nil {
+		return b.BundleErr
+	}
+	if bf.fail {
+		// Fail the bundle as though the SDK had, so it's subject to the job's retry policy.
+		j.SendMsg(fmt.Sprintf("injected fault: failing bundle %v of %v", rb.BundleID, rb.StageID))
+		return &worker.BundleError{InstID: rb.BundleID, PBDID: s.ID, Msg: "injected fault"}
 	}
 
 	// Tally metrics immeadiately so they're available before
@@ -230,10 +283,61 @@ progress:
 		slog.Debug("returned empty residual application", "bundle", rb, slog.Int("numResiduals", l), slog.String("pcollection", s.primaryInput))
 	}
 	em.PersistBundle(rb, s.OutputsToCoders, b.OutputData, s.inputInfo, residualData, minOutputWatermark)
+	b.OutputData.Release()
 	b.OutputData = engine.TentativeData{} // Clear the data.
+
+	// The bundle's output is now durably committed, so the SDK may finalize it.
+	// Finalization is best effort, since the output can't be retracted, so
+	// failures are reported to the job rather than failing it.
+	if resp.GetRequiresFinalization() {
+		if _, err := b.Finalize(ctx, wk); err != nil {
+			slog.Warn("bundle finalization failed", slog.Any("bundle", rb), slog.Any("error", err))
+			j.SendMsg(fmt.Sprintf("finalization of bundle %v of %v failed: %v", rb.BundleID, rb.StageID, err))
+		}
+	}
 	return nil
 }
 
+// split requests the SDK split the bundle at the fraction of its remainder, and
+// returns the residual elements to the ElementManager. Returns false if the SDK
+// didn't split the bundle.
+func (s *stage) split(ctx context.Context, wk *worker.W, em *engine.ElementManager, b *worker.B, rb engine.RunBundle, fraction float64) (bool, error) {
+	sr, err := b.Split(ctx, wk, fraction, nil /* allowed splits */)
+	if err != nil {
+		return false, err
+	}
+	if sr.GetChannelSplits() == nil {
+		return false, nil
+	}
+	// Primary roots replace the elements split within the bundle, so a retry
+	// of the bundle doesn't repeat the residual's work.
+	var primaryData [][]byte
+	for _, pr := range sr.GetPrimaryRoots() {
+		primaryData = append(primaryData, pr.GetElement())
+	}
+	var residualData [][]byte
+	for _, rr := range sr.GetResidualRoots() {
+		ba := rr.GetApplication()
+		residualData = append(residualData, ba.GetElement())
+		if len(ba.GetElement()) == 0 {
+			slog.LogAttrs(context.TODO(), slog.LevelError, "returned empty residual application", slog.Any("bundle", rb))
+			panic("sdk returned empty residual application")
+		}
+		// TODO what happens to output watermarks on splits?
+	}
+	if len(sr.GetChannelSplits()) != 1 {
+		slog.Warn("received non-single channel split", "bundle", rb)
+	}
+	cs := sr.GetChannelSplits()[0]
+	fr := cs.GetFirstResidualElement()
+	// The first residual can be after the end of data, so filter out those cases.
+	if len(b.InputData) >= int(fr) {
+		b.InputData = b.InputData[:int(fr)]
+		em.ReturnResiduals(rb, int(cs.GetLastPrimaryElement()), int(fr), s.inputInfo, primaryData, residualData)
+	}
+	return true, nil
+}
+
 func getSideInputs(t *pipepb.PTransform) (map[string]*pipepb.SideInput, error) {
 	if t.GetSpec().GetUrn() != urns.TransformParDo {
 		return nil, nil
@@ -304,7 +408,7 @@ func buildDescriptor(stg *stage, comps *pipepb.Components, wk *worker.W, ds *wor
 
 	// Then lets do Side Inputs, since they are also uniform.
 	var sides []string
-	var prepareSides []func(b *worker.B, watermark mtime.Time)
+	var prepareSides []func(b *worker.B, watermark mtime.Time) error
 	for _, si := range stg.sideInputs {
 		col := comps.GetPcollections()[si.global]
 		oCID := col.GetCoderId()
@@ -355,6 +459,21 @@ func buildDescriptor(stg *stage, comps *pipepb.Components, wk *worker.W, ds *wor
 		EDec:     ed,
 	}
 
+	if kcID, ok := kvKeyCoderID(coders[wInCid].GetComponentCoderIds()[0], coders); ok {
+		stg.keyDec = pullDecoder(coders[kcID], coders)
+	}
+	if stg.stateful {
+		if stg.keyDec == nil {
+			return fmt.Errorf("buildDescriptor: stateful stage %v requires a KV coded primary input, pcol %q %v", stg.ID, stg.primaryInput, prototext.Format(col))
+		}
+		if err := handleTimers(stg, transforms, comps, coders); err != nil {
+			return fmt.Errorf("buildDescriptor: failed to handle timers on stage %v:\n%w", stg.ID, err)
+		}
+		if err := addStateCoders(stg, transforms, comps, coders); err != nil {
+			return fmt.Errorf("buildDescriptor: failed to handle user state on stage %v:\n%w", stg.ID, err)
+		}
+	}
+
 	stg.inputTransformID = stg.ID + "_source"
 	transforms[stg.inputTransformID] = sourceTransform(stg.inputTransformID, portFor(wInCid, wk), stg.primaryInput)
 
@@ -375,12 +494,23 @@ func buildDescriptor(stg *stage, comps *pipepb.Components, wk *worker.W, ds *wor
 			Url: wk.Endpoint(),
 		},
 	}
+	if len(stg.hasTimers) > 0 {
+		desc.TimerApiServiceDescriptor = &pipepb.ApiServiceDescriptor{
+			Url: wk.Endpoint(),
+		}
+	}
 
 	stg.desc = desc
-	stg.prepareSides = func(b *worker.B, _ string, watermark mtime.Time) {
+	if err := buildDrainDescriptor(stg, comps, wk); err != nil {
+		return fmt.Errorf("buildDescriptor: failed to build drain descriptor for stage %v:\n%w", stg.ID, err)
+	}
+	stg.prepareSides = func(b *worker.B, _ string, watermark mtime.Time) error {
 		for _, prep := range prepareSides {
-			prep(b, watermark)
+			if err := prep(b, watermark); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 	stg.sides = sides // List of the global pcollection IDs this stage needs to wait on for side inputs.
 	stg.SinkToPCollection = sink2Col
@@ -391,8 +521,73 @@ func buildDescriptor(stg *stage, comps *pipepb.Components, wk *worker.W, ds *wor
 	return nil
 }
 
+// buildDrainDescriptor constructs an alternate ProcessBundleDescriptor for stages
+// that process splittable DoFn restrictions, used for bundles started while the
+// job is draining.
+//
+// The drain descriptor inserts a TRUNCATE_SIZED_RESTRICTION transform between the
+// stage's data source and the PROCESS_SIZED_ELEMENTS_AND_RESTRICTIONS transform,
+// so unbounded restrictions are made bounded before processing. Both transforms
+// consume and produce the same element format, so no other changes are needed.
+func buildDrainDescriptor(stg *stage, comps *pipepb.Components, wk *worker.W) error {
+	tid := stg.transforms[0]
+	t := stg.desc.GetTransforms()[tid]
+	if t.GetSpec().GetUrn() != urns.TransformProcessSizedElements {
+		return nil
+	}
+	var inputLocalID string
+	for local, global := range t.GetInputs() {
+		if global == stg.primaryInput {
+			inputLocalID = local
+			break
+		}
+	}
+	if inputLocalID == "" {
+		return fmt.Errorf("splittable DoFn %v doesn't consume the stage primary input %v", tid, stg.primaryInput)
+	}
+
+	// The truncated PCollection only exists in the drain descriptor, so it's added
+	// to a copy of the descriptor's PCollections, leaving the pipeline unchanged.
+	col := comps.GetPcollections()[stg.primaryInput]
+	truncatedID := stg.primaryInput + "_truncated"
+	truncatedCol := proto.Clone(col).(*pipepb.PCollection)
+	truncatedCol.UniqueName = col.GetUniqueName() + "_truncated"
+	pcols := maps.Clone(stg.desc.GetPcollections())
+	pcols[truncatedID] = truncatedCol
+
+	truncateID := tid + "_truncate"
+	process := proto.Clone(t).(*pipepb.PTransform)
+	process.GetInputs()[inputLocalID] = truncatedID
+
+	transforms := maps.Clone(stg.desc.GetTransforms())
+	transforms[tid] = process
+	transforms[truncateID] = &pipepb.PTransform{
+		UniqueName: truncateID,
+		Spec: &pipepb.FunctionSpec{
+			Urn:     urns.TransformTruncate,
+			Payload: t.GetSpec().GetPayload(),
+		},
+		Inputs: map[string]string{
+			inputLocalID: stg.primaryInput,
+		},
+		Outputs: map[string]string{
+			"i0": truncatedID,
+		},
+		EnvironmentId: t.GetEnvironmentId(),
+	}
+
+	desc := proto.Clone(stg.desc).(*fnpb.ProcessBundleDescriptor)
+	desc.Id = stg.ID + "_drain"
+	desc.Transforms = transforms
+	desc.Pcollections = pcols
+
+	stg.drainDesc = desc
+	wk.Descriptors[desc.GetId()] = desc
+	return nil
+}
+
 // handleSideInput returns a closure that will look up the data for a side input appropriate for the given watermark.
-func handleSideInput(tid, local, global string, comps *pipepb.Components, coders map[string]*pipepb.Coder, ds *worker.DataService) (func(b *worker.B, watermark mtime.Time), error) {
+func handleSideInput(tid, local, global string, comps *pipepb.Components, coders map[string]*pipepb.Coder, ds *worker.DataService) (func(b *worker.B, watermark mtime.Time) error, error) {
 	t := comps.GetTransforms()[tid]
 	sis, err := getSideInputs(t)
 	if err != nil {
@@ -411,8 +606,11 @@ func handleSideInput(tid, local, global string, comps *pipepb.Components, coders
 		// May be of zero length, but that's OK. Side inputs can be empty.
 
 		global, local := global, local
-		return func(b *worker.B, watermark mtime.Time) {
-			data := ds.GetAllData(global)
+		return func(b *worker.B, watermark mtime.Time) error {
+			data, err := ds.GetAllData(global)
+			if err != nil {
+				return err
+			}
 
 			if b.IterableSideInputData == nil {
 				b.IterableSideInputData = map[string]map[string]map[typex.Window][][]byte{}
@@ -426,6 +624,7 @@ func handleSideInput(tid, local, global string, comps *pipepb.Components, coders
 				}, func(a, b [][]byte) [][]byte {
 					return append(a, b...)
 				})
+			return nil
 		}, nil
 
 	case urns.SideInputMultiMap:
@@ -445,9 +644,12 @@ func handleSideInput(tid, local, global string, comps *pipepb.Components, coders
 		wDec, wEnc := getWindowValueCoders(comps, col, coders)
 
 		global, local := global, local
-		return func(b *worker.B, watermark mtime.Time) {
+		return func(b *worker.B, watermark mtime.Time) error {
 			// May be of zero length, but that's OK. Side inputs can be empty.
-			data := ds.GetAllData(global)
+			data, err := ds.GetAllData(global)
+			if err != nil {
+				return err
+			}
 			if b.MultiMapSideInputData == nil {
 				b.MultiMapSideInputData = map[string]map[string]map[typex.Window]map[string][][]byte{}
 			}
@@ -469,12 +671,117 @@ func handleSideInput(tid, local, global string, comps *pipepb.Components, coders
 					}
 					return a
 				})
+			return nil
 		}, nil
 	default:
 		return nil, fmt.Errorf("local input %v (global %v) uses accesspattern %v", local, global, si.GetAccessPattern().GetUrn())
 	}
 }
 
+// handleTimers records the timer families of the stage's transforms, and ensures the
+// timer coders are length prefixed consistently with the primary input's key coder,
+// so the runner can extract the keys from timers.
+func handleTimers(stg *stage, transforms map[string]*pipepb.PTransform, comps *pipepb.Components, coders map[string]*pipepb.Coder) error {
+	stg.hasTimers, stg.expirationTimers = nil, nil
+	stg.processingTimeTimers = map[engine.LinkID]bool{}
+	for _, tid := range stg.transforms {
+		t := transforms[tid]
+		if t.GetSpec().GetUrn() != urns.TransformParDo {
+			continue
+		}
+		pardo := &pipepb.ParDoPayload{}
+		if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pardo); err != nil {
+			return fmt.Errorf("unable to decode ParDoPayload for %v", tid)
+		}
+		if len(pardo.GetTimerFamilySpecs()) == 0 {
+			continue
+		}
+		families := maps.Keys(pardo.GetTimerFamilySpecs())
+		sort.Strings(families)
+		for _, family := range families {
+			spec := pardo.GetTimerFamilySpecs()[family]
+			cID, err := lpUnknownCoders(spec.GetTimerFamilyCoderId(), coders, comps.GetCoders())
+			if err != nil {
+				return fmt.Errorf("couldn't handle timer coder for %v family %v: %w", tid, family, err)
+			}
+			spec.TimerFamilyCoderId = cID
+
+			link := engine.LinkID{Transform: tid, Local: family}
+			stg.hasTimers = append(stg.hasTimers, link)
+			if spec.GetTimeDomain() == pipepb.TimeDomain_PROCESSING_TIME {
+				stg.processingTimeTimers[link] = true
+			}
+			if family == pardo.GetOnWindowExpirationTimerFamilySpec() {
+				stg.expirationTimers = append(stg.expirationTimers, link)
+			}
+		}
+		// Use a copy of the transform in the descriptor, to avoid modifying the pipeline.
+		payload, err := proto.Marshal(pardo)
+		if err != nil {
+			return fmt.Errorf("unable to encode ParDoPayload for %v", tid)
+		}
+		t = proto.Clone(t).(*pipepb.PTransform)
+		t.GetSpec().Payload = payload
+		transforms[tid] = t
+	}
+	return nil
+}
+
+// addStateCoders adds the coders of the user state of the stage's transforms to the bundle's
+// coders, since they needn't be used by any PCollection. State is opaque to the runner, so the
+// coders are used as is.
+func addStateCoders(stg *stage, transforms map[string]*pipepb.PTransform, comps *pipepb.Components, coders map[string]*pipepb.Coder) error {
+	for _, tid := range stg.transforms {
+		t := transforms[tid]
+		if t.GetSpec().GetUrn() != urns.TransformParDo {
+			continue
+		}
+		pardo := &pipepb.ParDoPayload{}
+		if err := (proto.UnmarshalOptions{}).Unmarshal(t.GetSpec().GetPayload(), pardo); err != nil {
+			return fmt.Errorf("unable to decode ParDoPayload for %v", tid)
+		}
+		for id, spec := range pardo.GetStateSpecs() {
+			var cIDs []string
+			switch s := spec.GetSpec().(type) {
+			case *pipepb.StateSpec_ReadModifyWriteSpec:
+				cIDs = []string{s.ReadModifyWriteSpec.GetCoderId()}
+			case *pipepb.StateSpec_BagSpec:
+				cIDs = []string{s.BagSpec.GetElementCoderId()}
+			case *pipepb.StateSpec_CombiningSpec:
+				cIDs = []string{s.CombiningSpec.GetAccumulatorCoderId()}
+			case *pipepb.StateSpec_MapSpec:
+				cIDs = []string{s.MapSpec.GetKeyCoderId(), s.MapSpec.GetValueCoderId()}
+			case *pipepb.StateSpec_SetSpec:
+				cIDs = []string{s.SetSpec.GetElementCoderId()}
+			case *pipepb.StateSpec_MultimapSpec:
+				cIDs = []string{s.MultimapSpec.GetKeyCoderId(), s.MultimapSpec.GetValueCoderId()}
+			case *pipepb.StateSpec_OrderedListSpec:
+				cIDs = []string{s.OrderedListSpec.GetElementCoderId()}
+			}
+			for _, cID := range cIDs {
+				if cID == "" {
+					continue
+				}
+				c, ok := comps.GetCoders()[cID]
+				if !ok {
+					return fmt.Errorf("unknown coder %v for state %v of %v", cID, id, tid)
+				}
+				coders[cID] = c
+			}
+		}
+	}
+	return nil
+}
+
+// kvKeyCoderID returns the key coder ID of the given coder ID, if it's a KV coder.
+func kvKeyCoderID(cID string, coders map[string]*pipepb.Coder) (string, bool) {
+	c := coders[cID]
+	if c.GetSpec().GetUrn() != urns.CoderKV {
+		return "", false
+	}
+	return c.GetComponentCoderIds()[0], true
+}
+
 func sourceTransform(parentID string, sourcePortBytes []byte, outPID string) *pipepb.PTransform {
 	source := &pipepb.PTransform{
 		UniqueName: parentID,
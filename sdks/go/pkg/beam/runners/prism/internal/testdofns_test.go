@@ -18,7 +18,9 @@ package internal_test
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
@@ -59,6 +61,8 @@ func init() {
 	register.Function3x0(dofn1Counter)
 	register.Function2x0(dofnSink)
 	register.Function3x1(doFnFail)
+	register.Function2x1(flakyFn)
+	register.Function3x0(finalizingFn)
 
 	register.Function2x1(combineIntSum)
 
@@ -283,6 +287,35 @@ func doFnFail(ctx context.Context, _ []byte, emit func(int64)) error {
 	return fmt.Errorf("doFnFail: failing as intended")
 }
 
+// flakyAttempts counts the calls to flakyFn across all jobs in the test binary.
+var flakyAttempts atomic.Int64
+
+// flakyFn fails until it has been called flakyFailures times, so bundles
+// only succeed once they're retried.
+func flakyFn(v int64, emit func(int64)) error {
+	if flakyAttempts.Add(1) <= flakyFailures {
+		return fmt.Errorf("flakyFn: transient failure")
+	}
+	emit(v)
+	return nil
+}
+
+const flakyFailures = 2
+
+// finalizedBundles counts the finalization callbacks run for finalizingFn
+// across all jobs in the test binary.
+var finalizedBundles atomic.Int64
+
+// finalizingFn passes through its input, and registers a callback to count
+// the finalization of its bundles.
+func finalizingFn(bf beam.BundleFinalization, v int64, emit func(int64)) {
+	bf.RegisterCallback(time.Minute, func() error {
+		finalizedBundles.Add(1)
+		return nil
+	})
+	emit(v)
+}
+
 func combineIntSum(a, b int64) int64 {
 	return a + b
 }
@@ -296,7 +329,11 @@ type SourceConfig struct {
 }
 
 // intRangeFn is a splittable DoFn for counting from 1 to N.
-type intRangeFn struct{}
+type intRangeFn struct {
+	// Sleep is how long each position takes to process, so bundles may be
+	// split within an element.
+	Sleep time.Duration
+}
 
 // CreateInitialRestriction creates an offset range restriction representing
 // the number of elements to emit.
@@ -332,6 +369,7 @@ func (fn *intRangeFn) CreateTracker(rest offsetrange.Restriction) *sdf.LockRTrac
 // form of KV<[]byte, []byte>.
 func (fn *intRangeFn) ProcessElement(rt *sdf.LockRTracker, config SourceConfig, emit func(int64)) error {
 	for i := rt.GetRestriction().(offsetrange.Restriction).Start; rt.TryClaim(i); i++ {
+		time.Sleep(fn.Sleep)
 		// Add 1 since the restrictions are from [0 ,N), but we want [1, N]
 		emit(i + 1)
 	}
@@ -399,3 +437,67 @@ func (fn *selfCheckpointingDoFn) ProcessElement(rt *sdf.LockRTracker, _ []byte,
 		}
 	}
 }
+
+func init() {
+	register.DoFn3x1[*sdf.LockRTracker, []byte, func(int64), sdf.ProcessContinuation](&unboundedDoFn{})
+}
+
+// unboundedClaims and unboundedTruncations count the positions claimed, and
+// restrictions truncated by unboundedDoFn, across all jobs in the test binary.
+var unboundedClaims, unboundedTruncations atomic.Int64
+
+// unboundedFirstStart records the first position processed by unboundedDoFn,
+// once reset to -1.
+var unboundedFirstStart atomic.Int64
+
+// unboundedDoFn is an SDF that processes an effectively infinite restriction,
+// checkpointing periodically, so the pipeline only terminates if canceled or drained.
+type unboundedDoFn struct{}
+
+// CreateInitialRestriction creates an effectively infinite restriction.
+func (fn *unboundedDoFn) CreateInitialRestriction(_ []byte) offsetrange.Restriction {
+	return offsetrange.Restriction{
+		Start: int64(0),
+		End:   int64(math.MaxInt64),
+	}
+}
+
+// CreateTracker wraps the given restriction into a LockRTracker type.
+func (fn *unboundedDoFn) CreateTracker(rest offsetrange.Restriction) *sdf.LockRTracker {
+	return sdf.NewLockRTracker(offsetrange.NewTracker(rest))
+}
+
+// RestrictionSize returns the size of the current restriction
+func (fn *unboundedDoFn) RestrictionSize(_ []byte, rest offsetrange.Restriction) float64 {
+	return rest.Size()
+}
+
+// SplitRestriction doesn't split the initial restriction.
+func (fn *unboundedDoFn) SplitRestriction(_ []byte, rest offsetrange.Restriction) []offsetrange.Restriction {
+	return []offsetrange.Restriction{rest}
+}
+
+// TruncateRestriction bounds the remaining restriction to a few positions when draining.
+func (fn *unboundedDoFn) TruncateRestriction(rt *sdf.LockRTracker, _ []byte) offsetrange.Restriction {
+	unboundedTruncations.Add(1)
+	start := rt.GetRestriction().(offsetrange.Restriction).Start
+	return offsetrange.Restriction{
+		Start: start,
+		End:   start + 5,
+	}
+}
+
+// ProcessElement claims and emits a few positions before checkpointing.
+func (fn *unboundedDoFn) ProcessElement(rt *sdf.LockRTracker, _ []byte, emit func(int64)) sdf.ProcessContinuation {
+	position := rt.GetRestriction().(offsetrange.Restriction).Start
+	unboundedFirstStart.CompareAndSwap(-1, position)
+	for i := 0; i < 10; i++ {
+		if !rt.TryClaim(position) {
+			return sdf.StopProcessing()
+		}
+		unboundedClaims.Add(1)
+		emit(position)
+		position++
+	}
+	return sdf.ResumeProcessingIn(10 * time.Millisecond)
+}
@@ -41,46 +41,10 @@ func TestUnimplemented(t *testing.T) {
 	tests := []struct {
 		pipeline func(s beam.Scope)
 	}{
-		// {pipeline: primitives.Drain}, // Can't test drain automatically yet.
-
-		{pipeline: primitives.TestStreamBoolSequence},
-		{pipeline: primitives.TestStreamByteSliceSequence},
-		{pipeline: primitives.TestStreamFloat64Sequence},
-		{pipeline: primitives.TestStreamInt64Sequence},
-		{pipeline: primitives.TestStreamStrings},
-		{pipeline: primitives.TestStreamTwoBoolSequences},
-		{pipeline: primitives.TestStreamTwoFloat64Sequences},
-		{pipeline: primitives.TestStreamTwoInt64Sequences},
-
-		// Needs teststream
-		{pipeline: primitives.Panes},
-
-		// Triggers (Need teststream and are unimplemented.)
-		{pipeline: primitives.TriggerAlways},
-		{pipeline: primitives.TriggerAfterAll},
-		{pipeline: primitives.TriggerAfterAny},
-		{pipeline: primitives.TriggerAfterEach},
-		{pipeline: primitives.TriggerAfterEndOfWindow},
+		// The test stream only advances processing time 2.1s, short of the trigger's
+		// 5s delay, so the trigger never fires. Prism emits all the elements in the
+		// final pane when the window closes, rather than the expected early pane.
 		{pipeline: primitives.TriggerAfterProcessingTime},
-		{pipeline: primitives.TriggerAfterSynchronizedProcessingTime},
-		{pipeline: primitives.TriggerElementCount},
-		{pipeline: primitives.TriggerNever},
-		{pipeline: primitives.TriggerOrFinally},
-		{pipeline: primitives.TriggerRepeat},
-
-		// State API
-		{pipeline: primitives.BagStateParDo},
-		{pipeline: primitives.BagStateParDoClear},
-		{pipeline: primitives.MapStateParDo},
-		{pipeline: primitives.MapStateParDoClear},
-		{pipeline: primitives.SetStateParDo},
-		{pipeline: primitives.SetStateParDoClear},
-		{pipeline: primitives.CombiningStateParDo},
-		{pipeline: primitives.ValueStateParDo},
-		{pipeline: primitives.ValueStateParDoClear},
-		{pipeline: primitives.ValueStateParDoWindowed},
-
-		// TODO: Timers integration tests.
 	}
 
 	for _, test := range tests {
@@ -111,6 +75,49 @@ func TestImplemented(t *testing.T) {
 
 		{pipeline: primitives.CoGBK},
 		{pipeline: primitives.ReshuffleKV},
+
+		// State API
+		{pipeline: primitives.BagStateParDo},
+		{pipeline: primitives.BagStateParDoClear},
+		{pipeline: primitives.MapStateParDo},
+		{pipeline: primitives.MapStateParDoClear},
+		{pipeline: primitives.SetStateParDo},
+		{pipeline: primitives.SetStateParDoClear},
+		{pipeline: primitives.OrderedListStateParDo},
+		{pipeline: primitives.CombiningStateParDo},
+		{pipeline: primitives.ValueStateParDo},
+		{pipeline: primitives.ValueStateParDoClear},
+		{pipeline: primitives.ValueStateParDoWindowed},
+		{pipeline: primitives.WindowExpirationParDo},
+
+		// Timers
+		{pipeline: primitives.TimersEventTimeBounded},
+		{pipeline: primitives.TimersEventTimeLoop},
+		{pipeline: primitives.TimersProcessingTimeBounded},
+
+		// TestStream
+		{pipeline: primitives.TestStreamBoolSequence},
+		{pipeline: primitives.TestStreamByteSliceSequence},
+		{pipeline: primitives.TestStreamFloat64Sequence},
+		{pipeline: primitives.TestStreamInt64Sequence},
+		{pipeline: primitives.TestStreamStrings},
+		{pipeline: primitives.TestStreamTwoBoolSequences},
+		{pipeline: primitives.TestStreamTwoFloat64Sequences},
+		{pipeline: primitives.TestStreamTwoInt64Sequences},
+
+		// Triggers
+		{pipeline: primitives.Panes},
+		{pipeline: primitives.TriggerDefault},
+		{pipeline: primitives.TriggerAlways},
+		{pipeline: primitives.TriggerAfterAll},
+		{pipeline: primitives.TriggerAfterAny},
+		{pipeline: primitives.TriggerAfterEach},
+		{pipeline: primitives.TriggerAfterEndOfWindow},
+		{pipeline: primitives.TriggerAfterSynchronizedProcessingTime},
+		{pipeline: primitives.TriggerElementCount},
+		{pipeline: primitives.TriggerNever},
+		{pipeline: primitives.TriggerOrFinally},
+		{pipeline: primitives.TriggerRepeat},
 	}
 
 	for _, test := range tests {
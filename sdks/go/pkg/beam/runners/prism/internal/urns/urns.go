@@ -51,6 +51,7 @@ var (
 	reqUrn     = toUrn[pipepb.StandardRequirements_Enum]()
 	runProcUrn = toUrn[pipepb.StandardRunnerProtocols_Enum]()
 	envUrn     = toUrn[pipepb.StandardEnvironments_Environments]()
+	metTypUrn  = toUrn[pipepb.MonitoringInfoTypeUrns_Enum]()
 )
 
 var (
@@ -76,6 +77,10 @@ var (
 	// Testing
 	TransformTestStream = ptUrn(pipepb.StandardPTransforms_TEST_STREAM)
 
+	// IO emulated by the runner.
+	TransformPubSubRead  = ctUrn(pipepb.StandardPTransforms_PUBSUB_READ)
+	TransformPubSubWrite = ctUrn(pipepb.StandardPTransforms_PUBSUB_WRITE)
+
 	// Debugging
 	TransformToString = ptUrn(pipepb.StandardPTransforms_TO_STRING)
 
@@ -133,10 +138,27 @@ var (
 	// Capabilities
 	CapabilityMonitoringInfoShortIDs           = runProcUrn(pipepb.StandardRunnerProtocols_MONITORING_INFO_SHORT_IDS)
 	CapabilityControlResponseElementsEmbedding = runProcUrn(pipepb.StandardRunnerProtocols_CONTROL_RESPONSE_ELEMENTS_EMBEDDING)
+	CapabilitySortedMultimapKeys               = "beam:go:protocol:sorted_multimap_keys:v1" // Only used by the Go SDK, for ordered list state.
 
 	// Environment types
 	EnvDocker   = envUrn(pipepb.StandardEnvironments_DOCKER)
 	EnvProcess  = envUrn(pipepb.StandardEnvironments_PROCESS)
 	EnvExternal = envUrn(pipepb.StandardEnvironments_EXTERNAL)
 	EnvDefault  = envUrn(pipepb.StandardEnvironments_DEFAULT)
+
+	// Metric types
+	MetricTypeSumInt64          = metTypUrn(pipepb.MonitoringInfoTypeUrns_SUM_INT64_TYPE)
+	MetricTypeSumDouble         = metTypUrn(pipepb.MonitoringInfoTypeUrns_SUM_DOUBLE_TYPE)
+	MetricTypeDistributionInt64 = metTypUrn(pipepb.MonitoringInfoTypeUrns_DISTRIBUTION_INT64_TYPE)
+	MetricTypeLatestInt64       = metTypUrn(pipepb.MonitoringInfoTypeUrns_LATEST_INT64_TYPE)
+)
+
+// Annotations prism adds to the PTransforms of the pipelines it returns from GetPipeline,
+// describing how they're executed.
+const (
+	// AnnotationStages is the comma separated IDs of the stages executing the transform.
+	AnnotationStages = "beam:prism:annotation:stages:v1"
+	// AnnotationOutputWatermarkPrefix, followed by the local name of an output, is the current
+	// watermark of that output PCollection, as decimal milliseconds since the epoch.
+	AnnotationOutputWatermarkPrefix = "beam:prism:annotation:output_watermark:v1:"
 )
@@ -0,0 +1,90 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/config"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+)
+
+// Pipeline options that select a variant of the runner's handler configuration.
+const (
+	// optVariantConfig is the path of a YAML file configuring variants of the handlers.
+	optVariantConfig = "variant_config"
+	// optVariant is the name of the variant in the variant_config file the job executes with.
+	optVariant = "variant"
+)
+
+// jobHandlers returns the handlers the job executes with, and the fault injection handler.
+//
+// Handlers have prism's default characteristics, unless they're configured by the
+// variant selected by the job's pipeline options.
+func jobHandlers(j *jobservices.Job) ([]any, *fault, error) {
+	var variant *config.Variant
+	opts := j.PipelineOptions()
+	path, hasConfig := jobOption(opts, optVariantConfig)
+	name, hasVariant := jobOption(opts, optVariant)
+	switch {
+	case hasConfig && hasVariant:
+		in, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read %v pipeline option: %w", optVariantConfig, err)
+		}
+		reg := config.NewHandlerRegistry()
+		reg.RegisterHandlers((*combine)(nil), (*pardo)(nil), (*runner)(nil), (*fault)(nil))
+		if err := reg.LoadFromYaml(in); err != nil {
+			return nil, nil, fmt.Errorf("invalid %v pipeline option %q: %w", optVariantConfig, path, err)
+		}
+		if variant = reg.GetVariant(name); variant == nil {
+			return nil, nil, fmt.Errorf("invalid %v pipeline option: %q isn't in %v, which has variants %v", optVariant, name, path, reg.Variants())
+		}
+	case hasConfig || hasVariant:
+		return nil, nil, fmt.Errorf("the %v and %v pipeline options must be set together", optVariantConfig, optVariant)
+	}
+
+	characteristic := func(handler string, def any) any {
+		if variant.Configures(handler) {
+			return variant.GetCharacteristics(handler)
+		}
+		return def
+	}
+	faults := Fault(characteristic("fault", defaultCharacteristics["fault"]))
+	if err := faults.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid fault configuration in variant %q: %w", name, err)
+	}
+	handlers := []any{
+		Combine(characteristic("combine", defaultCharacteristics["combine"])),
+		ParDo(characteristic("pardo", defaultCharacteristics["pardo"])),
+		Runner(characteristic("runner", defaultCharacteristics["runner"])),
+		faults,
+	}
+	return handlers, faults, nil
+}
+
+// defaultCharacteristics are prism's characteristics of each handler, keyed by the
+// handler's name in variant configurations, for jobs whose variant doesn't configure it.
+var defaultCharacteristics = map[string]any{
+	"combine": CombineCharacteristic{EnableLifting: true},
+	"pardo":   ParDoCharacteristic{DisableSDF: true},
+	"runner": RunnerCharacteristic{
+		SDKFlatten:   false,
+		SDKReshuffle: false,
+	},
+	"fault": FaultCharacteristic{},
+}
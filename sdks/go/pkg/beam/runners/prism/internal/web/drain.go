@@ -0,0 +1,54 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+)
+
+// jobDrainer is implemented by clients of in process job servers, which can
+// drain jobs. The Job Management API has no drain request.
+type jobDrainer interface {
+	Drain(ctx context.Context, jobID string) (jobpb.JobState_Enum, error)
+}
+
+// drainHandler drains a job on POST requests, and redirects to its page.
+type drainHandler struct {
+	Jobcli jobpb.JobServiceClient
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "drain requires a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	src, ok := h.Jobcli.(jobDrainer)
+	if !ok {
+		http.Error(w, "drain isn't available from this job server", http.StatusNotImplemented)
+		return
+	}
+	path := r.URL.EscapedPath()
+	jobID := path[strings.LastIndex(path, "/")+1:]
+	if _, err := src.Drain(r.Context(), jobID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/job/"+jobID, http.StatusSeeOther)
+}
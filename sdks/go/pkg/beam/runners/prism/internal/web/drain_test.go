@@ -0,0 +1,72 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+)
+
+// drainJobClient is a job client that drains a single job.
+type drainJobClient struct {
+	jobpb.JobServiceClient
+	jobID   string
+	drained bool
+}
+
+func (c *drainJobClient) Drain(_ context.Context, jobID string) (jobpb.JobState_Enum, error) {
+	if jobID != c.jobID {
+		return jobpb.JobState_UNSPECIFIED, fmt.Errorf("job with id %v not found", jobID)
+	}
+	c.drained = true
+	return jobpb.JobState_DRAINING, nil
+}
+
+func TestDrainHandler(t *testing.T) {
+	cli := &drainJobClient{jobID: "job-001"}
+	h := &drainHandler{Jobcli: cli}
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	if rec := serve(http.MethodGet, "/drain/job-001"); rec.Code != http.StatusMethodNotAllowed || cli.drained {
+		t.Errorf("GET status = %v, drained = %v, want %v, false", rec.Code, cli.drained, http.StatusMethodNotAllowed)
+	}
+	if rec := serve(http.MethodPost, "/drain/job-002"); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST unknown job status = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+	rec := serve(http.MethodPost, "/drain/job-001")
+	if rec.Code != http.StatusSeeOther || !cli.drained {
+		t.Errorf("POST status = %v, drained = %v, want %v, true", rec.Code, cli.drained, http.StatusSeeOther)
+	}
+	if got, want := rec.Header().Get("Location"), "/job/job-001"; got != want {
+		t.Errorf("POST redirected to %q, want %q", got, want)
+	}
+
+	h = &drainHandler{Jobcli: &messagesJobClient{jobID: "job-001"}}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain/job-001", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("POST without drainer status = %v, want %v", rec.Code, http.StatusNotImplemented)
+	}
+}
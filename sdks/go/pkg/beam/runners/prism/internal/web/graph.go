@@ -0,0 +1,511 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"golang.org/x/exp/maps"
+)
+
+// Graph layout dimensions, in pixels.
+const (
+	graphMargin    = 20
+	graphNodeW     = 220
+	graphNodeH     = 44
+	graphColW      = 320 // Horizontal distance between layers.
+	graphRowGap    = 16  // Vertical gap between nodes.
+	graphBoxPad    = 10  // Padding around the contents of expanded composites.
+	graphBoxLabelH = 20  // Space for the label of expanded composites.
+	graphNameChars = 30  // Maximum characters of transform names within nodes.
+)
+
+// graphStageColors are fill colors for fused stages, which contain multiple transforms.
+var graphStageColors = []string{"#fde0c5", "#d4e8f7", "#dff2d8", "#f3dcf2", "#fff5bf", "#e0e0f8"}
+
+// graphItem is a transform in the pipeline graph. Leaves and collapsed composites
+// are drawn as nodes, and expanded composites are drawn as boxes around their
+// subtransforms.
+type graphItem struct {
+	id       string
+	t        *pipepb.PTransform
+	expanded bool
+	children []*graphItem
+
+	layer      int     // Column of a node, from the longest path to it.
+	x, y, w, h float64 // Bounds of the node or box.
+}
+
+// graphEdge is a PCollection flowing between two nodes.
+type graphEdge struct {
+	from, to *graphItem
+	label    string
+}
+
+// pipelineGraph is the laid out graph of a pipeline's transforms.
+type pipelineGraph struct {
+	roots []*graphItem
+	nodes []*graphItem // In depth first order.
+	edges []graphEdge
+
+	expanded  map[string]bool
+	expandAll bool
+	stageFill map[string]string // Fill color for fused stages, keyed by stage ID.
+}
+
+// newPipelineGraph lays out the pipeline's transforms, with the given composite transforms
+// expanded, or all of them if expandAll is set. PCollection edges are labelled with element
+// counts from the metrics, and watermarks from the pipeline's annotations.
+func newPipelineGraph(p *pipepb.Pipeline, pcols map[metrics.StepKey]metrics.PColResult, expanded map[string]bool, expandAll bool) *pipelineGraph {
+	g := &pipelineGraph{expanded: expanded, expandAll: expandAll}
+	ts := p.GetComponents().GetTransforms()
+
+	roots := p.GetRootTransformIds()
+	if len(roots) == 0 {
+		// Without explicit roots, use the transforms that aren't subtransforms.
+		subs := map[string]bool{}
+		for _, t := range ts {
+			for _, sub := range t.GetSubtransforms() {
+				subs[sub] = true
+			}
+		}
+		for tid := range ts {
+			if !subs[tid] {
+				roots = append(roots, tid)
+			}
+		}
+		sort.Strings(roots)
+	}
+
+	owner := map[string]*graphItem{} // The node for each leaf transform.
+	var build func(tid string) *graphItem
+	build = func(tid string) *graphItem {
+		t, ok := ts[tid]
+		if !ok {
+			return nil
+		}
+		it := &graphItem{id: tid, t: t}
+		if len(t.GetSubtransforms()) > 0 && (expandAll || expanded[tid]) {
+			it.expanded = true
+			for _, sub := range t.GetSubtransforms() {
+				if c := build(sub); c != nil {
+					it.children = append(it.children, c)
+				}
+			}
+			return it
+		}
+		g.nodes = append(g.nodes, it)
+		for _, leaf := range leafTransforms(tid, ts) {
+			owner[leaf] = it
+		}
+		return it
+	}
+	for _, tid := range roots {
+		if it := build(tid); it != nil {
+			g.roots = append(g.roots, it)
+		}
+	}
+
+	g.edges = graphEdges(ts, owner, pcols)
+	g.assignLayers()
+	var y float64 = graphMargin
+	for _, it := range g.roots {
+		y = g.layout(it, y)
+	}
+	g.assignStageFills()
+	return g
+}
+
+// leafTransforms returns the leaf transforms of the given transform, in order.
+func leafTransforms(tid string, ts map[string]*pipepb.PTransform) []string {
+	t := ts[tid]
+	if len(t.GetSubtransforms()) == 0 {
+		return []string{tid}
+	}
+	var leaves []string
+	for _, sub := range t.GetSubtransforms() {
+		if _, ok := ts[sub]; ok {
+			leaves = append(leaves, leafTransforms(sub, ts)...)
+		}
+	}
+	return leaves
+}
+
+// graphEdges returns the PCollection edges between the nodes owning leaf transforms.
+// PCollections within a single node aren't drawn.
+func graphEdges(ts map[string]*pipepb.PTransform, owner map[string]*graphItem, pcols map[metrics.StepKey]metrics.PColResult) []graphEdge {
+	type producer struct {
+		leaf, local string
+	}
+	producers := map[string]producer{}
+	leaves := maps.Keys(owner)
+	sort.Strings(leaves)
+	for _, leaf := range leaves {
+		for local, global := range ts[leaf].GetOutputs() {
+			producers[global] = producer{leaf: leaf, local: local}
+		}
+	}
+	type edgeKey struct {
+		from, to *graphItem
+		pcol     string
+	}
+	seen := map[edgeKey]bool{}
+	var edges []graphEdge
+	for _, leaf := range leaves {
+		to := owner[leaf]
+		locals := maps.Keys(ts[leaf].GetInputs())
+		sort.Strings(locals)
+		for _, local := range locals {
+			global := ts[leaf].GetInputs()[local]
+			prod, ok := producers[global]
+			if !ok {
+				continue
+			}
+			from := owner[prod.leaf]
+			k := edgeKey{from: from, to: to, pcol: global}
+			if from == to || seen[k] {
+				continue
+			}
+			seen[k] = true
+			edges = append(edges, graphEdge{
+				from:  from,
+				to:    to,
+				label: edgeLabel(ts[prod.leaf], prod.local, pcols),
+			})
+		}
+	}
+	return edges
+}
+
+// edgeLabel describes the output of a leaf transform, with its element count and watermark.
+func edgeLabel(t *pipepb.PTransform, local string, pcols map[metrics.StepKey]metrics.PColResult) string {
+	var parts []string
+	if r, ok := pcols[metrics.StepKey{Step: t.GetUniqueName() + "." + local}]; ok {
+		parts = append(parts, fmt.Sprintf("%d elements", r.Committed.ElementCount))
+	}
+	if v, ok := t.GetAnnotations()[urns.AnnotationOutputWatermarkPrefix+local]; ok {
+		if ms, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			parts = append(parts, "wm "+formatWatermark(mtime.Time(ms)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatWatermark formats a watermark as a UTC time, or its symbolic name at the bounds of time.
+func formatWatermark(wm mtime.Time) string {
+	switch wm {
+	case mtime.MinTimestamp, mtime.MaxTimestamp, mtime.EndOfGlobalWindowTime:
+		return wm.String()
+	}
+	return wm.ToTime().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// assignLayers places nodes in the column after their furthest producer.
+// Cycles between collapsed composites are cut after as many passes as there are nodes.
+func (g *pipelineGraph) assignLayers() {
+	for i := 0; i < len(g.nodes); i++ {
+		changed := false
+		for _, e := range g.edges {
+			if l := e.from.layer + 1; l > e.to.layer {
+				e.to.layer = l
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// layout positions the item and its children, starting at the given y coordinate,
+// and returns the y coordinate for the next item.
+//
+// Nodes are stacked in depth first order, so the nodes within a composite are
+// contiguous, and expanded composite boxes nest without overlapping.
+func (g *pipelineGraph) layout(it *graphItem, y float64) float64 {
+	if !it.expanded {
+		it.x = graphMargin + float64(it.layer)*graphColW
+		it.y = y
+		it.w, it.h = graphNodeW, graphNodeH
+		return y + graphNodeH + graphRowGap
+	}
+	top := y
+	y += graphBoxLabelH
+	x0, x1 := 0.0, 0.0
+	for i, c := range it.children {
+		y = g.layout(c, y)
+		if i == 0 || c.x < x0 {
+			x0 = c.x
+		}
+		if i == 0 || c.x+c.w > x1 {
+			x1 = c.x + c.w
+		}
+	}
+	if len(it.children) == 0 {
+		x0, x1 = graphMargin, graphMargin+graphNodeW
+	}
+	bottom := y - graphRowGap + graphBoxPad
+	it.x, it.y = x0-graphBoxPad, top
+	it.w, it.h = x1-x0+2*graphBoxPad, bottom-top
+	return bottom + graphRowGap
+}
+
+// assignStageFills gives each fused stage, which executes multiple drawn leaf transforms, a color.
+func (g *pipelineGraph) assignStageFills() {
+	counts := map[string]int{}
+	var order []string
+	for _, n := range g.nodes {
+		if len(n.t.GetSubtransforms()) > 0 {
+			continue
+		}
+		for _, s := range nodeStages(n) {
+			if counts[s] == 0 {
+				order = append(order, s)
+			}
+			counts[s]++
+		}
+	}
+	g.stageFill = map[string]string{}
+	for _, s := range order {
+		if counts[s] > 1 {
+			g.stageFill[s] = graphStageColors[len(g.stageFill)%len(graphStageColors)]
+		}
+	}
+}
+
+// nodeStages returns the IDs of the stages executing the node's transform, if known.
+func nodeStages(it *graphItem) []string {
+	v, ok := it.t.GetAnnotations()[urns.AnnotationStages]
+	if !ok || len(v) == 0 {
+		return nil
+	}
+	return strings.Split(string(v), ",")
+}
+
+// toggleURL returns the relative URL of the page with the composite's expansion toggled.
+func (g *pipelineGraph) toggleURL(tid string) string {
+	var ids []string
+	if g.expandAll {
+		// Collapsing a composite from the fully expanded graph keeps the other composites expanded.
+		for _, n := range g.allComposites() {
+			if n != tid {
+				ids = append(ids, n)
+			}
+		}
+	} else {
+		for id := range g.expanded {
+			if id != tid {
+				ids = append(ids, id)
+			}
+		}
+		if !g.expanded[tid] {
+			ids = append(ids, tid)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		return "?"
+	}
+	return "?" + url.Values{"expand": ids}.Encode()
+}
+
+// allComposites returns the IDs of the drawn composites.
+func (g *pipelineGraph) allComposites() []string {
+	var ids []string
+	var walk func(it *graphItem)
+	walk = func(it *graphItem) {
+		if len(it.t.GetSubtransforms()) > 0 {
+			ids = append(ids, it.id)
+		}
+		for _, c := range it.children {
+			walk(c)
+		}
+	}
+	for _, it := range g.roots {
+		walk(it)
+	}
+	return ids
+}
+
+// SVG renders the graph as an inline SVG element.
+func (g *pipelineGraph) SVG() template.HTML {
+	var maxX, maxY float64
+	var visit func(it *graphItem)
+	visit = func(it *graphItem) {
+		if it.x+it.w > maxX {
+			maxX = it.x + it.w
+		}
+		if it.y+it.h > maxY {
+			maxY = it.y + it.h
+		}
+		for _, c := range it.children {
+			visit(c)
+		}
+	}
+	for _, it := range g.roots {
+		visit(it)
+	}
+	// Expanded boxes may extend left of the margin, so shift the drawing right.
+	shift := float64(graphBoxPad * g.maxDepth())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="pipeline-graph" xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f">`, maxX+shift+graphMargin, maxY+graphMargin)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z"/></marker></defs>`)
+	fmt.Fprintf(&b, `<g transform="translate(%.0f,0)">`, shift)
+	for _, it := range g.roots {
+		g.writeBoxes(&b, it)
+	}
+	for _, e := range g.edges {
+		writeEdge(&b, e)
+	}
+	for _, n := range g.nodes {
+		g.writeNode(&b, n)
+	}
+	b.WriteString(`</g></svg>`)
+	return template.HTML(b.String())
+}
+
+// maxDepth returns the maximum nesting of expanded composites.
+func (g *pipelineGraph) maxDepth() int {
+	var depth func(it *graphItem) int
+	depth = func(it *graphItem) int {
+		if !it.expanded {
+			return 0
+		}
+		d := 0
+		for _, c := range it.children {
+			if cd := depth(c); cd > d {
+				d = cd
+			}
+		}
+		return d + 1
+	}
+	max := 0
+	for _, it := range g.roots {
+		if d := depth(it); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// writeBoxes draws the boxes of expanded composites, outermost first.
+func (g *pipelineGraph) writeBoxes(b *strings.Builder, it *graphItem) {
+	if !it.expanded {
+		return
+	}
+	name := html.EscapeString(it.t.GetUniqueName())
+	fmt.Fprintf(b, `<g class="composite"><title>%s</title>`, name)
+	fmt.Fprintf(b, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="6"/>`, it.x, it.y, it.w, it.h)
+	label := "[-] " + shortName(it.t.GetUniqueName())
+	// Transforms replaced by the runner, like lifted combines, execute in the composite's stages.
+	if stages := nodeStages(it); len(stages) > 0 {
+		label += " (" + strings.Join(stages, ", ") + ")"
+	}
+	fmt.Fprintf(b, `<a href="%s"><text x="%.0f" y="%.0f">%s</text></a></g>`,
+		html.EscapeString(g.toggleURL(it.id)), it.x+graphBoxPad, it.y+graphBoxLabelH-6, html.EscapeString(label))
+	for _, c := range it.children {
+		g.writeBoxes(b, c)
+	}
+}
+
+// writeNode draws a leaf transform, or a collapsed composite.
+func (g *pipelineGraph) writeNode(b *strings.Builder, n *graphItem) {
+	name := n.t.GetUniqueName()
+	composite := len(n.t.GetSubtransforms()) > 0
+	stages := nodeStages(n)
+
+	class, fill := "transform", ""
+	if composite {
+		class = "transform collapsed"
+	} else if len(stages) == 1 {
+		if f, ok := g.stageFill[stages[0]]; ok {
+			class, fill = "transform fused", fmt.Sprintf(` style="fill:%s"`, f)
+		}
+	}
+	detail := strings.Join(stages, ", ")
+	if composite {
+		detail = fmt.Sprintf("%d transforms", len(n.t.GetSubtransforms()))
+		if len(stages) > 0 {
+			detail += " in " + strings.Join(stages, ", ")
+		}
+	}
+
+	fmt.Fprintf(b, `<g class="%s"><title>%s</title>`, class, html.EscapeString(name))
+	if composite {
+		fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(g.toggleURL(n.id)))
+	}
+	fmt.Fprintf(b, `<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" rx="4"%s/>`, n.x, n.y, n.w, n.h, fill)
+	label := shortName(name)
+	if composite {
+		label = "[+] " + label
+	}
+	fmt.Fprintf(b, `<text x="%.0f" y="%.0f">%s</text>`, n.x+8, n.y+18, html.EscapeString(label))
+	fmt.Fprintf(b, `<text class="detail" x="%.0f" y="%.0f">%s</text>`, n.x+8, n.y+35, html.EscapeString(detail))
+	if composite {
+		b.WriteString(`</a>`)
+	}
+	b.WriteString(`</g>`)
+}
+
+// writeEdge draws an edge as a curve, from the right of the producer, to the left of the consumer.
+func writeEdge(b *strings.Builder, e graphEdge) {
+	x1, y1 := e.from.x+e.from.w, e.from.y+e.from.h/2
+	x2, y2 := e.to.x, e.to.y+e.to.h/2
+	dx := (x2 - x1) / 2
+	if dx < graphColW/4 {
+		dx = graphColW / 4
+	}
+	fmt.Fprintf(b, `<g class="edge"><path d="M %.0f %.0f C %.0f %.0f, %.0f %.0f, %.0f %.0f" marker-end="url(#arrow)"/>`,
+		x1, y1, x1+dx, y1, x2-dx, y2, x2, y2)
+	if e.label != "" {
+		fmt.Fprintf(b, `<text x="%.0f" y="%.0f" text-anchor="middle">%s</text>`, (x1+x2)/2, (y1+y2)/2-4, html.EscapeString(e.label))
+	}
+	b.WriteString(`</g>`)
+}
+
+// shortName abbreviates a transform's unique name to its last path segments, to fit in a node.
+func shortName(name string) string {
+	for len(name) > graphNameChars {
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return name[:graphNameChars-3] + "..."
+		}
+		name = name[i+1:]
+	}
+	return name
+}
+
+// graphExpansion returns the expanded composites, and whether all composites are expanded,
+// from the query parameters of a job details request.
+func graphExpansion(q url.Values) (map[string]bool, bool) {
+	expanded := map[string]bool{}
+	for _, id := range q["expand"] {
+		expanded[id] = true
+	}
+	all, _ := strconv.ParseBool(q.Get("expand_all"))
+	return expanded, all
+}
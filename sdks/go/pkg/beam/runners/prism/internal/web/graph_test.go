@@ -0,0 +1,157 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/metrics"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/google/go-cmp/cmp"
+)
+
+// graphTestPipeline is impulse -> composite(pardo -> gbk) -> sink,
+// with the pardo and sink fused in a single stage.
+func graphTestPipeline() *pipepb.Pipeline {
+	return &pipepb.Pipeline{
+		RootTransformIds: []string{"impulse", "comp", "sink"},
+		Components: &pipepb.Components{
+			Transforms: map[string]*pipepb.PTransform{
+				"impulse": {
+					UniqueName:  "Impulse",
+					Outputs:     map[string]string{"o": "p0"},
+					Annotations: map[string][]byte{urns.AnnotationStages: []byte("stage-000"), urns.AnnotationOutputWatermarkPrefix + "o": []byte("1000")},
+				},
+				"comp": {
+					UniqueName:    "Composite",
+					Subtransforms: []string{"pardo", "gbk"},
+					Inputs:        map[string]string{"i": "p0"},
+					Outputs:       map[string]string{"o": "p2"},
+				},
+				"pardo": {
+					UniqueName:  "Composite/ParDo",
+					Inputs:      map[string]string{"i": "p0"},
+					Outputs:     map[string]string{"o": "p1"},
+					Annotations: map[string][]byte{urns.AnnotationStages: []byte("stage-001")},
+				},
+				"gbk": {
+					UniqueName:  "Composite/GBK",
+					Inputs:      map[string]string{"i": "p1"},
+					Outputs:     map[string]string{"o": "p2"},
+					Annotations: map[string][]byte{urns.AnnotationStages: []byte("stage-002")},
+				},
+				"sink": {
+					UniqueName:  "Sink",
+					Inputs:      map[string]string{"i": "p2"},
+					Annotations: map[string][]byte{urns.AnnotationStages: []byte("stage-001")},
+				},
+			},
+		},
+	}
+}
+
+func graphEdgeNames(g *pipelineGraph) []string {
+	var ret []string
+	for _, e := range g.edges {
+		ret = append(ret, e.from.id+"->"+e.to.id)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestPipelineGraph_Collapsed(t *testing.T) {
+	pcols := map[metrics.StepKey]metrics.PColResult{
+		{Step: "Impulse.o"}: {Committed: metrics.PColValue{ElementCount: 1}},
+	}
+	g := newPipelineGraph(graphTestPipeline(), pcols, nil, false)
+
+	if d := cmp.Diff([]string{"comp->sink", "impulse->comp"}, graphEdgeNames(g)); d != "" {
+		t.Errorf("edges (-want, +got):\n%v", d)
+	}
+	layers := map[string]int{}
+	for _, n := range g.nodes {
+		layers[n.id] = n.layer
+	}
+	if d := cmp.Diff(map[string]int{"impulse": 0, "comp": 1, "sink": 2}, layers); d != "" {
+		t.Errorf("layers (-want, +got):\n%v", d)
+	}
+	for _, e := range g.edges {
+		if e.from.id == "impulse" {
+			if got, want := e.label, "1 elements, wm 1970-01-01T00:00:01.000Z"; got != want {
+				t.Errorf("impulse edge label = %q, want %q", got, want)
+			}
+		}
+	}
+
+	svg := string(g.SVG())
+	if !strings.Contains(svg, `href="?expand=comp"`) {
+		t.Errorf("SVG() doesn't link to expand the composite:\n%v", svg)
+	}
+}
+
+func TestPipelineGraph_Expanded(t *testing.T) {
+	g := newPipelineGraph(graphTestPipeline(), nil, map[string]bool{"comp": true}, false)
+
+	if d := cmp.Diff([]string{"gbk->sink", "impulse->pardo", "pardo->gbk"}, graphEdgeNames(g)); d != "" {
+		t.Errorf("edges (-want, +got):\n%v", d)
+	}
+	comp := g.roots[1]
+	if !comp.expanded {
+		t.Fatalf("composite isn't expanded")
+	}
+	// The composite's box contains its subtransforms, and not its siblings.
+	for _, c := range comp.children {
+		if c.x < comp.x || c.y < comp.y || c.x+c.w > comp.x+comp.w || c.y+c.h > comp.y+comp.h {
+			t.Errorf("subtransform %v at (%v,%v,%v,%v) outside composite box (%v,%v,%v,%v)", c.id, c.x, c.y, c.w, c.h, comp.x, comp.y, comp.w, comp.h)
+		}
+	}
+	for _, sib := range []*graphItem{g.roots[0], g.roots[2]} {
+		if sib.y+sib.h > comp.y && sib.y < comp.y+comp.h {
+			t.Errorf("sibling %v overlaps composite box vertically", sib.id)
+		}
+	}
+	// The pardo and sink are fused into stage-001.
+	if _, ok := g.stageFill["stage-001"]; !ok {
+		t.Errorf("stage-001 isn't marked as fused: %v", g.stageFill)
+	}
+	if _, ok := g.stageFill["stage-002"]; ok {
+		t.Errorf("stage-002 is marked as fused: %v", g.stageFill)
+	}
+	if got, want := g.toggleURL("comp"), "?"; got != want {
+		t.Errorf("toggleURL(comp) = %q, want %q", got, want)
+	}
+}
+
+func TestGraphExpansion(t *testing.T) {
+	q, err := url.ParseQuery("expand=a&expand=b%2Fc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, all := graphExpansion(q)
+	if d := cmp.Diff(map[string]bool{"a": true, "b/c": true}, expanded); d != "" {
+		t.Errorf("graphExpansion() (-want, +got):\n%v", d)
+	}
+	if all {
+		t.Errorf("graphExpansion() expandAll = true, want false")
+	}
+	if _, all := graphExpansion(url.Values{"expand_all": {"true"}}); !all {
+		t.Errorf("graphExpansion(expand_all=true) expandAll = false, want true")
+	}
+}
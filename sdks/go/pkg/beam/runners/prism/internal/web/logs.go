@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+)
+
+// importanceName returns the name of a message importance, without its "JOB_MESSAGE_" prefix.
+func importanceName(imp jobpb.JobMessage_MessageImportance) string {
+	return strings.TrimPrefix(imp.String(), "JOB_MESSAGE_")
+}
+
+// jobMessagesSource is implemented by clients of in process job servers, which
+// can provide the structured messages of jobs.
+type jobMessagesSource interface {
+	JobMessages(jobID string, filter jobservices.MessageFilter) []jobservices.JobMessage
+}
+
+// logsData is the data of the job logs page.
+type logsData struct {
+	JobID       string
+	Filter      jobservices.MessageFilter
+	Importances []jobpb.JobMessage_MessageImportance // Importances to filter by, least first.
+	Messages    []jobservices.JobMessage
+	JSONURL     string // URL of the filtered messages as JSON.
+
+	errorHolder
+}
+
+// logsHandler serves the messages of a job, filtered by the query parameters
+// "importance", "transform", and "text". See jobservices.MessageFilter.
+//
+// Messages are rendered as a page, or as JSON with the "format=json" parameter.
+type logsHandler struct {
+	Jobcli jobpb.JobServiceClient
+}
+
+func (h *logsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	jobID := path[strings.LastIndex(path, "/")+1:]
+
+	src, ok := h.Jobcli.(jobMessagesSource)
+	if !ok {
+		http.Error(w, "job logs are only available from an in process job server", http.StatusNotFound)
+		return
+	}
+	if _, err := h.Jobcli.GetState(r.Context(), &jobpb.GetJobStateRequest{JobId: jobID}); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	filter := jobservices.MessageFilter{
+		Transform: q.Get("transform"),
+		Text:      q.Get("text"),
+	}
+	if v := q.Get("importance"); v != "" {
+		imp, err := jobservices.ParseImportance(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.MinImportance = imp
+	}
+	msgs := src.JobMessages(jobID, filter)
+
+	if q.Get("format") == "json" {
+		if msgs == nil {
+			msgs = []jobservices.JobMessage{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(msgs)
+		return
+	}
+	q.Set("format", "json")
+	data := logsData{
+		JobID:    jobID,
+		Filter:   filter,
+		Messages: msgs,
+		JSONURL:  r.URL.Path + "?" + q.Encode(),
+		Importances: []jobpb.JobMessage_MessageImportance{
+			jobpb.JobMessage_JOB_MESSAGE_DEBUG,
+			jobpb.JobMessage_JOB_MESSAGE_DETAILED,
+			jobpb.JobMessage_JOB_MESSAGE_BASIC,
+			jobpb.JobMessage_JOB_MESSAGE_WARNING,
+			jobpb.JobMessage_JOB_MESSAGE_ERROR,
+		},
+	}
+	renderPage(logsPage, &data, w)
+}
@@ -0,0 +1,101 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+)
+
+// messagesJobClient is a job client with the messages of a single job.
+type messagesJobClient struct {
+	jobpb.JobServiceClient
+	jobID   string
+	msgs    []jobservices.JobMessage
+	filters []jobservices.MessageFilter // Filters of calls to JobMessages.
+}
+
+func (c *messagesJobClient) GetState(_ context.Context, req *jobpb.GetJobStateRequest, _ ...grpc.CallOption) (*jobpb.JobStateEvent, error) {
+	if req.GetJobId() != c.jobID {
+		return nil, fmt.Errorf("job with id %v not found", req.GetJobId())
+	}
+	return &jobpb.JobStateEvent{State: jobpb.JobState_RUNNING}, nil
+}
+
+func (c *messagesJobClient) JobMessages(_ string, filter jobservices.MessageFilter) []jobservices.JobMessage {
+	c.filters = append(c.filters, filter)
+	return c.msgs
+}
+
+func TestLogsHandler(t *testing.T) {
+	cli := &messagesJobClient{
+		jobID: "job-001",
+		msgs: []jobservices.JobMessage{{
+			Importance: jobpb.JobMessage_JOB_MESSAGE_WARNING,
+			Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Text:       "<squeamish> ossiphrage",
+			Stage:      "stage-001",
+			Transform:  "parse",
+		}},
+	}
+	h := &logsHandler{Jobcli: cli}
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/logs/job-001?importance=warning&transform=Parse&text=oss")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("page status = %v, want %v: %v", rec.Code, http.StatusOK, rec.Body)
+	}
+	for _, want := range []string{"&lt;squeamish&gt; ossiphrage", "stage-001", "WARNING", `value="Parse"`, "format=json"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("page doesn't contain %q:\n%v", want, rec.Body)
+		}
+	}
+	wantFilter := jobservices.MessageFilter{MinImportance: jobpb.JobMessage_JOB_MESSAGE_WARNING, Transform: "Parse", Text: "oss"}
+	if d := cmp.Diff([]jobservices.MessageFilter{wantFilter}, cli.filters); d != "" {
+		t.Errorf("JobMessages() filters diff (-want, +got):\n%v", d)
+	}
+
+	rec = serve("/logs/job-001?format=json")
+	var got []jobservices.JobMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%v) = %v", rec.Body, err)
+	}
+	if d := cmp.Diff(cli.msgs, got); d != "" {
+		t.Errorf("JSON messages diff (-want, +got):\n%v", d)
+	}
+
+	if rec := serve("/logs/job-001?importance=loud"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid importance status = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+	if rec := serve("/logs/job-002"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,305 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"golang.org/x/exp/slog"
+)
+
+// stageStatsSource is implemented by clients of in process job servers, which
+// can provide the runner's execution statistics for jobs.
+type stageStatsSource interface {
+	StageStats(jobID string) []engine.StageStats
+}
+
+// metricsHandler serves the metrics of all jobs in the Prometheus text exposition format.
+//
+// Job metrics reported by SDKs are labeled with the job, and the transform, PCollection,
+// namespace, and name as applicable. Stage execution statistics are included if the
+// job server is in the same process.
+type metricsHandler struct {
+	Jobcli jobpb.JobServiceClient
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	resp, err := h.Jobcli.GetJobs(ctx, &jobpb.GetJobsRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jobs := resp.GetJobInfo()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].GetJobId() < jobs[j].GetJobId()
+	})
+
+	fams := promFamilies{}
+	for _, j := range jobs {
+		jobID := j.GetJobId()
+		metsResp, err := h.Jobcli.GetJobMetrics(ctx, &jobpb.GetJobMetricsRequest{JobId: jobID})
+		if err != nil {
+			slog.Debug("metrics unavailable for job", slog.String("job", jobID), slog.Any("error", err))
+			continue
+		}
+		// Label transforms and PCollections by their names where possible.
+		pipeResp, err := h.Jobcli.GetPipeline(ctx, &jobpb.GetJobPipelineRequest{JobId: jobID})
+		if err != nil {
+			slog.Debug("pipeline unavailable for job", slog.String("job", jobID), slog.Any("error", err))
+		}
+		fams.addMonitoringInfos(jobID, pipeResp.GetPipeline().GetComponents(), metsResp.GetMetrics().GetCommitted())
+		if src, ok := h.Jobcli.(stageStatsSource); ok {
+			fams.addStageStats(jobID, src.StageStats(jobID))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := fams.write(w); err != nil {
+		// Headers have already been sent, so the error can only be logged.
+		slog.Warn("unable to write metrics", slog.Any("error", err))
+	}
+}
+
+type promLabel struct {
+	name, value string
+}
+
+type promSample struct {
+	suffix string // Appended to the family name, such as "_bucket" for histograms.
+	labels []promLabel
+	value  float64
+}
+
+type promFamily struct {
+	typ, help string
+	samples   []promSample
+}
+
+// promFamilies holds metric families by name, so all samples of a family
+// are written together, as the exposition format requires.
+type promFamilies map[string]*promFamily
+
+func (fs promFamilies) add(name, typ, help, suffix string, labels []promLabel, v float64) {
+	f, ok := fs[name]
+	if !ok {
+		f = &promFamily{typ: typ, help: help}
+		fs[name] = f
+	}
+	f.samples = append(f.samples, promSample{suffix: suffix, labels: labels, value: v})
+}
+
+// write writes the families in the Prometheus text exposition format, ordered by name.
+func (fs promFamilies) write(w io.Writer) error {
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := fs[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.typ)
+		for _, s := range f.samples {
+			bw.WriteString(name + s.suffix)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l.name, escapeLabelValue(l.value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatPromValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	metricUrnVersion = regexp.MustCompile(`:v[0-9]+$`)
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// promMetricName derives a metric family name from a Beam metric urn.
+// For example, "beam:metric:user:sum_int64:v1" becomes "beam_user_sum_int64".
+func promMetricName(urn string) string {
+	name := strings.TrimPrefix(urn, "beam:metric:")
+	name = metricUrnVersion.ReplaceAllString(name, "")
+	return "beam_" + invalidNameChars.ReplaceAllString(name, "_")
+}
+
+// monitoringLabels converts the labels of a MonitoringInfo, prefixed by the job label.
+// Transforms and PCollections are labeled by their unique names, if known.
+func monitoringLabels(jobID string, comps *pipepb.Components, miLabels map[string]string) []promLabel {
+	keys := make([]string, 0, len(miLabels))
+	for k := range miLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	labels := []promLabel{{"job", jobID}}
+	for _, k := range keys {
+		v := miLabels[k]
+		switch k {
+		case "PTRANSFORM":
+			if t, ok := comps.GetTransforms()[v]; ok {
+				v = t.GetUniqueName()
+			}
+			labels = append(labels, promLabel{"transform", v})
+		case "PCOLLECTION":
+			if pc, ok := comps.GetPcollections()[v]; ok {
+				v = pc.GetUniqueName()
+			}
+			labels = append(labels, promLabel{"pcollection", v})
+		default:
+			labels = append(labels, promLabel{invalidNameChars.ReplaceAllString(strings.ToLower(k), "_"), v})
+		}
+	}
+	return labels
+}
+
+// addMonitoringInfos adds the job's metrics. Metrics of types without a
+// Prometheus equivalent, such as progress, are skipped.
+func (fs promFamilies) addMonitoringInfos(jobID string, comps *pipepb.Components, infos []*pipepb.MonitoringInfo) {
+	for _, mi := range infos {
+		name := promMetricName(mi.GetUrn())
+		help := "Beam metric " + mi.GetUrn()
+		labels := monitoringLabels(jobID, comps, mi.GetLabels())
+		buf := bytes.NewBuffer(mi.GetPayload())
+		var err error
+		switch mi.GetType() {
+		case urns.MetricTypeSumInt64:
+			var v int64
+			if v, err = coder.DecodeVarInt(buf); err == nil {
+				fs.add(name+"_total", "counter", help, "", labels, float64(v))
+			}
+		case urns.MetricTypeSumDouble:
+			var v float64
+			if v, err = coder.DecodeDouble(buf); err == nil {
+				fs.add(name+"_total", "counter", help, "", labels, v)
+			}
+		case urns.MetricTypeDistributionInt64:
+			var vs [4]int64 // count, sum, min, max
+			for i := range vs {
+				if vs[i], err = coder.DecodeVarInt(buf); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				fs.add(name, "summary", help, "_count", labels, float64(vs[0]))
+				fs.add(name, "summary", help, "_sum", labels, float64(vs[1]))
+				fs.add(name+"_min", "gauge", help+" minimum", "", labels, float64(vs[2]))
+				fs.add(name+"_max", "gauge", help+" maximum", "", labels, float64(vs[3]))
+			}
+		case urns.MetricTypeLatestInt64:
+			// The payload is the timestamp of the value, followed by the value.
+			if _, err = coder.DecodeVarInt(buf); err == nil {
+				var v int64
+				if v, err = coder.DecodeVarInt(buf); err == nil {
+					fs.add(name, "gauge", help, "", labels, float64(v))
+				}
+			}
+		}
+		if err != nil {
+			slog.Debug("unable to decode metric", slog.String("job", jobID), slog.String("urn", mi.GetUrn()), slog.Any("error", err))
+		}
+	}
+}
+
+// watermarkSeconds converts a watermark to seconds since the epoch, with
+// the minimum and maximum timestamps as negative and positive infinity.
+func watermarkSeconds(t mtime.Time) float64 {
+	switch {
+	case t <= mtime.MinTimestamp:
+		return math.Inf(-1)
+	case t >= mtime.MaxTimestamp:
+		return math.Inf(1)
+	}
+	return float64(t) / 1000
+}
+
+// addStageStats adds the runner's execution statistics for the job's stages.
+func (fs promFamilies) addStageStats(jobID string, stats []engine.StageStats) {
+	for _, st := range stats {
+		labels := []promLabel{{"job", jobID}, {"stage", st.ID}}
+		fs.add("prism_stage_pending_elements", "gauge", "Elements waiting to be processed by the stage.", "", labels, float64(st.PendingElements))
+		fs.add("prism_stage_inprogress_bundles", "gauge", "Bundles currently being processed by the stage.", "", labels, float64(st.InprogressBundles))
+		fs.add("prism_stage_input_watermark_seconds", "gauge", "Input watermark of the stage, in seconds since the epoch.", "", labels, watermarkSeconds(st.InputWatermark))
+		fs.add("prism_stage_output_watermark_seconds", "gauge", "Output watermark of the stage, in seconds since the epoch.", "", labels, watermarkSeconds(st.OutputWatermark))
+		fs.add("prism_stage_spilled_elements", "gauge", "Pending elements of the stage currently paged out to disk.", "", labels, float64(st.SpilledElements))
+		fs.add("prism_stage_spilled_bytes_total", "counter", "Bytes of the stage's pending elements paged out to disk.", "", labels, float64(st.SpilledBytes))
+		fs.add("prism_stage_dropped_late_elements_total", "counter", "Elements dropped by the stage for arriving after their window expired.", "", labels, float64(st.DroppedLate))
+
+		const latency, latencyHelp = "prism_stage_bundle_latency_seconds", "Time from starting to persisting the stage's bundles."
+		var cumulative int64
+		for i, bound := range engine.BundleLatencyBuckets {
+			if i < len(st.BundleLatency.Buckets) {
+				cumulative += st.BundleLatency.Buckets[i]
+			}
+			le := append(labels[:len(labels):len(labels)], promLabel{"le", formatPromValue(bound.Seconds())})
+			fs.add(latency, "histogram", latencyHelp, "_bucket", le, float64(cumulative))
+		}
+		le := append(labels[:len(labels):len(labels)], promLabel{"le", "+Inf"})
+		fs.add(latency, "histogram", latencyHelp, "_bucket", le, float64(st.BundleLatency.Count))
+		fs.add(latency, "histogram", latencyHelp, "_sum", labels, st.BundleLatency.Sum.Seconds())
+		fs.add(latency, "histogram", latencyHelp, "_count", labels, float64(st.BundleLatency.Count))
+	}
+}
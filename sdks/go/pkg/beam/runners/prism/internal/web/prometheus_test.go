@@ -0,0 +1,137 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+)
+
+func TestPromMetricName(t *testing.T) {
+	tests := []struct {
+		urn, want string
+	}{
+		{"beam:metric:user:sum_int64:v1", "beam_user_sum_int64"},
+		{"beam:metric:element_count:v1", "beam_element_count"},
+		{"beam:metric:pardo_execution_time:process_bundle_msecs:v1", "beam_pardo_execution_time_process_bundle_msecs"},
+		{"custom.metric-urn", "beam_custom_metric_urn"},
+	}
+	for _, test := range tests {
+		if got := promMetricName(test.urn); got != test.want {
+			t.Errorf("promMetricName(%q) = %q, want %q", test.urn, got, test.want)
+		}
+	}
+}
+
+func TestPromFamilies(t *testing.T) {
+	comps := &pipepb.Components{
+		Transforms: map[string]*pipepb.PTransform{
+			"e1": {UniqueName: "ParDo(\"count\")"},
+		},
+		Pcollections: map[string]*pipepb.PCollection{
+			"n1": {UniqueName: "ParDo.out"},
+		},
+	}
+	infos := []*pipepb.MonitoringInfo{
+		{
+			Urn:     "beam:metric:user:sum_int64:v1",
+			Type:    urns.MetricTypeSumInt64,
+			Payload: []byte{5},
+			Labels:  map[string]string{"PTRANSFORM": "e1", "NAMESPACE": "ns", "NAME": "things"},
+		}, {
+			Urn:     "beam:metric:element_count:v1",
+			Type:    urns.MetricTypeSumInt64,
+			Payload: []byte{3},
+			Labels:  map[string]string{"PCOLLECTION": "n1"},
+		}, {
+			Urn:     "beam:metric:user:distribution_int64:v1",
+			Type:    urns.MetricTypeDistributionInt64,
+			Payload: []byte{2, 10, 4, 6},
+			Labels:  map[string]string{"PTRANSFORM": "e1", "NAMESPACE": "ns", "NAME": "sizes"},
+		}, {
+			Urn:     "beam:metric:user:latest_int64:v1",
+			Type:    urns.MetricTypeLatestInt64,
+			Payload: []byte{100, 7},
+			Labels:  map[string]string{"PTRANSFORM": "e1", "NAMESPACE": "ns", "NAME": "level"},
+		},
+	}
+	var latency engine.Histogram
+	latency.Buckets = make([]int64, len(engine.BundleLatencyBuckets)+1)
+	latency.Buckets[0] = 1
+	latency.Buckets[len(engine.BundleLatencyBuckets)] = 1
+	latency.Count = 2
+	latency.Sum = 2 * time.Minute
+	stats := []engine.StageStats{{
+		ID:                "stage-001",
+		PendingElements:   4,
+		InprogressBundles: 1,
+		InputWatermark:    mtime.FromMilliseconds(1500),
+		OutputWatermark:   mtime.MinTimestamp,
+		BundleLatency:     latency,
+		SpilledElements:   2,
+		SpilledBytes:      512,
+		DroppedLate:       3,
+	}}
+
+	fams := promFamilies{}
+	fams.addMonitoringInfos("job-001", comps, infos)
+	fams.addStageStats("job-001", stats)
+	var buf strings.Builder
+	if err := fams.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"# TYPE beam_user_sum_int64_total counter\n",
+		`beam_user_sum_int64_total{job="job-001",name="things",namespace="ns",transform="ParDo(\"count\")"} 5` + "\n",
+		`beam_element_count_total{job="job-001",pcollection="ParDo.out"} 3` + "\n",
+		"# TYPE beam_user_distribution_int64 summary\n",
+		`beam_user_distribution_int64_count{job="job-001",name="sizes",namespace="ns",transform="ParDo(\"count\")"} 2` + "\n",
+		`beam_user_distribution_int64_sum{job="job-001",name="sizes",namespace="ns",transform="ParDo(\"count\")"} 10` + "\n",
+		`beam_user_distribution_int64_max{job="job-001",name="sizes",namespace="ns",transform="ParDo(\"count\")"} 6` + "\n",
+		`beam_user_latest_int64{job="job-001",name="level",namespace="ns",transform="ParDo(\"count\")"} 7` + "\n",
+		`prism_stage_pending_elements{job="job-001",stage="stage-001"} 4` + "\n",
+		`prism_stage_inprogress_bundles{job="job-001",stage="stage-001"} 1` + "\n",
+		`prism_stage_input_watermark_seconds{job="job-001",stage="stage-001"} 1.5` + "\n",
+		`prism_stage_output_watermark_seconds{job="job-001",stage="stage-001"} -Inf` + "\n",
+		`prism_stage_spilled_elements{job="job-001",stage="stage-001"} 2` + "\n",
+		"# TYPE prism_stage_spilled_bytes_total counter\n",
+		`prism_stage_spilled_bytes_total{job="job-001",stage="stage-001"} 512` + "\n",
+		"# TYPE prism_stage_dropped_late_elements_total counter\n",
+		`prism_stage_dropped_late_elements_total{job="job-001",stage="stage-001"} 3` + "\n",
+		"# TYPE prism_stage_bundle_latency_seconds histogram\n",
+		`prism_stage_bundle_latency_seconds_bucket{job="job-001",stage="stage-001",le="0.001"} 1` + "\n",
+		`prism_stage_bundle_latency_seconds_bucket{job="job-001",stage="stage-001",le="60"} 1` + "\n",
+		`prism_stage_bundle_latency_seconds_bucket{job="job-001",stage="stage-001",le="+Inf"} 2` + "\n",
+		`prism_stage_bundle_latency_seconds_sum{job="job-001",stage="stage-001"} 120` + "\n",
+		`prism_stage_bundle_latency_seconds_count{job="job-001",stage="stage-001"} 2` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("write() output missing %q, got:\n%v", want, got)
+		}
+	}
+	// Each family is described exactly once.
+	if n := strings.Count(got, "# TYPE prism_stage_bundle_latency_seconds "); n != 1 {
+		t.Errorf("write() described the latency histogram %v times, want 1", n)
+	}
+}
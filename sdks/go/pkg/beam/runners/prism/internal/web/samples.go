@@ -0,0 +1,94 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+)
+
+// elementSamplesSource is implemented by clients of in process job servers, which
+// can provide the recent elements of the PCollections of jobs.
+type elementSamplesSource interface {
+	ElementSamples(jobID string) map[string][]jobservices.ElementSample
+}
+
+// pcolSamples are the recent elements of a PCollection.
+type pcolSamples struct {
+	PCollection string                      `json:"pcollection"` // The PCollection ID.
+	Name        string                      `json:"name"`
+	Samples     []jobservices.ElementSample `json:"samples"`
+}
+
+// collectSamples returns the recent elements of the job's PCollections, ordered by
+// PCollection name, and whether samples are available from the job client.
+func collectSamples(jobcli jobpb.JobServiceClient, jobID string, p *pipepb.Pipeline) ([]pcolSamples, bool) {
+	src, ok := jobcli.(elementSamplesSource)
+	if !ok {
+		return nil, false
+	}
+	pcols := p.GetComponents().GetPcollections()
+	var ret []pcolSamples
+	for id, samples := range src.ElementSamples(jobID) {
+		// The runner may introduce PCollections that aren't in the submitted pipeline.
+		name := id
+		if pc, ok := pcols[id]; ok {
+			name = pc.GetUniqueName()
+		}
+		ret = append(ret, pcolSamples{PCollection: id, Name: name, Samples: samples})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name == ret[j].Name {
+			return ret[i].PCollection < ret[j].PCollection
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, true
+}
+
+// samplesHandler serves the recent elements of a job's PCollections as JSON.
+type samplesHandler struct {
+	Jobcli jobpb.JobServiceClient
+}
+
+func (h *samplesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	jobID := path[strings.LastIndex(path, "/")+1:]
+
+	pipeResp, err := h.Jobcli.GetPipeline(r.Context(), &jobpb.GetJobPipelineRequest{JobId: jobID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	samples, ok := collectSamples(h.Jobcli, jobID, pipeResp.GetPipeline())
+	if !ok {
+		http.Error(w, "element samples are only available from an in process job server", http.StatusNotFound)
+		return
+	}
+	if samples == nil {
+		samples = []pcolSamples{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(samples)
+}
@@ -49,6 +49,9 @@ var jobTemplate string
 //go:embed debugz.html
 var debugzTemplate string
 
+//go:embed logs.html
+var logsTemplate string
+
 //go:embed assets/*
 var assets embed.FS
 
@@ -56,6 +59,7 @@ var (
 	indexPage  = template.Must(template.New("index").Parse(indexTemplate))
 	jobPage    = template.Must(template.New("job").Parse(jobTemplate))
 	debugzPage = template.Must(template.New("debugz").Parse(debugzTemplate))
+	logsPage   = template.Must(template.New("logs").Funcs(template.FuncMap{"importance": importanceName}).Parse(logsTemplate))
 )
 
 type pTransform struct {
@@ -92,6 +96,11 @@ type jobDetailsData struct {
 	Transforms     []pTransform
 	PCols          map[metrics.StepKey]metrics.PColResult
 	DisplayData    []*pipepb.LabelledPayload
+	Graph          template.HTML // The pipeline graph, as inline SVG.
+	Samples        []pcolSamples // Recent elements of the job's PCollections.
+	HasSamples     bool          // Whether element samples are available for the job.
+	HasLogs        bool          // Whether structured job messages are available for the job.
+	CanDrain       bool          // Whether the job is running, and may be drained.
 
 	errorHolder
 }
@@ -185,6 +194,12 @@ func (h *jobDetailsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data.PCols = pcols
+	expanded, expandAll := graphExpansion(r.URL.Query())
+	data.Graph = newPipelineGraph(pipeResp.GetPipeline(), pcols, expanded, expandAll).SVG()
+	data.Samples, data.HasSamples = collectSamples(h.Jobcli, jobID, pipeResp.GetPipeline())
+	_, data.HasLogs = h.Jobcli.(jobMessagesSource)
+	_, drainer := h.Jobcli.(jobDrainer)
+	data.CanDrain = drainer && data.State == jobpb.JobState_RUNNING
 	trs := pipeResp.GetPipeline().GetComponents().GetTransforms()
 	col2T, topo := preprocessTransforms(trs)
 
@@ -304,6 +319,10 @@ func Initialize(ctx context.Context, port int, jobcli jobpb.JobServiceClient) er
 	mux.Handle("/assets/", assetsFs)
 	mux.Handle("/job/", &jobDetailsHandler{Jobcli: jobcli})
 	mux.Handle("/debugz", &debugzHandler{})
+	mux.Handle("/metrics", &metricsHandler{Jobcli: jobcli})
+	mux.Handle("/samples/", &samplesHandler{Jobcli: jobcli})
+	mux.Handle("/logs/", &logsHandler{Jobcli: jobcli})
+	mux.Handle("/drain/", &drainHandler{Jobcli: jobcli})
 	mux.Handle("/", &jobsConsoleHandler{Jobcli: jobcli})
 
 	endpoint := fmt.Sprintf("localhost:%d", port)
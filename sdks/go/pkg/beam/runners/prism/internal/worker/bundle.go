@@ -16,9 +16,13 @@
 package worker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
@@ -34,7 +38,15 @@ type B struct {
 
 	// InputTransformID is data being sent to the SDK.
 	InputTransformID string
-	InputData        [][]byte // Data specifically for this bundle.
+	InputData        [][]byte      // Data specifically for this bundle.
+	DataDelay        time.Duration // Delay before sending each element of InputData, to test slow data delivery.
+
+	// HasTimers lists the transform and timer family pairs of the bundle's stage,
+	// sorted by transform. Each transform with timers must receive a final timer
+	// element, even if no timers fire.
+	HasTimers []engine.LinkID
+	// InputTimers is the encoded fired timers for this bundle, keyed by transform and timer family.
+	InputTimers map[engine.LinkID][]byte
 
 	// TODO change to a single map[tid] -> map[input] -> map[window] -> struct { Iter data, MultiMap data } instead of all maps.
 	// IterableSideInputData is a map from transformID, to inputID, to window, to data.
@@ -56,9 +68,22 @@ type B struct {
 	BundleErr error
 	responded bool
 
+	pagesMu    sync.Mutex
+	statePages map[string][][]byte // Remaining data of paged state responses, keyed by continuation token.
+
 	SinkToPCollection map[string]string
 }
 
+// BundleError is a failure reported by the SDK while processing a bundle.
+type BundleError struct {
+	InstID, PBDID string
+	Msg           string // The failure message from the SDK.
+}
+
+func (e *BundleError) Error() string {
+	return fmt.Sprintf("bundle %v %v failed:%v", e.InstID, e.PBDID, e.Msg)
+}
+
 // Init initializes the bundle's internal state for waiting on all
 // data and for relaying a response back.
 func (b *B) Init() {
@@ -80,6 +105,43 @@ func (b *B) DataDone() {
 	}
 }
 
+// pageState encodes the first page of the data, with at least one value and up to
+// pageSize bytes, and returns it with a continuation token for the remaining data.
+// The token is nil if there's no remaining data. Values are never split across pages.
+// A pageSize of 0 or less returns all the data in a single page.
+//
+// The remaining data is retained by the bundle, so later pages are consistent with
+// the first, even if the state changes while it's being read.
+func (b *B) pageState(data [][]byte, pageSize int) ([]byte, []byte) {
+	var buf bytes.Buffer
+	i := 0
+	for ; i < len(data); i++ {
+		if pageSize > 0 && i > 0 && buf.Len()+len(data[i]) > pageSize {
+			break
+		}
+		buf.Write(data[i])
+	}
+	if i == len(data) {
+		return buf.Bytes(), nil
+	}
+	b.pagesMu.Lock()
+	defer b.pagesMu.Unlock()
+	if b.statePages == nil {
+		b.statePages = map[string][][]byte{}
+	}
+	token := strconv.Itoa(len(b.statePages) + 1)
+	b.statePages[token] = data[i:]
+	return buf.Bytes(), []byte(token)
+}
+
+// continueState returns the remaining data for a continuation token from pageState.
+func (b *B) continueState(token []byte) ([][]byte, bool) {
+	b.pagesMu.Lock()
+	defer b.pagesMu.Unlock()
+	data, ok := b.statePages[string(token)]
+	return data, ok
+}
+
 func (b *B) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("ID", b.InstID),
@@ -93,7 +155,7 @@ func (b *B) Respond(resp *fnpb.InstructionResponse) {
 	}
 	b.responded = true
 	if resp.GetError() != "" {
-		b.BundleErr = fmt.Errorf("bundle %v %v failed:%v", resp.GetInstructionId(), b.PBDID, resp.GetError())
+		b.BundleErr = &BundleError{InstID: resp.GetInstructionId(), PBDID: b.PBDID, Msg: resp.GetError()}
 		close(b.Resp)
 		return
 	}
@@ -110,6 +172,15 @@ func (b *B) Respond(resp *fnpb.InstructionResponse) {
 // public GRPC APIs up with local calls.
 func (b *B) ProcessOn(ctx context.Context, wk *W) <-chan struct{} {
 	wk.mu.Lock()
+	if wk.Killed() {
+		// The bundle can't be processed, so fail it instead of sending it.
+		wk.mu.Unlock()
+		b.Respond(&fnpb.InstructionResponse{
+			InstructionId: b.InstID,
+			Error:         errKilled,
+		})
+		return b.DataWait
+	}
 	wk.activeInstructions[b.InstID] = b
 	wk.mu.Unlock()
 
@@ -127,6 +198,14 @@ func (b *B) ProcessOn(ctx context.Context, wk *W) <-chan struct{} {
 
 	// TODO: make batching decisions.
 	for i, d := range b.InputData {
+		if b.DataDelay > 0 {
+			select {
+			case <-time.After(b.DataDelay):
+			case <-ctx.Done():
+				b.DataDone()
+				return b.DataWait
+			}
+		}
 		select {
 		case wk.DataReqs <- &fnpb.Elements{
 			Data: []*fnpb.Elements_Data{
@@ -143,6 +222,43 @@ func (b *B) ProcessOn(ctx context.Context, wk *W) <-chan struct{} {
 			return b.DataWait
 		}
 	}
+	if len(b.InputData) == 0 {
+		// Bundles with only timers still need to close the data input.
+		select {
+		case wk.DataReqs <- &fnpb.Elements{
+			Data: []*fnpb.Elements_Data{
+				{
+					InstructionId: b.InstID,
+					TransformId:   b.InputTransformID,
+					IsLast:        true,
+				},
+			},
+		}:
+		case <-ctx.Done():
+			b.DataDone()
+			return b.DataWait
+		}
+	}
+	for i, link := range b.HasTimers {
+		// The final timer element for a transform marks the end of its timers.
+		last := i+1 == len(b.HasTimers) || b.HasTimers[i+1].Transform != link.Transform
+		select {
+		case wk.DataReqs <- &fnpb.Elements{
+			Timers: []*fnpb.Elements_Timers{
+				{
+					InstructionId: b.InstID,
+					TransformId:   link.Transform,
+					TimerFamilyId: link.Local,
+					Timers:        b.InputTimers[link],
+					IsLast:        last,
+				},
+			},
+		}:
+		case <-ctx.Done():
+			b.DataDone()
+			return b.DataWait
+		}
+	}
 	return b.DataWait
 }
 
@@ -189,3 +305,19 @@ func (b *B) Split(ctx context.Context, wk *W, fraction float64, allowedSplits []
 	}
 	return resp.GetProcessBundleSplit(), nil
 }
+
+// Finalize sends a finalization request for the given bundle to the passed in worker, blocking on the response.
+// It must only be sent after the bundle's output has been committed.
+func (b *B) Finalize(ctx context.Context, wk *W) (*fnpb.FinalizeBundleResponse, error) {
+	resp := wk.sendInstruction(ctx, &fnpb.InstructionRequest{
+		Request: &fnpb.InstructionRequest_FinalizeBundle{
+			FinalizeBundle: &fnpb.FinalizeBundleRequest{
+				InstructionId: b.InstID,
+			},
+		},
+	})
+	if resp.GetError() != "" {
+		return nil, fmt.Errorf("finalize[%v] error from SDK: %v", b.InstID, resp.GetError())
+	}
+	return resp.GetFinalizeBundle(), nil
+}
@@ -20,6 +20,7 @@ package worker
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -62,6 +63,19 @@ type W struct {
 	EnvPb                    *pipepb.Environment
 	PipelineOptions          *structpb.Struct
 
+	// StatePageSize caps the bytes of data in each response to a state request.
+	// Larger state is paged, with continuation tokens for the remaining data.
+	// 0 or less means state is never paged.
+	StatePageSize int
+
+	// Logs, if set, is called with each log entry of at least the minimum severity
+	// logged by the SDK harness while processing a bundle, along with the ID of the
+	// stage of the entry's bundle, if known.
+	//
+	// Entries outside of bundles are only logged by prism, since they include the
+	// job messages that in process SDKs log as they're received.
+	Logs func(l *fnpb.LogEntry, stageID string)
+
 	// Server management
 	lis    net.Listener
 	server *grpc.Server
@@ -70,6 +84,10 @@ type W struct {
 	inst               uint64
 	connected, stopped atomic.Bool
 
+	killMu   sync.Mutex
+	killed   chan struct{} // Closed when the worker is killed, and replaced when it's revived.
+	restarts int           // The number of times the worker has been revived.
+
 	InstReqs chan *fnpb.InstructionRequest
 	DataReqs chan *fnpb.Elements
 
@@ -99,6 +117,7 @@ func New(id, env string) *W {
 
 		InstReqs: make(chan *fnpb.InstructionRequest, 10),
 		DataReqs: make(chan *fnpb.Elements, 10),
+		killed:   make(chan struct{}),
 
 		activeInstructions: make(map[string]controlResponder),
 		Descriptors:        make(map[string]*fnpb.ProcessBundleDescriptor),
@@ -134,9 +153,12 @@ func (wk *W) LogValue() slog.Value {
 }
 
 // Stop the GRPC server.
+// Only the first call has an effect.
 func (wk *W) Stop() {
+	if wk.stopped.Swap(true) {
+		return
+	}
 	slog.Debug("stopping", "worker", wk)
-	wk.stopped.Store(true)
 	close(wk.InstReqs)
 	close(wk.DataReqs)
 	wk.server.Stop()
@@ -144,6 +166,60 @@ func (wk *W) Stop() {
 	slog.Debug("stopped", "worker", wk)
 }
 
+// Kill disconnects the SDK worker's control and data streams, as if the worker had crashed.
+// Active instructions fail, and later instructions fail without being sent, until the
+// worker is revived. Used to test how jobs behave when workers are lost.
+func (wk *W) Kill() {
+	wk.killMu.Lock()
+	select {
+	case <-wk.killed:
+		wk.killMu.Unlock()
+		return
+	default:
+		close(wk.killed)
+	}
+	wk.killMu.Unlock()
+	wk.disconnect(errKilled)
+}
+
+// errKilled is the failure of instructions to a killed worker.
+const errKilled = "SDK worker killed"
+
+// Killed returns whether the worker has been killed, and not yet revived.
+func (wk *W) Killed() bool {
+	return isClosed(wk.killedCh())
+}
+
+// killedCh returns the channel closed when the worker is next killed.
+func (wk *W) killedCh() <-chan struct{} {
+	wk.killMu.Lock()
+	defer wk.killMu.Unlock()
+	return wk.killed
+}
+
+// Revive readies a killed worker for a new SDK worker to connect to it, returning
+// whether the worker had been killed. The caller is responsible for starting the
+// new SDK worker.
+func (wk *W) Revive() bool {
+	wk.killMu.Lock()
+	defer wk.killMu.Unlock()
+	select {
+	case <-wk.killed:
+	default:
+		return false
+	}
+	wk.killed = make(chan struct{})
+	wk.restarts++
+	return true
+}
+
+// Restarts returns the number of times the worker has been revived.
+func (wk *W) Restarts() int {
+	wk.killMu.Lock()
+	defer wk.killMu.Unlock()
+	return wk.restarts
+}
+
 func (wk *W) NextInst() string {
 	return fmt.Sprintf("inst-%v-%03d", wk.Env, atomic.AddUint64(&wk.inst, 1))
 }
@@ -160,6 +236,7 @@ func (wk *W) GetProvisionInfo(_ context.Context, _ *fnpb.GetProvisionInfoRequest
 			// TODO: Include runner capabilities with the per job configuration.
 			RunnerCapabilities: []string{
 				urns.CapabilityMonitoringInfoShortIDs,
+				urns.CapabilitySortedMultimapKeys,
 			},
 			LoggingEndpoint: endpoint,
 			ControlEndpoint: endpoint,
@@ -200,8 +277,6 @@ func (wk *W) Logging(stream fnpb.BeamFnLogging_LoggingServer) error {
 		}
 		for _, l := range in.GetLogEntries() {
 			if l.Severity >= minsev {
-				// TODO: Connect to the associated Job for this worker instead of
-				// logging locally for SDK side logging.
 				file := l.GetLogLocation()
 				i := strings.LastIndex(file, ":")
 				line, _ := strconv.Atoi(file[i+1:])
@@ -217,11 +292,28 @@ func (wk *W) Logging(stream fnpb.BeamFnLogging_LoggingServer) error {
 					slog.Time(slog.TimeKey, l.GetTimestamp().AsTime()),
 					slog.Any("worker", wk),
 				)
+				if wk.Logs != nil && l.GetInstructionId() != "" {
+					wk.Logs(l, wk.instructionStage(l.GetInstructionId()))
+				}
 			}
 		}
 	}
 }
 
+// instructionStage returns the ID of the stage of the active bundle with the
+// given instruction ID, or "" if there isn't one.
+func (wk *W) instructionStage(instID string) string {
+	if instID == "" {
+		return ""
+	}
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	if b, ok := wk.activeInstructions[instID].(*B); ok {
+		return b.PBDID
+	}
+	return ""
+}
+
 func toSlogSev(sev fnpb.LogEntry_Severity_Enum) slog.Level {
 	switch sev {
 	case fnpb.LogEntry_Severity_TRACE:
@@ -250,7 +342,7 @@ func (wk *W) GetProcessBundleDescriptor(ctx context.Context, req *fnpb.GetProces
 	return desc, nil
 }
 
-// Connected indicates whether the worker has connected to the control RPC.
+// Connected indicates whether the worker is connected to the control RPC.
 func (wk *W) Connected() bool {
 	return wk.connected.Load()
 }
@@ -264,6 +356,7 @@ func (wk *W) Stopped() bool {
 //
 // Requests come from the runner, and are sent to the client in the SDK.
 func (wk *W) Control(ctrl fnpb.BeamFnControl_ControlServer) error {
+	killed := wk.killedCh()
 	wk.connected.Store(true)
 	done := make(chan error, 1)
 	go func() {
@@ -302,23 +395,22 @@ func (wk *W) Control(ctrl fnpb.BeamFnControl_ControlServer) error {
 				slog.Debug("Worker shutting down.", "worker", wk)
 				return nil
 			}
+			if isClosed(killed) {
+				// The request is for the revived worker, but reached the killed
+				// worker's stream, so it fails as if the worker were killed.
+				wk.failKilled(req.GetInstructionId())
+				return status.Error(codes.Aborted, errKilled)
+			}
 			if err := ctrl.Send(req); err != nil {
 				return err
 			}
 		case <-ctrl.Context().Done():
-			wk.mu.Lock()
-			// Fail extant instructions
-			slog.Debug("SDK Disconnected", "worker", wk, "ctx_error", ctrl.Context().Err(), "outstanding_instructions", len(wk.activeInstructions))
-
-			msg := fmt.Sprintf("SDK worker disconnected: %v, %v active instructions", wk.String(), len(wk.activeInstructions))
-			for instID, b := range wk.activeInstructions {
-				b.Respond(&fnpb.InstructionResponse{
-					InstructionId: instID,
-					Error:         msg,
-				})
-			}
-			wk.mu.Unlock()
+			slog.Debug("SDK Disconnected", "worker", wk, "ctx_error", ctrl.Context().Err())
+			wk.disconnect("SDK worker disconnected")
 			return context.Cause(ctrl.Context())
+		case <-killed:
+			slog.Debug("SDK Killed", "worker", wk)
+			return status.Error(codes.Aborted, errKilled)
 		case err := <-done:
 			if err != nil {
 				slog.Warn("Control done", "error", err, "worker", wk)
@@ -330,11 +422,50 @@ func (wk *W) Control(ctrl fnpb.BeamFnControl_ControlServer) error {
 	}
 }
 
+// disconnect marks the worker as disconnected, and fails its active instructions.
+func (wk *W) disconnect(reason string) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	wk.connected.Store(false)
+	msg := fmt.Sprintf("%v: %v, %v active instructions", reason, wk.String(), len(wk.activeInstructions))
+	for instID, b := range wk.activeInstructions {
+		b.Respond(&fnpb.InstructionResponse{
+			InstructionId: instID,
+			Error:         msg,
+		})
+	}
+}
+
+// failKilled fails the given active instructions, as instructions of a killed worker.
+func (wk *W) failKilled(instIDs ...string) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	for _, instID := range instIDs {
+		if b, ok := wk.activeInstructions[instID]; ok {
+			b.Respond(&fnpb.InstructionResponse{
+				InstructionId: instID,
+				Error:         fmt.Sprintf("%v: %v", errKilled, wk.String()),
+			})
+		}
+	}
+}
+
+// isClosed returns whether the channel is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
 // Data relays elements and timer bytes to SDKs and back again, coordinated via
 // ProcessBundle instructionIDs, and receiving input transforms.
 //
 // Data is multiplexed on a single stream for all active bundles on a worker.
 func (wk *W) Data(data fnpb.BeamFnData_DataServer) error {
+	killed := wk.killedCh()
 	go func() {
 		for {
 			resp, err := data.Recv()
@@ -370,6 +501,22 @@ func (wk *W) Data(data fnpb.BeamFnData_DataServer) error {
 					b.DataDone()
 				}
 			}
+			for _, t := range resp.GetTimers() {
+				cr, ok := wk.activeInstructions[t.GetInstructionId()]
+				if !ok {
+					slog.Info("data.Recv for unknown bundle", "response", resp)
+					continue
+				}
+				// Received timers are always for an active ProcessBundle instruction
+				b := cr.(*B)
+
+				if len(t.GetTimers()) > 0 {
+					b.OutputData.WriteTimers(t.GetTransformId(), t.GetTimerFamilyId(), t.GetTimers())
+				}
+				if t.GetIsLast() {
+					b.DataDone()
+				}
+			}
 			wk.mu.Unlock()
 		}
 	}()
@@ -379,12 +526,26 @@ func (wk *W) Data(data fnpb.BeamFnData_DataServer) error {
 			if !ok {
 				return nil
 			}
+			if isClosed(killed) {
+				var instIDs []string
+				for _, d := range req.GetData() {
+					instIDs = append(instIDs, d.GetInstructionId())
+				}
+				for _, t := range req.GetTimers() {
+					instIDs = append(instIDs, t.GetInstructionId())
+				}
+				wk.failKilled(instIDs...)
+				return status.Error(codes.Aborted, errKilled)
+			}
 			if err := data.Send(req); err != nil {
 				slog.LogAttrs(context.TODO(), slog.LevelDebug, "data.Send error", slog.Any("error", err))
 			}
 		case <-data.Context().Done():
 			slog.Debug("Data context canceled")
 			return context.Cause(data.Context())
+		case <-killed:
+			// Leave data requests for the revived worker's stream.
+			return status.Error(codes.Aborted, errKilled)
 		}
 	}
 }
@@ -413,20 +574,34 @@ func (wk *W) State(state fnpb.BeamFnState_StateServer) error {
 					panic(err)
 				}
 			}
+			// State requests are always for an active ProcessBundle instruction
+			wk.mu.Lock()
+			b, ok := wk.activeInstructions[req.GetInstructionId()].(*B)
+			wk.mu.Unlock()
+			if !ok {
+				slog.Warn("state request after bundle inactive", "instruction", req.GetInstructionId(), "worker", wk)
+				continue
+			}
+			key := req.GetStateKey()
 			switch req.GetRequest().(type) {
 			case *fnpb.StateRequest_Get:
 				// TODO: move data handling to be pcollection based.
+				slog.Debug("StateRequest_Get", prototext.Format(req), "bundle", b)
 
-				// State requests are always for an active ProcessBundle instruction
-				wk.mu.Lock()
-				b, ok := wk.activeInstructions[req.GetInstructionId()].(*B)
-				wk.mu.Unlock()
-				if !ok {
-					slog.Warn("state request after bundle inactive", "instruction", req.GetInstructionId(), "worker", wk)
+				if token := req.GetGet().GetContinuationToken(); len(token) > 0 {
+					// Later pages are served from the data retained for the token,
+					// so they're consistent with the first page.
+					data, ok := b.continueState(token)
+					if !ok {
+						responses <- &fnpb.StateResponse{
+							Id:    req.GetId(),
+							Error: fmt.Sprintf("unknown continuation token %q for bundle %v", token, b.InstID),
+						}
+						continue
+					}
+					responses <- getResponse(req.GetId(), b, data, wk.StatePageSize)
 					continue
 				}
-				key := req.GetStateKey()
-				slog.Debug("StateRequest_Get", prototext.Format(req), "bundle", b)
 
 				var data [][]byte
 				switch key.GetType().(type) {
@@ -472,22 +647,70 @@ func (wk *W) State(state fnpb.BeamFnState_StateServer) error {
 
 					data = winMap[w][string(dKey)]
 
+				case *fnpb.StateKey_BagUserState_:
+					bagkey := key.GetBagUserState()
+					data, err = b.OutputData.GetBagState(engine.LinkID{Transform: bagkey.GetTransformId(), Local: bagkey.GetUserStateId()}, bagkey.GetWindow(), bagkey.GetKey())
+				case *fnpb.StateKey_MultimapUserState_:
+					mmkey := key.GetMultimapUserState()
+					data, err = b.OutputData.GetMultimapState(engine.LinkID{Transform: mmkey.GetTransformId(), Local: mmkey.GetUserStateId()}, mmkey.GetWindow(), mmkey.GetKey(), mmkey.GetMapKey())
+				case *fnpb.StateKey_MultimapKeysUserState_:
+					mmkey := key.GetMultimapKeysUserState()
+					data, err = b.OutputData.GetMultimapKeysState(engine.LinkID{Transform: mmkey.GetTransformId(), Local: mmkey.GetUserStateId()}, mmkey.GetWindow(), mmkey.GetKey())
 				default:
-					panic(fmt.Sprintf("unsupported StateKey Access type: %T: %v", key.GetType(), prototext.Format(key)))
+					panic(fmt.Sprintf("unsupported StateKey Get type: %T: %v", key.GetType(), prototext.Format(key)))
+				}
+				if err != nil {
+					responses <- stateErrorResponse(req.GetId(), b, err)
+					continue
 				}
 
-				// Encode the runner iterable (no length, just consecutive elements), and send it out.
-				// This is also where we can handle things like State Backed Iterables.
-				var buf bytes.Buffer
-				for _, value := range data {
-					buf.Write(value)
+				responses <- getResponse(req.GetId(), b, data, wk.StatePageSize)
+			case *fnpb.StateRequest_Append:
+				slog.Debug("StateRequest_Append", prototext.Format(req), "bundle", b)
+				data := req.GetAppend().GetData()
+				switch key.GetType().(type) {
+				case *fnpb.StateKey_BagUserState_:
+					bagkey := key.GetBagUserState()
+					err = b.OutputData.AppendBagState(engine.LinkID{Transform: bagkey.GetTransformId(), Local: bagkey.GetUserStateId()}, bagkey.GetWindow(), bagkey.GetKey(), data)
+				case *fnpb.StateKey_MultimapUserState_:
+					mmkey := key.GetMultimapUserState()
+					err = b.OutputData.AppendMultimapState(engine.LinkID{Transform: mmkey.GetTransformId(), Local: mmkey.GetUserStateId()}, mmkey.GetWindow(), mmkey.GetKey(), mmkey.GetMapKey(), data)
+				default:
+					panic(fmt.Sprintf("unsupported StateKey Append type: %T: %v", key.GetType(), prototext.Format(key)))
+				}
+				if err != nil {
+					responses <- stateErrorResponse(req.GetId(), b, err)
+					continue
 				}
 				responses <- &fnpb.StateResponse{
 					Id: req.GetId(),
-					Response: &fnpb.StateResponse_Get{
-						Get: &fnpb.StateGetResponse{
-							Data: buf.Bytes(),
-						},
+					Response: &fnpb.StateResponse_Append{
+						Append: &fnpb.StateAppendResponse{},
+					},
+				}
+			case *fnpb.StateRequest_Clear:
+				slog.Debug("StateRequest_Clear", prototext.Format(req), "bundle", b)
+				switch key.GetType().(type) {
+				case *fnpb.StateKey_BagUserState_:
+					bagkey := key.GetBagUserState()
+					err = b.OutputData.ClearBagState(engine.LinkID{Transform: bagkey.GetTransformId(), Local: bagkey.GetUserStateId()}, bagkey.GetWindow(), bagkey.GetKey())
+				case *fnpb.StateKey_MultimapUserState_:
+					mmkey := key.GetMultimapUserState()
+					err = b.OutputData.ClearMultimapState(engine.LinkID{Transform: mmkey.GetTransformId(), Local: mmkey.GetUserStateId()}, mmkey.GetWindow(), mmkey.GetKey(), mmkey.GetMapKey())
+				case *fnpb.StateKey_MultimapKeysUserState_:
+					mmkey := key.GetMultimapKeysUserState()
+					err = b.OutputData.ClearMultimapKeysState(engine.LinkID{Transform: mmkey.GetTransformId(), Local: mmkey.GetUserStateId()}, mmkey.GetWindow(), mmkey.GetKey())
+				default:
+					panic(fmt.Sprintf("unsupported StateKey Clear type: %T: %v", key.GetType(), prototext.Format(key)))
+				}
+				if err != nil {
+					responses <- stateErrorResponse(req.GetId(), b, err)
+					continue
+				}
+				responses <- &fnpb.StateResponse{
+					Id: req.GetId(),
+					Response: &fnpb.StateResponse_Clear{
+						Clear: &fnpb.StateClearResponse{},
 					},
 				}
 			default:
@@ -503,6 +726,30 @@ func (wk *W) State(state fnpb.BeamFnState_StateServer) error {
 	return nil
 }
 
+// stateErrorResponse fails the state request with the given ID.
+func stateErrorResponse(id string, b *B, err error) *fnpb.StateResponse {
+	return &fnpb.StateResponse{
+		Id:    id,
+		Error: fmt.Sprintf("state request for bundle %v failed: %v", b.InstID, err),
+	}
+}
+
+// getResponse encodes the data as a runner iterable (no length, just consecutive elements),
+// in a response to the state get request with the given ID.
+// Data beyond the page size is paged, and retained by the bundle for the continuation token.
+func getResponse(id string, b *B, data [][]byte, pageSize int) *fnpb.StateResponse {
+	page, next := b.pageState(data, pageSize)
+	return &fnpb.StateResponse{
+		Id: id,
+		Response: &fnpb.StateResponse_Get{
+			Get: &fnpb.StateGetResponse{
+				Data:              page,
+				ContinuationToken: next,
+			},
+		},
+	}
+}
+
 var chanResponderPool = sync.Pool{
 	New: func() any {
 		return &chanResponder{make(chan *fnpb.InstructionResponse, 1)}
@@ -538,6 +785,12 @@ func (wk *W) sendInstruction(ctx context.Context, req *fnpb.InstructionRequest)
 	if wk.Stopped() {
 		return nil
 	}
+	if wk.Killed() {
+		return &fnpb.InstructionResponse{
+			InstructionId: progInst,
+			Error:         errKilled,
+		}
+	}
 	wk.InstReqs <- req
 
 	select {
@@ -567,9 +820,15 @@ func (wk *W) MonitoringMetadata(ctx context.Context, unknownIDs []string) *fnpb.
 // management for side inputs.
 // TODO(https://github.com/apache/beam/issues/28543), remove this concept.
 type DataService struct {
+	// Spill pages committed data out to disk when the job is over its memory budget.
+	// Nil if data is always held in memory.
+	Spill *engine.Spiller
+
 	mu sync.Mutex
 	// TODO actually quick process the data to windows here as well.
-	raw map[string][][]byte
+	raw      map[string][][]byte
+	rawBytes map[string]int64             // Bytes of raw data held in memory, by collection.
+	segments map[string][]*engine.Segment // Data paged out to disk, preceding the raw data, by collection.
 }
 
 // Commit tentative data to the datastore.
@@ -578,15 +837,87 @@ func (d *DataService) Commit(tent engine.TentativeData) {
 	defer d.mu.Unlock()
 	if d.raw == nil {
 		d.raw = map[string][][]byte{}
+		d.rawBytes = map[string]int64{}
 	}
 	for colID, data := range tent.Raw {
 		d.raw[colID] = append(d.raw[colID], data...)
+		if d.Spill == nil {
+			continue
+		}
+		var n int64
+		for _, datum := range data {
+			n += int64(len(datum))
+		}
+		d.rawBytes[colID] += n
+		d.Spill.Track(n)
+		if d.Spill.OverBudget() {
+			d.spill(colID)
+		}
 	}
 }
 
+// spill pages the collection's data held in memory out to disk.
+// Assumes the lock is held.
+func (d *DataService) spill(colID string) {
+	seg, err := d.Spill.Write(d.raw[colID])
+	if errors.Is(err, engine.ErrSpillerClosed) {
+		return
+	}
+	if err != nil {
+		slog.Warn("unable to spill side input data, keeping it in memory", slog.String("collection", colID), slog.Any("error", err))
+		return
+	}
+	if d.segments == nil {
+		d.segments = map[string][]*engine.Segment{}
+	}
+	d.segments[colID] = append(d.segments[colID], seg)
+	d.Spill.Track(-d.rawBytes[colID])
+	delete(d.rawBytes, colID)
+	delete(d.raw, colID)
+}
+
+// Snapshot returns all committed data, keyed by collection, including data paged out to disk.
+func (d *DataService) Snapshot() (map[string][][]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ret := map[string][][]byte{}
+	for colID, segs := range d.segments {
+		for _, seg := range segs {
+			data, err := d.Spill.Read(seg)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read data for %v: %w", colID, err)
+			}
+			ret[colID] = append(ret[colID], data...)
+		}
+	}
+	for colID, data := range d.raw {
+		ret[colID] = append(ret[colID], data...)
+	}
+	return ret, nil
+}
+
 // GetAllData is a hack for Side Inputs until watermarks are sorted out.
-func (d *DataService) GetAllData(colID string) [][]byte {
+//
+// Data paged out to disk is read back for each call, and isn't retained in memory.
+// Returns an error if the data can't be read back.
+func (d *DataService) GetAllData(colID string) ([][]byte, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	return d.raw[colID]
+	segs := d.segments[colID]
+	if len(segs) == 0 {
+		return d.raw[colID], nil
+	}
+	var ret [][]byte
+	for _, seg := range segs {
+		data, err := d.Spill.Read(seg)
+		if errors.Is(err, engine.ErrSpillerClosed) {
+			// The job has terminated, so the data is no longer needed.
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read side input data for %v: %w", colID, err)
+		}
+		ret = append(ret, data...)
+	}
+	return append(ret, d.raw[colID]...), nil
 }
@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"context"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -26,8 +27,12 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
 	fnpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
+	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -97,7 +102,18 @@ func serveTestWorker(t *testing.T) (context.Context, *W, *grpc.ClientConn) {
 }
 
 func TestWorker_Logging(t *testing.T) {
-	ctx, _, clientConn := serveTestWorker(t)
+	ctx, w, clientConn := serveTestWorker(t)
+
+	type logged struct {
+		Message, Instruction, Stage string
+	}
+	logs := make(chan logged, 2)
+	w.Logs = func(l *fnpb.LogEntry, stageID string) {
+		logs <- logged{l.GetMessage(), l.GetInstructionId(), stageID}
+	}
+	w.mu.Lock()
+	w.activeInstructions["inst1"] = &B{PBDID: "stage1"}
+	w.mu.Unlock()
 
 	logCli := fnpb.NewBeamFnLoggingClient(clientConn)
 	logStream, err := logCli.Logging(ctx)
@@ -107,9 +123,10 @@ func TestWorker_Logging(t *testing.T) {
 
 	logStream.Send(&fnpb.LogEntry_List{
 		LogEntries: []*fnpb.LogEntry{{
-			Severity:    fnpb.LogEntry_Severity_INFO,
-			Message:     "squeamish ossiphrage",
-			LogLocation: "intentionally.go:124",
+			Severity:      fnpb.LogEntry_Severity_INFO,
+			Message:       "squeamish ossiphrage",
+			LogLocation:   "intentionally.go:124",
+			InstructionId: "inst1",
 		}},
 	})
 
@@ -121,12 +138,29 @@ func TestWorker_Logging(t *testing.T) {
 		}},
 	})
 
-	// TODO: Connect to the job management service.
-	// At this point job messages are just logged to wherever the prism runner executes
-	// But this should pivot to anyone connecting to the Job Management service for the
-	// job.
-	// In the meantime, sleep to validate execution via coverage.
-	time.Sleep(20 * time.Millisecond)
+	logStream.Send(&fnpb.LogEntry_List{
+		LogEntries: []*fnpb.LogEntry{{
+			Severity:      fnpb.LogEntry_Severity_INFO,
+			Message:       "squeamish ossiphrage the third",
+			InstructionId: "inst2",
+		}},
+	})
+
+	// Entries outside of bundles aren't passed to Logs.
+	want := []logged{
+		{Message: "squeamish ossiphrage", Instruction: "inst1", Stage: "stage1"},
+		{Message: "squeamish ossiphrage the third", Instruction: "inst2"},
+	}
+	for _, wl := range want {
+		select {
+		case got := <-logs:
+			if got != wl {
+				t.Errorf("Logs() got %+v, want %+v", got, wl)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Logs() not called for %q", wl.Message)
+		}
+	}
 }
 
 func TestWorker_Control_HappyPath(t *testing.T) {
@@ -164,6 +198,71 @@ func TestWorker_Control_HappyPath(t *testing.T) {
 	}
 }
 
+func TestWorker_Kill(t *testing.T) {
+	ctx, wk, clientConn := serveTestWorker(t)
+
+	ctrlCli := fnpb.NewBeamFnControlClient(clientConn)
+	ctrlStream, err := ctrlCli.Control(ctx)
+	if err != nil {
+		t.Fatal("couldn't create control client:", err)
+	}
+
+	b := &B{InstID: wk.NextInst()}
+	b.Init()
+	b.ProcessOn(ctx, wk)
+	if _, err := ctrlStream.Recv(); err != nil {
+		t.Fatal("couldn't receive ProcessBundle instruction:", err)
+	}
+
+	wk.Kill()
+	if _, err := ctrlStream.Recv(); status.Code(err) != codes.Aborted {
+		t.Errorf("ctrlStream.Recv() after Kill = %v, want Aborted", err)
+	}
+	<-b.Resp
+	if b.BundleErr == nil || !strings.Contains(b.BundleErr.Error(), errKilled) {
+		t.Errorf("active bundle error = %v, want %q", b.BundleErr, errKilled)
+	}
+	if wk.Connected() {
+		t.Error("wk.Connected() = true after Kill, want false")
+	}
+
+	// Later instructions fail without being sent.
+	if _, err := b.Progress(ctx, wk); err == nil || !strings.Contains(err.Error(), errKilled) {
+		t.Errorf("b.Progress() after Kill = %v, want %q", err, errKilled)
+	}
+	later := &B{InstID: wk.NextInst()}
+	later.Init()
+	later.ProcessOn(ctx, wk)
+	<-later.Resp
+	if later.BundleErr == nil || !strings.Contains(later.BundleErr.Error(), errKilled) {
+		t.Errorf("later bundle error = %v, want %q", later.BundleErr, errKilled)
+	}
+
+	// A revived worker accepts a new SDK worker's connection.
+	if !wk.Revive() {
+		t.Fatal("wk.Revive() = false after Kill, want true")
+	}
+	if wk.Revive() {
+		t.Error("wk.Revive() = true for a live worker, want false")
+	}
+	if got, want := wk.Restarts(), 1; got != want {
+		t.Errorf("wk.Restarts() = %v, want %v", got, want)
+	}
+	ctrlStream, err = ctrlCli.Control(ctx)
+	if err != nil {
+		t.Fatal("couldn't create control client:", err)
+	}
+	revived := &B{InstID: wk.NextInst()}
+	revived.Init()
+	revived.ProcessOn(ctx, wk)
+	if _, err := ctrlStream.Recv(); err != nil {
+		t.Fatalf("ctrlStream.Recv() after Revive = %v, want the ProcessBundle instruction", err)
+	}
+	if !wk.Connected() {
+		t.Error("wk.Connected() = false after Revive, want true")
+	}
+}
+
 func TestWorker_Data_HappyPath(t *testing.T) {
 	ctx, wk, clientConn := serveTestWorker(t)
 
@@ -276,3 +375,187 @@ func TestWorker_State_Iterable(t *testing.T) {
 		t.Errorf("stateStream.CloseSend() = %v", err)
 	}
 }
+
+func TestWorker_State_Paging(t *testing.T) {
+	ctx, wk, clientConn := serveTestWorker(t)
+	wk.StatePageSize = 2
+
+	stateCli := fnpb.NewBeamFnStateClient(clientConn)
+	stateStream, err := stateCli.State(ctx)
+	if err != nil {
+		t.Fatal("couldn't create state client:", err)
+	}
+
+	instID := wk.NextInst()
+	wk.activeInstructions[instID] = &B{
+		IterableSideInputData: map[string]map[string]map[typex.Window][][]byte{
+			"transformID": {
+				"i1": {
+					window.GlobalWindow{}: [][]byte{{1}, {2, 3}, {4}},
+				},
+			},
+		},
+	}
+	stateKey := &fnpb.StateKey{Type: &fnpb.StateKey_IterableSideInput_{
+		IterableSideInput: &fnpb.StateKey_IterableSideInput{
+			TransformId: "transformID",
+			SideInputId: "i1",
+			Window:      []byte{}, // Global Windows
+		},
+	}}
+	get := func(token []byte) *fnpb.StateResponse {
+		t.Helper()
+		stateStream.Send(&fnpb.StateRequest{
+			Id:            "get",
+			InstructionId: instID,
+			Request: &fnpb.StateRequest_Get{
+				Get: &fnpb.StateGetRequest{ContinuationToken: token},
+			},
+			StateKey: stateKey,
+		})
+		resp, err := stateStream.Recv()
+		if err != nil {
+			t.Fatal("couldn't receive state response:", err)
+		}
+		return resp
+	}
+
+	// Values aren't split across pages, and pages are followed until there's no token.
+	var pages [][]byte
+	var token []byte
+	for {
+		resp := get(token)
+		if resp.GetError() != "" {
+			t.Fatalf("state response error: %v", resp.GetError())
+		}
+		pages = append(pages, resp.GetGet().GetData())
+		if token = resp.GetGet().GetContinuationToken(); token == nil {
+			break
+		}
+		if len(pages) > 3 {
+			t.Fatalf("too many pages: %v", pages)
+		}
+	}
+	if want := [][]byte{{1}, {2, 3}, {4}}; !cmp.Equal(pages, want) {
+		t.Errorf("paged state = %v, want %v", pages, want)
+	}
+
+	if resp := get([]byte("unknown")); resp.GetError() == "" {
+		t.Errorf("state response for unknown token = %v, want error", resp)
+	}
+
+	if err := stateStream.CloseSend(); err != nil {
+		t.Errorf("stateStream.CloseSend() = %v", err)
+	}
+}
+
+func TestWorker_State_BagUserState(t *testing.T) {
+	ctx, wk, clientConn := serveTestWorker(t)
+
+	stateCli := fnpb.NewBeamFnStateClient(clientConn)
+	stateStream, err := stateCli.State(ctx)
+	if err != nil {
+		t.Fatal("couldn't create state client:", err)
+	}
+
+	instID := wk.NextInst()
+	wk.activeInstructions[instID] = &B{}
+
+	stateKey := &fnpb.StateKey{Type: &fnpb.StateKey_BagUserState_{
+		BagUserState: &fnpb.StateKey_BagUserState{
+			TransformId: "transformID",
+			UserStateId: "state1",
+			Window:      []byte{}, // Global Windows
+			Key:         []byte{1},
+		},
+	}}
+
+	reqs := []*fnpb.StateRequest{
+		{
+			Id:       "append1",
+			Request:  &fnpb.StateRequest_Append{Append: &fnpb.StateAppendRequest{Data: []byte{42}}},
+			StateKey: stateKey,
+		}, {
+			Id:       "append2",
+			Request:  &fnpb.StateRequest_Append{Append: &fnpb.StateAppendRequest{Data: []byte{43}}},
+			StateKey: stateKey,
+		}, {
+			Id:       "get1",
+			Request:  &fnpb.StateRequest_Get{Get: &fnpb.StateGetRequest{}},
+			StateKey: stateKey,
+		}, {
+			Id:       "clear",
+			Request:  &fnpb.StateRequest_Clear{Clear: &fnpb.StateClearRequest{}},
+			StateKey: stateKey,
+		}, {
+			Id:       "get2",
+			Request:  &fnpb.StateRequest_Get{Get: &fnpb.StateGetRequest{}},
+			StateKey: stateKey,
+		}, {
+			Id:      "badWindow",
+			Request: &fnpb.StateRequest_Get{Get: &fnpb.StateGetRequest{}},
+			StateKey: &fnpb.StateKey{Type: &fnpb.StateKey_BagUserState_{
+				BagUserState: &fnpb.StateKey_BagUserState{
+					TransformId: "transformID",
+					UserStateId: "state1",
+					Window:      []byte{1}, // Not a valid interval window.
+					Key:         []byte{1},
+				},
+			}},
+		},
+	}
+	wantData := map[string][]byte{
+		"get1": {42, 43},
+		"get2": nil,
+	}
+	wantErr := map[string]bool{"badWindow": true}
+
+	for _, req := range reqs {
+		req.InstructionId = instID
+		stateStream.Send(req)
+		resp, err := stateStream.Recv()
+		if err != nil {
+			t.Fatal("couldn't receive state response:", err)
+		}
+		if got, want := resp.GetId(), req.GetId(); got != want {
+			t.Fatalf("didn't receive expected state response: got %v, want %v", got, want)
+		}
+		if got, want := resp.GetError() != "", wantErr[req.GetId()]; got != want {
+			t.Errorf("state response for %v has error %q, want error: %v", req.GetId(), resp.GetError(), want)
+		}
+		if want, ok := wantData[req.GetId()]; ok {
+			if got := resp.GetGet().GetData(); !bytes.Equal(got, want) {
+				t.Errorf("didn't receive expected state response data for %v: got %v, want %v", req.GetId(), got, want)
+			}
+		}
+	}
+
+	if err := stateStream.CloseSend(); err != nil {
+		t.Errorf("stateStream.CloseSend() = %v", err)
+	}
+}
+
+func TestDataService_Spill(t *testing.T) {
+	spill := engine.NewSpiller(t.TempDir(), 4)
+	defer spill.Close()
+	ds := &DataService{Spill: spill}
+
+	var tent engine.TentativeData
+	tent.WriteData("pcol", []byte("first"))
+	ds.Commit(tent)
+	tent = engine.TentativeData{}
+	tent.WriteData("pcol", []byte("ab"))
+	ds.Commit(tent)
+
+	if got := spill.SpilledBytes(); got == 0 {
+		t.Errorf("SpilledBytes() = 0, want data spilled")
+	}
+	want := [][]byte{[]byte("first"), []byte("ab")}
+	got, err := ds.GetAllData("pcol")
+	if err != nil {
+		t.Fatalf("GetAllData() error = %v", err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("GetAllData() = %q, want %q", got, want)
+	}
+}
@@ -19,12 +19,15 @@ package prism
 
 import (
 	"context"
+	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
 	jobpb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/jobmanagement_v1"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/options/jobopts"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/engine"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/pubsub"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/web"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/universal"
 	"google.golang.org/grpc"
@@ -47,6 +50,7 @@ func Execute(ctx context.Context, p *beam.Pipeline) (beam.PipelineResult, error)
 		// Conveniently, this means that if multiple pipelines are executed against
 		// the local runner, they will all use the same server.
 		s := jobservices.NewServer(0, internal.RunPipeline)
+		s.SetOptionDescriptors(internal.OptionDescriptors())
 		*jobopts.Endpoint = s.Endpoint()
 		go s.Serve()
 		if !jobopts.IsLoopback() {
@@ -56,21 +60,88 @@ func Execute(ctx context.Context, p *beam.Pipeline) (beam.PipelineResult, error)
 	return universal.Execute(ctx, p)
 }
 
+// StartPubSubEmulator starts the in process Pub/Sub emulator on the given port, or
+// any available port if 0, and returns the address it serves the Pub/Sub API on.
+// If the emulator is already running, its address is returned regardless of the port.
+//
+// Pipelines run by in process job servers read from and write to the emulator's
+// topics and subscriptions with pubsubio, starting the emulator if necessary.
+// Test code publishes to and reads from its topics with a Pub/Sub client, such as
+// by setting PUBSUB_EMULATOR_HOST to the address. Reads of a topic only receive
+// messages published after the job starts, so tests which publish first read from
+// a subscription they create beforehand.
+func StartPubSubEmulator(port int) (string, error) {
+	emu, err := pubsub.Start(port)
+	if err != nil {
+		return "", err
+	}
+	return emu.Addr(), nil
+}
+
 // Options for in process server creation.
 type Options struct {
 	Port int
+
+	// JobStoreDir is a directory where completed jobs are persisted, so they
+	// remain available after a restart. Jobs are kept in memory only if unset.
+	JobStoreDir string
+	// MaxStoredJobs bounds the number of stored jobs, if positive.
+	MaxStoredJobs int
+	// MaxStoredJobAge bounds how long jobs are stored after completing, if positive.
+	MaxStoredJobAge time.Duration
 }
 
 // CreateJobServer returns a Beam JobServicesClient connected to an in memory JobServer.
 // This call is non-blocking.
 func CreateJobServer(ctx context.Context, opts Options) (jobpb.JobServiceClient, error) {
 	s := jobservices.NewServer(opts.Port, internal.RunPipeline)
+	s.SetOptionDescriptors(internal.OptionDescriptors())
+	if opts.JobStoreDir != "" {
+		store, err := jobservices.OpenJobStore(opts.JobStoreDir, jobservices.Retention{
+			MaxJobs: opts.MaxStoredJobs,
+			MaxAge:  opts.MaxStoredJobAge,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.UseJobStore(store); err != nil {
+			return nil, err
+		}
+	}
 	go s.Serve()
 	clientConn, err := grpc.DialContext(ctx, s.Endpoint(), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
 	if err != nil {
 		return nil, err
 	}
-	return jobpb.NewJobServiceClient(clientConn), nil
+	return localJobClient{JobServiceClient: jobpb.NewJobServiceClient(clientConn), s: s}, nil
+}
+
+// localJobClient is a client of an in process job server, which also provides
+// the execution statistics, element samples, and structured messages of jobs
+// to the web UI, and drains jobs.
+type localJobClient struct {
+	jobpb.JobServiceClient
+	s *jobservices.Server
+}
+
+// StageStats returns the execution statistics of the stages of the given job.
+func (c localJobClient) StageStats(jobID string) []engine.StageStats {
+	return c.s.StageStats(jobID)
+}
+
+// ElementSamples returns the recent elements of the PCollections of the given job.
+func (c localJobClient) ElementSamples(jobID string) map[string][]jobservices.ElementSample {
+	return c.s.ElementSamples(jobID)
+}
+
+// JobMessages returns the messages of the given job selected by the filter.
+func (c localJobClient) JobMessages(jobID string, filter jobservices.MessageFilter) []jobservices.JobMessage {
+	return c.s.JobMessages(jobID, filter)
+}
+
+// Drain requests that the given job drain.
+func (c localJobClient) Drain(ctx context.Context, jobID string) (jobpb.JobState_Enum, error) {
+	return c.s.Drain(ctx, jobID)
 }
 
 // CreateWebServer initialises the web UI for prism against the given JobsServiceClient.
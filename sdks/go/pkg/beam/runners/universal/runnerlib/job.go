@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 
 	"github.com/apache/beam/sdks/v2/go/container/tools"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
@@ -50,6 +51,10 @@ type JobOptions struct {
 
 	// Loopback indicates this job is running in loopback mode and will reconnect to the local process.
 	Loopback bool
+
+	// Options are pipeline options for this job only. They take precedence
+	// over those in beam.PipelineOptions.
+	Options map[string]string
 }
 
 // Prepare prepares a job to the given job service. It returns the preparation id
@@ -57,8 +62,10 @@ type JobOptions struct {
 func Prepare(ctx context.Context, client jobpb.JobServiceClient, p *pipepb.Pipeline, opt *JobOptions) (id, endpoint, stagingToken string, err error) {
 	hooks.SerializeHooksToOptions()
 	beam.PipelineOptions.LoadOptionsFromFlags(nil)
+	opts := beam.PipelineOptions.Export()
+	maps.Copy(opts.Options, opt.Options)
 	raw := runtime.RawOptionsWrapper{
-		Options:      beam.PipelineOptions.Export(),
+		Options:      opts,
 		AppName:      opt.Name,
 		Experiments:  append(opt.Experiments, "beam_fn_api"),
 		RetainDocker: opt.RetainDocker,
@@ -126,7 +133,7 @@ func WaitForCompletion(ctx context.Context, client jobpb.JobServiceClient, jobID
 			log.Infof(ctx, "Job[%v] state: %v", jobID, resp.GetState().String())
 
 			switch resp.State {
-			case jobpb.JobState_DONE, jobpb.JobState_CANCELLED:
+			case jobpb.JobState_DONE, jobpb.JobState_CANCELLED, jobpb.JobState_DRAINED:
 				return nil
 			case jobpb.JobState_FAILED:
 				jobFailed = true
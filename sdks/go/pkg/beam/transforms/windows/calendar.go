@@ -0,0 +1,172 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package windows contains WindowFns for calendar-aligned windows, such as days,
+// weeks, months and years in a time zone, which fixed windows can't express.
+//
+// Calendar windows are IntervalWindows from midnight in the time zone, so they
+// respect daylight saving time and the lengths of months. For example:
+//
+//	loc, _ := time.LoadLocation("America/New_York")
+//	monthly := beam.WindowInto(s, windows.Months(1, loc), col)
+//
+// The time zone is serialized by name and loaded on workers with time.LoadLocation,
+// so it must be a named location, such as time.UTC or one from time.LoadLocation,
+// and workers need the time zone database. Pipelines whose worker containers lack
+// one can embed it by importing time/tzdata in their main package. time.Local is
+// the local time zone of each worker.
+//
+// Beam's portable model only defines global, fixed, sliding and session WindowFns,
+// so there is no portable translation for calendar windows. They're translated as
+// Go SDK custom WindowFns, which only runners that group windows without knowing
+// their WindowFn, such as prism and the direct runner, can execute. Dataflow rejects
+// them when the job is submitted, and the Flink, Spark and Samza job servers reject
+// the unknown WindowFn.
+package windows
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*calendarWindows)(nil)).Elem())
+}
+
+// Days returns a WindowFn that assigns elements to windows of n days, starting at
+// midnight in the given location. Windows are aligned to January 1st, 1970.
+func Days(n int, loc *time.Location) *window.Fn {
+	return newCalendarWindows("Days", dayUnit, n, 0, loc)
+}
+
+// Weeks returns a WindowFn that assigns elements to windows of n weeks, starting at
+// midnight on startDay in the given location. Windows are aligned to the first startDay
+// on or after January 1st, 1970.
+func Weeks(n int, startDay time.Weekday, loc *time.Location) *window.Fn {
+	// January 1st, 1970 was a Thursday.
+	offset := (int(startDay) - int(time.Thursday) + 7) % 7
+	return newCalendarWindows("Weeks", dayUnit, 7*n, offset, loc)
+}
+
+// Months returns a WindowFn that assigns elements to windows of n months, starting at
+// midnight on the first day of the month in the given location. Windows are aligned
+// to January 1970.
+func Months(n int, loc *time.Location) *window.Fn {
+	return newCalendarWindows("Months", monthUnit, n, 0, loc)
+}
+
+// Years returns a WindowFn that assigns elements to windows of n years, starting at
+// midnight on January 1st in the given location. Windows are aligned to 1970.
+func Years(n int, loc *time.Location) *window.Fn {
+	return newCalendarWindows("Years", monthUnit, 12*n, 0, loc)
+}
+
+func newCalendarWindows(name string, unit calendarUnit, n, offset int, loc *time.Location) *window.Fn {
+	if n <= 0 {
+		panic(fmt.Sprintf("windows.%v: number of units must be positive, got %v", name, n))
+	}
+	if loc == nil {
+		panic(fmt.Sprintf("windows.%v: missing location", name))
+	}
+	if _, err := loadLocation(loc.String()); err != nil {
+		panic(fmt.Sprintf("windows.%v: location %v must be loadable by name: %v", name, loc, err))
+	}
+	return window.NewCustomWindows[window.IntervalWindow](calendarWindows{
+		Unit:     unit,
+		N:        n,
+		Offset:   offset,
+		Location: loc.String(),
+	})
+}
+
+type calendarUnit int
+
+const (
+	dayUnit calendarUnit = iota
+	monthUnit
+)
+
+// calendarWindows assigns elements to windows of N days or months in a location.
+// Windows start Offset units after the unit containing the Unix epoch.
+type calendarWindows struct {
+	Unit     calendarUnit
+	N        int
+	Offset   int
+	Location string
+}
+
+// AssignWindows assigns the element to the calendar window containing its timestamp.
+func (fn calendarWindows) AssignWindows(ts beam.EventTime, _ any) []beam.Window {
+	loc, err := loadLocation(fn.Location)
+	if err != nil {
+		panic(fmt.Sprintf("calendar windows: %v", err))
+	}
+	y, m, d := ts.ToTime().In(loc).Date()
+	var start, end time.Time
+	switch fn.Unit {
+	case dayUnit:
+		// Count days in UTC, which has no DST transitions.
+		days := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+		first := fn.Offset + floorDiv(days-fn.Offset, fn.N)*fn.N
+		start = time.Date(1970, time.January, 1+first, 0, 0, 0, 0, loc)
+		end = time.Date(1970, time.January, 1+first+fn.N, 0, 0, 0, 0, loc)
+	case monthUnit:
+		months := (y-1970)*12 + int(m-time.January)
+		first := fn.Offset + floorDiv(months-fn.Offset, fn.N)*fn.N
+		start = time.Date(1970, time.January+time.Month(first), 1, 0, 0, 0, 0, loc)
+		end = time.Date(1970, time.January+time.Month(first+fn.N), 1, 0, 0, 0, 0, loc)
+	default:
+		panic(fmt.Sprintf("calendar windows: unknown unit %v", fn.Unit))
+	}
+	return []beam.Window{window.IntervalWindow{Start: mtime.FromTime(start), End: mtime.FromTime(end)}}
+}
+
+func (fn calendarWindows) String() string {
+	unit := "days"
+	if fn.Unit == monthUnit {
+		unit = "months"
+	}
+	return fmt.Sprintf("%v %v in %v (offset %v)", fn.N, unit, fn.Location, fn.Offset)
+}
+
+// floorDiv divides a by b, rounding towards negative infinity.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// locations caches time.Locations by name, since loading them reads the time zone database.
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,242 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package windows
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/ptest"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/transforms/stats"
+)
+
+func TestMain(m *testing.M) {
+	ptest.Main(m)
+}
+
+func init() {
+	register.DoFn2x0[[]byte, func(beam.EventTime, string)](&createTimestamped{})
+	register.Function3x1(formatWindow)
+	register.Emitter2[beam.EventTime, string]()
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("time.LoadLocation(%q) failed: %v", name, err)
+	}
+	return loc
+}
+
+func TestCalendarWindows(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	tokyo := mustLoadLocation(t, "Asia/Tokyo")
+
+	date := func(loc *time.Location, y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name       string
+		wfn        *window.Fn
+		ts         time.Time
+		start, end time.Time
+	}{
+		{
+			name:  "day",
+			wfn:   Days(1, time.UTC),
+			ts:    date(time.UTC, 2024, time.June, 15, 13),
+			start: date(time.UTC, 2024, time.June, 15, 0),
+			end:   date(time.UTC, 2024, time.June, 16, 0),
+		}, {
+			name:  "day in location",
+			wfn:   Days(1, tokyo),
+			ts:    date(time.UTC, 2024, time.June, 15, 20),
+			start: date(tokyo, 2024, time.June, 16, 0),
+			end:   date(tokyo, 2024, time.June, 17, 0),
+		}, {
+			name:  "day starting DST",
+			wfn:   Days(1, newYork),
+			ts:    date(newYork, 2024, time.March, 10, 12),
+			start: date(newYork, 2024, time.March, 10, 0),
+			end:   date(newYork, 2024, time.March, 11, 0),
+		}, {
+			name:  "day ending DST",
+			wfn:   Days(1, newYork),
+			ts:    date(newYork, 2024, time.November, 3, 23),
+			start: date(newYork, 2024, time.November, 3, 0),
+			end:   date(newYork, 2024, time.November, 4, 0),
+		}, {
+			name:  "days",
+			wfn:   Days(3, time.UTC),
+			ts:    date(time.UTC, 1970, time.January, 6, 1),
+			start: date(time.UTC, 1970, time.January, 4, 0),
+			end:   date(time.UTC, 1970, time.January, 7, 0),
+		}, {
+			name:  "days before epoch",
+			wfn:   Days(3, time.UTC),
+			ts:    date(time.UTC, 1969, time.December, 31, 1),
+			start: date(time.UTC, 1969, time.December, 29, 0),
+			end:   date(time.UTC, 1970, time.January, 1, 0),
+		}, {
+			name:  "week",
+			wfn:   Weeks(1, time.Monday, time.UTC),
+			ts:    date(time.UTC, 2024, time.June, 15, 13), // Saturday
+			start: date(time.UTC, 2024, time.June, 10, 0),
+			end:   date(time.UTC, 2024, time.June, 17, 0),
+		}, {
+			name:  "week starting on day",
+			wfn:   Weeks(1, time.Saturday, time.UTC),
+			ts:    date(time.UTC, 2024, time.June, 15, 13),
+			start: date(time.UTC, 2024, time.June, 15, 0),
+			end:   date(time.UTC, 2024, time.June, 22, 0),
+		}, {
+			name:  "weeks",
+			wfn:   Weeks(2, time.Thursday, time.UTC),
+			ts:    date(time.UTC, 1970, time.January, 20, 0),
+			start: date(time.UTC, 1970, time.January, 15, 0),
+			end:   date(time.UTC, 1970, time.January, 29, 0),
+		}, {
+			name:  "week across DST",
+			wfn:   Weeks(1, time.Sunday, newYork),
+			ts:    date(newYork, 2024, time.March, 12, 0),
+			start: date(newYork, 2024, time.March, 10, 0),
+			end:   date(newYork, 2024, time.March, 17, 0),
+		}, {
+			name:  "month",
+			wfn:   Months(1, time.UTC),
+			ts:    date(time.UTC, 2024, time.February, 29, 23),
+			start: date(time.UTC, 2024, time.February, 1, 0),
+			end:   date(time.UTC, 2024, time.March, 1, 0),
+		}, {
+			name:  "month in location",
+			wfn:   Months(1, tokyo),
+			ts:    date(time.UTC, 2024, time.January, 31, 20),
+			start: date(tokyo, 2024, time.February, 1, 0),
+			end:   date(tokyo, 2024, time.March, 1, 0),
+		}, {
+			name:  "quarter",
+			wfn:   Months(3, newYork),
+			ts:    date(newYork, 2024, time.May, 5, 0),
+			start: date(newYork, 2024, time.April, 1, 0),
+			end:   date(newYork, 2024, time.July, 1, 0),
+		}, {
+			name:  "months before epoch",
+			wfn:   Months(5, time.UTC),
+			ts:    date(time.UTC, 1969, time.September, 1, 0),
+			start: date(time.UTC, 1969, time.August, 1, 0),
+			end:   date(time.UTC, 1970, time.January, 1, 0),
+		}, {
+			name:  "year",
+			wfn:   Years(1, newYork),
+			ts:    date(newYork, 2024, time.December, 31, 23),
+			start: date(newYork, 2024, time.January, 1, 0),
+			end:   date(newYork, 2025, time.January, 1, 0),
+		}, {
+			name:  "decade",
+			wfn:   Years(10, time.UTC),
+			ts:    date(time.UTC, 2024, time.June, 15, 0),
+			start: date(time.UTC, 2020, time.January, 1, 0),
+			end:   date(time.UTC, 2030, time.January, 1, 0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.wfn.CustomFn.AssignWindows(mtime.FromTime(test.ts), nil)
+			want := window.IntervalWindow{Start: mtime.FromTime(test.start), End: mtime.FromTime(test.end)}
+			if len(got) != 1 || !got[0].Equals(want) {
+				t.Errorf("%v.AssignWindows(%v) = %v, want [%v]", test.wfn, test.ts, got, want)
+			}
+		})
+	}
+}
+
+func TestCalendarWindows_Fn(t *testing.T) {
+	wfn := Months(1, time.UTC)
+	if got, want := wfn.Kind, window.Custom; got != want {
+		t.Errorf("Months(1, time.UTC).Kind = %v, want %v", got, want)
+	}
+	if wfn.HasCustomWindows() {
+		t.Error("Months(1, time.UTC).HasCustomWindows() = true, want false")
+	}
+	if !wfn.Equals(Months(1, time.UTC)) {
+		t.Error("Months(1, time.UTC) doesn't equal itself")
+	}
+	if wfn.Equals(Years(1, time.UTC)) || wfn.Equals(Months(1, mustLoadLocation(t, "Asia/Tokyo"))) {
+		t.Error("Months(1, time.UTC) equals windows of another size or location")
+	}
+}
+
+func TestCalendarWindows_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		wfn  func()
+	}{
+		{"zero days", func() { Days(0, time.UTC) }},
+		{"negative weeks", func() { Weeks(-1, time.Monday, time.UTC) }},
+		{"nil location", func() { Months(1, nil) }},
+		{"unnamed location", func() { Years(1, time.FixedZone("UTC+9", 9*60*60)) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("calendar windows were created, but should have panicked")
+				}
+			}()
+			test.wfn()
+		})
+	}
+}
+
+// createTimestamped emits elements at the given times.
+type createTimestamped struct {
+	Times []time.Time
+}
+
+func (fn *createTimestamped) ProcessElement(_ []byte, emit func(beam.EventTime, string)) {
+	for _, t := range fn.Times {
+		emit(mtime.FromTime(t), "event")
+	}
+}
+
+func formatWindow(w beam.Window, _ string, count int) string {
+	iw := w.(window.IntervalWindow)
+	return fmt.Sprintf("%v: %v", iw.Start.ToTime().UTC().Format(time.DateOnly), count)
+}
+
+func TestMonths_Pipeline(t *testing.T) {
+	p, s := beam.NewPipelineWithRoot()
+	events := beam.ParDo(s, &createTimestamped{Times: []time.Time{
+		time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.January, 31, 23, 59, 0, 0, time.UTC),
+		time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}}, beam.Impulse(s))
+	windowed := beam.WindowInto(s, Months(1, time.UTC), events)
+	counts := beam.ParDo(s, formatWindow, stats.Count(s, windowed))
+	counts = beam.WindowInto(s, window.NewGlobalWindows(), counts)
+	passert.Equals(s, counts, "2024-01-01: 2", "2024-02-01: 1", "2024-03-01: 1")
+
+	ptest.RunAndValidate(t, p)
+}
@@ -26,7 +26,8 @@ import (
 )
 
 const (
-	cacheCapacityHook = "beam:go:hook:sideinputcache:capacity"
+	cacheCapacityHook          = "beam:go:hook:sideinputcache:capacity"
+	userStateCacheCapacityHook = "beam:go:hook:userstatecache:capacity"
 )
 
 // SideInputCacheCapacity accepts a desired capacity for the side input cache. A non-zero positive
@@ -40,3 +41,15 @@ func SideInputCacheCapacity(capacity int64) error {
 	// The hook itself is defined in beam/core/runtime/harness/cache_hooks.go
 	return hooks.EnableHook(cacheCapacityHook, capString)
 }
+
+// UserStateCacheCapacity accepts a desired capacity in bytes for the user state cache, which
+// caches the state of stateful DoFns across bundles. A non-zero positive integer enables the
+// cache (the capacity of the cache is 0 by default.) Cache use also requires runner support.
+func UserStateCacheCapacity(bytes int64) error {
+	if bytes < 0 {
+		return fmt.Errorf("capacity of cache cannot be negative, got %v", bytes)
+	}
+	capString := strconv.FormatInt(bytes, 10)
+	// The hook itself is defined in beam/core/runtime/harness/cache_hooks.go
+	return hooks.EnableHook(userStateCacheCapacityHook, capString)
+}
@@ -45,3 +45,27 @@ func TestSideInputCacheCapacity_Bad(t *testing.T) {
 		t.Errorf("SideInputCacheCapacity succeeded when it should have failed")
 	}
 }
+
+func TestUserStateCacheCapacity(t *testing.T) {
+	err := UserStateCacheCapacity(1 << 20)
+	if err != nil {
+		t.Errorf("UserStateCacheCapacity failed when it should have succeeded, got %v", err)
+	}
+	ok, opts := hooks.IsEnabled(userStateCacheCapacityHook)
+	if !ok {
+		t.Fatalf("UserStateCacheCapacity hook is not enabled")
+	}
+	if len(opts) != 1 {
+		t.Errorf("num opts mismatch, got %v, want 1", len(opts))
+	}
+	if opts[0] != "1048576" {
+		t.Errorf("cache size option mismatch, got %v, want %v", opts[0], 1<<20)
+	}
+}
+
+func TestUserStateCacheCapacity_Bad(t *testing.T) {
+	err := UserStateCacheCapacity(-1)
+	if err == nil {
+		t.Errorf("UserStateCacheCapacity succeeded when it should have failed")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/coder"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window/trigger"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/internal/errors"
@@ -84,6 +85,16 @@ func TryWindowInto(s Scope, wfn *window.Fn, col PCollection, opts ...WindowIntoO
 	if !col.IsValid() {
 		return PCollection{}, errors.New("invalid input pcollection")
 	}
+	if wfn.Kind == window.Custom {
+		if wfn.CustomFn == nil {
+			return PCollection{}, errors.New("invalid custom WindowFn: missing fn")
+		}
+		if wfn.HasCustomWindows() {
+			if _, err := coder.NewCustomWindow(wfn.WindowType); err != nil {
+				return PCollection{}, errors.WithContextf(err, "invalid custom WindowFn %v", wfn)
+			}
+		}
+	}
 	ws := window.WindowingStrategy{Fn: wfn, Trigger: trigger.DefaultTrigger{}}
 	for _, opt := range opts {
 		switch opt := opt.(type) {
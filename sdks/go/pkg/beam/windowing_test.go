@@ -0,0 +1,44 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package beam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/window"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/typex"
+)
+
+// everySecondWindows is a custom WindowFn that assigns elements to one second windows.
+type everySecondWindows struct{}
+
+func (everySecondWindows) AssignWindows(ts typex.EventTime, _ any) []typex.Window {
+	start := ts - ts%1000
+	return []typex.Window{window.IntervalWindow{Start: start, End: start + 1000}}
+}
+
+func TestTryWindowInto_CustomWindows(t *testing.T) {
+	_, s := NewPipelineWithRoot()
+	col := Impulse(s)
+	if _, err := TryWindowInto(s, &window.Fn{Kind: window.Custom}, col); err == nil || !strings.Contains(err.Error(), "missing fn") {
+		t.Errorf("TryWindowInto() with no custom WindowFn = %v, want missing fn error", err)
+	}
+	wfn := window.NewCustomWindows[window.IntervalWindow](everySecondWindows{})
+	if _, err := TryWindowInto(s, wfn, col); err != nil {
+		t.Errorf("TryWindowInto(%v) = %v, want nil", wfn, err)
+	}
+}
@@ -104,6 +104,10 @@ var directFilters = []string{
 	"TestMapStateClear",
 	"TestSetState",
 	"TestSetStateClear",
+	"TestOrderedListState",
+	// The direct runner does not support timers.
+	"TestTimers.*",
+	"TestOnWindowExpiration",
 }
 
 var portableFilters = []string{
@@ -137,39 +141,28 @@ var portableFilters = []string{
 	"TestMapStateClear",
 	"TestSetState",
 	"TestSetStateClear",
+	"TestOrderedListState",
+	// The portable runner does not support timers.
+	"TestTimers.*",
+	"TestOnWindowExpiration",
+	// The portable runner rejects the Go SDK's user-defined WindowFns, such as calendar windows.
+	"TestWindowSums_Custom",
+	"TestWindowSums_Calendar",
 }
 
 var prismFilters = []string{
 	// The prism runner does not yet support Java's CoGBK.
 	"TestXLang_CoGroupBy",
-	// The prism runner does not support the TestStream primitive
-	"TestTestStream.*",
-	// The trigger and pane tests uses TestStream
-	"TestTrigger.*",
-	"TestPanes",
 
 	// TODO(https://github.com/apache/beam/issues/21058): Xlang ios don't yet work on prism.
 	"TestKafkaIO.*",
 	// TODO(BEAM-13215): GCP IOs currently do not work in non-Dataflow portable runners.
 	"TestBigQueryIO.*",
 	"TestSpannerIO.*",
-	// The prism runner does not support pipeline drain for SDF.
-	"TestDrain",
 	// FhirIO currently only supports Dataflow runner
 	"TestFhirIO.*",
 	// OOMs currently only lead to heap dumps on Dataflow runner
 	"TestOomParDo",
-	// The prism runner does not support user state.
-	"TestValueState",
-	"TestValueStateWindowed",
-	"TestValueStateClear",
-	"TestBagState",
-	"TestBagStateClear",
-	"TestCombiningState",
-	"TestMapState",
-	"TestMapStateClear",
-	"TestSetState",
-	"TestSetStateClear",
 }
 
 var flinkFilters = []string{
@@ -193,6 +186,10 @@ var flinkFilters = []string{
 	"TestMapStateClear",
 	"TestSetStateClear",
 	"TestSetState",
+	"TestOrderedListState",
+	// Flink rejects the Go SDK's user-defined WindowFns, such as calendar windows.
+	"TestWindowSums_Custom",
+	"TestWindowSums_Calendar",
 }
 
 var samzaFilters = []string{
@@ -229,8 +226,15 @@ var samzaFilters = []string{
 	"TestMapStateClear",
 	"TestSetState",
 	"TestSetStateClear",
+	"TestOrderedListState",
+	// The samza runner does not support timers.
+	"TestTimers.*",
+	"TestOnWindowExpiration",
 	// TODO(https://github.com/apache/beam/issues/26126): Java runner issue (AcitveBundle has no regsitered handler)
 	"TestDebeziumIO_BasicRead",
+	// The samza runner rejects the Go SDK's user-defined WindowFns, such as calendar windows.
+	"TestWindowSums_Custom",
+	"TestWindowSums_Calendar",
 }
 
 var sparkFilters = []string{
@@ -262,6 +266,10 @@ var sparkFilters = []string{
 	"TestMapStateClear",
 	"TestSetStateClear",
 	"TestSetState",
+	"TestOrderedListState",
+	// Spark rejects the Go SDK's user-defined WindowFns, such as calendar windows.
+	"TestWindowSums_Custom",
+	"TestWindowSums_Calendar",
 }
 
 var dataflowFilters = []string{
@@ -292,6 +300,9 @@ var dataflowFilters = []string{
 	"TestSpannerIO.*",
 	// Dataflow does not drain jobs by itself.
 	"TestDrain",
+	// Dataflow rejects the Go SDK's user-defined WindowFns, such as calendar windows.
+	"TestWindowSums_Custom",
+	"TestWindowSums_Calendar",
 }
 
 // CheckFilters checks if an integration test is filtered to be skipped, either
@@ -39,6 +39,10 @@ func init() {
 	register.DoFn3x1[state.Provider, string, int, string](&mapStateClearFn{})
 	register.DoFn3x1[state.Provider, string, int, string](&setStateFn{})
 	register.DoFn3x1[state.Provider, string, int, string](&setStateClearFn{})
+	register.DoFn3x1[state.Provider, string, int, string](&orderedListStateFn{})
+	register.DoFn4x0[state.Provider, string, int, func(string)](&windowExpirationFn{})
+	register.Emitter1[string]()
+	register.Function2x0(pairWithOne)
 	register.Emitter2[string, int]()
 	register.Combiner1[int](&combine1{})
 	register.Combiner2[string, int](&combine2{})
@@ -46,6 +50,11 @@ func init() {
 	register.Combiner1[int](&combine4{})
 }
 
+// pairWithOne keys each word with a count of one, for the stateful DoFns.
+func pairWithOne(w string, emit func(string, int)) {
+	emit(w, 1)
+}
+
 type valueStateFn struct {
 	State1 state.Value[int]
 	State2 state.Value[string]
@@ -527,3 +536,85 @@ func SetStateParDoClear(s beam.Scope) {
 	counts := beam.ParDo(s, &setStateClearFn{State1: state.MakeSetState[string]("key1")}, keyed)
 	passert.Equals(s, counts, "apple: [apple]", "pear: [pear]", "peach: [peach]", "apple: [apple1 apple2 apple3]", "apple: []", "pear: [pear1 pear2 pear3]")
 }
+
+type orderedListStateFn struct {
+	State1 state.OrderedList[int]
+}
+
+func (f *orderedListStateFn) ProcessElement(s state.Provider, w string, c int) string {
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	vals, _, err := f.State1.Read(s)
+	if err != nil {
+		panic(err)
+	}
+	n := len(vals)
+	// Add values with decreasing timestamps, so they're read in the reverse of the order they were added.
+	if err := f.State1.Add(s, at(int64(10-n)), n); err != nil {
+		panic(err)
+	}
+	if n == 2 {
+		if err := f.State1.ClearRange(s, at(10), at(11)); err != nil {
+			panic(err)
+		}
+	}
+
+	vals, _, err = f.State1.Read(s)
+	if err != nil {
+		panic(err)
+	}
+	var all []int
+	for _, v := range vals {
+		all = append(all, v.Value)
+	}
+	it, err := f.State1.ReadRange(s, at(9), at(11))
+	if err != nil {
+		panic(err)
+	}
+	var recent []int
+	for {
+		v, ok, err := it.Next()
+		if err != nil {
+			panic(err)
+		}
+		if !ok {
+			break
+		}
+		recent = append(recent, v.Value)
+	}
+	return fmt.Sprintf("%v: %v, recent: %v", w, all, recent)
+}
+
+// OrderedListStateParDo tests a DoFn that uses ordered list state.
+func OrderedListStateParDo(s beam.Scope) {
+	in := beam.Create(s, "apple", "pear", "peach", "apple", "apple", "pear")
+	keyed := beam.ParDo(s, pairWithOne, in)
+	counts := beam.ParDo(s, &orderedListStateFn{State1: state.MakeOrderedListState[int]("key1")}, keyed)
+	passert.Equals(s, counts, "apple: [0], recent: [0]", "pear: [0], recent: [0]", "peach: [0], recent: [0]", "apple: [1 0], recent: [1 0]", "apple: [2 1], recent: [1]", "pear: [1 0], recent: [1 0]")
+}
+
+type windowExpirationFn struct {
+	State1 state.Bag[int]
+}
+
+func (f *windowExpirationFn) ProcessElement(s state.Provider, w string, c int, _ func(string)) {
+	if err := f.State1.Add(s, c); err != nil {
+		panic(err)
+	}
+}
+
+func (f *windowExpirationFn) OnWindowExpiration(s state.Provider, w string, emit func(string)) {
+	vals, _, err := f.State1.Read(s)
+	if err != nil {
+		panic(err)
+	}
+	emit(fmt.Sprintf("%v: %v", w, vals))
+}
+
+// WindowExpirationParDo tests a DoFn that outputs its buffered state when windows expire.
+func WindowExpirationParDo(s beam.Scope) {
+	timestampedData := beam.ParDo(s, &createTimestampedData{Data: []int{4, 9, 2, 3, 5, 7, 8, 1, 6}}, beam.Impulse(s))
+	wData := beam.WindowInto(s, window.NewFixedWindows(3*time.Second), timestampedData)
+	expired := beam.ParDo(s, &windowExpirationFn{State1: state.MakeBagState[int]("key1")}, wData)
+	globalExpired := beam.WindowInto(s, window.NewGlobalWindows(), expired)
+	passert.Equals(s, globalExpired, "magic: [4 9 2]", "magic: [3 5 7]", "magic: [8 1 6]")
+}
@@ -71,3 +71,13 @@ func TestSetStateClear(t *testing.T) {
 	integration.CheckFilters(t)
 	ptest.BuildAndRun(t, SetStateParDoClear)
 }
+
+func TestOrderedListState(t *testing.T) {
+	integration.CheckFilters(t)
+	ptest.BuildAndRun(t, OrderedListStateParDo)
+}
+
+func TestOnWindowExpiration(t *testing.T) {
+	integration.CheckFilters(t)
+	ptest.BuildAndRun(t, WindowExpirationParDo)
+}
@@ -0,0 +1,165 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package primitives
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/state"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/timers"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/register"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
+)
+
+func init() {
+	register.DoFn5x0[state.Provider, timers.Provider, string, int, func(string, int)](&eventTimeFn{})
+	register.DoFn5x0[state.Provider, timers.Provider, string, int, func(string, int)](&eventTimeLoopFn{})
+	register.DoFn5x0[state.Provider, timers.Provider, string, int, func(string, int)](&processingTimeFn{})
+	register.Function2x1(formatCount)
+}
+
+// formatCount renders a key and count pair for comparison.
+func formatCount(k string, c int) string {
+	return fmt.Sprintf("%s: %v", k, c)
+}
+
+// eventTimeFn counts elements per key, and emits the count once an
+// event time timer fires for the key.
+type eventTimeFn struct {
+	Callback timers.EventTime
+	Count    state.Value[int]
+}
+
+func (f *eventTimeFn) ProcessElement(sp state.Provider, tp timers.Provider, key string, _ int, _ func(string, int)) {
+	c, _, err := f.Count.Read(sp)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Count.Write(sp, c+1); err != nil {
+		panic(err)
+	}
+	// Setting the timer again overwrites the earlier firing, so it only fires once per key.
+	f.Callback.Set(tp, mtime.FromMilliseconds(1000).ToTime())
+	// Tagged timers are independent of the untagged timer, and may be cleared.
+	f.Callback.Set(tp, mtime.FromMilliseconds(2000).ToTime(), timers.WithTag("cleared"))
+	f.Callback.ClearTag(tp, "cleared")
+}
+
+func (f *eventTimeFn) OnTimer(sp state.Provider, tp timers.Provider, key string, timer timers.Context, emit func(string, int)) {
+	if timer.Tag != "" {
+		panic("cleared timer fired for key " + key)
+	}
+	c, _, err := f.Count.Read(sp)
+	if err != nil {
+		panic(err)
+	}
+	emit(key, c)
+}
+
+// TimersEventTimeBounded tests that event time timers fire once the input is complete.
+func TimersEventTimeBounded(s beam.Scope) {
+	in := beam.Create(s, "apple", "pear", "peach", "apple", "apple", "pear")
+	keyed := beam.ParDo(s, pairWithOne, in)
+	counts := beam.ParDo(s, &eventTimeFn{
+		Callback: timers.InEventTime("Callback"),
+		Count:    state.MakeValueState[int]("count"),
+	}, keyed)
+	passert.Equals(s, beam.ParDo(s, formatCount, counts), "apple: 3", "pear: 2", "peach: 1")
+}
+
+// eventTimeLoopFn sets an event time timer for each key, which is set again
+// from the timer callback until it's fired a number of times.
+type eventTimeLoopFn struct {
+	Loop  timers.EventTime
+	Fired state.Value[int]
+}
+
+const timerLoopCount = 3
+
+func (f *eventTimeLoopFn) ProcessElement(sp state.Provider, tp timers.Provider, key string, _ int, _ func(string, int)) {
+	f.Loop.Set(tp, mtime.FromMilliseconds(1000).ToTime())
+}
+
+func (f *eventTimeLoopFn) OnTimer(sp state.Provider, tp timers.Provider, key string, timer timers.Context, emit func(string, int)) {
+	c, _, err := f.Fired.Read(sp)
+	if err != nil {
+		panic(err)
+	}
+	c++
+	if err := f.Fired.Write(sp, c); err != nil {
+		panic(err)
+	}
+	emit(key, c)
+	if c < timerLoopCount {
+		f.Loop.Set(tp, mtime.FromMilliseconds(int64(1000*(c+1))).ToTime())
+	}
+}
+
+// TimersEventTimeLoop tests that timers set from a timer callback are fired.
+func TimersEventTimeLoop(s beam.Scope) {
+	in := beam.Create(s, "apple", "pear", "apple")
+	keyed := beam.ParDo(s, pairWithOne, in)
+	fired := beam.ParDo(s, &eventTimeLoopFn{
+		Loop:  timers.InEventTime("Loop"),
+		Fired: state.MakeValueState[int]("fired"),
+	}, keyed)
+	passert.Equals(s, beam.ParDo(s, formatCount, fired), "apple: 1", "apple: 2", "apple: 3", "pear: 1", "pear: 2", "pear: 3")
+}
+
+// processingTimeFn counts elements per key, and emits the count once a
+// processing time timer fires for the key.
+type processingTimeFn struct {
+	Callback timers.ProcessingTime
+	Count    state.Value[int]
+}
+
+func (f *processingTimeFn) ProcessElement(sp state.Provider, tp timers.Provider, key string, _ int, _ func(string, int)) {
+	c, _, err := f.Count.Read(sp)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Count.Write(sp, c+1); err != nil {
+		panic(err)
+	}
+	f.Callback.Set(tp, time.Now().Add(time.Second))
+	f.Callback.Set(tp, time.Now(), timers.WithTag("cleared"))
+	f.Callback.ClearTag(tp, "cleared")
+}
+
+func (f *processingTimeFn) OnTimer(sp state.Provider, tp timers.Provider, key string, timer timers.Context, emit func(string, int)) {
+	if timer.Tag != "" {
+		panic("cleared timer fired for key " + key)
+	}
+	c, _, err := f.Count.Read(sp)
+	if err != nil {
+		panic(err)
+	}
+	emit(key, c)
+}
+
+// TimersProcessingTimeBounded tests that processing time timers fire.
+func TimersProcessingTimeBounded(s beam.Scope) {
+	in := beam.Create(s, "apple", "pear", "peach", "apple", "apple", "pear")
+	keyed := beam.ParDo(s, pairWithOne, in)
+	counts := beam.ParDo(s, &processingTimeFn{
+		Callback: timers.InProcessingTime("Callback"),
+		Count:    state.MakeValueState[int]("count"),
+	}, keyed)
+	passert.Equals(s, beam.ParDo(s, formatCount, counts), "apple: 3", "pear: 2", "peach: 1")
+}
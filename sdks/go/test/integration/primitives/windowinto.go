@@ -16,6 +16,7 @@
 package primitives
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/apache/beam/sdks/v2/go/pkg/beam"
@@ -26,12 +27,16 @@ import (
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/passert"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/testing/teststream"
 	"github.com/apache/beam/sdks/v2/go/pkg/beam/transforms/stats"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/transforms/windows"
 )
 
 func init() {
 	register.Function4x2(sumPerKey)
 	register.Function3x0(sumSideInputs)
 	register.DoFn2x0[[]byte, func(beam.EventTime, string, int)](&createTimestampedData{})
+	register.DoFn2x0[[]byte, func(beam.EventTime, string, int)](&createCalendarData{})
+
+	beam.RegisterType(reflect.TypeOf((*fixedCustomWindows)(nil)).Elem())
 
 	register.Emitter3[beam.EventTime, string, int]()
 	register.Emitter1[int]()
@@ -50,6 +55,17 @@ func (f *createTimestampedData) ProcessElement(_ []byte, emit func(beam.EventTim
 	}
 }
 
+// fixedCustomWindows is a user-defined WindowFn that assigns elements to fixed windows.
+type fixedCustomWindows struct {
+	Size time.Duration
+}
+
+func (f fixedCustomWindows) AssignWindows(ts beam.EventTime, _ any) []beam.Window {
+	size := mtime.FromDuration(f.Size)
+	start := ts - ts%size
+	return []beam.Window{window.IntervalWindow{Start: start, End: start + size}}
+}
+
 // WindowSums produces a pipeline that generates the numbers of a 3x3 magic square, and
 // configures the pipeline so that PCollection. Sum is a closure to handle summing data over the window, in a few conditions.
 func WindowSums(s beam.Scope, sumPerKey func(beam.Scope, beam.PCollection) beam.PCollection) {
@@ -99,6 +115,48 @@ func WindowSums_Lifted(s beam.Scope) {
 	WindowSums(s.Scope("Lifted"), stats.SumPerKey)
 }
 
+// WindowSums_Custom sums the numbers of a 3x3 magic square in the windows of a user-defined
+// WindowFn, which are identical to fixed windows.
+func WindowSums_Custom(s beam.Scope) {
+	timestampedData := beam.ParDo(s, &createTimestampedData{Data: []int{4, 9, 2, 3, 5, 7, 8, 1, 6}}, beam.Impulse(s))
+	windowed := beam.WindowInto(s, window.NewCustomWindows[window.IntervalWindow](fixedCustomWindows{Size: 3 * time.Second}), timestampedData)
+	sums := stats.SumPerKey(s, windowed)
+	sums = beam.WindowInto(s, window.NewGlobalWindows(), sums)
+	sums = beam.DropKey(s, sums)
+	passert.Equals(s, sums, 15, 15, 15)
+}
+
+// createCalendarData produces the ordinals of the times, timestamped with the times.
+type createCalendarData struct {
+	Times []time.Time
+}
+
+func (f *createCalendarData) ProcessElement(_ []byte, emit func(beam.EventTime, string, int)) {
+	for i, t := range f.Times {
+		emit(mtime.FromTime(t), "magic", i+1)
+	}
+}
+
+// WindowSums_Calendar sums data in the calendar month windows of a time zone with daylight
+// saving time.
+func WindowSums_Calendar(s beam.Scope) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		panic(err)
+	}
+	timestampedData := beam.ParDo(s, &createCalendarData{Times: []time.Time{
+		time.Date(2024, time.January, 31, 23, 30, 0, 0, loc), // February 1st in UTC.
+		time.Date(2024, time.February, 1, 0, 30, 0, 0, loc),
+		time.Date(2024, time.February, 29, 12, 0, 0, 0, loc),
+		time.Date(2024, time.March, 10, 3, 0, 0, 0, loc), // After the DST transition.
+	}}, beam.Impulse(s))
+	windowed := beam.WindowInto(s, windows.Months(1, loc), timestampedData)
+	sums := stats.SumPerKey(s, windowed)
+	sums = beam.WindowInto(s, window.NewGlobalWindows(), sums)
+	sums = beam.DropKey(s, sums)
+	passert.Equals(s, sums, 1, 5, 4)
+}
+
 // ValidateWindowedSideInputs checks that side inputs have accurate windowing information when used.
 func ValidateWindowedSideInputs(s beam.Scope) {
 	timestampedData := beam.ParDo(s, &createTimestampedData{Data: []int{1, 2, 3}}, beam.Impulse(s))
@@ -32,6 +32,16 @@ func TestWindowSums_GBK(t *testing.T) {
 	ptest.BuildAndRun(t, WindowSums_GBK)
 }
 
+func TestWindowSums_Custom(t *testing.T) {
+	integration.CheckFilters(t)
+	ptest.BuildAndRun(t, WindowSums_Custom)
+}
+
+func TestWindowSums_Calendar(t *testing.T) {
+	integration.CheckFilters(t)
+	ptest.BuildAndRun(t, WindowSums_Calendar)
+}
+
 func TestValidateWindowedSideInputs(t *testing.T) {
 	integration.CheckFilters(t)
 	ptest.BuildAndRun(t, ValidateWindowedSideInputs)